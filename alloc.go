@@ -0,0 +1,33 @@
+package uast
+
+// arenaBlockSize is the number of nodes allocated together by a nodeArena
+const arenaBlockSize = 256
+
+// nodeSlot keeps a node and its location in a single allocation
+type nodeSlot struct {
+	node     Node
+	location Location
+}
+
+// nodeArena hands out nodes from preallocated blocks. It is not safe for
+// concurrent use; each conversion goroutine uses its own arena.
+type nodeArena struct {
+	slots []nodeSlot
+}
+
+// alloc returns a zeroed node and location. A nil arena allocates them
+// individually.
+func (a *nodeArena) alloc() (*Node, *Location) {
+	if a == nil {
+		slot := &nodeSlot{}
+		return &slot.node, &slot.location
+	}
+
+	if len(a.slots) == 0 {
+		a.slots = make([]nodeSlot, arenaBlockSize)
+	}
+
+	slot := &a.slots[0]
+	a.slots = a.slots[1:]
+	return &slot.node, &slot.location
+}
@@ -0,0 +1,235 @@
+// Package analysis provides analyses that span the files of a workspace
+package analysis
+
+import (
+	"cmp"
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+
+	"github.com/flaticols/uast-go"
+)
+
+// CloneKind distinguishes exact clones from clones that differ only in names
+// and literal values
+type CloneKind string
+
+// Clone kinds
+const (
+	ExactClone      CloneKind = "exact"
+	NormalizedClone CloneKind = "normalized"
+)
+
+// Fragment is one occurrence of a cloned subtree
+type Fragment struct {
+	Path     string         `json:"path"`
+	Node     *uast.Node     `json:"-"`
+	Location *uast.Location `json:"location,omitempty"`
+}
+
+// CloneGroup is a set of structurally identical fragments
+type CloneGroup struct {
+	Kind      CloneKind  `json:"kind"`
+	Size      int        `json:"size"` // Nodes in each fragment, excluding comments
+	Fragments []Fragment `json:"fragments"`
+}
+
+// subtreeHash summarises a subtree for clone detection
+type subtreeHash struct {
+	exact      uint64
+	normalized uint64
+	size       int
+}
+
+// FindClones returns groups of subtrees with at least minNodes nodes that
+// occur more than once across the workspace. Exact clones match token for
+// token; normalized clones match once identifiers and literals are ignored.
+// Comments are ignored in both. Groups wholly contained in a larger group
+// are omitted. Groups are ordered by decreasing size.
+func FindClones(w *uast.Workspace, minNodes int) []CloneGroup {
+	if minNodes < 1 {
+		minNodes = 1
+	}
+
+	exact := make(map[uint64][]Fragment)
+	normalized := make(map[uint64][]Fragment)
+	sizes := make(map[*uast.Node]int)
+
+	for _, path := range w.Paths() {
+		u, ok := w.Get(path)
+		if !ok || u.Root == nil {
+			continue
+		}
+		for node, h := range hashSubtrees(u.Root) {
+			if h.size < minNodes {
+				continue
+			}
+			sizes[node] = h.size
+			fragment := Fragment{Path: path, Node: node, Location: node.Location}
+			exact[h.exact] = append(exact[h.exact], fragment)
+			normalized[h.normalized] = append(normalized[h.normalized], fragment)
+		}
+	}
+
+	var groups []CloneGroup
+	covered := make(map[*uast.Node]bool)
+	for _, kind := range []CloneKind{ExactClone, NormalizedClone} {
+		buckets := exact
+		if kind == NormalizedClone {
+			buckets = normalized
+		}
+
+		candidates := cloneCandidates(buckets, sizes, kind)
+		for _, group := range candidates {
+			if !slices.ContainsFunc(group.Fragments, func(f Fragment) bool { return !covered[f.Node] }) {
+				continue
+			}
+			groups = append(groups, group)
+		}
+		// Cover after the pass, so exact groups of the same subtrees don't
+		// hide each other but do hide their normalized counterparts
+		for _, group := range groups {
+			for _, fragment := range group.Fragments {
+				coverSubtree(fragment.Node, covered)
+			}
+		}
+	}
+
+	slices.SortStableFunc(groups, func(a, b CloneGroup) int {
+		return cmp.Compare(b.Size, a.Size)
+	})
+	return groups
+}
+
+// cloneCandidates turns hash buckets with more than one fragment into groups,
+// largest first
+func cloneCandidates(buckets map[uint64][]Fragment, sizes map[*uast.Node]int, kind CloneKind) []CloneGroup {
+	var groups []CloneGroup
+	for _, fragments := range buckets {
+		if len(fragments) < 2 {
+			continue
+		}
+		slices.SortFunc(fragments, compareFragments)
+		groups = append(groups, CloneGroup{Kind: kind, Size: sizes[fragments[0].Node], Fragments: fragments})
+	}
+
+	slices.SortFunc(groups, func(a, b CloneGroup) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return compareFragments(a.Fragments[0], b.Fragments[0])
+	})
+
+	// A group of children is redundant if every fragment sits directly under
+	// a fragment of a larger group of the same kind
+	inGroup := make(map[*uast.Node]bool)
+	kept := groups[:0]
+	for _, group := range groups {
+		redundant := true
+		for _, fragment := range group.Fragments {
+			if parent := fragment.Node.Parent(); parent == nil || !inGroup[parent] {
+				redundant = false
+			}
+		}
+		for _, fragment := range group.Fragments {
+			inGroup[fragment.Node] = true
+		}
+		if !redundant {
+			kept = append(kept, group)
+		}
+	}
+	return kept
+}
+
+// compareFragments orders fragments by path and then position
+func compareFragments(a, b Fragment) int {
+	if c := cmp.Compare(a.Path, b.Path); c != 0 {
+		return c
+	}
+	la, lb := a.Node.Location, b.Node.Location
+	if la == nil || lb == nil {
+		return cmp.Compare(a.Node.ID, b.Node.ID)
+	}
+	if c := cmp.Compare(la.Start.Line, lb.Start.Line); c != 0 {
+		return c
+	}
+	return cmp.Compare(la.Start.Column, lb.Start.Column)
+}
+
+// coverSubtree marks a node and its descendants as part of a reported clone
+func coverSubtree(root *uast.Node, covered map[*uast.Node]bool) {
+	stack := []*uast.Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		covered[node] = true
+		for _, child := range node.Children {
+			if child != nil {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
+
+// hashSubtrees computes the hashes of every subtree under root, bottom-up
+func hashSubtrees(root *uast.Node) map[*uast.Node]subtreeHash {
+	hashes := make(map[*uast.Node]subtreeHash)
+
+	type entry struct {
+		node     *uast.Node
+		expanded bool
+	}
+
+	stack := []entry{{root, false}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		node := top.node
+		if node.Type == uast.Comment {
+			continue
+		}
+		if !top.expanded {
+			stack = append(stack, entry{node, true})
+			for _, child := range node.Children {
+				if child != nil {
+					stack = append(stack, entry{child, false})
+				}
+			}
+			continue
+		}
+
+		exact, normalized := fnv.New64a(), fnv.New64a()
+		writeString := func(s string, includeNormalized bool) {
+			exact.Write([]byte(s))
+			exact.Write([]byte{0})
+			if includeNormalized {
+				normalized.Write([]byte(s))
+				normalized.Write([]byte{0})
+			}
+		}
+
+		writeString(string(node.Type), true)
+		writeString(node.Properties["ts_type"], true)
+		// Names and values are what normalization abstracts away
+		writeString(node.Token, node.Type != uast.Identifier && node.Type != uast.Literal)
+
+		size := 1
+		var buf [16]byte
+		for _, child := range node.Children {
+			h, ok := hashes[child]
+			if !ok {
+				continue // nil or a comment
+			}
+			size += h.size
+			binary.BigEndian.PutUint64(buf[:8], h.exact)
+			binary.BigEndian.PutUint64(buf[8:], h.normalized)
+			exact.Write(buf[:8])
+			normalized.Write(buf[8:])
+		}
+
+		hashes[node] = subtreeHash{exact: exact.Sum64(), normalized: normalized.Sum64(), size: size}
+	}
+	return hashes
+}
@@ -0,0 +1,62 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/analysis"
+)
+
+// increment builds func name(param) { return param + 1 }
+func increment(name, param string, line uint32) *uast.Node {
+	at := func(column uint32) *uast.Location {
+		return &uast.Location{Start: uast.Position{Line: line, Column: column}, End: uast.Position{Line: line, Column: column + 1}}
+	}
+	return &uast.Node{Type: uast.Function, Location: at(1), Children: []*uast.Node{
+		{Type: uast.Identifier, Token: name, Location: at(6)},
+		{Type: uast.Parameter, Location: at(10), Children: []*uast.Node{
+			{Type: uast.Identifier, Token: param, Location: at(11)},
+		}},
+		{Type: uast.Return, Location: at(20), Children: []*uast.Node{
+			{Type: uast.Expression, Location: at(27), Children: []*uast.Node{
+				{Type: uast.Identifier, Token: param, Location: at(27)},
+				{Type: uast.Operator, Token: "+", Location: at(29)},
+				{Type: uast.Literal, Token: "1", Location: at(31)},
+			}},
+		}},
+	}}
+}
+
+func TestFindClones(t *testing.T) {
+	w := uast.NewWorkspace()
+	w.Add("a.go", uast.NewUAST(&uast.Node{Type: uast.File, Children: []*uast.Node{
+		increment("inc", "x", 1),
+		{Type: uast.Comment, Token: "// unrelated"},
+	}}, "go"))
+	w.Add("b.go", uast.NewUAST(&uast.Node{Type: uast.File, Children: []*uast.Node{
+		increment("inc", "x", 1),
+		increment("next", "n", 5),
+	}}, "go"))
+
+	groups := analysis.FindClones(w, 5)
+	if len(groups) != 2 {
+		t.Fatalf("Expected an exact and a normalized clone group, got %+v", groups)
+	}
+
+	if groups[0].Kind != analysis.ExactClone || len(groups[0].Fragments) != 2 {
+		t.Errorf("Expected the two inc functions as exact clones, got %+v", groups[0])
+	}
+	if groups[0].Size != 9 {
+		t.Errorf("Expected clones of 9 nodes, got %d", groups[0].Size)
+	}
+	if groups[1].Kind != analysis.NormalizedClone || len(groups[1].Fragments) != 3 {
+		t.Errorf("Expected all three functions as normalized clones, got %+v", groups[1])
+	}
+	if f := groups[1].Fragments[2]; f.Path != "b.go" || f.Location == nil || f.Location.Start.Line != 5 {
+		t.Errorf("Expected the last fragment to be next in b.go, got %+v", f)
+	}
+
+	if groups := analysis.FindClones(w, 10); len(groups) != 0 {
+		t.Errorf("Expected no clones of 10 or more nodes, got %d groups", len(groups))
+	}
+}
@@ -0,0 +1,57 @@
+package uast
+
+// SetAnnotation attaches analysis data, such as a complexity score or taint
+// label, to the node. Unlike Properties, which belong to the converter,
+// annotations are free for analyses to use; keys should be namespaced, as
+// with MetadataKey. Annotations are serialized with the node when set, and
+// values decoded from JSON have JSON types, such as float64 for numbers.
+func (n *Node) SetAnnotation(key string, value any) {
+	if n.Annotations == nil {
+		n.Annotations = make(map[string]any, 1)
+	}
+	n.Annotations[key] = value
+}
+
+// Annotation returns the annotation under key
+func (n *Node) Annotation(key string) (any, bool) {
+	value, ok := n.Annotations[key]
+	return value, ok
+}
+
+// DeleteAnnotation removes the annotation under key
+func (n *Node) DeleteAnnotation(key string) {
+	delete(n.Annotations, key)
+	if len(n.Annotations) == 0 {
+		n.Annotations = nil
+	}
+}
+
+// AnnotationOf returns the annotation under key as a T. ok is false if it is
+// not set or has another type.
+func AnnotationOf[T any](n *Node, key string) (value T, ok bool) {
+	value, ok = n.Annotations[key].(T)
+	return value, ok
+}
+
+// ClearAnnotations removes the annotations under the given keys from every
+// node, or all annotations if no keys are given, such as before saving a
+// tree without the data of in-memory analyses. It returns ErrFrozen for a
+// frozen UAST.
+func (u *UAST) ClearAnnotations(keys ...string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	walk(u.Root, func(node *Node, _ int) {
+		if len(keys) == 0 {
+			node.Annotations = nil
+			return
+		}
+		for _, key := range keys {
+			node.DeleteAnnotation(key)
+		}
+	})
+	return nil
+}
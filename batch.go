@@ -0,0 +1,93 @@
+package uast
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// FileInput describes one file to convert in a batch
+type FileInput struct {
+	Path     string
+	Language string
+	CST      *TreeSitterNode // If nil, the CST is loaded from the JSON file at Path
+}
+
+// FileResult holds the outcome of converting one file in a batch
+type FileResult struct {
+	Path string
+	UAST *UAST
+	Err  error
+}
+
+// ConvertFiles converts many CSTs concurrently using a bounded pool of
+// workers (see SetBatchWorkers). Results are returned in the same order as
+// files. Each UAST gets a "path" metadata entry. Files not yet started when
+// ctx is cancelled fail with the context's error.
+func (c *Converter) ConvertFiles(ctx context.Context, files []FileInput) []FileResult {
+	results := make([]FileResult, len(files))
+
+	workers := c.batchWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(files))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.convertFile(ctx, files[i])
+			}
+		}()
+	}
+
+	for i := range files {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			results[i] = FileResult{Path: files[i].Path, Err: ctx.Err()}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// convertFile converts a single batch input
+func (c *Converter) convertFile(ctx context.Context, file FileInput) FileResult {
+	result := FileResult{Path: file.Path}
+
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	root := file.CST
+	if root == nil {
+		var err error
+		root, err = LoadTreeSitterCST(file.Path)
+		if err != nil {
+			result.Err = fmt.Errorf("failed to load %s: %w", file.Path, err)
+			return result
+		}
+	}
+
+	u, err := c.Convert(root, file.Language)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to convert %s: %w", file.Path, err)
+		return result
+	}
+	if file.Path != "" {
+		u.AddMetadata("path", file.Path)
+	}
+
+	result.UAST = u
+	return result
+}
@@ -0,0 +1,200 @@
+package uast
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// SetTypeWeights sets how MaxTotalTokens is shared between node types when
+// the output is over budget, such as {Function: 4, Class: 3, Comment: 1}.
+// Without weights, the prioritized types are weighted by their order, the
+// first the most.
+func (p *LLMProcessor) SetTypeWeights(weights map[NodeType]int) {
+	p.typeWeights = weights
+}
+
+// weights returns the budget weight of each type whose subtrees may be elided
+func (p *LLMProcessor) weights() map[NodeType]int {
+	if len(p.typeWeights) > 0 {
+		return p.typeWeights
+	}
+	weights := make(map[NodeType]int, len(p.PrioritizeTypes))
+	for i, nodeType := range p.PrioritizeTypes {
+		if _, ok := weights[nodeType]; !ok {
+			weights[nodeType] = len(p.PrioritizeTypes) - i
+		}
+	}
+	return weights
+}
+
+// elidable is an outermost subtree of a weighted type in a view
+type elidable struct {
+	node       *Node
+	name       string
+	token      string
+	properties map[string]string
+	children   []*Node
+	tokens     int // Of the subtree
+	marker     int // Of the marker replacing it
+}
+
+// elide fits an over-budget view, whose rendering is text, to
+// MaxTotalTokens. The outermost subtrees of weighted types share what the
+// rest of the tree leaves of the budget in proportion to their weights, and
+// those that don't fit their type's share are replaced by markers such as
+// "main … (120 tokens elided)". Unused shares pass to the other types.
+func (p *LLMProcessor) elide(view *UAST, text string) (string, error) {
+	weights := p.weights()
+	var units []*elidable
+	byType := make(map[NodeType][]*elidable)
+	var types []NodeType
+
+	// Collect the outermost units in pre-order, with an explicit stack so
+	// deep trees can't overflow the goroutine stack
+	stack := []*Node{view.Root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		if weights[node.Type] == 0 || node == view.Root {
+			for i := len(node.Children) - 1; i >= 0; i-- {
+				stack = append(stack, node.Children[i])
+			}
+			continue
+		}
+
+		// Units are charged for what they add to their marker, so those no
+		// larger than it are left alone
+		unit := &elidable{node: node, token: node.Token, properties: node.Properties, children: node.Children}
+		if node.HasRole(RoleDeclaration) {
+			unit.name = DeclarationName(node)
+		}
+		unit.tokens = p.countTokens(simpleText(node))
+		unit.elide()
+		unit.marker = p.countTokens(simpleText(node))
+		unit.restore()
+		if unit.tokens <= unit.marker {
+			continue
+		}
+		if byType[node.Type] == nil {
+			types = append(types, node.Type)
+		}
+		units = append(units, unit)
+		byType[node.Type] = append(byType[node.Type], unit)
+	}
+	if len(units) == 0 {
+		return text, nil
+	}
+
+	// The budget shrinks by any overrun of the estimates
+	total := p.countTokens(text)
+	for _, unit := range units {
+		total -= unit.tokens - unit.marker
+	}
+	budget := p.MaxTotalTokens - max(total, 0)
+
+	var err error
+	for {
+		sizes := make([]int, len(types))
+		shares := make([]int, len(types))
+		for i, nodeType := range types {
+			for _, unit := range byType[nodeType] {
+				sizes[i] += unit.tokens - unit.marker
+			}
+			shares[i] = weights[nodeType]
+		}
+		limits := allocateBudget(sizes, shares, budget)
+
+		elided := 0
+		for i, nodeType := range types {
+			used := 0
+			for _, unit := range byType[nodeType] {
+				if cost := unit.tokens - unit.marker; used+cost <= limits[i] {
+					used += cost
+					unit.restore()
+				} else {
+					unit.elide()
+					elided++
+				}
+			}
+		}
+
+		view.buildIndices()
+		if text, err = p.format.Format(view); err != nil {
+			return "", err
+		}
+		over := p.countTokens(text) - p.MaxTotalTokens
+		if over <= 0 || elided == len(units) {
+			break
+		}
+		budget -= over
+	}
+	return text, nil
+}
+
+// simpleText renders a subtree in the SimpleTextFormat
+func simpleText(node *Node) string {
+	var sb strings.Builder
+	formatNode(&sb, node, 0, SimpleTextFormat{})
+	return sb.String()
+}
+
+// elide replaces the subtree by a marker
+func (e *elidable) elide() {
+	e.node.Token = fmt.Sprintf("… (%d tokens elided)", e.tokens)
+	if e.name != "" {
+		e.node.Token = e.name + " " + e.node.Token
+	}
+	e.node.Children = nil
+	e.node.Properties = maps.Clone(e.properties)
+	e.node.SetProperty("elided", strconv.Itoa(e.tokens))
+}
+
+// restore undoes elide
+func (e *elidable) restore() {
+	e.node.Token = e.token
+	e.node.Children = e.children
+	e.node.Properties = e.properties
+}
+
+// allocateBudget shares a budget between parts of the given sizes in
+// proportion to their weights. Parts smaller than their share keep their
+// size and leave the rest to the others.
+func allocateBudget(sizes, weights []int, budget int) []int {
+	limits := make([]int, len(sizes))
+	open := make([]int, 0, len(sizes))
+	for i := range sizes {
+		open = append(open, i)
+	}
+	budget = max(budget, 0)
+
+	for len(open) > 0 {
+		total := 0
+		for _, i := range open {
+			total += weights[i]
+		}
+		var next []int
+		used := 0
+		for _, i := range open {
+			if sizes[i]*total <= budget*weights[i] {
+				limits[i] = sizes[i]
+				used += sizes[i]
+			} else {
+				next = append(next, i)
+			}
+		}
+		if len(next) == len(open) {
+			for _, i := range open {
+				limits[i] = budget * weights[i] / total
+			}
+			break
+		}
+		budget -= used
+		open = next
+	}
+	return limits
+}
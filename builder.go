@@ -0,0 +1,90 @@
+package uast
+
+import (
+	"slices"
+	"strconv"
+)
+
+// B builds a node with children, for constructing trees by hand:
+//
+//	root := uast.B(uast.Function, "main",
+//		uast.B(uast.Return, "return"),
+//	).WithRoles(uast.RoleDeclaration)
+//	u := uast.Build(root, "go")
+func B(nodeType NodeType, token string, children ...*Node) *Node {
+	return &Node{Type: nodeType, Token: token, Children: children}
+}
+
+// WithRoles adds roles to the node and returns it
+func (n *Node) WithRoles(roles ...Role) *Node {
+	for _, role := range roles {
+		addRole(n, role)
+	}
+	return n
+}
+
+// WithProperty sets a property and returns the node
+func (n *Node) WithProperty(key, value string) *Node {
+	n.SetProperty(key, value)
+	return n
+}
+
+// WithLocation sets the node's location and returns it
+func (n *Node) WithLocation(start, end Position) *Node {
+	n.Location = &Location{Start: start, End: end}
+	return n
+}
+
+// Build returns a UAST of a tree built with B. Nodes without an ID get
+// sequential IDs not already in use, and nodes without a location get one
+// as if the tree were written one node per line in pre-order, each line
+// holding the node's token, so every node spans its descendants.
+func Build(root *Node, language string) *UAST {
+	used := make(map[string]bool)
+	walk(root, func(node *Node, _ int) {
+		if node.ID != "" {
+			used[node.ID] = true
+		}
+	})
+
+	// IDs and lines are assigned in pre-order, then locations bottom-up so
+	// each node can end where its last child does. Explicit stacks keep
+	// deep trees from overflowing the goroutine stack.
+	next := uint64(0)
+	var order []*Node
+	stack := []*Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		if node.ID == "" {
+			for node.ID == "" || used[node.ID] {
+				next++
+				node.ID = strconv.FormatUint(next, 10)
+			}
+			used[node.ID] = true
+		}
+		order = append(order, node)
+		for _, child := range slices.Backward(node.Children) {
+			stack = append(stack, child)
+		}
+	}
+
+	for i, node := range slices.Backward(order) {
+		if node.Location != nil {
+			continue
+		}
+		line := uint32(i + 1)
+		start := Position{Line: line, Column: 1}
+		end := Position{Line: line, Column: uint32(len(node.Token)) + 1}
+		for _, child := range node.Children {
+			if child != nil {
+				end = child.Location.End
+			}
+		}
+		node.Location = &Location{Start: start, End: end}
+	}
+	return NewUAST(root, language)
+}
@@ -0,0 +1,155 @@
+package uast
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheFormat is part of every cache key, so entries written in an older
+// format are never read
+const cacheFormat = "uast-cache-1"
+
+// cacheEntry is the gob-encoded content of a cache file
+type cacheEntry struct {
+	Tree        *CompactUAST
+	Diagnostics []Diagnostic
+}
+
+// ConversionCache stores converted UASTs in a directory, keyed by a hash of
+// the content they were converted from, so unchanged files are decoded
+// instead of parsed and converted again. Entries are written atomically, so
+// a cache may be shared by concurrent conversions and processes.
+//
+// The key covers the content, the language, the converter's mapping rules
+// and options, and the version: change the version with SetVersion whenever
+// the parser or a custom IDGenerator changes. Annotations are not cached.
+type ConversionCache struct {
+	dir     string
+	version string
+}
+
+// NewConversionCache returns a cache storing its entries in dir, which is
+// created if needed
+func NewConversionCache(dir string) (*ConversionCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &ConversionCache{dir: dir}, nil
+}
+
+// SetVersion sets a version added to every key, such as the parser's
+// version, so entries of other versions are ignored
+func (c *ConversionCache) SetVersion(version string) {
+	c.version = version
+}
+
+// Convert returns the UAST converted from content, the source or CST dump
+// of a file: from the cache if it holds an entry for content, and otherwise
+// by converting the CST parse returns and storing the result. Unreadable
+// entries are treated as missing and overwritten.
+func (c *ConversionCache) Convert(converter *Converter, content []byte, language string, parse func() (*TreeSitterNode, error)) (*UAST, error) {
+	path := c.entryPath(converter, content, language)
+	if u, ok := c.lookup(converter, path); ok {
+		return u, nil
+	}
+
+	root, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	u, err := converter.Convert(root, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert: %w", err)
+	}
+	if err := c.store(path, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// entryPath returns the file holding the entry for content converted by
+// converter
+func (c *ConversionCache) entryPath(converter *Converter, content []byte, language string) string {
+	h := sha256.New()
+	for _, part := range []string{cacheFormat, c.version, language, converter.fingerprint()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(content)
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".uast")
+}
+
+// lookup returns the UAST cached at path, indexed as converter would have
+// indexed it
+func (c *ConversionCache) lookup(converter *Converter, path string) (*UAST, bool) {
+	u, ok := c.load(path)
+	if ok && converter.foldTokens {
+		u.EnableTokenFolding()
+	}
+	return u, ok
+}
+
+// load decodes the entry at path, reporting false if there is none or it
+// cannot be decoded
+func (c *ConversionCache) load(path string) (*UAST, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil || entry.Tree == nil {
+		return nil, false
+	}
+
+	u := entry.Tree.ToUAST()
+	u.Diagnostics = entry.Diagnostics
+	return u, true
+}
+
+// store writes the entry for u to path, through a temporary file so readers
+// never see a partial entry
+func (c *ConversionCache) store(path string, u *UAST) error {
+	u.mu.RLock()
+	diagnostics := u.Diagnostics
+	u.mu.RUnlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cacheEntry{Tree: u.Compact(), Diagnostics: diagnostics}); err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// fingerprint returns a hash of the configuration that shapes the converter's
+// output: its mapping, role and name rules and its options
+func (c *Converter) fingerprint() string {
+	h := sha256.New()
+	_ = c.DumpMappingRules(h) // Rules always marshal
+	fmt.Fprintf(h, "%v|%v|%v|%v|", c.roleRules.rules(), c.nameRules, sortedKeys(c.skipTypes), c.cstStrictness)
+	fmt.Fprintf(h, "%v|%v|%T|%v|", c.idStrategy, c.trivialMode, c.idGenerator, c.simplify)
+	fmt.Fprintf(h, "%v|%v|%v|%v|", c.captureTypes, c.structuralRoles, c.passThrough, c.extractSignatures)
+	fmt.Fprintf(h, "%v|%v|%v|%v", c.byteOffsets, c.cstDetails, c.partial, c.conversionStats)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,212 @@
+package uast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LineRange is an inclusive range of 1-based source lines
+type LineRange struct {
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+}
+
+// intersects reports whether the range shares a line with the location
+func (r LineRange) intersects(loc *Location) bool {
+	return loc != nil && r.Start <= loc.End.Line && loc.Start.Line <= r.End
+}
+
+// ParseUnifiedDiff returns the lines changed in each file of a unified diff,
+// keyed by the file's new path with any "b/" prefix removed. Added lines are
+// reported at their new position and removed lines at the line following
+// them. Deleted files are omitted.
+func ParseUnifiedDiff(r io.Reader) (map[string][]LineRange, error) {
+	changes := make(map[string][]LineRange)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var path string
+	var lines []uint32
+	var line, oldLeft, newLeft uint32
+	flush := func() {
+		if path != "" && len(lines) > 0 {
+			changes[path] = mergeLineRanges(append(changes[path], lineRanges(lines)...))
+		}
+		lines = lines[:0]
+	}
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := scanner.Text()
+
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(text, "+"):
+				lines = append(lines, line)
+				line++
+				newLeft = decrement(newLeft)
+			case strings.HasPrefix(text, "-"):
+				lines = append(lines, max(line, 1))
+				oldLeft = decrement(oldLeft)
+			case strings.HasPrefix(text, `\`):
+				// No newline at end of file
+			default:
+				line++
+				oldLeft, newLeft = decrement(oldLeft), decrement(newLeft)
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			flush()
+			path = diffPath(strings.TrimPrefix(text, "+++ "))
+		case strings.HasPrefix(text, "@@"):
+			var err error
+			if line, oldLeft, newLeft, err = parseHunkHeader(text); err != nil {
+				return nil, fmt.Errorf("failed to parse diff line %d: %w", lineNo, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read diff: %w", err)
+	}
+	flush()
+	return changes, nil
+}
+
+// decrement returns n-1, stopping at zero for malformed hunks
+func decrement(n uint32) uint32 {
+	if n == 0 {
+		return 0
+	}
+	return n - 1
+}
+
+// diffPath extracts the path from a +++ header, returning "" for /dev/null
+func diffPath(header string) string {
+	if tab := strings.IndexByte(header, '\t'); tab >= 0 {
+		header = header[:tab] // Drop the timestamp
+	}
+	if header == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(header, "b/")
+}
+
+// parseHunkHeader parses "@@ -old,count +new,count @@", returning the first
+// new line and the number of old and new lines in the hunk
+func parseHunkHeader(header string) (start, oldCount, newCount uint32, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+	if _, oldCount, err = parseHunkRange(fields[1][1:]); err != nil {
+		return 0, 0, 0, err
+	}
+	if start, newCount, err = parseHunkRange(fields[2][1:]); err != nil {
+		return 0, 0, 0, err
+	}
+	return start, oldCount, newCount, nil
+}
+
+// parseHunkRange parses "start,count" or "start", where count defaults to 1
+func parseHunkRange(s string) (start, count uint32, err error) {
+	startText, countText, hasCount := strings.Cut(s, ",")
+	n, err := strconv.ParseUint(startText, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hunk range %q: %w", s, err)
+	}
+	if !hasCount {
+		return uint32(n), 1, nil
+	}
+	c, err := strconv.ParseUint(countText, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hunk range %q: %w", s, err)
+	}
+	return uint32(n), uint32(c), nil
+}
+
+// lineRanges returns a single-line range for each line
+func lineRanges(lines []uint32) []LineRange {
+	ranges := make([]LineRange, 0, len(lines))
+	for _, line := range lines {
+		ranges = append(ranges, LineRange{Start: line, End: line})
+	}
+	return ranges
+}
+
+// mergeLineRanges sorts ranges and merges overlapping and adjacent ones
+func mergeLineRanges(ranges []LineRange) []LineRange {
+	slices.SortFunc(ranges, func(a, b LineRange) int {
+		return int(a.Start) - int(b.Start)
+	})
+
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.Start <= merged[n-1].End+1 {
+			merged[n-1].End = max(merged[n-1].End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// AffectedDeclarations returns the nodes with the Declaration role whose
+// lines intersect any of the ranges, in pre-order. Enclosing declarations
+// are included along with the nested ones that changed.
+func (u *UAST) AffectedDeclarations(ranges []LineRange) []*Node {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var decls []*Node
+	walk(u.Root, func(node *Node, _ int) {
+		if node.HasRole(RoleDeclaration) && intersectsAny(ranges, node.Location) {
+			decls = append(decls, node)
+		}
+	})
+	return decls
+}
+
+// intersectsAny reports whether any range shares a line with the location
+func intersectsAny(ranges []LineRange, loc *Location) bool {
+	for _, r := range ranges {
+		if r.intersects(loc) {
+			return true
+		}
+	}
+	return false
+}
+
+// AffectedDeclarations returns the declarations whose lines intersect the
+// changed ranges of their file, sorted by path and symbol
+func (w *Workspace) AffectedDeclarations(changes map[string][]LineRange) []Declaration {
+	index := w.SymbolIndex()
+
+	var affected []Declaration
+	for path, ranges := range changes {
+		for _, decl := range index.DeclarationsIn(path) {
+			if intersectsAny(ranges, decl.Node.Location) {
+				affected = append(affected, decl)
+			}
+		}
+	}
+	sortDeclarations(affected)
+	return affected
+}
+
+// AffectedByDiff parses a unified diff and returns the declarations it
+// touches, such as the functions changed by a pull request
+func (w *Workspace) AffectedByDiff(r io.Reader) ([]Declaration, error) {
+	changes, err := ParseUnifiedDiff(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.AffectedDeclarations(changes), nil
+}
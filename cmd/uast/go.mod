@@ -0,0 +1,18 @@
+module github.com/flaticols/uast-go/cmd/uast
+
+go 1.24.1
+
+require (
+	github.com/flaticols/uast-go v0.0.0
+	github.com/flaticols/uast-go/watch v0.0.0
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.10.1 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
+
+replace (
+	github.com/flaticols/uast-go => ../../
+	github.com/flaticols/uast-go/watch => ../../watch
+)
@@ -0,0 +1,353 @@
+// Command uast converts Tree-sitter CSTs to UASTs, queries them and renders
+// them in any registered format.
+//
+// Usage:
+//
+//	uast convert [flags] FILE          write the UAST as JSON
+//	uast query [flags] FILE...         list nodes matching a query
+//	uast format [flags] FILE...        render UASTs in a registered format
+//	uast stats [flags] FILE...         print tree statistics as JSON lines
+//	uast watch [flags] DIR             convert files under DIR as they change
+//	uast mcp [flags] DIR               serve DIR to coding agents over MCP on stdio
+//
+// FILE is a CST JSON dump, a UAST JSON file written by convert, or source
+// code when -parser names a command that prints its CST. Use - for stdin.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/mcp"
+	"github.com/flaticols/uast-go/watch"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "uast:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+// usage describes the subcommands
+const usage = `usage: uast <command> [flags] FILE...
+
+commands:
+  convert   write the UAST as JSON
+  query     list nodes matching -type, -token or -pattern
+  format    render UASTs with -format (%s)
+  stats     print tree statistics as JSON lines
+  watch     convert files under a directory as they change
+  mcp       serve a directory to coding agents over MCP on stdio
+`
+
+// run executes a subcommand
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf(usage, strings.Join(uast.FormatNames(), ", "))
+	}
+
+	switch command, args := args[0], args[1:]; command {
+	case "convert":
+		return runConvert(ctx, args, stdin, stdout)
+	case "query":
+		return runQuery(ctx, args, stdin, stdout)
+	case "format":
+		return runFormat(ctx, args, stdin, stdout)
+	case "stats":
+		return runStats(ctx, args, stdin, stdout)
+	case "watch":
+		return runWatch(ctx, args, stdout)
+	case "mcp":
+		return runMCP(ctx, args, stdin, stdout)
+	default:
+		return fmt.Errorf("unknown command %q\n"+usage, command, strings.Join(uast.FormatNames(), ", "))
+	}
+}
+
+// inputFlags are the flags shared by every subcommand
+type inputFlags struct {
+	language string
+	parser   string
+	profile  bool
+}
+
+// register adds the input flags to a flag set
+func (f *inputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.language, "lang", "", "language of the input, detected from the file name by default")
+	fs.StringVar(&f.parser, "parser", "", "command that reads source on stdin and prints its CST JSON")
+	fs.BoolVar(&f.profile, "profile", true, "apply the language profile when converting")
+}
+
+// load reads a file and converts it to a UAST
+func (f *inputFlags) load(ctx context.Context, path string, stdin io.Reader) (*uast.UAST, error) {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	language := f.language
+	if language == "" {
+		language = uast.DetectLanguage(strings.TrimSuffix(path, ".json"))
+	}
+
+	var root *uast.TreeSitterNode
+	switch {
+	case f.parser != "" && !strings.HasSuffix(path, ".json"):
+		fields := strings.Fields(f.parser)
+		parser := uast.CommandParser{Command: fields[0], Args: fields[1:]}
+		root, err = parser.Parse(ctx, content, language)
+	case isUASTJSON(content):
+		return uast.DecodeUAST(bytes.NewReader(content))
+	default:
+		root, err = uast.DecodeTreeSitterCST(bytes.NewReader(content))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	converter := uast.NewConverter()
+	if f.profile {
+		converter = uast.ConverterFor(language)
+	}
+	u, err := converter.Convert(root, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", path, err)
+	}
+	u.AddMetadata("filename", path)
+	return u, nil
+}
+
+// isUASTJSON reports whether content is a UAST written by convert rather
+// than a CST dump
+func isUASTJSON(content []byte) bool {
+	var probe struct {
+		Root json.RawMessage `json:"root"`
+	}
+	return json.Unmarshal(content, &probe) == nil && len(probe.Root) > 0
+}
+
+// parseFlags parses a subcommand's flags and checks its file arguments
+func parseFlags(fs *flag.FlagSet, args []string, single bool) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	files := fs.Args()
+	switch {
+	case len(files) == 0:
+		return nil, fmt.Errorf("%s: missing input file", fs.Name())
+	case single && len(files) > 1:
+		return nil, fmt.Errorf("%s: expected one input file, got %d", fs.Name(), len(files))
+	}
+	return files, nil
+}
+
+// runConvert implements uast convert
+func runConvert(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	var input inputFlags
+	input.register(fs)
+	output := fs.String("o", "", "write the UAST to this file instead of stdout")
+	files, err := parseFlags(fs, args, true)
+	if err != nil {
+		return err
+	}
+
+	u, err := input.load(ctx, files[0], stdin)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return uast.SaveUAST(u, *output)
+	}
+	text, err := u.ToJSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, text)
+	return err
+}
+
+// runQuery implements uast query
+func runQuery(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	var input inputFlags
+	input.register(fs)
+	nodeType := fs.String("type", "", "match nodes of this type")
+	token := fs.String("token", "", "match nodes with this token")
+	pattern := fs.String("pattern", "", "match a structural pattern, such as (Call \"add\" ...)")
+	files, err := parseFlags(fs, args, false)
+	if err != nil {
+		return err
+	}
+	if *nodeType == "" && *token == "" && *pattern == "" {
+		return fmt.Errorf("query: one of -type, -token or -pattern is required")
+	}
+
+	p := &uast.Pattern{Type: *nodeType, Token: *token}
+	if *pattern != "" {
+		if p, err = uast.ParsePattern(*pattern); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range files {
+		u, err := input.load(ctx, path, stdin)
+		if err != nil {
+			return err
+		}
+		for _, match := range u.Search(p) {
+			node := match.Node
+			line, column := uint32(0), uint32(0)
+			if node.Location != nil {
+				line, column = node.Location.Start.Line, node.Location.Start.Column
+			}
+			fmt.Fprintf(stdout, "%s:%d:%d\t%s\t%s\n", path, line, column, node.Type, node.Token)
+		}
+	}
+	return nil
+}
+
+// runFormat implements uast format
+func runFormat(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("format", flag.ContinueOnError)
+	var input inputFlags
+	input.register(fs)
+	name := fs.String("format", "tree", "output format: "+strings.Join(uast.FormatNames(), ", "))
+	color := fs.String("color", "auto", "colorize tree output: auto, always or never")
+	files, err := parseFlags(fs, args, false)
+	if err != nil {
+		return err
+	}
+	format, ok := uast.LookupFormat(*name)
+	if !ok {
+		return fmt.Errorf("format: unknown format %q, expected one of %s", *name, strings.Join(uast.FormatNames(), ", "))
+	}
+	if tree, ok := format.(uast.TreeTextFormat); ok {
+		switch *color {
+		case "auto":
+			tree.Color = uast.ColorEnabled(stdout)
+		case "always":
+			tree.Color = true
+		case "never":
+		default:
+			return fmt.Errorf("format: unknown -color %q, expected auto, always or never", *color)
+		}
+		if tree.Color {
+			tree.IncludeRoles = true // Colors keep roles apart from tokens
+		}
+		format = tree
+	}
+
+	for _, path := range files {
+		u, err := input.load(ctx, path, stdin)
+		if err != nil {
+			return err
+		}
+		text, err := uast.ToLLMFormat(u, format)
+		if err != nil {
+			return fmt.Errorf("failed to format %s: %w", path, err)
+		}
+		fmt.Fprintln(stdout, strings.TrimSuffix(text, "\n"))
+	}
+	return nil
+}
+
+// runStats implements uast stats
+func runStats(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	var input inputFlags
+	input.register(fs)
+	files, err := parseFlags(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	for _, path := range files {
+		u, err := input.load(ctx, path, stdin)
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(struct {
+			Path string `json:"path"`
+			uast.Stats
+		}{path, u.Stats()}); err != nil {
+			return fmt.Errorf("failed to write stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// runWatch implements uast watch
+func runWatch(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	output := fs.String("o", "", "write a UAST JSON file for each converted file to this directory")
+	parser := fs.String("parser", "", "command that reads source on stdin and prints its CST JSON")
+	dirs, err := parseFlags(fs, args, true)
+	if err != nil {
+		return err
+	}
+
+	opts := watch.Options{OutputDir: *output}
+	if fields := strings.Fields(*parser); len(fields) > 0 {
+		opts.Parser = uast.CommandParser{Command: fields[0], Args: fields[1:]}
+	}
+	return watch.Watch(ctx, dirs[0], opts, func(event watch.Event) error {
+		switch {
+		case event.Err != nil:
+			fmt.Fprintf(stdout, "error\t%s\t%v\n", event.Path, event.Err)
+		case event.Removed:
+			fmt.Fprintf(stdout, "removed\t%s\n", event.Path)
+		default:
+			fmt.Fprintf(stdout, "converted\t%s\t%d nodes\n", event.Path, event.UAST.Stats().TotalNodes)
+		}
+		return nil
+	})
+}
+
+// runMCP implements uast mcp
+func runMCP(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	parser := fs.String("parser", "", "command that reads source on stdin and prints its CST JSON")
+	dirs, err := parseFlags(fs, args, true)
+	if err != nil {
+		return err
+	}
+
+	opts := uast.LoadOptions{}
+	if fields := strings.Fields(*parser); len(fields) > 0 {
+		opts.Parser = uast.CommandParser{Command: fields[0], Args: fields[1:]}
+	}
+	workspace := uast.NewWorkspace()
+	err = uast.LoadDir(ctx, dirs[0], opts, func(result uast.FileResult) error {
+		if result.Err == nil {
+			workspace.Add(result.Path, result.UAST)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return mcp.NewServer(workspace, mcp.Options{}).Serve(ctx, stdin, stdout)
+}
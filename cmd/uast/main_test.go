@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const example = "../../testdata/example.json"
+
+func runCommand(t *testing.T, args ...string) string {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	if err := run(context.Background(), args, strings.NewReader(""), &stdout); err != nil {
+		t.Fatalf("uast %s failed: %v", strings.Join(args, " "), err)
+	}
+	return stdout.String()
+}
+
+func TestCommands(t *testing.T) {
+	// The language can't be detected from the file name
+	out := runCommand(t, "query", "-lang", "go", "-type", "Function", example)
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.Contains(lines[0], "\tFunction\tadd") {
+		t.Errorf("Expected functions add and main, got %q", out)
+	}
+
+	// Converted UASTs can be read back
+	converted := filepath.Join(t.TempDir(), "example.uast.json")
+	runCommand(t, "convert", "-lang", "go", "-o", converted, example)
+	out = runCommand(t, "query", "-pattern", `(Call "add" ...)`, converted)
+	if !strings.Contains(out, ":19:") {
+		t.Errorf("Expected the call to add on line 19, got %q", out)
+	}
+
+	out = runCommand(t, "stats", "-lang", "go", example)
+	var stats struct {
+		Path       string `json:"path"`
+		TotalNodes int    `json:"totalNodes"`
+	}
+	if err := json.Unmarshal([]byte(out), &stats); err != nil || stats.Path != example || stats.TotalNodes == 0 {
+		t.Errorf("Expected stats for the example, got %q (%v)", out, err)
+	}
+
+	out = runCommand(t, "format", "-lang", "go", "-format", "source", example)
+	if !strings.HasPrefix(out, "package main\n") {
+		t.Errorf("Expected regenerated source, got %q", out)
+	}
+
+	out = runCommand(t, "format", "-lang", "go", "-color", "always", example)
+	if !strings.Contains(out, "\x1b[") {
+		t.Errorf("Expected colored tree output, got %q", out)
+	}
+
+	for _, args := range [][]string{{}, {"unknown"}, {"query", example}, {"format", "-format", "nope", example}, {"convert"}} {
+		if err := run(context.Background(), args, strings.NewReader(""), &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected uast %v to fail", args)
+		}
+	}
+}
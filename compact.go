@@ -0,0 +1,193 @@
+package uast
+
+import "slices"
+
+// CompactUAST is a struct-of-arrays representation of a UAST. Node fields are
+// stored in parallel slices indexed by the node's position in pre-order, with
+// index 0 being the root. It uses far fewer pointers than the Node-based form,
+// which makes it cheaper to hold many trees in memory.
+type CompactUAST struct {
+	Language string            `json:"language"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	IDs       []string   `json:"ids"`
+	Types     []NodeType `json:"types"`
+	Tokens    []string   `json:"tokens"`
+	Parents   []int32    `json:"parents"` // -1 for the root
+	Locations []Location `json:"locations"`
+	HasLoc    []bool     `json:"hasLoc"`
+
+	// NameLocations holds the name locations of the declarations that have one
+	NameLocations map[int32]Location `json:"nameLocations,omitempty"`
+
+	// Children of node i are ChildList[ChildOffsets[i]:ChildOffsets[i+1]]
+	ChildOffsets []int32 `json:"childOffsets"`
+	ChildList    []int32 `json:"childList"`
+
+	// Roles of node i are RoleList[RoleOffsets[i]:RoleOffsets[i+1]]
+	RoleOffsets []int32 `json:"roleOffsets"`
+	RoleList    []Role  `json:"roleList"`
+
+	// Properties of node i are the key/value pairs in
+	// PropKeys/PropValues[PropOffsets[i]:PropOffsets[i+1]], sorted by key
+	PropOffsets []int32  `json:"propOffsets"`
+	PropKeys    []string `json:"propKeys"`
+	PropValues  []string `json:"propValues"`
+}
+
+// Compact converts the UAST to its struct-of-arrays representation
+func (u *UAST) Compact() *CompactUAST {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	c := &CompactUAST{
+		Language: u.Language,
+		Metadata: make(map[string]string, len(u.Metadata)),
+	}
+	for k, v := range u.Metadata {
+		c.Metadata[k] = v
+	}
+
+	if u.Root == nil {
+		return c
+	}
+
+	// First pass assigns pre-order indices so child lists can be written
+	index := make(map[*Node]int32)
+	var order []*Node
+	walk(u.Root, func(node *Node, _ int) {
+		index[node] = int32(len(order))
+		order = append(order, node)
+	})
+
+	n := len(order)
+	c.IDs = make([]string, n)
+	c.Types = make([]NodeType, n)
+	c.Tokens = make([]string, n)
+	c.Parents = make([]int32, n)
+	c.Locations = make([]Location, n)
+	c.HasLoc = make([]bool, n)
+	c.ChildOffsets = make([]int32, 0, n+1)
+	c.RoleOffsets = make([]int32, 0, n+1)
+	c.PropOffsets = make([]int32, 0, n+1)
+
+	c.Parents[0] = -1
+	for i, node := range order {
+		c.IDs[i] = node.ID
+		c.Types[i] = node.Type
+		c.Tokens[i] = node.Token
+		if node.Location != nil {
+			c.Locations[i] = *node.Location
+			c.HasLoc[i] = true
+		}
+		if node.NameLocation != nil {
+			if c.NameLocations == nil {
+				c.NameLocations = make(map[int32]Location)
+			}
+			c.NameLocations[int32(i)] = *node.NameLocation
+		}
+
+		c.ChildOffsets = append(c.ChildOffsets, int32(len(c.ChildList)))
+		for _, child := range node.Children {
+			if child == nil {
+				continue
+			}
+			childIndex := index[child]
+			c.ChildList = append(c.ChildList, childIndex)
+			c.Parents[childIndex] = int32(i)
+		}
+
+		c.RoleOffsets = append(c.RoleOffsets, int32(len(c.RoleList)))
+		c.RoleList = append(c.RoleList, node.Roles...)
+
+		c.PropOffsets = append(c.PropOffsets, int32(len(c.PropKeys)))
+		keys := make([]string, 0, len(node.Properties))
+		for k := range node.Properties {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			c.PropKeys = append(c.PropKeys, k)
+			c.PropValues = append(c.PropValues, node.Properties[k])
+		}
+	}
+	c.ChildOffsets = append(c.ChildOffsets, int32(len(c.ChildList)))
+	c.RoleOffsets = append(c.RoleOffsets, int32(len(c.RoleList)))
+	c.PropOffsets = append(c.PropOffsets, int32(len(c.PropKeys)))
+
+	return c
+}
+
+// Len returns the number of nodes
+func (c *CompactUAST) Len() int {
+	return len(c.IDs)
+}
+
+// Children returns the indices of the children of node i
+func (c *CompactUAST) Children(i int) []int32 {
+	return c.ChildList[c.ChildOffsets[i]:c.ChildOffsets[i+1]]
+}
+
+// Roles returns the roles of node i
+func (c *CompactUAST) Roles(i int) []Role {
+	return c.RoleList[c.RoleOffsets[i]:c.RoleOffsets[i+1]]
+}
+
+// Property returns the value of a property of node i
+func (c *CompactUAST) Property(i int, key string) (string, bool) {
+	start, end := int(c.PropOffsets[i]), int(c.PropOffsets[i+1])
+	if j, ok := slices.BinarySearch(c.PropKeys[start:end], key); ok {
+		return c.PropValues[start+j], true
+	}
+	return "", false
+}
+
+// Node materializes node i without its children
+func (c *CompactUAST) Node(i int) *Node {
+	node := &Node{
+		ID:    c.IDs[i],
+		Type:  c.Types[i],
+		Token: c.Tokens[i],
+	}
+	if roles := c.Roles(i); len(roles) > 0 {
+		node.Roles = slices.Clone(roles)
+	}
+	if c.HasLoc[i] {
+		location := c.Locations[i]
+		node.Location = &location
+	}
+	if nameLocation, ok := c.NameLocations[int32(i)]; ok {
+		node.NameLocation = &nameLocation
+	}
+	for j := c.PropOffsets[i]; j < c.PropOffsets[i+1]; j++ {
+		node.SetProperty(c.PropKeys[j], c.PropValues[j])
+	}
+	return node
+}
+
+// ToUAST converts the compact representation back into a pointer-based UAST
+func (c *CompactUAST) ToUAST() *UAST {
+	nodes := make([]*Node, c.Len())
+	for i := range nodes {
+		nodes[i] = c.Node(i)
+	}
+	for i, node := range nodes {
+		if children := c.Children(i); len(children) > 0 {
+			node.Children = make([]*Node, len(children))
+			for j, childIndex := range children {
+				node.Children[j] = nodes[childIndex]
+			}
+		}
+	}
+
+	var root *Node
+	if len(nodes) > 0 {
+		root = nodes[0]
+	}
+
+	u := NewUAST(root, c.Language)
+	for k, v := range c.Metadata {
+		u.Metadata[k] = v
+	}
+	return u
+}
@@ -0,0 +1,64 @@
+package uast
+
+import "regexp"
+
+// compiledCacheSize is the number of compiled strings of each kind kept for
+// reuse
+const compiledCacheSize = 256
+
+var (
+	compiledQueries  = newLRU[string, *CompiledQuery](compiledCacheSize)
+	compiledPaths    = newLRU[string, []pathStep](compiledCacheSize)
+	compiledPatterns = newLRU[string, *regexp.Regexp](compiledCacheSize)
+)
+
+// CompiledQuery is a structural search pattern parsed once, for reuse across
+// trees. It is immutable and safe for concurrent use.
+type CompiledQuery struct {
+	source  string
+	pattern *Pattern
+}
+
+// Compile parses a pattern in the syntax of ParsePattern into a query.
+// Recently compiled patterns are cached, so compiling the same string again
+// is cheap.
+func Compile(pattern string) (*CompiledQuery, error) {
+	return cached(compiledQueries, pattern, func(source string) (*CompiledQuery, error) {
+		p, err := ParsePattern(source)
+		if err != nil {
+			return nil, err
+		}
+		return &CompiledQuery{source: source, pattern: p}, nil
+	})
+}
+
+// MustCompile is like Compile but panics if the pattern cannot be parsed,
+// for patterns known at compile time
+func MustCompile(pattern string) *CompiledQuery {
+	q, err := Compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the pattern the query was compiled from
+func (q *CompiledQuery) String() string {
+	return q.source
+}
+
+// Search returns the nodes of a UAST matching the query, as UAST.Search does
+func (q *CompiledQuery) Search(u *UAST) []Match {
+	return u.Search(q.pattern)
+}
+
+// compilePath parses a path, reusing the segments of recently parsed paths
+func compilePath(path string) ([]pathStep, error) {
+	return cached(compiledPaths, path, splitPath)
+}
+
+// compileRegexp compiles a regular expression, reusing recently compiled
+// ones; a Regexp is safe for concurrent use
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	return cached(compiledPatterns, pattern, regexp.Compile)
+}
@@ -1,10 +1,13 @@
 package uast
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unicode"
+	"unique"
 )
 
 // TreeSitterNode represents a node in the Tree-sitter CST
@@ -16,23 +19,95 @@ type TreeSitterNode struct {
 	EndPoint   [2]int            `json:"endPoint"`   // [row, column]
 	Children   []*TreeSitterNode `json:"children,omitempty"`
 	Text       string            `json:"text,omitempty"`
+	Field      string            `json:"field,omitempty"`   // Field name within the parent, if exported
+	IsNamed    *bool             `json:"isNamed,omitempty"` // nil when the exporter doesn't record it
 }
 
+// namedKeywordLeaves are leaf types that grammars name even though their
+// text equals their type, such as Go's nil and JavaScript's null
+var namedKeywordLeaves = map[string]bool{
+	"true": true, "false": true, "nil": true, "null": true, "none": true,
+	"undefined": true, "iota": true, "self": true, "this": true, "super": true,
+}
+
+// IsAnonymous reports whether the node is an anonymous (keyword or
+// punctuation) node. When the CST doesn't record named-ness, leaves whose type
+// contains no letters or digits, or equals their text and is not a named
+// literal such as true or nil, are considered anonymous.
+func (n *TreeSitterNode) IsAnonymous() bool {
+	if n.IsNamed != nil {
+		return !*n.IsNamed
+	}
+	if len(n.Children) > 0 {
+		return false
+	}
+	if n.Type == n.Text && !namedKeywordLeaves[n.Type] {
+		return true
+	}
+	return !strings.ContainsFunc(n.Type, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	})
+}
+
+// TrivialNodeMode controls how anonymous and skipped CST nodes are converted
+type TrivialNodeMode int
+
+const (
+	// KeepTrivialNodes converts every CST node
+	KeepTrivialNodes TrivialNodeMode = iota
+	// DropTrivialNodes omits trivial nodes from the UAST
+	DropTrivialNodes
+	// FoldTrivialNodes omits trivial nodes and records their text in the
+	// parent's "folded_tokens" property
+	FoldTrivialNodes
+)
+
 // Converter handles the conversion from Tree-sitter CST to UAST
 type Converter struct {
-	mappingRules      map[string]NodeType
+	mappingRules      map[string]MappingRule // Exact rules, which take precedence
+	patternRules      []MappingRule          // In the order added
+	defaultRules      map[string]NodeType    // Used when no other rule matches
+	patternMatches    *sync.Map              // Tree-sitter type to NodeType, or "" if no pattern matches
 	nodeIDCounter     uint64
 	parallelThreshold int // Minimum number of nodes to process in parallel
 	maxGoRoutines     int // Maximum number of goroutines to spawn
+	idStrategy        IDStrategy
+	idGenerator       IDGenerator
+	trivialMode       TrivialNodeMode
+	skipTypes         map[string]bool
+	simplify          bool
+	internStrings     bool
+	useArena          bool
+	captureTypes      bool
+	roleRules         *roleRuleSet
+	structuralRoles   bool
+	passThrough       bool
+	nameRules         map[string]NameRule
+	extractSignatures bool
+	byteOffsets       bool
+	cstDetails        bool // Record field names for ToTreeSitterCST
+	batchWorkers      int  // Maximum number of files converted at once by ConvertFiles
+	cstStrictness     CSTStrictness
+	partial           bool // Stub out faulty subtrees instead of failing
+	foldTokens        bool // Give converted UASTs a folded token index
+	conversionStats   bool // Record a ConversionStats in each UAST's metadata
+	instruments       *instrumentation
 }
 
 // NewConverter creates a new Converter with the default mapping rules
 func NewConverter() *Converter {
 	return &Converter{
-		mappingRules:      defaultMappingRules(),
+		mappingRules:      make(map[string]MappingRule),
+		defaultRules:      defaultMappingRules(),
+		patternMatches:    new(sync.Map),
 		nodeIDCounter:     0,
 		parallelThreshold: 50,  // Default threshold for parallel processing
 		maxGoRoutines:     100, // Default max goroutines
+		idStrategy:        SequentialIDs,
+		trivialMode:       KeepTrivialNodes,
+		skipTypes:         make(map[string]bool),
+		roleRules:         newRoleRuleSet(DefaultRoleRules()),
+		nameRules:         make(map[string]NameRule),
 	}
 }
 
@@ -46,9 +121,99 @@ func (c *Converter) SetParallelizationParams(threshold, maxRoutines int) {
 	}
 }
 
-// AddMappingRule adds a custom mapping rule
+// SetBatchWorkers sets the number of files ConvertFiles converts at once.
+// Zero or less uses GOMAXPROCS.
+func (c *Converter) SetBatchWorkers(workers int) {
+	c.batchWorkers = workers
+}
+
+// SetIDStrategy configures how node IDs are generated
+func (c *Converter) SetIDStrategy(strategy IDStrategy) {
+	c.idStrategy = strategy
+}
+
+// SetIDGenerator sets a custom ID generator, which takes precedence over the
+// ID strategy. Passing nil restores the configured strategy.
+func (c *Converter) SetIDGenerator(generator IDGenerator) {
+	c.idGenerator = generator
+}
+
+// SetTrivialNodeMode configures whether anonymous and skipped CST nodes are
+// kept, dropped, or folded into their parent's properties
+func (c *Converter) SetTrivialNodeMode(mode TrivialNodeMode) {
+	c.trivialMode = mode
+}
+
+// SetPassThrough configures whether Tree-sitter types without a mapping
+// rule or registered node type are used as the NodeType, rather than Unknown.
+// This gives lossless trees for languages without a profile.
+func (c *Converter) SetPassThrough(enabled bool) {
+	c.passThrough = enabled
+}
+
+// SetSimplify configures whether converted trees are simplified by collapsing
+// single-child wrapper chains (see UAST.Simplify)
+func (c *Converter) SetSimplify(simplify bool) {
+	c.simplify = simplify
+}
+
+// SetStringInterning configures whether tokens and property strings are
+// interned, so identical strings across nodes and conversions share memory.
+// This trades some conversion time for a much smaller heap on large corpora.
+func (c *Converter) SetStringInterning(enabled bool) {
+	c.internStrings = enabled
+}
+
+// SetArenaAllocation configures whether nodes are allocated in large blocks
+// rather than individually, reducing GC pressure for bulk conversions. Memory
+// for a block is only released once every node in it is unreachable, so this
+// suits trees that are discarded wholesale.
+func (c *Converter) SetArenaAllocation(enabled bool) {
+	c.useArena = enabled
+}
+
+// intern returns the canonical copy of s when string interning is enabled
+func (c *Converter) intern(s string) string {
+	if !c.internStrings || s == "" {
+		return s
+	}
+	return unique.Make(s).Value()
+}
+
+// AddSkipType marks a Tree-sitter node type as trivial regardless of whether
+// it is anonymous. Children of skipped nodes are kept and attached to the
+// nearest non-trivial ancestor.
+func (c *Converter) AddSkipType(treeType string) {
+	c.skipTypes[treeType] = true
+}
+
+// ApplyProfile adds the profile's mapping rules, skip types, role rules and
+// name rules to the converter. Invalid prioritized rules are skipped.
+func (c *Converter) ApplyProfile(profile *Profile) {
+	if profile == nil {
+		return
+	}
+	for treeType, uastType := range profile.MappingRules {
+		c.AddMappingRule(treeType, uastType)
+	}
+	for _, rule := range profile.Rules {
+		_ = c.AddMapping(rule)
+	}
+	for _, treeType := range profile.SkipTypes {
+		c.AddSkipType(treeType)
+	}
+	for _, rule := range profile.RoleRules {
+		c.AddRoleRule(rule)
+	}
+	for _, rule := range profile.NameRules {
+		c.AddNameRule(rule)
+	}
+}
+
+// AddMappingRule adds an exact mapping rule of priority zero, replacing any
+// rule for treeType that doesn't have a higher priority
 func (c *Converter) AddMappingRule(treeType string, uastType NodeType) {
-	c.mappingRules[treeType] = uastType
+	_ = c.AddMapping(MappingRule{TSType: treeType, NodeType: uastType}) // Only empty types fail, and they match nothing
 }
 
 // defaultMappingRules returns the default mapping from Tree-sitter node types to UAST
@@ -85,13 +250,58 @@ func defaultMappingRules() map[string]NodeType {
 // Convert converts a Tree-sitter CST to a UAST
 func (c *Converter) Convert(root *TreeSitterNode, language string) (*UAST, error) {
 	if root == nil {
-		return nil, fmt.Errorf("root node cannot be nil")
+		return nil, ErrNilRoot
+	}
+	var counts *conversionCounts
+	var start time.Time
+	if c.conversionStats {
+		counts, start = new(conversionCounts), time.Now()
 	}
 
-	uastRoot := c.convertNode(root)
-	uast := NewUAST(uastRoot, language)
+	done := c.phase(PhaseCheck)
+	faults, diagnostics, err := c.checkInput(root)
+	done()
+	if err != nil {
+		return nil, err
+	}
+
+	done = c.phase(PhaseConvert)
+	uastRoot := c.convertNode(root, nil, faults, counts)
+	done()
+
+	return c.finish(uastRoot, language, diagnostics, start, counts), nil
+}
 
-	return uast, nil
+// finish runs the phases that follow building the nodes of a conversion
+// started at start, shared by Convert and ConvertIncremental. Statistics
+// are recorded if counts is not nil.
+func (c *Converter) finish(root *Node, language string, diagnostics []*Diagnostic, start time.Time, counts *conversionCounts) *UAST {
+	if c.structuralRoles {
+		done := c.phase(PhaseRoles)
+		inferStructuralRoles(root)
+		done()
+	}
+	if c.simplify {
+		done := c.phase(PhaseSimplify)
+		removed := 0
+		root = simplifyNode(root, &removed)
+		done()
+	}
+	done := c.phase(PhaseIndex)
+	u := newUAST(root, language, c.foldTokens)
+	done()
+	collectDiagnostics(u, diagnostics)
+	if counts != nil {
+		recordConversionStats(u, time.Since(start), counts)
+	}
+	return u
+}
+
+// Reset clears the per-conversion state, such as the sequential ID counter,
+// while keeping the configuration, so a Converter can be reused for unrelated
+// conversions. It must not be called while a conversion is in progress.
+func (c *Converter) Reset() {
+	atomic.StoreUint64(&c.nodeIDCounter, 0)
 }
 
 // nextNodeID generates a unique ID for a node
@@ -100,135 +310,256 @@ func (c *Converter) nextNodeID() string {
 	return strconv.FormatUint(id, 10)
 }
 
-// convertNode converts a single Tree-sitter node to a UAST node
-func (c *Converter) convertNode(tsNode *TreeSitterNode) *Node {
+// framePool recycles conversion work stacks between conversions
+var framePool = sync.Pool{
+	New: func() any {
+		stack := make([]conversionFrame, 0, 64)
+		return &stack
+	},
+}
+
+// conversionFrame tracks a node whose children are still being converted
+type conversionFrame struct {
+	tsNode   *TreeSitterNode
+	node     *Node
+	children []*TreeSitterNode
+	next     int
+}
+
+// convertNode converts a Tree-sitter subtree to a UAST subtree to be attached
+// under parent, which may be nil, stubbing out faulty nodes. It uses an
+// explicit work stack rather than recursion, so nesting depth is bounded only
+// by available heap. Parallel splits are counted in counts, if not nil.
+func (c *Converter) convertNode(tsNode *TreeSitterNode, parent *Node, faults cstFaults, counts *conversionCounts) *Node {
 	if tsNode == nil {
 		return nil
 	}
 
+	var arena *nodeArena
+	if c.useArena {
+		arena = &nodeArena{}
+	}
+
+	stackPtr := framePool.Get().(*[]conversionFrame)
+	defer func() {
+		clear(*stackPtr) // Drop references so pooled stacks don't pin trees
+		*stackPtr = (*stackPtr)[:0]
+		framePool.Put(stackPtr)
+	}()
+
+	root, children := c.newNode(tsNode, parent, arena, faults)
+	stack := append((*stackPtr)[:0], c.newFrame(tsNode, root, children, faults, counts))
+
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+
+		if top.next < len(top.children) {
+			child := top.children[top.next]
+			top.next++
+			if child == nil {
+				continue
+			}
+
+			childNode, grandchildren := c.newNode(child, top.node, arena, faults)
+			top.node.Children = append(top.node.Children, childNode)
+			stack = append(stack, c.newFrame(child, childNode, grandchildren, faults, counts))
+			continue
+		}
+
+		// Content hashes depend on the children, so they are computed last
+		if c.idGenerator == nil && c.idStrategy == ContentHashIDs {
+			top.node.ID = contentHashID(top.tsNode.Type, top.node)
+		}
+		stack = stack[:len(stack)-1]
+	}
+
+	// Keep the grown stack for the next conversion
+	*stackPtr = stack[:cap(stack)]
+
+	return root
+}
+
+// newFrame creates a work frame for node. Nodes with many children have them
+// converted in parallel up front, leaving nothing for the work loop to do.
+func (c *Converter) newFrame(tsNode *TreeSitterNode, node *Node, children []*TreeSitterNode, faults cstFaults, counts *conversionCounts) conversionFrame {
+	frame := conversionFrame{tsNode: tsNode, node: node, children: children}
+
+	// Check if we should process children in parallel
+	if len(children) > c.parallelThreshold && len(children) < 1000 {
+		node.Children = c.convertChildrenParallel(children, node, faults, counts)
+		frame.next = len(children)
+	}
+
+	return frame
+}
+
+// newNode converts a single Tree-sitter node without its children, returning
+// the UAST node and the CST children that remain to be converted. A faulty
+// node becomes a stub without children.
+func (c *Converter) newNode(tsNode *TreeSitterNode, parent *Node, arena *nodeArena, faults cstFaults) (*Node, []*TreeSitterNode) {
+	if diagnostic := faults[tsNode]; diagnostic != nil {
+		return c.newStub(tsNode, arena, diagnostic), nil
+	}
+
 	nodeType := c.mapNodeType(tsNode.Type)
 
-	node := &Node{
-		ID:    c.nextNodeID(),
-		Type:  nodeType,
-		Token: tsNode.Text,
-		Location: &Location{
-			Start: Position{
-				Line:   uint32(tsNode.StartPoint[0] + 1), // Convert to 1-based
-				Column: uint32(tsNode.StartPoint[1] + 1),
-			},
-			End: Position{
-				Line:   uint32(tsNode.EndPoint[0] + 1),
-				Column: uint32(tsNode.EndPoint[1] + 1),
-			},
-		},
-		Properties: make(map[string]string),
-		Roles:      inferRoles(nodeType, tsNode.Type),
+	node, location := arena.alloc()
+	node.Type = nodeType
+	node.Token = c.intern(tsNode.Text)
+	node.Roles = c.roleRules.infer(nodeType, tsNode, parent)
+	for _, role := range registeredRoles(nodeType) {
+		addRole(node, role)
 	}
 
+	*location = tsLocation(tsNode)
+	node.Location = location
+
 	// Add original Tree-sitter type as a property
-	node.Properties["ts_type"] = tsNode.Type
+	node.SetProperty("ts_type", c.intern(tsNode.Type))
+	c.recordCSTDetails(tsNode, node)
+	c.extractName(tsNode, node)
+	if c.captureTypes {
+		c.captureTypeAnnotations(tsNode, node)
+	}
+	if c.extractSignatures && (nodeType == Function || nodeType == Method) {
+		c.captureSignature(tsNode, node)
+	}
 
-	// Check if we should process children in parallel
-	if len(tsNode.Children) > c.parallelThreshold && len(tsNode.Children) < 1000 {
-		node.Children = c.convertChildrenParallel(tsNode.Children)
-	} else {
-		node.Children = c.convertChildrenSequential(tsNode.Children)
+	children := tsNode.Children
+	if c.trivialMode != KeepTrivialNodes {
+		var folded []string
+		children, folded = c.splitTrivialChildren(children)
+		if c.trivialMode == FoldTrivialNodes && len(folded) > 0 {
+			node.SetProperty("folded_tokens", c.intern(strings.Join(folded, " ")))
+		}
 	}
 
-	return node
+	c.assignID(node)
+	if len(children) > 0 {
+		node.Children = make([]*Node, 0, len(children))
+	}
+
+	return node, children
 }
 
-// convertChildrenSequential converts children sequentially
-func (c *Converter) convertChildrenSequential(children []*TreeSitterNode) []*Node {
-	result := make([]*Node, 0, len(children))
+// assignID gives a node a generated or sequential ID. These are assigned in
+// pre-order, before any children; content hashes are computed later.
+func (c *Converter) assignID(node *Node) {
+	if c.idGenerator != nil {
+		node.ID = c.idGenerator.NewID(node)
+	} else if c.idStrategy == SequentialIDs {
+		node.ID = c.nextNodeID()
+	}
+}
+
+// tsLocation converts a Tree-sitter node's 0-based span to a 1-based Location
+func tsLocation(tsNode *TreeSitterNode) Location {
+	return Location{
+		Start: Position{
+			Line:   uint32(tsNode.StartPoint[0] + 1),
+			Column: uint32(tsNode.StartPoint[1] + 1),
+		},
+		End: Position{
+			Line:   uint32(tsNode.EndPoint[0] + 1),
+			Column: uint32(tsNode.EndPoint[1] + 1),
+		},
+	}
+}
+
+// isTrivial reports whether a CST node should be dropped or folded
+func (c *Converter) isTrivial(tsNode *TreeSitterNode) bool {
+	return c.skipTypes[tsNode.Type] || tsNode.IsAnonymous()
+}
+
+// splitTrivialChildren separates trivial children from the rest, returning the
+// remaining children and the text of the trivial ones. Children of a trivial
+// node are spliced into its place.
+func (c *Converter) splitTrivialChildren(children []*TreeSitterNode) ([]*TreeSitterNode, []string) {
+	kept := make([]*TreeSitterNode, 0, len(children))
+	var folded []string
 
 	for _, child := range children {
-		childNode := c.convertNode(child)
-		if childNode != nil {
-			result = append(result, childNode)
+		if child == nil {
+			continue
+		}
+		if !c.isTrivial(child) {
+			kept = append(kept, child)
+			continue
 		}
+
+		if len(child.Children) > 0 {
+			spliced, splicedFolded := c.splitTrivialChildren(child.Children)
+			kept = append(kept, spliced...)
+			folded = append(folded, splicedFolded...)
+			continue
+		}
+
+		text := child.Text
+		if text == "" {
+			text = child.Type
+		}
+		folded = append(folded, text)
 	}
 
-	return result
+	return kept, folded
 }
 
-// convertChildrenParallel converts children in parallel
-func (c *Converter) convertChildrenParallel(children []*TreeSitterNode) []*Node {
-	// Create a mutex-protected result slice to avoid race conditions
-	var resultMutex sync.Mutex
-	result := make([]*Node, 0, len(children))
+// convertChildrenParallel converts children in parallel, preserving their order
+func (c *Converter) convertChildrenParallel(children []*TreeSitterNode, parent *Node, faults cstFaults, counts *conversionCounts) []*Node {
+	// Each goroutine writes only its own slot, so no locking is needed
+	converted := make([]*Node, len(children))
 	var wg sync.WaitGroup
 
 	// Use a semaphore to limit the number of goroutines
 	sem := make(chan struct{}, c.maxGoRoutines)
 
-	for _, child := range children {
+	started := 0
+	for i, child := range children {
 		if child == nil {
 			continue
 		}
+		started++
 
 		wg.Add(1)
 		sem <- struct{}{} // Acquire semaphore
 
-		go func(child *TreeSitterNode) {
+		go func(i int, child *TreeSitterNode) {
 			defer wg.Done()
 			defer func() { <-sem }() // Release semaphore
 
-			childNode := c.convertNode(child)
-			if childNode != nil {
-				// Safely append to the result slice
-				resultMutex.Lock()
-				result = append(result, childNode)
-				resultMutex.Unlock()
-			}
-		}(child)
+			converted[i] = c.convertNode(child, parent, faults, counts)
+		}(i, child)
 	}
 
 	wg.Wait()
+	c.recordSplit(started, counts)
+
+	result := make([]*Node, 0, len(children))
+	for _, childNode := range converted {
+		if childNode != nil {
+			result = append(result, childNode)
+		}
+	}
 	return result
 }
 
-// mapNodeType maps a Tree-sitter node type to a UAST node type
+// mapNodeType maps a Tree-sitter node type to a UAST node type, trying exact
+// rules, then pattern rules, then the defaults and registered node types
 func (c *Converter) mapNodeType(tsType string) NodeType {
-	if nodeType, ok := c.mappingRules[tsType]; ok {
+	if rule, ok := c.mappingRules[tsType]; ok {
+		return rule.NodeType
+	}
+	if nodeType := c.matchPattern(tsType); nodeType != "" {
 		return nodeType
 	}
+	if nodeType, ok := c.defaultRules[tsType]; ok {
+		return nodeType
+	}
+	if nodeType, ok := registeredNodeType(tsType); ok {
+		return nodeType
+	}
+	if c.passThrough {
+		return NodeType(c.intern(tsType))
+	}
 	return Unknown
 }
-
-// inferRoles infers the roles of a node based on its type and Tree-sitter type
-func inferRoles(nodeType NodeType, tsType string) []Role {
-	roles := make([]Role, 0, 2)
-
-	// Infer roles based on node type
-	switch nodeType {
-	case Function, Method, Class:
-		roles = append(roles, RoleDeclaration, RoleDefinition)
-	case Call:
-		roles = append(roles, RoleCall)
-	case Identifier:
-		roles = append(roles, RoleReference)
-	case Import:
-		roles = append(roles, RoleImport)
-	case Statement:
-		roles = append(roles, RoleStatement)
-	case Expression:
-		roles = append(roles, RoleExpression)
-	case Argument:
-		roles = append(roles, RoleArgument)
-	case Parameter:
-		roles = append(roles, RoleArgument)
-	case Condition:
-		roles = append(roles, RoleCondition)
-	}
-
-	// Additional role inference based on Tree-sitter type
-	if tsType == "method_receiver" {
-		roles = append(roles, RoleReceiver)
-	} else if tsType == "function_body" || tsType == "method_body" {
-		roles = append(roles, RoleBody)
-	}
-
-	return roles
-}
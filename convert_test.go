@@ -0,0 +1,1188 @@
+package uast_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/uasttest"
+)
+
+func TestContentHashIDsAreStable(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	collectIDs := func() []string {
+		converter := uast.NewConverter()
+		converter.SetIDStrategy(uast.ContentHashIDs)
+		converter.SetParallelizationParams(1, 4)
+
+		u, err := converter.Convert(tsNode, "go")
+		if err != nil {
+			t.Fatalf("Error converting to UAST: %v", err)
+		}
+
+		var ids []string
+		var walk func(*uast.Node)
+		walk = func(node *uast.Node) {
+			ids = append(ids, node.ID)
+			for _, child := range node.Children {
+				walk(child)
+			}
+		}
+		walk(u.Root)
+		return ids
+	}
+
+	first, second := collectIDs(), collectIDs()
+	if len(first) != len(second) {
+		t.Fatalf("Expected %d IDs, got %d", len(first), len(second))
+	}
+
+	seen := make(map[string]bool)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("ID %d differs between runs: %s != %s", i, first[i], second[i])
+		}
+		if seen[first[i]] {
+			t.Errorf("Duplicate ID %s", first[i])
+		}
+		seen[first[i]] = true
+	}
+}
+
+func TestPrefixedIDGenerator(t *testing.T) {
+	converter := uast.NewConverter()
+	converter.SetIDGenerator(uast.NewPrefixedIDGenerator("main.go"))
+
+	tsNode, err := createSimpleCST()
+	if err != nil {
+		t.Fatalf("Error creating CST: %v", err)
+	}
+
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	if u.Root.ID != "main.go#1" {
+		t.Errorf("Expected root ID to be 'main.go#1', got '%s'", u.Root.ID)
+	}
+	if got := u.Root.Children[1].ID; got != "main.go#3" {
+		t.Errorf("Expected second child ID to be 'main.go#3', got '%s'", got)
+	}
+}
+
+func TestFoldTrivialNodes(t *testing.T) {
+	converter := goConverter(t)
+	converter.SetTrivialNodeMode(uast.FoldTrivialNodes)
+	var next atomic.Int64
+	converter.SetIDGenerator(uast.IDGeneratorFunc(func(node *uast.Node) string {
+		return fmt.Sprintf("%d:%s", next.Add(1), node.Properties["folded_tokens"])
+	}))
+	u := convertGoExample(t, converter)
+
+	for _, tsType := range []string{".", "func", "import_spec_list"} {
+		for _, node := range u.FindByType(uast.Unknown) {
+			if node.Properties["ts_type"] == tsType {
+				t.Errorf("Expected %q nodes to be folded", tsType)
+			}
+		}
+	}
+
+	imports := u.FindByType(uast.Import)
+	if len(imports) != 3 {
+		t.Fatalf("Expected 3 import nodes, got %d", len(imports))
+	}
+	if got := imports[0].Properties["folded_tokens"]; got != "import" {
+		t.Errorf("Expected folded_tokens to be 'import', got '%s'", got)
+	}
+	if !strings.HasSuffix(imports[0].ID, ":import") {
+		t.Errorf("Expected the ID generator to see folded_tokens, got ID %q", imports[0].ID)
+	}
+	if len(imports[0].Children) != 2 {
+		t.Errorf("Expected import specs to be spliced into the declaration, got %d children", len(imports[0].Children))
+	}
+}
+
+func TestIsAnonymous(t *testing.T) {
+	for _, tt := range []struct {
+		node uast.TreeSitterNode
+		want bool
+	}{
+		{uast.TreeSitterNode{Type: "func", Text: "func"}, true},
+		{uast.TreeSitterNode{Type: "(", Text: "("}, true},
+		{uast.TreeSitterNode{Type: "nil", Text: "nil"}, false},
+		{uast.TreeSitterNode{Type: "true", Text: "true"}, false},
+		{uast.TreeSitterNode{Type: "identifier", Text: "x"}, false},
+	} {
+		if got := tt.node.IsAnonymous(); got != tt.want {
+			t.Errorf("IsAnonymous(%q) = %v, want %v", tt.node.Type, got, tt.want)
+		}
+	}
+}
+
+func TestTypeCapture(t *testing.T) {
+	converter := goConverter(t)
+	converter.SetTypeCapture(true)
+	u := convertGoExample(t, converter)
+
+	// func add(a, b int) int
+	if nodes := u.FindByDeclaredType("int"); len(nodes) != 2 {
+		t.Errorf("Expected the parameters and result of add to be typed int, got %d nodes", len(nodes))
+	}
+	for _, fn := range u.FindByType(uast.Function) {
+		if got, want := fn.Properties["return_type"], map[string]string{"add": "int", "main": ""}[uast.DeclarationName(fn)]; got != want {
+			t.Errorf("Expected return type %q for %s, got %q", want, uast.DeclarationName(fn), got)
+		}
+	}
+
+	// Composite types are rendered from their tokens
+	param := &uast.TreeSitterNode{
+		Type: "parameter_declaration",
+		Children: []*uast.TreeSitterNode{
+			{Type: "identifier", Text: "data"},
+			{Type: "slice_type", Children: []*uast.TreeSitterNode{
+				{Type: "[", Text: "["},
+				{Type: "]", Text: "]"},
+				{Type: "type_identifier", Text: "byte"},
+			}},
+		},
+	}
+	u, err := converter.Convert(param, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	if got := u.Root.Properties["type"]; got != "[]byte" {
+		t.Errorf("Expected type []byte, got %q", got)
+	}
+}
+
+func TestSignatureExtraction(t *testing.T) {
+	// func (s *Server) Handle(ctx context.Context, a, b int) (int, error)
+	leaf := func(tsType, text string) *uast.TreeSitterNode {
+		return &uast.TreeSitterNode{Type: tsType, Text: text}
+	}
+	method := &uast.TreeSitterNode{
+		Type: "method_declaration",
+		Children: []*uast.TreeSitterNode{
+			leaf("func", "func"),
+			{Type: "parameter_list", Children: []*uast.TreeSitterNode{
+				{Type: "parameter_declaration", Children: []*uast.TreeSitterNode{
+					leaf("identifier", "s"),
+					{Type: "pointer_type", Children: []*uast.TreeSitterNode{leaf("*", "*"), leaf("type_identifier", "Server")}},
+				}},
+			}},
+			leaf("field_identifier", "Handle"),
+			{Type: "parameter_list", Children: []*uast.TreeSitterNode{
+				{Type: "parameter_declaration", Children: []*uast.TreeSitterNode{
+					leaf("identifier", "ctx"),
+					{Type: "qualified_type", Children: []*uast.TreeSitterNode{
+						leaf("package_identifier", "context"), leaf(".", "."), leaf("type_identifier", "Context"),
+					}},
+				}},
+				leaf(",", ","),
+				{Type: "parameter_declaration", Children: []*uast.TreeSitterNode{
+					leaf("identifier", "a"), leaf(",", ","), leaf("identifier", "b"), leaf("type_identifier", "int"),
+				}},
+			}},
+			{Type: "parameter_list", Children: []*uast.TreeSitterNode{
+				leaf("type_identifier", "int"), leaf(",", ","), leaf("type_identifier", "error"),
+			}},
+		},
+	}
+
+	converter := uast.NewConverter()
+	converter.AddMappingRule("method_declaration", uast.Method)
+	converter.SetSignatureExtraction(true)
+
+	u, err := converter.Convert(method, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	if got := u.Root.Properties["parameters"]; got != "ctx context.Context, a int, b int" {
+		t.Errorf("Unexpected parameters property %q", got)
+	}
+
+	sig, ok := uast.SignatureOf(u.Root)
+	if !ok {
+		t.Fatal("Expected a signature on the method")
+	}
+	if sig.Receiver == nil || *sig.Receiver != (uast.Param{Name: "s", Type: "*Server"}) {
+		t.Errorf("Expected receiver s *Server, got %+v", sig.Receiver)
+	}
+	if len(sig.Params) != 3 || sig.Params[2] != (uast.Param{Name: "b", Type: "int"}) {
+		t.Errorf("Expected parameters ctx, a and b, got %+v", sig.Params)
+	}
+	if strings.Join(sig.Returns, ",") != "int,error" {
+		t.Errorf("Expected returns int and error, got %v", sig.Returns)
+	}
+}
+
+func TestRoleRules(t *testing.T) {
+	u := loadGoExample(t)
+	for _, fn := range u.FindByType(uast.Function) {
+		body := fn.Children[len(fn.Children)-1]
+		if !slices.Contains(body.Roles, uast.RoleBody) {
+			t.Errorf("Expected the block of %s to have the Body role, got %v", uast.DeclarationName(fn), body.Roles)
+		}
+	}
+
+	rules, err := uast.DecodeRoleRules(strings.NewReader(`[
+		{"field": "name", "parentType": "Function", "roles": ["Declaration"]}
+	]`))
+	if err != nil {
+		t.Fatalf("Error decoding role rules: %v", err)
+	}
+
+	converter := uast.NewConverter()
+	converter.SetRoleRules(rules)
+	u, err = converter.Convert(&uast.TreeSitterNode{
+		Type: "function",
+		Children: []*uast.TreeSitterNode{
+			{Type: "identifier", Text: "main", Field: "name"},
+			{Type: "identifier", Text: "unnamed"},
+		},
+	}, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	if len(u.Root.Roles) != 0 {
+		t.Errorf("Expected the default rules to be replaced, got %v", u.Root.Roles)
+	}
+	if roles := u.Root.Children[0].Roles; len(roles) != 1 || roles[0] != uast.RoleDeclaration {
+		t.Errorf("Expected the name field to be a declaration, got %v", roles)
+	}
+	if roles := u.Root.Children[1].Roles; len(roles) != 0 {
+		t.Errorf("Expected no roles without the field, got %v", roles)
+	}
+
+	if _, err := uast.DecodeRoleRules(strings.NewReader(`[{"tsType": "block"}]`)); err == nil {
+		t.Error("Expected an error for a rule without roles")
+	}
+}
+
+func TestExtendedRoles(t *testing.T) {
+	converter := goConverter(t)
+	converter.SetStructuralRoles(true)
+	u := convertGoExample(t, converter)
+
+	// Write targets: message, sum and i are declared, and i is incremented
+	var targets []string
+	for _, node := range u.FindByType(uast.Identifier) {
+		if slices.Contains(node.Roles, uast.RoleWrite) {
+			targets = append(targets, node.Token)
+		}
+	}
+	if got := strings.Join(targets, ","); got != "message,sum,i,i" {
+		t.Errorf("Expected write targets message,sum,i,i, got %s", got)
+	}
+
+	var docs []string
+	for _, comment := range u.FindByType(uast.Comment) {
+		if slices.Contains(comment.Roles, uast.RoleDocumentation) {
+			docs = append(docs, comment.Token)
+		}
+	}
+	if len(docs) != 1 || docs[0] != "// Add two numbers and return the result" {
+		t.Errorf("Expected the comment above add to be documentation, got %q", docs)
+	}
+
+	for _, literal := range u.FindByType(uast.Literal) {
+		if literal.Token == "5" && !slices.Contains(literal.Roles, uast.RoleNumber) {
+			t.Errorf("Expected 5 to have the Number role, got %v", literal.Roles)
+		}
+	}
+}
+
+func TestRegisterNodeType(t *testing.T) {
+	const decorator uast.NodeType = "Decorator"
+
+	err := uast.RegisterNodeType(decorator, uast.NodeTypeOptions{
+		TreeSitterTypes: []string{"decorator"},
+		Roles:           []uast.Role{uast.RoleCall},
+	})
+	if err != nil {
+		t.Fatalf("Error registering node type: %v", err)
+	}
+	t.Cleanup(func() { uast.UnregisterNodeType(decorator) })
+
+	if err := uast.RegisterNodeType(uast.Function, uast.NodeTypeOptions{}); err == nil {
+		t.Error("Expected an error registering a built-in type")
+	}
+	if !uast.IsKnownNodeType(decorator) || !slices.Contains(uast.NodeTypes(), decorator) {
+		t.Error("Expected Decorator to be a known node type")
+	}
+
+	u, err := uast.NewConverter().Convert(&uast.TreeSitterNode{
+		Type:     "class_definition",
+		Children: []*uast.TreeSitterNode{{Type: "decorator", Text: "@dataclass"}},
+	}, "python")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	nodes := u.FindByType(decorator)
+	if len(nodes) != 1 || !slices.Contains(nodes[0].Roles, uast.RoleCall) {
+		t.Fatalf("Expected one Decorator node with the Call role, got %+v", nodes)
+	}
+
+	uast.UnregisterNodeType(decorator)
+	if uast.IsKnownNodeType(decorator) {
+		t.Error("Expected Decorator to be unregistered")
+	}
+}
+
+func TestPassThrough(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	converter := uast.NewConverter()
+	converter.SetPassThrough(true)
+
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	if got := u.CountByType(uast.Unknown); got != 0 {
+		t.Errorf("Expected no Unknown nodes, got %d", got)
+	}
+	if got := u.CountByType("function_declaration"); got != 2 {
+		t.Errorf("Expected 2 function_declaration nodes, got %d", got)
+	}
+	// Mapped types are unaffected
+	if got := u.CountByType(uast.Call); got != 5 {
+		t.Errorf("Expected 5 Call nodes, got %d", got)
+	}
+}
+
+func TestNameRules(t *testing.T) {
+	u := loadGoExample(t)
+
+	var fn *uast.Node
+	for _, node := range u.FindByToken("main") {
+		if node.Type == uast.Function {
+			fn = node
+		}
+	}
+	if fn == nil {
+		t.Fatal("Expected FindByToken to find the main function")
+	}
+	if got := fn.Properties["name"]; got != "main" {
+		t.Errorf("Expected name property main, got %q", got)
+	}
+	want := uast.Location{Start: uast.Position{Line: 13, Column: 6}, End: uast.Position{Line: 13, Column: 10}}
+	if fn.NameLocation == nil || *fn.NameLocation != want {
+		t.Errorf("Expected name location %+v, got %+v", want, fn.NameLocation)
+	}
+
+	// Name locations survive the compact form
+	for _, node := range u.Compact().ToUAST().FindByType(uast.Function) {
+		if node.NameLocation == nil {
+			t.Errorf("Expected %s to keep its name location", node.Token)
+		}
+	}
+
+	// Field names take precedence over child types
+	converter := uast.NewConverter()
+	converter.AddNameRule(uast.NameRule{TSType: "class_declaration", Field: "name", ChildTypes: []string{"identifier"}})
+	u, err := converter.Convert(&uast.TreeSitterNode{
+		Type: "class_declaration",
+		Children: []*uast.TreeSitterNode{
+			{Type: "identifier", Text: "Base"},
+			{Type: "identifier", Text: "Derived", Field: "name"},
+		},
+	}, "java")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	if u.Root.Token != "Derived" {
+		t.Errorf("Expected the class to be named Derived, got %q", u.Root.Token)
+	}
+}
+
+func TestGoTypeNames(t *testing.T) {
+	// type (
+	// 	T struct{}
+	// 	A = T
+	// )
+	leaf := func(tsType, field, text string, row, start int) *uast.TreeSitterNode {
+		return &uast.TreeSitterNode{Type: tsType, Field: field, Text: text, StartPoint: [2]int{row, start}, EndPoint: [2]int{row, start + len(text)}}
+	}
+	spec := &uast.TreeSitterNode{Type: "type_spec", StartPoint: [2]int{1, 1}, EndPoint: [2]int{1, 11}, Children: []*uast.TreeSitterNode{
+		leaf("type_identifier", "name", "T", 1, 1),
+		{Type: "struct_type", Field: "type", StartPoint: [2]int{1, 3}, EndPoint: [2]int{1, 11}, Children: []*uast.TreeSitterNode{
+			leaf("struct", "", "struct", 1, 3),
+			{Type: "field_declaration_list", StartPoint: [2]int{1, 9}, EndPoint: [2]int{1, 11}, Children: []*uast.TreeSitterNode{
+				leaf("{", "", "{", 1, 9), leaf("}", "", "}", 1, 10),
+			}},
+		}},
+	}}
+	alias := &uast.TreeSitterNode{Type: "type_alias", StartPoint: [2]int{2, 1}, EndPoint: [2]int{2, 6}, Children: []*uast.TreeSitterNode{
+		leaf("type_identifier", "name", "A", 2, 1), leaf("=", "", "=", 2, 3), leaf("type_identifier", "type", "T", 2, 5),
+	}}
+	root := &uast.TreeSitterNode{Type: "source_file", EndPoint: [2]int{4, 0}, Children: []*uast.TreeSitterNode{
+		{Type: "type_declaration", EndPoint: [2]int{3, 1}, Children: []*uast.TreeSitterNode{
+			leaf("type", "", "type", 0, 0), leaf("(", "", "(", 0, 5), spec, leaf("\n", "", "\n", 1, 11), alias, leaf("\n", "", "\n", 2, 6), leaf(")", "", ")", 3, 0),
+		}},
+	}}
+
+	u, err := goConverter(t).Convert(root, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	classes := u.FindByType(uast.Class)
+	if len(classes) != 2 {
+		t.Fatalf("Expected a class per type, got %d", len(classes))
+	}
+	for i, want := range []string{"T", "A"} {
+		class := classes[i]
+		if class.Token != want || uast.DeclarationName(class) != want || class.NameLocation == nil || class.NameLocation.Start.Line != uint32(i+2) {
+			t.Errorf("Expected class %s named from its type_identifier, got %q at %v", want, class.Token, class.NameLocation)
+		}
+		if got := class.Path(); got != "File/Statement[0]/Class["+want+"]" {
+			t.Errorf("Expected the path to name %s, got %s", want, got)
+		}
+	}
+
+	w := uast.NewWorkspace()
+	w.Add("types.go", u)
+	if got := w.ResolveSymbol("T"); len(got) != 1 || got[0].Node != classes[0] {
+		t.Errorf("Expected T to resolve to its type, got %v", got)
+	}
+}
+
+func TestToTreeSitterCST(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	converter := goConverter(t)
+	converter.SetByteOffsets(true)
+	converter.SetRecordCSTDetails(true)
+
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	// Compare encodings, which don't distinguish nil and empty child lists
+	got, err := json.Marshal(u.ToTreeSitterCST())
+	if err != nil {
+		t.Fatalf("Error encoding CST: %v", err)
+	}
+	want, err := json.Marshal(tsNode)
+	if err != nil {
+		t.Fatalf("Error encoding CST: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("Expected the reconstructed CST to match the original")
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	input := `{"type": "program", "children": [{"type": "function", "children": [{"type": "identifier", "text": "main"}]}]}`
+
+	tests := []struct {
+		name   string
+		limits uast.DecodeLimits
+		limit  string
+	}{
+		{"unlimited", uast.DecodeLimits{}, ""},
+		{"bytes", uast.DecodeLimits{MaxBytes: 10}, "MaxBytes"},
+		{"depth", uast.DecodeLimits{MaxDepth: 2}, "MaxDepth"},
+		{"nodes", uast.DecodeLimits{MaxNodes: 2}, "MaxNodes"},
+		{"text", uast.DecodeLimits{MaxTextLen: 3}, "MaxTextLen"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uast.DecodeTreeSitterCSTWithLimits(strings.NewReader(input), tt.limits)
+			if tt.limit == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var limitErr *uast.LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+				t.Fatalf("Expected %s limit error, got %v", tt.limit, err)
+			}
+			if !errors.Is(err, uast.ErrLimitExceeded) {
+				t.Errorf("Expected error to match ErrLimitExceeded")
+			}
+		})
+	}
+}
+
+func TestConvertDeepTree(t *testing.T) {
+	const depth = 100_000
+
+	root := &uast.TreeSitterNode{Type: "program"}
+	current := root
+	for i := 0; i < depth; i++ {
+		child := &uast.TreeSitterNode{Type: "expression"}
+		current.Children = []*uast.TreeSitterNode{child}
+		current = child
+	}
+	current.Text = "leaf"
+
+	converter := uast.NewConverter()
+	u, err := converter.Convert(root, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	levels := 0
+	node := u.Root
+	for len(node.Children) > 0 {
+		node = node.Children[0]
+		levels++
+	}
+
+	if levels != depth {
+		t.Errorf("Expected depth %d, got %d", depth, levels)
+	}
+	if node.Token != "leaf" {
+		t.Errorf("Expected leaf token 'leaf', got '%s'", node.Token)
+	}
+	if got := len(u.FindByType(uast.Expression)); got != depth {
+		t.Errorf("Expected %d indexed expressions, got %d", depth, got)
+	}
+}
+
+func TestStringInterning(t *testing.T) {
+	// Build the tokens at runtime so they don't share compiler-allocated memory
+	tsNode := &uast.TreeSitterNode{
+		Type: "program",
+		Children: []*uast.TreeSitterNode{
+			{Type: "identifier", Text: strings.Repeat("x", 8)},
+			{Type: "identifier", Text: strings.Repeat("x", 8)},
+		},
+	}
+
+	converter := uast.NewConverter()
+	converter.SetStringInterning(true)
+
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	first, second := u.Root.Children[0].Token, u.Root.Children[1].Token
+	if unsafe.StringData(first) != unsafe.StringData(second) {
+		t.Errorf("Expected identical tokens to share memory")
+	}
+}
+
+func BenchmarkConvert(b *testing.B) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		b.Fatalf("Error loading CST: %v", err)
+	}
+
+	for _, useArena := range []bool{false, true} {
+		b.Run("arena="+strconv.FormatBool(useArena), func(b *testing.B) {
+			converter := uast.NewConverter()
+			converter.SetArenaAllocation(useArena)
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := converter.Convert(tsNode, "go"); err != nil {
+					b.Fatalf("Error converting to UAST: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestArenaAllocationMatchesDefault(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	render := func(useArena bool) string {
+		converter := uast.NewConverter()
+		converter.SetArenaAllocation(useArena)
+
+		u, err := converter.Convert(tsNode, "go")
+		if err != nil {
+			t.Fatalf("Error converting to UAST: %v", err)
+		}
+
+		text, err := uast.ToLLMFormat(u, &uast.SimpleTextFormat{IncludeLocations: true})
+		if err != nil {
+			t.Fatalf("Error formatting UAST: %v", err)
+		}
+		return text
+	}
+
+	if render(true) != render(false) {
+		t.Errorf("Expected arena allocation to produce the same tree")
+	}
+}
+
+func TestConverterReset(t *testing.T) {
+	converter := uast.NewConverter()
+
+	tsNode, err := createSimpleCST()
+	if err != nil {
+		t.Fatalf("Error creating CST: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		converter.Reset()
+
+		u, err := converter.Convert(tsNode, "rust")
+		if err != nil {
+			t.Fatalf("Error converting to UAST: %v", err)
+		}
+		if u.Root.ID != "1" {
+			t.Errorf("Expected root ID '1' after Reset, got '%s'", u.Root.ID)
+		}
+	}
+}
+
+func TestConvertFiles(t *testing.T) {
+	simple, err := createSimpleCST()
+	if err != nil {
+		t.Fatalf("Error creating CST: %v", err)
+	}
+
+	files := []uast.FileInput{
+		{Path: "testdata/example.json", Language: "go"},
+		{Path: "simple.rs", Language: "rust", CST: simple},
+		{Path: "testdata/missing.json", Language: "go"},
+	}
+
+	converter := uast.NewConverter()
+	converter.SetBatchWorkers(2)
+	results := converter.ConvertFiles(context.Background(), files)
+
+	if len(results) != len(files) {
+		t.Fatalf("Expected %d results, got %d", len(files), len(results))
+	}
+	for i, result := range results[:2] {
+		if result.Err != nil {
+			t.Fatalf("Unexpected error for %s: %v", files[i].Path, result.Err)
+		}
+		if result.Path != files[i].Path || result.UAST.Metadata["path"] != files[i].Path {
+			t.Errorf("Expected result %d to be for %s", i, files[i].Path)
+		}
+	}
+	if results[2].Err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range converter.ConvertFiles(ctx, files) {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("Expected cancelled conversion for %s, got %v", result.Path, result.Err)
+		}
+	}
+}
+
+func TestConvertIncremental(t *testing.T) {
+	load := func() *uast.TreeSitterNode {
+		tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+		if err != nil {
+			t.Fatalf("Error loading CST: %v", err)
+		}
+		return tsNode
+	}
+	converter := uast.NewConverter()
+	converter.SetIDStrategy(uast.ContentHashIDs)
+	converter.SetByteOffsets(true)
+
+	prev, err := converter.Convert(load(), "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	var addFn *uast.Node
+	for _, node := range prev.Root.Children {
+		if addFn == nil && node.Properties["ts_type"] == "function_declaration" {
+			addFn = node
+		}
+	}
+
+	// Insert a newline after "package main", moving everything below down a line
+	edit := uast.InputEdit{
+		StartByte: 12, OldEndByte: 12, NewEndByte: 13,
+		StartPoint: [2]int{0, 12}, OldEndPoint: [2]int{0, 12}, NewEndPoint: [2]int{1, 0},
+	}
+	edited := load()
+	stack := []*uast.TreeSitterNode{edited}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		stack = append(stack, node.Children...)
+		if node.StartPoint[0] > 0 {
+			node.StartPoint[0]++
+			node.StartByte++
+		}
+		if node.EndPoint[0] > 0 {
+			node.EndPoint[0]++
+			node.EndByte++
+		}
+	}
+
+	got, err := converter.ConvertIncremental(prev, edited, []uast.InputEdit{edit})
+	if err != nil {
+		t.Fatalf("Error converting incrementally: %v", err)
+	}
+	full := uast.NewConverter()
+	full.SetIDStrategy(uast.ContentHashIDs)
+	full.SetByteOffsets(true)
+	want, err := full.Convert(edited, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("Expected incremental conversion to match a full conversion")
+	}
+
+	if addFn == nil || !slices.Contains(got.Root.Children, addFn) {
+		t.Error("Expected the untouched function add to be reused")
+	}
+	if addFn != nil && addFn.Location.Start.Line != 10 {
+		t.Errorf("Expected add to move to line 10, got %d", addFn.Location.Start.Line)
+	}
+
+	// Incremental conversions are instrumented and measured like full ones
+	converter.SetInstrumentation(true)
+	converter.SetConversionStats(true)
+	again, err := converter.ConvertIncremental(got, edited, nil)
+	if err != nil {
+		t.Fatalf("Error converting incrementally: %v", err)
+	}
+	if stats, ok := again.ConversionStats(); !ok || stats.Nodes != want.Stats().TotalNodes {
+		t.Errorf("Expected conversion stats for every node, got %+v", stats)
+	}
+	if phases := converter.Report().Phases; phases[uast.PhaseConvert].Calls != 1 || phases[uast.PhaseIndex].Calls != 1 {
+		t.Errorf("Expected the conversion phases to be recorded, got %v", phases)
+	}
+}
+
+func TestValidateCST(t *testing.T) {
+	leaf := func(start, end int, text string) *uast.TreeSitterNode {
+		return &uast.TreeSitterNode{Type: "identifier", StartByte: start, EndByte: end, StartPoint: [2]int{0, start}, EndPoint: [2]int{0, end}, Text: text}
+	}
+	root := &uast.TreeSitterNode{
+		Type: "source_file", EndByte: 10, EndPoint: [2]int{0, 10},
+		Children: []*uast.TreeSitterNode{leaf(0, 3, "foo"), leaf(2, 6, "barz")},
+	}
+	for _, strictness := range []uast.CSTStrictness{uast.CSTSkipValidation, uast.CSTLenient, uast.CSTStandard} {
+		if err := uast.ValidateCST(root, strictness); err != nil {
+			t.Errorf("Expected overlapping siblings to pass strictness %d, got %v", strictness, err)
+		}
+	}
+	err := uast.ValidateCST(root, uast.CSTStrict)
+	var cstErr *uast.CSTError
+	if !errors.As(err, &cstErr) || cstErr.Path != "/children/1" || !strings.Contains(cstErr.Message, "previous sibling ends at byte 3") {
+		t.Errorf("Expected an overlap error at /children/1, got %v", err)
+	}
+
+	root.Children = append(root.Children, leaf(1, 12, ""))
+	if err := uast.ValidateCST(root, uast.CSTStandard); !errors.As(err, &cstErr) || cstErr.Path != "/children/2" {
+		t.Errorf("Expected a range error at /children/2, got %v", err)
+	}
+	root.Children[2] = leaf(1, 2, "")
+	if err := uast.ValidateCST(root, uast.CSTStandard); err == nil || !strings.Contains(err.Error(), "before its previous sibling at byte 2") {
+		t.Errorf("Expected an ordering error, got %v", err)
+	}
+	root.Children[2] = leaf(5, 4, "")
+	if err := uast.ValidateCST(root, uast.CSTLenient); err == nil || !strings.Contains(err.Error(), "ends at byte 4 before it starts at byte 5") {
+		t.Errorf("Expected a reversed range error, got %v", err)
+	}
+
+	converter := uast.NewConverter()
+	converter.SetCSTValidation(uast.CSTLenient)
+	if _, err := converter.Convert(root, "go"); !errors.As(err, &cstErr) {
+		t.Errorf("Expected Convert to reject the CST, got %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	converter := uast.NewConverter()
+	if _, err := converter.Convert(nil, "go"); !errors.Is(err, uast.ErrNilRoot) {
+		t.Errorf("Expected ErrNilRoot converting a nil CST, got %v", err)
+	}
+	if _, err := uast.NewLLMProcessor().Process(&uast.UAST{}); !errors.Is(err, uast.ErrNilRoot) {
+		t.Errorf("Expected ErrNilRoot processing a UAST without a root, got %v", err)
+	}
+
+	limits := uast.DefaultDecodeLimits()
+	for name, decode := range map[string]func() error{
+		"CST":        func() error { _, err := uast.DecodeTreeSitterCST(strings.NewReader("{")); return err },
+		"limited":    func() error { _, err := uast.DecodeTreeSitterCSTWithLimits(strings.NewReader("{"), limits); return err },
+		"UAST":       func() error { _, err := uast.DecodeUAST(strings.NewReader("[")); return err },
+		"role rules": func() error { _, err := uast.DecodeRoleRules(strings.NewReader(`[{"roles": []}]`)); return err },
+		"workspace":  func() error { _, err := uast.DecodeWorkspace(strings.NewReader("nope")); return err },
+	} {
+		if err := decode(); !errors.Is(err, uast.ErrDecode) {
+			t.Errorf("Expected ErrDecode decoding malformed %s input, got %v", name, err)
+		}
+	}
+	var syntaxErr *json.SyntaxError
+	if _, err := uast.DecodeTreeSitterCST(strings.NewReader("}")); !errors.As(err, &syntaxErr) {
+		t.Errorf("Expected the underlying decode error to stay reachable, got %v", err)
+	}
+
+	bad := &uast.TreeSitterNode{Type: "source_file", EndByte: 4, Children: []*uast.TreeSitterNode{{Type: "identifier", StartByte: 2, EndByte: 9}}}
+	converter.SetCSTValidation(uast.CSTStandard)
+	_, err := converter.Convert(bad, "go")
+	var conversionErr *uast.ConversionError
+	var cstErr *uast.CSTError
+	if !errors.As(err, &conversionErr) || conversionErr.Node != bad.Children[0] || !errors.As(err, &cstErr) {
+		t.Errorf("Expected a ConversionError at the identifier caused by a CSTError, got %v", err)
+	}
+}
+
+func TestPartialConversion(t *testing.T) {
+	ident := func(start, end int, text string) *uast.TreeSitterNode {
+		return &uast.TreeSitterNode{Type: "identifier", StartByte: start, EndByte: end, StartPoint: [2]int{0, start}, EndPoint: [2]int{0, end}, Text: text}
+	}
+	call := &uast.TreeSitterNode{
+		Type: "call_expression", StartByte: 4, EndByte: 30, StartPoint: [2]int{0, 4}, EndPoint: [2]int{0, 30},
+		Children: []*uast.TreeSitterNode{ident(4, 7, "foo")},
+	}
+	root := &uast.TreeSitterNode{
+		Type: "source_file", EndByte: 12, EndPoint: [2]int{0, 12},
+		Children: []*uast.TreeSitterNode{ident(0, 3, "bar"), call, nil, ident(9, 12, "baz")},
+	}
+
+	converter := uast.NewConverter()
+	if _, err := converter.Convert(root, "go"); err != nil {
+		t.Fatalf("Expected conversion without validation to succeed, got %v", err)
+	}
+	converter.SetCSTValidation(uast.CSTStandard)
+	if _, err := converter.Convert(root, "go"); err == nil {
+		t.Fatal("Expected validated conversion to fail")
+	}
+
+	converter.SetPartialConversion(true)
+	u, err := converter.Convert(root, "go")
+	if err != nil {
+		t.Fatalf("Expected partial conversion to succeed, got %v", err)
+	}
+	if len(u.Diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %+v", u.Diagnostics)
+	}
+	stubbed, skipped := u.Diagnostics[0], u.Diagnostics[1]
+	if stubbed.Path != "/children/1" || stubbed.Type != "call_expression" || !strings.Contains(stubbed.Message, "outside its parent") {
+		t.Errorf("Unexpected diagnostic for the call: %+v", stubbed)
+	}
+	if skipped.Path != "/children/2" || skipped.NodeID != "" {
+		t.Errorf("Unexpected diagnostic for the nil child: %+v", skipped)
+	}
+
+	children := u.Root.Children
+	if len(children) != 3 || children[2].Token != "baz" {
+		t.Fatalf("Expected the good siblings to be kept, got %v", children)
+	}
+	stub := children[1]
+	if stub.ID != stubbed.NodeID || stub.Type != uast.Unknown || len(stub.Children) != 0 || stub.Properties["conversion_error"] != stubbed.Message {
+		t.Errorf("Expected the call to be replaced by a stub, got %+v", stub)
+	}
+	if len(u.FindByToken("foo")) != 0 {
+		t.Error("Expected the stubbed subtree to be left out")
+	}
+
+	// Diagnostics survive serialization
+	text, err := u.ToJSON()
+	if err != nil {
+		t.Fatalf("Error serializing UAST: %v", err)
+	}
+	if err := uast.ValidateUASTJSON(strings.NewReader(text)); err != nil {
+		t.Errorf("Expected a UAST with diagnostics to match the schema, got %v", err)
+	}
+	decoded, err := uast.DecodeUAST(strings.NewReader(text))
+	if err != nil || !slices.Equal(decoded.Diagnostics, u.Diagnostics) {
+		t.Errorf("Expected diagnostics to round-trip, got %+v (%v)", decoded.Diagnostics, err)
+	}
+}
+
+func TestConverterFor(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+	u := loadGoExample(t)
+	want, _ := u.ToJSON()
+
+	// Each converter is a fresh copy of the cached one
+	for range 2 {
+		got, err := uast.ConverterFor("go").Convert(tsNode, "go")
+		if err != nil {
+			t.Fatalf("Error converting: %v", err)
+		}
+		if text, _ := got.ToJSON(); text != want {
+			t.Error("Expected ConverterFor to match a converter with the go profile applied")
+		}
+	}
+	adjusted := uast.ConverterFor("go")
+	adjusted.AddMappingRule("function_declaration", uast.Unknown)
+	if got, _ := uast.ConverterFor("go").Convert(tsNode, "go"); len(got.FindByType(uast.Function)) == 0 {
+		t.Error("Expected adjusting a converter to leave the cached one alone")
+	}
+
+	uast.RegisterConverterDefaults("go", func(c *uast.Converter) { c.SetTrivialNodeMode(uast.DropTrivialNodes) })
+	defer uast.RegisterConverterDefaults("go", nil)
+	got, err := uast.ConverterFor("go").Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting: %v", err)
+	}
+	if len(u.FindByToken("package")) != 1 || len(got.FindByToken("package")) != 0 {
+		t.Error("Expected the registered defaults to drop trivial nodes")
+	}
+}
+
+func TestInstrumentation(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	converter := uast.NewConverter()
+	if _, err := converter.Convert(tsNode, "go"); err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	if report := converter.Report(); len(report.Phases) != 0 {
+		t.Errorf("Expected no phases without instrumentation, got %v", report.Phases)
+	}
+
+	converter.SetInstrumentation(true)
+	converter.SetStructuralRoles(true)
+	converter.SetParallelizationParams(1, 4)
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	if _, err := converter.Format(u, uast.SimpleTextFormat{}); err != nil {
+		t.Fatalf("Error formatting UAST: %v", err)
+	}
+
+	report := converter.Report()
+	for _, phase := range []string{uast.PhaseCheck, uast.PhaseConvert, uast.PhaseRoles, uast.PhaseIndex, uast.PhaseFormat} {
+		if stats := report.Phases[phase]; stats.Calls != 1 || stats.Duration <= 0 {
+			t.Errorf("Expected one timed call of %s, got %+v", phase, stats)
+		}
+	}
+	if _, ok := report.Phases[uast.PhaseSimplify]; ok {
+		t.Errorf("Expected no simplify phase when simplification is off")
+	}
+	if report.Phases[uast.PhaseConvert].Allocs == 0 {
+		t.Errorf("Expected conversion allocations to be counted")
+	}
+	if report.ParallelThreshold != 1 || report.MaxGoRoutines != 4 || report.ParallelSplits == 0 || report.Goroutines < report.ParallelSplits {
+		t.Errorf("Expected parallel conversion to be reported, got %+v", report)
+	}
+}
+
+func TestConversionStats(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	converter := uast.NewConverter()
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	if _, ok := u.ConversionStats(); ok {
+		t.Errorf("Expected no conversion stats unless enabled")
+	}
+
+	converter.SetConversionStats(true)
+	converter.SetParallelizationParams(1, 4)
+	u, err = converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	stats, ok := u.ConversionStats()
+	if !ok {
+		t.Fatalf("Expected conversion stats in the metadata, got %v", u.Metadata)
+	}
+	if total := u.Stats(); stats.Nodes != total.TotalNodes || stats.TypeCounts[uast.Identifier] != total.TypeCounts[uast.Identifier] {
+		t.Errorf("Expected the node counts of the tree, got %+v", stats)
+	}
+	if want := float64(stats.Unknown) / float64(stats.Nodes); stats.Unknown == 0 || stats.UnknownRatio != want {
+		t.Errorf("Expected an unknown ratio of %v, got %+v", want, stats)
+	}
+	if stats.Duration <= 0 || stats.ParallelSplits == 0 || stats.Goroutines < stats.ParallelSplits {
+		t.Errorf("Expected the duration and parallel splits, got %+v", stats)
+	}
+
+	restored := u.Compact().ToUAST()
+	if again, ok := restored.ConversionStats(); !ok || again.Nodes != stats.Nodes {
+		t.Errorf("Expected conversion stats to survive serialization, got %+v", again)
+	}
+}
+
+func FuzzConvertGenerated(f *testing.F) {
+	for seed := range uint64(8) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed uint64) {
+		tree := uasttest.NewGenerator(seed, uasttest.Config{Anonymous: 0.1}).Tree()
+		u, err := uast.NewConverter().Convert(tree.CST, "generated")
+		if err != nil {
+			t.Fatalf("Error converting a generated CST: %v", err)
+		}
+		if findings := u.Validate(); len(findings) > 0 {
+			t.Errorf("Expected a valid UAST, got %v", findings)
+		}
+	})
+}
+
+func TestMappingRulesRoundTrip(t *testing.T) {
+	converter := goConverter(t)
+	converter.AddMappingRule("decorator", uast.Expression)
+
+	var dump bytes.Buffer
+	if err := converter.DumpMappingRules(&dump); err != nil {
+		t.Fatalf("Error dumping mapping rules: %v", err)
+	}
+
+	loaded := uast.NewConverter()
+	loaded.AddMappingRule("stale", uast.Call)
+	if err := loaded.LoadMappingRules(bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatalf("Error loading mapping rules: %v", err)
+	}
+	if !slices.Equal(loaded.MappingRules(), converter.MappingRules()) {
+		t.Errorf("Expected the loaded rules to match the dumped ones")
+	}
+	if slices.ContainsFunc(loaded.MappingRules(), func(rule uast.MappingRule) bool { return rule.TSType == "stale" }) {
+		t.Errorf("Expected loading to replace the existing rules")
+	}
+	rules := loaded.MappingRules()
+	if !slices.Contains(rules, uast.MappingRule{TSType: "decorator", NodeType: uast.Expression}) || !slices.Contains(rules, uast.MappingRule{TSType: "comment", NodeType: uast.Comment, Default: true}) {
+		t.Errorf("Expected overrides and defaults to be kept apart, got %v", rules)
+	}
+
+	for _, input := range []string{`{}`, `[{"tsType": "x"}]`, `[{"tsType": "x", "nodeType": "Call"}, {"tsType": "x", "nodeType": "File"}]`} {
+		if err := loaded.LoadMappingRules(strings.NewReader(input)); !errors.Is(err, uast.ErrDecode) {
+			t.Errorf("Expected ErrDecode for %s, got %v", input, err)
+		}
+	}
+	if !slices.Equal(loaded.MappingRules(), rules) {
+		t.Errorf("Expected failed loads to leave the rules unchanged")
+	}
+}
+
+func TestMappingRulePrecedence(t *testing.T) {
+	leaf := func(tsType string) *uast.TreeSitterNode {
+		return &uast.TreeSitterNode{Type: tsType, Text: "x"}
+	}
+	root := &uast.TreeSitterNode{Type: "program", Children: []*uast.TreeSitterNode{
+		leaf("if_statement"), leaf("while_statement"), leaf("expression_statement"), leaf("comment"),
+	}}
+	convert := func(c *uast.Converter) []uast.NodeType {
+		c.SetStructuralRoles(false)
+		u, err := c.Convert(root, "test")
+		if err != nil {
+			t.Fatalf("Error converting: %v", err)
+		}
+		var types []uast.NodeType
+		for _, child := range u.Root.Children {
+			types = append(types, child.Type)
+		}
+		return types
+	}
+
+	converter := uast.NewConverter()
+	for _, rule := range []uast.MappingRule{
+		{Pattern: "*_statement", NodeType: uast.Statement},
+		{Pattern: "expression_*", NodeType: uast.Expression, Priority: 1},
+		{TSType: "while_statement", NodeType: uast.Loop, Priority: 5},
+	} {
+		if err := converter.AddMapping(rule); err != nil {
+			t.Fatalf("Error adding rule: %v", err)
+		}
+	}
+	converter.AddMappingRule("while_statement", uast.Call) // Outranked by the priority 5 rule
+
+	want := []uast.NodeType{uast.Statement, uast.Loop, uast.Expression, uast.Comment}
+	if got := convert(converter); !slices.Equal(got, want) {
+		t.Errorf("Expected exact > pattern > default, got %v, want %v", got, want)
+	}
+
+	if !converter.RemoveMappingRule("comment") || !converter.RemovePatternRule("*_statement") || converter.RemovePatternRule("missing") {
+		t.Errorf("Expected removal to report the rules that existed")
+	}
+	want = []uast.NodeType{uast.Condition, uast.Loop, uast.Expression, uast.Unknown}
+	if got := convert(converter); !slices.Equal(got, want) {
+		t.Errorf("Expected removed rules to fall back, got %v, want %v", got, want)
+	}
+
+	if err := converter.AddMapping(uast.MappingRule{Pattern: "[", NodeType: uast.Call}); err == nil {
+		t.Errorf("Expected an invalid pattern to be rejected")
+	}
+	if err := converter.AddMapping(uast.MappingRule{TSType: "a", Pattern: "b*", NodeType: uast.Call}); err == nil {
+		t.Errorf("Expected a rule with both a type and a pattern to be rejected")
+	}
+}
+
+func TestMappingCoverage(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+	u, err := uast.NewConverter().Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	report := uast.MappingCoverage(u)
+	if report.Nodes != len(slices.Collect(u.Root.Descendants()))+1 || report.Unmapped == 0 || report.Coverage() >= 1 {
+		t.Fatalf("Expected some of the nodes to be unmapped, got %+v", report)
+	}
+	if report.Types[0].Mapped {
+		t.Errorf("Expected unmapped types first")
+	}
+
+	byType := make(map[string]uast.TypeCoverage)
+	for _, coverage := range report.Types {
+		byType[coverage.TSType] = coverage
+	}
+	if c := byType["function_declaration"]; c.Mapped || c.Suggestion != uast.Function {
+		t.Errorf("Expected function_declaration to be unmapped with a Function suggestion, got %+v", c)
+	}
+	if c := byType["identifier"]; !c.Mapped || c.NodeType != uast.Identifier {
+		t.Errorf("Expected identifier to be mapped, got %+v", c)
+	}
+
+	converter := uast.NewConverter()
+	for _, rule := range report.SuggestedRules() {
+		if err := converter.AddMapping(rule); err != nil {
+			t.Fatalf("Error adding suggested rule: %v", err)
+		}
+	}
+	improved, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	if uast.MappingCoverage(improved).Unmapped >= report.Unmapped {
+		t.Errorf("Expected the suggested rules to map more nodes")
+	}
+}
@@ -0,0 +1,65 @@
+package uast
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ConversionStatsKey is the metadata key Convert records conversion
+// statistics under when they are enabled
+const ConversionStatsKey = "conversion_stats"
+
+// ConversionStats describes one conversion, for monitoring the conversion
+// quality of an index pipeline over time
+type ConversionStats struct {
+	Nodes          int              `json:"nodes"`
+	TypeCounts     map[NodeType]int `json:"typeCounts"`
+	Unknown        int              `json:"unknown"`      // Nodes no mapping rule covered
+	UnknownRatio   float64          `json:"unknownRatio"` // Unknown nodes per node
+	Diagnostics    int              `json:"diagnostics"`  // Subtrees stubbed out by partial conversion
+	Duration       time.Duration    `json:"duration"`
+	ParallelSplits int64            `json:"parallelSplits"` // Nodes whose children were converted in parallel
+	Goroutines     int64            `json:"goroutines"`     // Goroutines started for them
+}
+
+// conversionCounts accumulates the parallel splits of one conversion
+type conversionCounts struct {
+	splits     atomic.Int64
+	goroutines atomic.Int64
+}
+
+// SetConversionStats configures whether Convert records a ConversionStats
+// in the metadata of each UAST, retrievable with ConversionStats. Unlike
+// instrumentation, it measures each conversion on its own and is cheap
+// enough to leave on.
+func (c *Converter) SetConversionStats(enabled bool) {
+	c.conversionStats = enabled
+}
+
+// ConversionStats returns the statistics Convert recorded for the tree.
+// ok is false if they were not enabled; they describe the tree as
+// converted, not as edited since.
+func (u *UAST) ConversionStats() (stats ConversionStats, ok bool) {
+	return stats, u.MetadataJSON(ConversionStatsKey, &stats) == nil
+}
+
+// recordConversionStats stores the statistics of a finished conversion in
+// the metadata of u
+func recordConversionStats(u *UAST, elapsed time.Duration, counts *conversionCounts) {
+	stats := ConversionStats{
+		TypeCounts:     make(map[NodeType]int, len(u.TypeIndex)),
+		Diagnostics:    len(u.Diagnostics),
+		Duration:       elapsed,
+		ParallelSplits: counts.splits.Load(),
+		Goroutines:     counts.goroutines.Load(),
+	}
+	for nodeType, nodes := range u.TypeIndex {
+		stats.TypeCounts[nodeType] = len(nodes)
+		stats.Nodes += len(nodes)
+	}
+	stats.Unknown = stats.TypeCounts[Unknown]
+	if stats.Nodes > 0 {
+		stats.UnknownRatio = float64(stats.Unknown) / float64(stats.Nodes)
+	}
+	_ = u.SetMetadataJSON(ConversionStatsKey, stats) // Counts always marshal
+}
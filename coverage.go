@@ -0,0 +1,138 @@
+package uast
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// TypeCoverage describes how the nodes of one Tree-sitter type were mapped
+type TypeCoverage struct {
+	TSType     string   `json:"tsType"`
+	Count      int      `json:"count"`
+	NodeType   NodeType `json:"nodeType"`
+	Mapped     bool     `json:"mapped"`               // False for Unknown and pass-through nodes
+	Suggestion NodeType `json:"suggestion,omitempty"` // A likely type for an unmapped Tree-sitter type, guessed from its name
+}
+
+// CoverageReport summarizes how well a converter's mapping rules covered the
+// Tree-sitter types of some trees
+type CoverageReport struct {
+	Types    []TypeCoverage `json:"types"` // Unmapped types first, then by count and name
+	Nodes    int            `json:"nodes"`
+	Unmapped int            `json:"unmapped"`
+}
+
+// MappingCoverage reports the Tree-sitter types the nodes of the trees were
+// converted from, read from their "ts_type" properties, and which of them
+// no rule mapped. Trivial nodes the converter dropped or folded are not
+// counted. It is meant for writing a new language profile: convert a few
+// representative files and add rules for the unmapped types, starting from
+// SuggestedRules.
+func MappingCoverage(trees ...*UAST) CoverageReport {
+	var report CoverageReport
+	byType := make(map[string]*TypeCoverage)
+	for _, u := range trees {
+		if u == nil {
+			continue
+		}
+		u.mu.RLock()
+		walk(u.Root, func(node *Node, _ int) {
+			tsType, ok := node.Properties["ts_type"]
+			if !ok {
+				return
+			}
+			coverage := byType[tsType]
+			if coverage == nil {
+				mapped := node.Type != Unknown && node.Type != NodeType(tsType)
+				coverage = &TypeCoverage{TSType: tsType, NodeType: node.Type, Mapped: mapped}
+				if !mapped {
+					coverage.Suggestion = suggestNodeType(tsType)
+				}
+				byType[tsType] = coverage
+			}
+			coverage.Count++
+			report.Nodes++
+			if !coverage.Mapped {
+				report.Unmapped++
+			}
+		})
+		u.mu.RUnlock()
+	}
+
+	for _, coverage := range byType {
+		report.Types = append(report.Types, *coverage)
+	}
+	slices.SortFunc(report.Types, func(a, b TypeCoverage) int {
+		if a.Mapped != b.Mapped {
+			if !a.Mapped {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.TSType, b.TSType))
+	})
+	return report
+}
+
+// Coverage returns the fraction of nodes that were mapped, or 1 if there
+// were none
+func (r CoverageReport) Coverage() float64 {
+	if r.Nodes == 0 {
+		return 1
+	}
+	return float64(r.Nodes-r.Unmapped) / float64(r.Nodes)
+}
+
+// SuggestedRules returns a mapping rule for each unmapped type with a
+// suggestion, to review before adding them with AddMapping
+func (r CoverageReport) SuggestedRules() []MappingRule {
+	var rules []MappingRule
+	for _, coverage := range r.Types {
+		if !coverage.Mapped && coverage.Suggestion != "" {
+			rules = append(rules, MappingRule{TSType: coverage.TSType, NodeType: coverage.Suggestion})
+		}
+	}
+	return rules
+}
+
+// typeHints maps words of Tree-sitter type names to the UAST type they
+// suggest, most specific first, so "call_expression" suggests Call
+var typeHints = []struct {
+	words    []string
+	nodeType NodeType
+}{
+	{[]string{"method"}, Method},
+	{[]string{"function", "func", "lambda", "closure", "arrow"}, Function},
+	{[]string{"class", "struct", "interface", "trait", "enum", "record", "impl"}, Class},
+	{[]string{"call", "invocation"}, Call},
+	{[]string{"if", "switch", "case", "match", "conditional", "ternary", "when"}, Condition},
+	{[]string{"for", "while", "loop", "do", "foreach", "repeat"}, Loop},
+	{[]string{"return", "yield"}, Return},
+	{[]string{"import", "include", "use", "require"}, Import},
+	{[]string{"package", "module", "namespace"}, Package},
+	{[]string{"comment"}, Comment},
+	{[]string{"parameter", "parameters", "param"}, Parameter},
+	{[]string{"argument", "arguments"}, Argument},
+	{[]string{"assignment", "assign"}, Assignment},
+	{[]string{"operator"}, Operator},
+	{[]string{"literal", "string", "number", "integer", "float", "char", "true", "false", "nil", "null", "none"}, Literal},
+	{[]string{"identifier", "name"}, Identifier},
+	{[]string{"var", "variable", "const", "let", "field", "property"}, Variable},
+	{[]string{"expression"}, Expression},
+	{[]string{"statement", "declaration", "block"}, Statement},
+}
+
+// suggestNodeType guesses the UAST type of a Tree-sitter type from the
+// words of its name, returning "" if nothing suggests one
+func suggestNodeType(tsType string) NodeType {
+	words := strings.Split(strings.ToLower(tsType), "_")
+	for _, hint := range typeHints {
+		for _, word := range words {
+			if slices.Contains(hint.words, word) {
+				return hint.nodeType
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+package uast
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// CSTStrictness selects the checks ValidateCST applies, each level adding to
+// the one before
+type CSTStrictness int
+
+const (
+	// CSTSkipValidation applies no checks, the Converter default
+	CSTSkipValidation CSTStrictness = iota
+	// CSTLenient checks that ranges are non-negative and end no earlier than
+	// they start
+	CSTLenient
+	// CSTStandard also checks that children lie within their parent and
+	// start in order
+	CSTStandard
+	// CSTStrict also checks that siblings don't overlap and that leaf text
+	// fills its byte range
+	CSTStrict
+)
+
+// CSTError reports the first malformed node found by ValidateCST
+type CSTError struct {
+	Path    string          // JSON Pointer to the node, such as "/children/0/children/2"
+	Node    *TreeSitterNode // nil for a nil child
+	Type    string          // Tree-sitter type of the node
+	Message string
+}
+
+// Error implements the error interface
+func (e *CSTError) Error() string {
+	return fmt.Sprintf("invalid CST node %s at %q: %s", e.Type, e.Path, e.Message)
+}
+
+// SetCSTValidation makes Convert check its input with ValidateCST at the
+// given strictness, failing before any node is converted
+func (c *Converter) SetCSTValidation(strictness CSTStrictness) {
+	c.cstStrictness = strictness
+}
+
+// validateCST applies the configured CST validation, reporting a failure as
+// a *ConversionError at the malformed node
+func (c *Converter) validateCST(root *TreeSitterNode) error {
+	if err := ValidateCST(root, c.cstStrictness); err != nil {
+		conversionErr := &ConversionError{Cause: err}
+		var cstErr *CSTError
+		if errors.As(err, &cstErr) {
+			conversionErr.Node = cstErr.Node
+		}
+		return conversionErr
+	}
+	return nil
+}
+
+// ValidateCST checks the byte and point ranges of a CST, returning a
+// *CSTError for the first node that breaks a check of the given strictness
+func ValidateCST(root *TreeSitterNode, strictness CSTStrictness) error {
+	if root == nil {
+		return ErrNilRoot
+	}
+	if strictness <= CSTSkipValidation {
+		return nil
+	}
+
+	var first *CSTError
+	checkCST(root, strictness, func(err *CSTError) bool {
+		first = err
+		return false
+	})
+	if first != nil {
+		return first
+	}
+	return nil
+}
+
+// cstEntry is a CST node awaiting checks, with the nodes it is checked against
+type cstEntry struct {
+	node, parent, prev *TreeSitterNode
+	path               string
+}
+
+// checkCST walks a CST in pre-order, passing each node that breaks a check of
+// the given strictness to report and skipping its subtree. The walk stops when
+// report returns false.
+func checkCST(root *TreeSitterNode, strictness CSTStrictness, report func(*CSTError) bool) {
+	stack := []cstEntry{{node: root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if err := checkCSTNode(top, strictness); err != nil {
+			if !report(err) {
+				return
+			}
+			continue
+		}
+
+		start := len(stack)
+		var prev *TreeSitterNode
+		for i, child := range top.node.Children {
+			stack = append(stack, cstEntry{node: child, parent: top.node, prev: prev, path: top.path + "/children/" + strconv.Itoa(i)})
+			if child != nil {
+				prev = child
+			}
+		}
+		slices.Reverse(stack[start:])
+	}
+}
+
+// checkCSTNode checks the ranges of a node, and how they fit within its
+// parent and after its previous sibling
+func checkCSTNode(e cstEntry, strictness CSTStrictness) *CSTError {
+	node := e.node
+	if node == nil {
+		return &CSTError{Path: e.path, Message: "is nil"}
+	}
+	fail := func(format string, args ...any) *CSTError {
+		return &CSTError{Path: e.path, Node: node, Type: node.Type, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if node.StartByte < 0 || node.StartPoint[0] < 0 || node.StartPoint[1] < 0 {
+		return fail("starts at byte %d, point %s", node.StartByte, pointString(node.StartPoint))
+	}
+	if node.EndByte < node.StartByte {
+		return fail("ends at byte %d before it starts at byte %d", node.EndByte, node.StartByte)
+	}
+	if comparePoints(node.EndPoint, node.StartPoint) < 0 {
+		return fail("ends at point %s before it starts at point %s", pointString(node.EndPoint), pointString(node.StartPoint))
+	}
+	if strictness >= CSTStrict {
+		if node.Text != "" && len(node.Children) == 0 && len(node.Text) != node.EndByte-node.StartByte {
+			return fail("has %d bytes of text for a range of %d bytes", len(node.Text), node.EndByte-node.StartByte)
+		}
+		if (node.StartByte == node.EndByte) != (node.StartPoint == node.EndPoint) {
+			return fail("has byte range %d-%d but point range %s-%s", node.StartByte, node.EndByte, pointString(node.StartPoint), pointString(node.EndPoint))
+		}
+	}
+	if strictness < CSTStandard || e.parent == nil {
+		return nil
+	}
+
+	parent, prev := e.parent, e.prev
+	switch {
+	case node.StartByte < parent.StartByte || node.EndByte > parent.EndByte:
+		return fail("has byte range %d-%d outside its parent's %d-%d", node.StartByte, node.EndByte, parent.StartByte, parent.EndByte)
+	case comparePoints(node.StartPoint, parent.StartPoint) < 0 || comparePoints(node.EndPoint, parent.EndPoint) > 0:
+		return fail("has point range %s-%s outside its parent's %s-%s", pointString(node.StartPoint), pointString(node.EndPoint), pointString(parent.StartPoint), pointString(parent.EndPoint))
+	case prev == nil:
+	case node.StartByte < prev.StartByte:
+		return fail("starts at byte %d before its previous sibling at byte %d", node.StartByte, prev.StartByte)
+	case comparePoints(node.StartPoint, prev.StartPoint) < 0:
+		return fail("starts at point %s before its previous sibling at point %s", pointString(node.StartPoint), pointString(prev.StartPoint))
+	case strictness >= CSTStrict && node.StartByte < prev.EndByte:
+		return fail("starts at byte %d before its previous sibling ends at byte %d", node.StartByte, prev.EndByte)
+	case strictness >= CSTStrict && comparePoints(node.StartPoint, prev.EndPoint) < 0:
+		return fail("starts at point %s before its previous sibling ends at point %s", pointString(node.StartPoint), pointString(prev.EndPoint))
+	}
+	return nil
+}
+
+// pointString formats a point as it appears in CST JSON
+func pointString(p [2]int) string {
+	return fmt.Sprintf("[%d, %d]", p[0], p[1])
+}
@@ -0,0 +1,455 @@
+package uast
+
+import (
+	"slices"
+	"strings"
+)
+
+// Definition is a point in a function where a local variable or parameter
+// is given a value
+type Definition struct {
+	Binding *Binding
+	Node    *Node // The identifier written to
+	index   int   // Order of the definition within the function
+}
+
+// DataFlow holds the reaching definitions of a function's local variables.
+// The analysis follows the structure of the tree rather than a control-flow
+// graph: both arms of a condition are assumed possible and loop bodies are
+// iterated to a fixed point. Nested functions are not analysed.
+type DataFlow struct {
+	Function    *Node
+	definitions []*Definition
+	reaching    map[*Node][]*Definition // Use -> definitions reaching it
+	uses        map[*Definition][]*Node
+	reads       map[*Definition][]*Node // Uses evaluated to compute a definition
+}
+
+// Definitions returns the function's definitions in evaluation order
+func (d *DataFlow) Definitions() []*Definition {
+	return slices.Clone(d.definitions)
+}
+
+// DefinitionsOf returns the definitions of a binding in evaluation order
+func (d *DataFlow) DefinitionsOf(binding *Binding) []*Definition {
+	var defs []*Definition
+	for _, def := range d.definitions {
+		if def.Binding == binding {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+// ReachingDefinitions returns the definitions that may supply the value read
+// by an identifier
+func (d *DataFlow) ReachingDefinitions(use *Node) []*Definition {
+	return slices.Clone(d.reaching[use])
+}
+
+// Uses returns the identifiers that may read the value of a definition
+func (d *DataFlow) Uses(def *Definition) []*Node {
+	return slices.Clone(d.uses[def])
+}
+
+// Inputs returns the definitions whose values may flow directly into a
+// definition, such as the definition of x in y := x + 1
+func (d *DataFlow) Inputs(def *Definition) []*Definition {
+	var inputs []*Definition
+	for _, use := range d.reads[def] {
+		inputs = mergeDefinitions(inputs, d.reaching[use])
+	}
+	return inputs
+}
+
+// FlowsTo reports whether the value of from may reach to, directly or
+// through intermediate definitions
+func (d *DataFlow) FlowsTo(from, to *Definition) bool {
+	seen := map[*Definition]bool{to: true}
+	stack := []*Definition{to}
+	for len(stack) > 0 {
+		def := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, input := range d.Inputs(def) {
+			if input == from {
+				return true
+			}
+			if !seen[input] {
+				seen[input] = true
+				stack = append(stack, input)
+			}
+		}
+	}
+	return false
+}
+
+// DataFlow computes reaching definitions for the locals of a Function or
+// Method node
+func (u *UAST) DataFlow(fn *Node) *DataFlow {
+	a := &flowAnalysis{
+		scopes: u.Scopes(),
+		flow: &DataFlow{
+			Function: fn,
+			reaching: make(map[*Node][]*Definition),
+			uses:     make(map[*Definition][]*Node),
+			reads:    make(map[*Definition][]*Node),
+		},
+		defs: make(map[*Node]*Definition),
+	}
+	a.local = a.scopes.ScopeOf(fn)
+	if a.local == nil {
+		return a.flow
+	}
+
+	state := make(flowState)
+	for _, child := range fn.Children {
+		if child != nil {
+			state = a.visit(child, state)
+		}
+	}
+	return a.flow
+}
+
+// flowState maps each binding to the definitions that may currently reach
+type flowState map[*Binding][]*Definition
+
+// clone copies the state so a branch can update it independently
+func (s flowState) clone() flowState {
+	out := make(flowState, len(s))
+	for binding, defs := range s {
+		out[binding] = defs
+	}
+	return out
+}
+
+// merge returns the union of two states
+func (s flowState) merge(other flowState) flowState {
+	out := s.clone()
+	for binding, defs := range other {
+		out[binding] = mergeDefinitions(out[binding], defs)
+	}
+	return out
+}
+
+// equal reports whether two states hold the same definitions
+func (s flowState) equal(other flowState) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for binding, defs := range s {
+		if !slices.Equal(defs, other[binding]) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeDefinitions returns the sorted union of two sorted definition lists
+func mergeDefinitions(a, b []*Definition) []*Definition {
+	out := make([]*Definition, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, a[i])
+			i++
+			j++
+		case a[i].index < b[j].index:
+			out = append(out, a[i])
+			i++
+		default:
+			out = append(out, b[j])
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// flowAnalysis is the working state of a DataFlow computation
+type flowAnalysis struct {
+	scopes *ScopeTree
+	local  *Scope // The function's scope
+	flow   *DataFlow
+	defs   map[*Node]*Definition // Defining identifier -> definition
+	reads  []*Node               // Uses seen while evaluating a right-hand side
+}
+
+// visit applies a node's effects to the state and returns the new state
+func (a *flowAnalysis) visit(node *Node, state flowState) flowState {
+	switch node.Type {
+	case Function, Method, Class:
+		// Nested declarations run separately from the enclosing function
+		return state
+	case Identifier:
+		a.use(node, state)
+		return state
+	case Parameter:
+		for _, name := range declaredIdentifiers(node) {
+			state = a.define(name, a.scopes.BindingOf(name), nil, state)
+		}
+		return state
+	case Variable, Assignment:
+		return a.visitAssignment(node, state)
+	case Condition:
+		return a.visitCondition(node, state)
+	case Loop:
+		return a.visitLoop(node, state)
+	}
+
+	switch node.Properties["ts_type"] {
+	case "inc_statement", "dec_statement", "update_expression":
+		for _, child := range node.Children {
+			if child != nil && child.Type == Identifier {
+				a.use(child, state)
+				state = a.define(child, a.scopes.DefinitionOf(child), []*Node{child}, state)
+			}
+		}
+		return state
+	}
+	return a.visitChildren(node.Children, state)
+}
+
+// visitChildren visits nodes in order
+func (a *flowAnalysis) visitChildren(nodes []*Node, state flowState) flowState {
+	for _, child := range nodes {
+		if child != nil {
+			state = a.visit(child, state)
+		}
+	}
+	return state
+}
+
+// visitAssignment evaluates the value of an assignment before defining its
+// targets. Compound assignments such as += also read their targets.
+func (a *flowAnalysis) visitAssignment(node *Node, state flowState) flowState {
+	declaring := node.Type == Variable || isDeclaringAssignment(node)
+
+	var targets, values []*Node
+	compound := false
+	if declaring {
+		targets = declaredIdentifiers(node)
+		values = declarationValues(node, targets)
+	} else {
+		split := slices.IndexFunc(node.Children, func(child *Node) bool {
+			return child != nil && child.Type == Operator
+		})
+		if split < 0 {
+			return a.visitChildren(node.Children, state)
+		}
+		op := node.Children[split].Token
+		compound = op != "=" && strings.HasSuffix(op, "=")
+		targets = assignmentTargets(node.Children[:split])
+		values = node.Children[split+1:]
+	}
+
+	saved := a.reads
+	a.reads = nil
+	if compound {
+		for _, target := range targets {
+			a.use(target, state)
+		}
+	}
+	state = a.visitChildren(values, state)
+	reads := a.reads
+	a.reads = append(saved, reads...)
+
+	for _, target := range targets {
+		binding := a.scopes.DefinitionOf(target)
+		if declaring {
+			binding = a.scopes.BindingOf(target)
+		}
+		state = a.define(target, binding, reads, state)
+	}
+	return state
+}
+
+// declarationValues returns the children of a declaration other than the
+// names it declares, descending into the lists and specs holding those names
+func declarationValues(node *Node, targets []*Node) []*Node {
+	var values []*Node
+	for _, child := range node.Children {
+		switch {
+		case child == nil, slices.Contains(targets, child):
+		case holdsAny(child, targets):
+			values = append(values, declarationValues(child, targets)...)
+		default:
+			values = append(values, child)
+		}
+	}
+	return values
+}
+
+// holdsAny reports whether any of nodes lies strictly below node
+func holdsAny(node *Node, nodes []*Node) bool {
+	for _, child := range node.Children {
+		if child != nil && (slices.Contains(nodes, child) || holdsAny(child, nodes)) {
+			return true
+		}
+	}
+	return false
+}
+
+// visitCondition evaluates the condition, then each branch from the state
+// after it. Without an else or default branch, the condition may also fall
+// through unchanged.
+func (a *flowAnalysis) visitCondition(node *Node, state flowState) flowState {
+	var header, branches []*Node
+	exhaustive := false
+	for _, child := range node.Children {
+		if child == nil {
+			continue
+		}
+		tsType := child.Properties["ts_type"]
+		switch {
+		case a.scopes.ScopeOf(child) != nil, strings.Contains(tsType, "case"), strings.Contains(tsType, "default"):
+			branches = append(branches, child)
+			if strings.Contains(tsType, "default") {
+				exhaustive = true
+			}
+		case len(branches) > 0 && child.Type != Condition:
+			// Trailing tokens such as else belong to no branch
+		default:
+			header = append(header, child)
+		}
+	}
+	if len(branches) == 2 && a.scopes.ScopeOf(branches[0]) != nil && branches[0].Type != Condition {
+		// An if with an else or else-if arm
+		exhaustive = true
+	}
+
+	state = a.visitChildren(header, state)
+	out := make(flowState)
+	if !exhaustive {
+		out = state.clone()
+	}
+	for _, branch := range branches {
+		out = out.merge(a.visit(branch, state.clone()))
+	}
+	return out
+}
+
+// visitLoop runs a loop's initialiser once, then its condition, body and
+// update statements until the definitions reaching the loop head settle
+func (a *flowAnalysis) visitLoop(node *Node, state flowState) flowState {
+	var init, cond, body, update []*Node
+	for _, child := range node.Children {
+		if child == nil {
+			continue
+		}
+		if a.scopes.ScopeOf(child) != nil {
+			body = append(body, child)
+			continue
+		}
+		// A for clause groups the initialiser, condition and update
+		parts := []*Node{child}
+		if child.Type == Unknown && len(child.Children) > 0 {
+			parts = child.Children
+		}
+		for _, part := range parts {
+			switch {
+			case part == nil, part.Type == Unknown && len(part.Children) == 0:
+				// Keywords such as for
+			case len(cond) == 0 && len(body) == 0 && isStatementLike(part):
+				init = append(init, part)
+			case len(cond) > 0 && isStatementLike(part):
+				update = append(update, part)
+			default:
+				cond = append(cond, part)
+			}
+		}
+	}
+
+	head := a.visitChildren(init, state)
+	for {
+		exit := a.visitChildren(cond, head)
+		out := a.visitChildren(body, exit)
+		out = a.visitChildren(update, out)
+
+		next := head.merge(out)
+		if next.equal(head) {
+			return exit
+		}
+		head = next
+	}
+}
+
+// isStatementLike reports whether a loop header part is a statement rather
+// than the loop condition
+func isStatementLike(node *Node) bool {
+	switch node.Type {
+	case Assignment, Variable, Statement:
+		return true
+	}
+	return false
+}
+
+// assignmentTargets returns the identifiers assigned by the left-hand side
+// of an assignment, including those inside an expression list
+func assignmentTargets(lhs []*Node) []*Node {
+	var targets []*Node
+	for _, node := range lhs {
+		switch {
+		case node == nil:
+		case node.Type == Identifier:
+			targets = append(targets, node)
+		case node.Type == Unknown:
+			targets = append(targets, assignmentTargets(node.Children)...)
+		}
+	}
+	return targets
+}
+
+// isLocal reports whether a binding is declared inside the analysed function
+func (a *flowAnalysis) isLocal(binding *Binding) bool {
+	if binding == nil || (binding.Kind != Variable && binding.Kind != Parameter) {
+		return false
+	}
+	for scope := binding.Scope; scope != nil; scope = scope.Parent {
+		if scope == a.local {
+			return true
+		}
+	}
+	return false
+}
+
+// use records the definitions reaching a read of a local
+func (a *flowAnalysis) use(ref *Node, state flowState) {
+	binding := a.scopes.DefinitionOf(ref)
+	if !a.isLocal(binding) {
+		return
+	}
+
+	a.reads = append(a.reads, ref)
+	for _, def := range state[binding] {
+		if !slices.Contains(a.flow.uses[def], ref) {
+			a.flow.uses[def] = append(a.flow.uses[def], ref)
+		}
+	}
+	a.flow.reaching[ref] = mergeDefinitions(a.flow.reaching[ref], state[binding])
+}
+
+// define records a write to a local, replacing the definitions reaching after
+// it. A definition revisited in a later loop iteration is reused.
+func (a *flowAnalysis) define(target *Node, binding *Binding, reads []*Node, state flowState) flowState {
+	if !a.isLocal(binding) {
+		return state
+	}
+
+	def, ok := a.defs[target]
+	if !ok {
+		def = &Definition{Binding: binding, Node: target, index: len(a.flow.definitions)}
+		a.defs[target] = def
+		a.flow.definitions = append(a.flow.definitions, def)
+	}
+	for _, read := range reads {
+		if !slices.Contains(a.flow.reads[def], read) {
+			a.flow.reads[def] = append(a.flow.reads[def], read)
+		}
+	}
+
+	state = state.clone()
+	state[binding] = []*Definition{def}
+	return state
+}
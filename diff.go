@@ -0,0 +1,197 @@
+package uast
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ChangeKind classifies a change to a declaration
+type ChangeKind int
+
+const (
+	// SymbolAdded is a declaration only present in the new tree
+	SymbolAdded ChangeKind = iota
+	// SymbolRemoved is a declaration only present in the old tree
+	SymbolRemoved
+	// SymbolModified is a declaration whose structure changed
+	SymbolModified
+)
+
+// String returns the name of the change kind
+func (k ChangeKind) String() string {
+	switch k {
+	case SymbolAdded:
+		return "added"
+	case SymbolRemoved:
+		return "removed"
+	case SymbolModified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// SymbolChange is a declaration that differs between two trees
+type SymbolChange struct {
+	Kind   ChangeKind
+	Symbol string // Qualified name, as from QualifiedName
+	Old    *Node  // Nil for added declarations
+	New    *Node  // Nil for removed declarations
+}
+
+// DiffReport is the structural difference between two versions of a file
+type DiffReport struct {
+	Path    string
+	Old     *UAST // Nil if the file didn't exist
+	New     *UAST // Nil if the file was deleted
+	Changes []SymbolChange
+}
+
+// DiffUAST compares the declarations of two trees, matched by qualified
+// name. A declaration is modified when its types, tokens or shape changed;
+// moves and comment edits are ignored. A changed method also modifies its
+// enclosing class. Either tree may be nil. Changes are sorted by symbol.
+func DiffUAST(old, updated *UAST) []SymbolChange {
+	oldDecls, newDecls := declarationsBySymbol(old), declarationsBySymbol(updated)
+
+	var changes []SymbolChange
+	for symbol, olds := range oldDecls {
+		news := newDecls[symbol]
+		for i, oldNode := range olds {
+			switch {
+			case i >= len(news):
+				changes = append(changes, SymbolChange{Kind: SymbolRemoved, Symbol: symbol, Old: oldNode})
+			case !sameStructure(oldNode, news[i]):
+				changes = append(changes, SymbolChange{Kind: SymbolModified, Symbol: symbol, Old: oldNode, New: news[i]})
+			}
+		}
+	}
+	for symbol, news := range newDecls {
+		for _, newNode := range news[min(len(oldDecls[symbol]), len(news)):] {
+			changes = append(changes, SymbolChange{Kind: SymbolAdded, Symbol: symbol, New: newNode})
+		}
+	}
+
+	slices.SortStableFunc(changes, func(a, b SymbolChange) int {
+		if c := strings.Compare(a.Symbol, b.Symbol); c != 0 {
+			return c
+		}
+		return int(a.Kind) - int(b.Kind)
+	})
+	return changes
+}
+
+// declarationsBySymbol groups a tree's declarations by qualified name, in
+// source order
+func declarationsBySymbol(u *UAST) map[string][]*Node {
+	decls := make(map[string][]*Node)
+	if u == nil {
+		return decls
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	walk(u.Root, func(node *Node, _ int) {
+		if node.HasRole(RoleDeclaration) {
+			symbol := QualifiedName(node)
+			decls[symbol] = append(decls[symbol], node)
+		}
+	})
+	return decls
+}
+
+// DiffOptions configures DiffBlobs and DiffRevisions
+type DiffOptions struct {
+	Parser    Parser     // Required
+	Converter *Converter // Defaults to NewConverter()
+	Language  string     // Defaults to detection from the path
+	Repo      string     // Git working directory for DiffRevisions, defaults to "."
+}
+
+// DiffBlobs parses and converts two versions of a file and compares them.
+// A nil blob stands for a file that doesn't exist in that version.
+func DiffBlobs(ctx context.Context, path string, oldSource, newSource []byte, opts DiffOptions) (*DiffReport, error) {
+	if opts.Parser == nil {
+		return nil, fmt.Errorf("parser cannot be nil")
+	}
+	converter := opts.Converter
+	if converter == nil {
+		converter = NewConverter()
+	}
+	language := opts.Language
+	if language == "" {
+		language = DetectLanguage(path)
+	}
+
+	report := &DiffReport{Path: path}
+	var err error
+	if report.Old, err = parseBlob(ctx, converter, opts.Parser, oldSource, language); err != nil {
+		return nil, fmt.Errorf("failed to convert old %s: %w", path, err)
+	}
+	if report.New, err = parseBlob(ctx, converter, opts.Parser, newSource, language); err != nil {
+		return nil, fmt.Errorf("failed to convert new %s: %w", path, err)
+	}
+	report.Changes = DiffUAST(report.Old, report.New)
+	return report, nil
+}
+
+// parseBlob parses and converts a blob, returning nil for a nil blob
+func parseBlob(ctx context.Context, converter *Converter, parser Parser, source []byte, language string) (*UAST, error) {
+	if source == nil {
+		return nil, nil
+	}
+	root, err := parser.Parse(ctx, source, language)
+	if err != nil {
+		return nil, err
+	}
+	return converter.Convert(root, language)
+}
+
+// DiffRevisions compares a file at two git revisions, such as "HEAD~1" and
+// "HEAD", reading the blobs with git show. A file missing from a revision
+// is treated as added or deleted. The path is relative to the repository.
+func DiffRevisions(ctx context.Context, path, oldRev, newRev string, opts DiffOptions) (*DiffReport, error) {
+	oldSource, err := gitShow(ctx, opts.Repo, oldRev, path)
+	if err != nil {
+		return nil, err
+	}
+	newSource, err := gitShow(ctx, opts.Repo, newRev, path)
+	if err != nil {
+		return nil, err
+	}
+	return DiffBlobs(ctx, path, oldSource, newSource, opts)
+}
+
+// gitShow returns the content of a file at a revision, or nil if the file
+// doesn't exist there
+func gitShow(ctx context.Context, repo, rev, path string) ([]byte, error) {
+	if repo == "" {
+		repo = "."
+	}
+	object := rev + ":" + filepath.ToSlash(path)
+
+	// Check for the file first so missing files aren't reported as errors
+	if err := exec.CommandContext(ctx, "git", "-C", repo, "cat-file", "-e", object).Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to run git: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "-C", repo, "show", object)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at %s: %w: %s", path, rev, err, strings.TrimSpace(stderr.String()))
+	}
+	if out == nil {
+		out = []byte{}
+	}
+	return out, nil
+}
@@ -0,0 +1,225 @@
+package uast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Summary describes the report's changes on one line, prefixed by the path
+func (r *DiffReport) Summary() string {
+	summary := SummarizeChanges(r.Changes)
+	if summary == "" {
+		return ""
+	}
+	return r.Path + ": " + summary
+}
+
+// SummarizeDiffs describes the changes of several reports, one file per
+// line, for uses such as generated pull request descriptions. Files without
+// structural changes are left out.
+func SummarizeDiffs(reports []*DiffReport) string {
+	var b strings.Builder
+	for _, report := range reports {
+		if summary := report.Summary(); summary != "" {
+			b.WriteString(summary)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// SummarizeChanges describes symbol changes compactly, such as
+// "Function Foo: 2 statements added in loop body; Class Bar: method Baz
+// removed". Changes to members are listed under their modified declaration.
+func SummarizeChanges(changes []SymbolChange) string {
+	modified := make(map[string]int) // Symbol -> index in parts
+	var parts []string
+	members := make(map[int][]string)
+
+	for _, change := range changes {
+		node := change.New
+		if node == nil {
+			node = change.Old
+		}
+		if change.Kind == SymbolModified {
+			modified[change.Symbol] = len(parts)
+			parts = append(parts, "")
+		}
+
+		// Changes to members belong to the enclosing declaration, if that
+		// was modified; added or removed declarations already cover theirs
+		if owner := enclosingDeclaration(node); owner != nil {
+			if index, ok := modified[QualifiedName(owner)]; ok {
+				members[index] = append(members[index], fmt.Sprintf("%s %s %s", kindWord(node), DeclarationName(node), change.Kind))
+				continue
+			}
+			if hasChange(changes, QualifiedName(owner)) {
+				continue
+			}
+		}
+
+		label := fmt.Sprintf("%s %s", node.Type, change.Symbol)
+		switch change.Kind {
+		case SymbolModified:
+			parts[modified[change.Symbol]] = label
+		default:
+			parts = append(parts, fmt.Sprintf("%s %s", label, change.Kind))
+		}
+	}
+
+	// Modified declarations are described by their member changes, or else
+	// by where their structure changed
+	for symbol, index := range modified {
+		details := members[index]
+		if len(details) == 0 {
+			for _, change := range changes {
+				if change.Kind == SymbolModified && change.Symbol == symbol {
+					details = describeEdit(change.Old, change.New)
+				}
+			}
+		}
+		if len(details) == 0 {
+			details = []string{"modified"}
+		}
+		parts[index] += ": " + strings.Join(details, ", ")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// enclosingDeclaration returns the nearest declaration above a node
+func enclosingDeclaration(node *Node) *Node {
+	for ancestor := range node.AncestorsWithRole(RoleDeclaration) {
+		return ancestor
+	}
+	return nil
+}
+
+// hasChange reports whether a symbol has any change
+func hasChange(changes []SymbolChange, symbol string) bool {
+	for _, change := range changes {
+		if change.Symbol == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// describeEdit describes how the structure of a node changed, such as
+// "2 statements added in loop body". Child sequences are aligned, and a
+// single child replaced by one of the same type is described from inside.
+func describeEdit(old, updated *Node) []string {
+	oldChildren, newChildren := structuralChildren(old), structuralChildren(updated)
+	if len(oldChildren) == 0 && len(newChildren) == 0 {
+		if old.Token != updated.Token {
+			return []string{kindWord(updated) + " changed in " + containerName(updated.Parent())}
+		}
+		return nil
+	}
+
+	var details []string
+	for _, gap := range alignChildren(oldChildren, newChildren) {
+		removed, added := gap.removed, gap.added
+		if len(removed) == 1 && len(added) == 1 && removed[0].Type == added[0].Type {
+			if inner := describeEdit(removed[0], added[0]); len(inner) > 0 {
+				details = append(details, inner...)
+				continue
+			}
+		}
+		if len(added) > 0 {
+			details = append(details, countNodes(added)+" added in "+containerName(updated))
+		}
+		if len(removed) > 0 {
+			details = append(details, countNodes(removed)+" removed from "+containerName(old))
+		}
+	}
+	return details
+}
+
+// childGap is a run of unmatched children between two aligned sequences
+type childGap struct {
+	removed, added []*Node
+}
+
+// alignChildren matches two child sequences by their longest common
+// subsequence of structurally equal nodes, returning the unmatched runs
+func alignChildren(old, updated []*Node) []childGap {
+	// lengths[i][j] is the LCS length of old[i:] and updated[j:]
+	lengths := make([][]int, len(old)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(updated)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(updated) - 1; j >= 0; j-- {
+			if sameStructure(old[i], updated[j]) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var gaps []childGap
+	var gap childGap
+	flush := func() {
+		if len(gap.removed) > 0 || len(gap.added) > 0 {
+			gaps = append(gaps, gap)
+			gap = childGap{}
+		}
+	}
+	i, j := 0, 0
+	for i < len(old) || j < len(updated) {
+		switch {
+		case i < len(old) && j < len(updated) && sameStructure(old[i], updated[j]):
+			flush()
+			i, j = i+1, j+1
+		case j == len(updated) || (i < len(old) && lengths[i+1][j] >= lengths[i][j+1]):
+			gap.removed = append(gap.removed, old[i])
+			i++
+		default:
+			gap.added = append(gap.added, updated[j])
+			j++
+		}
+	}
+	flush()
+	return gaps
+}
+
+// countNodes describes a run of nodes by count and type, such as
+// "2 statements" or "1 call and 1 loop"
+func countNodes(nodes []*Node) string {
+	var kinds []string
+	counts := make(map[string]int)
+	for _, node := range nodes {
+		kind := kindWord(node)
+		if counts[kind] == 0 {
+			kinds = append(kinds, kind)
+		}
+		counts[kind]++
+	}
+
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		word := kind
+		if counts[kind] != 1 {
+			word += "s"
+		}
+		parts[i] = fmt.Sprintf("%d %s", counts[kind], word)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// containerName names the place a change happened, such as "loop body"
+func containerName(node *Node) string {
+	if node == nil {
+		return "file"
+	}
+	if parent := node.Parent(); parent != nil && node.HasRole(RoleBody) {
+		return kindWord(parent) + " body"
+	}
+	return kindWord(node)
+}
+
+// kindWord returns the lower-case word for a node's type
+func kindWord(node *Node) string {
+	return strings.ToLower(string(node.Type))
+}
@@ -0,0 +1,39 @@
+package uast
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors matched by errors.Is, alongside ErrLimitExceeded for
+// decode limits
+var (
+	// ErrNilRoot reports a nil CST, or a UAST without a root node
+	ErrNilRoot = errors.New("root node cannot be nil")
+	// ErrDecode reports input that cannot be decoded, such as malformed JSON
+	ErrDecode = errors.New("failed to decode")
+	// ErrFrozen reports an in-place edit of a UAST made immutable by Freeze
+	ErrFrozen = errors.New("UAST is frozen")
+	// ErrInvalidNode reports a node that NewNode cannot construct
+	ErrInvalidNode = errors.New("invalid node")
+)
+
+// ConversionError reports a CST that could not be converted, and the node
+// at fault
+type ConversionError struct {
+	Node  *TreeSitterNode // nil if the fault is not at a single node
+	Cause error
+}
+
+// Error implements the error interface
+func (e *ConversionError) Error() string {
+	if e.Node == nil {
+		return fmt.Sprintf("failed to convert CST: %v", e.Cause)
+	}
+	return fmt.Sprintf("failed to convert %s node: %v", e.Node.Type, e.Cause)
+}
+
+// Unwrap returns the cause
+func (e *ConversionError) Unwrap() error {
+	return e.Cause
+}
@@ -136,12 +136,8 @@ func Example_parallelProcessing() {
 	// Structure:
 	// File
 	//   Function: hello [Declaration, Definition]
-	//     Unknown
-	//       Unknown: name
-	//     Unknown [Body]
-	//       Return: return
+	//     Return: return
 	//   Class: Example [Declaration, Definition]
-	//     Unknown: test
 }
 
 func Example_customLLMFormatting() {
@@ -0,0 +1,81 @@
+package uast
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// tokenFolder is the folder set with SetTokenFolder, if any
+var tokenFolder atomic.Pointer[func(string) string]
+
+// SetTokenFolder replaces how tokens are folded for FindByTokenFold, such as
+// with full Unicode case folding and normalization from golang.org/x/text,
+// or nil to restore the default simple case folding. Trees already folded
+// keep the index of the folder they were built with, so it should be set
+// before any are, typically in an init function.
+func SetTokenFolder(folder func(string) string) {
+	if folder == nil {
+		tokenFolder.Store(nil)
+		return
+	}
+	tokenFolder.Store(&folder)
+}
+
+// SetTokenFolding makes converted UASTs index their tokens case-folded and
+// normalized as well, as EnableTokenFolding does
+func (c *Converter) SetTokenFolding(enabled bool) {
+	c.foldTokens = enabled
+}
+
+// EnableTokenFolding also indexes tokens case-folded, for case-insensitive lookups with FindByTokenFold, and keeps that index up
+// to date through edits
+func (u *UAST) EnableTokenFolding() {
+	u.flushDirty()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.fold {
+		u.fold = true
+		u.buildIndicesLocked()
+	}
+}
+
+// FindByTokenFold returns all nodes whose token equals token when both are
+// case-folded, so "Begin" also finds "BEGIN" and "begin". It
+// returns nil unless token folding is enabled.
+func (u *UAST) FindByTokenFold(token string) []*Node {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if !u.fold {
+		return nil
+	}
+	if nodes, ok := u.FoldIndex[foldToken(token)]; ok {
+		return slices.Clone(nodes)
+	}
+	return []*Node{}
+}
+
+// foldToken returns the folded form of a token, under which tokens that
+// differ only in case are equal. By default each rune is replaced by the
+// smallest rune it simple-folds to, as in strings.EqualFold.
+func foldToken(token string) string {
+	if folder := tokenFolder.Load(); folder != nil {
+		return (*folder)(token)
+	}
+	return strings.Map(foldRune, token)
+}
+
+// foldRune returns the smallest rune of the case folding orbit of r
+func foldRune(r rune) rune {
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		folded = min(folded, f)
+	}
+	return folded
+}
@@ -0,0 +1,193 @@
+package uast
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Freeze makes the UAST immutable, so concurrent readers never see a partial
+// edit. Its edits then return ErrFrozen, and the With methods return edited
+// versions instead, which share every node but the edited one and its
+// ancestors with the UAST. Metadata can still be added.
+//
+// Shared nodes keep the parent links of the version they were first part of,
+// so Parent, Path and the queries built on them may lead into an earlier
+// version for nodes beside an edit.
+func (u *UAST) Freeze() {
+	u.flushDirty()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.frozen = true
+	u.indexedAs = nil
+}
+
+// Frozen reports whether the UAST is immutable
+func (u *UAST) Frozen() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return u.frozen
+}
+
+// WithReplaced returns a frozen version of the UAST in which old and its
+// subtree are replaced by replacement, which must consist of new nodes
+func (u *UAST) WithReplaced(old, replacement *Node) (*UAST, error) {
+	if replacement == nil {
+		return nil, fmt.Errorf("replacement cannot be nil")
+	}
+	return u.withEdit(old, func(*Node) (*Node, error) { return replacement, nil })
+}
+
+// WithEdited returns a frozen version of the UAST in which node is replaced by
+// a copy changed by edit, such as to set its token or a property. The copy
+// shares its children, roles, properties and annotations with node, so edit
+// must replace rather than modify them.
+func (u *UAST) WithEdited(node *Node, edit func(*Node)) (*UAST, error) {
+	return u.withEdit(node, func(node *Node) (*Node, error) {
+		edited := *node
+		edited.parent = nil
+		edit(&edited)
+		return &edited, nil
+	})
+}
+
+// WithInserted returns a frozen version of the UAST in which child, which
+// must consist of new nodes, is inserted into parent's children at index. A
+// negative index appends.
+func (u *UAST) WithInserted(parent *Node, index int, child *Node) (*UAST, error) {
+	if child == nil {
+		return nil, fmt.Errorf("child cannot be nil")
+	}
+	return u.withEdit(parent, func(parent *Node) (*Node, error) {
+		edited := *parent
+		edited.parent = nil
+		if index < 0 || index > len(parent.Children) {
+			index = len(parent.Children)
+		}
+		edited.Children = slices.Insert(slices.Clone(parent.Children), index, child)
+		return &edited, nil
+	})
+}
+
+// WithRemoved returns a frozen version of the UAST without node and its
+// subtree
+func (u *UAST) WithRemoved(node *Node) (*UAST, error) {
+	if node == nil {
+		return nil, fmt.Errorf("node cannot be nil")
+	}
+	if node == u.Root {
+		return nil, fmt.Errorf("cannot remove the root node")
+	}
+
+	u.mu.RLock()
+	path := pathTo(u.Root, node)
+	u.mu.RUnlock()
+	if len(path) < 2 {
+		return nil, fmt.Errorf("node is not part of this UAST")
+	}
+
+	return u.withEdit(path[len(path)-2], func(parent *Node) (*Node, error) {
+		edited := *parent
+		edited.parent = nil
+		edited.Children = slices.DeleteFunc(slices.Clone(parent.Children), func(child *Node) bool { return child == node })
+		return &edited, nil
+	})
+}
+
+// withEdit returns a frozen version of the UAST in which target is replaced
+// by the node edit returns, copying target's ancestors and sharing the rest
+func (u *UAST) withEdit(target *Node, edit func(*Node) (*Node, error)) (*UAST, error) {
+	if target == nil {
+		return nil, fmt.Errorf("node cannot be nil")
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if !u.frozen {
+		return nil, fmt.Errorf("UAST must be frozen to be edited by copy")
+	}
+	// Parent links of shared nodes may lead to another version, so the path
+	// is found from the root
+	path := pathTo(u.Root, target)
+	if path == nil {
+		return nil, fmt.Errorf("node is not part of this UAST")
+	}
+	replacement, err := edit(target)
+	if err != nil {
+		return nil, err
+	}
+	linkNewNodes(replacement)
+
+	for i := len(path) - 2; i >= 0; i-- {
+		parent := *path[i]
+		parent.parent = nil
+		parent.Children = slices.Clone(parent.Children)
+		parent.Children[slices.Index(parent.Children, path[i+1])] = replacement
+		replacement.parent = &parent
+		replacement = &parent
+	}
+
+	edited := &UAST{
+		Root:        replacement,
+		Language:    u.Language,
+		Metadata:    maps.Clone(u.Metadata),
+		Diagnostics: slices.Clone(u.Diagnostics),
+		frozen:      true,
+		fold:        u.fold,
+	}
+	if edited.Metadata == nil {
+		edited.Metadata = make(map[string]string)
+	}
+	edited.buildIndices()
+	return edited, nil
+}
+
+// pathTo returns the nodes from root down to target, or nil if target is not
+// in root's subtree
+func pathTo(root, target *Node) []*Node {
+	type entry struct {
+		node  *Node
+		depth int
+	}
+
+	var path []*Node
+	stack := []entry{{node: root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.node == nil {
+			continue
+		}
+
+		path = append(path[:top.depth], top.node)
+		if top.node == target {
+			return path
+		}
+		for i := len(top.node.Children) - 1; i >= 0; i-- {
+			stack = append(stack, entry{node: top.node.Children[i], depth: top.depth + 1})
+		}
+	}
+	return nil
+}
+
+// linkNewNodes links the new nodes of an edit to their parents. Nodes that
+// already have a parent are shared with another version, so they and their
+// subtrees are left alone.
+func linkNewNodes(root *Node) {
+	root.parent = nil
+	stack := []*Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range node.Children {
+			if child != nil && child.parent == nil {
+				child.parent = node
+				stack = append(stack, child)
+			}
+		}
+	}
+}
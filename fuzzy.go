@@ -0,0 +1,146 @@
+package uast
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// FuzzyMatch is a token found by FuzzyTokens; its nodes can be looked up
+// with FindByToken
+type FuzzyMatch struct {
+	Token     string
+	Distance  int  // Edit distance from the query, ignoring case
+	Substring bool // The token contains the query, ignoring case
+	Count     int  // Number of nodes with the token
+}
+
+// FuzzyTokens returns the indexed tokens that contain query or are within a
+// small edit distance of it, for "did you mean" suggestions. Matches are
+// ranked exact first, then containing the query, then by distance and by
+// how often they occur. A limit of zero or less returns every match.
+func (u *UAST) FuzzyTokens(query string, limit int) []FuzzyMatch {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	m := newFuzzyMatcher(query)
+	var matches []FuzzyMatch
+	for token, nodes := range u.TokenIndex {
+		if match, ok := m.match(token); ok {
+			match.Count = len(nodes)
+			matches = append(matches, match)
+		}
+	}
+	return rankFuzzyMatches(matches, limit)
+}
+
+// FuzzyTokens returns the tokens matching query across the workspace, as
+// UAST.FuzzyTokens does, with counts summed over the files
+func (w *Workspace) FuzzyTokens(query string, limit int) []FuzzyMatch {
+	byToken := make(map[string]FuzzyMatch)
+	for _, path := range w.Paths() {
+		u, ok := w.Get(path)
+		if !ok {
+			continue
+		}
+		for _, match := range u.FuzzyTokens(query, 0) {
+			match.Count += byToken[match.Token].Count
+			byToken[match.Token] = match
+		}
+	}
+
+	matches := make([]FuzzyMatch, 0, len(byToken))
+	for _, match := range byToken {
+		matches = append(matches, match)
+	}
+	return rankFuzzyMatches(matches, limit)
+}
+
+// rankFuzzyMatches sorts matches best first and keeps up to limit of them
+func rankFuzzyMatches(matches []FuzzyMatch, limit int) []FuzzyMatch {
+	slices.SortFunc(matches, func(a, b FuzzyMatch) int {
+		if c := cmp.Compare(min(a.Distance, 1), min(b.Distance, 1)); c != 0 {
+			return c
+		}
+		if a.Substring != b.Substring {
+			if a.Substring {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(
+			cmp.Compare(a.Distance, b.Distance),
+			cmp.Compare(b.Count, a.Count),
+			cmp.Compare(a.Token, b.Token),
+		)
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// fuzzyMatcher compares tokens against a query
+type fuzzyMatcher struct {
+	query       []rune
+	lower       string
+	maxDistance int // Tokens further away must contain the query
+}
+
+// newFuzzyMatcher creates a matcher for query
+func newFuzzyMatcher(query string) *fuzzyMatcher {
+	lower := strings.ToLower(query)
+	runes := []rune(lower)
+	return &fuzzyMatcher{query: runes, lower: lower, maxDistance: max(1, len(runes)/3)}
+}
+
+// match reports whether token matches the query, and how closely
+func (m *fuzzyMatcher) match(token string) (FuzzyMatch, bool) {
+	if len(m.query) == 0 {
+		return FuzzyMatch{}, false
+	}
+
+	lower := strings.ToLower(token)
+	runes := []rune(lower)
+	substring := strings.Contains(lower, m.lower)
+	if !substring && abs(len(runes)-len(m.query)) > m.maxDistance {
+		return FuzzyMatch{}, false
+	}
+
+	distance := editDistance(m.query, runes)
+	if !substring && distance > m.maxDistance {
+		return FuzzyMatch{}, false
+	}
+	return FuzzyMatch{Token: token, Distance: distance, Substring: substring}, true
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,105 @@
+package uast
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// IDStrategy determines how the Converter assigns node IDs
+type IDStrategy int
+
+const (
+	// SequentialIDs assigns increasing integers in conversion order
+	SequentialIDs IDStrategy = iota
+	// ContentHashIDs derives IDs from a hash of the node's type, location,
+	// token and child IDs, so identical code yields identical IDs across runs
+	ContentHashIDs
+)
+
+// contentHashIDLength is the number of hex characters kept from the hash
+const contentHashIDLength = 16
+
+// contentHashID computes a stable ID for a node whose children already have IDs
+func contentHashID(tsType string, node *Node) string {
+	h := sha256.New()
+
+	writeString := func(s string) {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(s)))
+		h.Write(length[:])
+		h.Write([]byte(s))
+	}
+
+	writeString(tsType)
+	writeString(node.Token)
+
+	if node.Location != nil {
+		var pos [16]byte
+		binary.BigEndian.PutUint32(pos[0:], node.Location.Start.Line)
+		binary.BigEndian.PutUint32(pos[4:], node.Location.Start.Column)
+		binary.BigEndian.PutUint32(pos[8:], node.Location.End.Line)
+		binary.BigEndian.PutUint32(pos[12:], node.Location.End.Column)
+		h.Write(pos[:])
+	}
+
+	for _, child := range node.Children {
+		writeString(child.ID)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:contentHashIDLength]
+}
+
+// IDGenerator produces node IDs during conversion. NewID is called once per
+// node, before its children are converted. Type, Token, Roles and Location
+// are set by then, as are the properties conversion records, such as ts_type
+// and folded_tokens; Children and properties added after conversion are not.
+// Implementations must be safe for concurrent use, since children may be
+// converted in parallel.
+type IDGenerator interface {
+	NewID(node *Node) string
+}
+
+// IDGeneratorFunc adapts an ordinary function to the IDGenerator interface
+type IDGeneratorFunc func(node *Node) string
+
+// NewID calls f(node)
+func (f IDGeneratorFunc) NewID(node *Node) string {
+	return f(node)
+}
+
+// UUIDGenerator generates random version 4 UUIDs
+type UUIDGenerator struct{}
+
+// NewID returns a new random UUID
+func (UUIDGenerator) NewID(*Node) string {
+	var b [16]byte
+	rand.Read(b[:]) // Never returns an error
+
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// PrefixedIDGenerator generates sequential IDs with a fixed prefix, such as
+// "main.go#42", so IDs from different files do not collide
+type PrefixedIDGenerator struct {
+	Prefix  string
+	counter uint64
+}
+
+// NewPrefixedIDGenerator creates a PrefixedIDGenerator for the given prefix
+func NewPrefixedIDGenerator(prefix string) *PrefixedIDGenerator {
+	return &PrefixedIDGenerator{Prefix: prefix}
+}
+
+// NewID returns the prefix followed by the next sequence number
+func (g *PrefixedIDGenerator) NewID(*Node) string {
+	id := atomic.AddUint64(&g.counter, 1)
+	return g.Prefix + "#" + strconv.FormatUint(id, 10)
+}
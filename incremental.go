@@ -0,0 +1,263 @@
+package uast
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// InputEdit describes an edit to the source, as in tree-sitter's
+// TSInputEdit. Points are 0-based [row, column] pairs.
+type InputEdit struct {
+	StartByte   int    `json:"startByte"`
+	OldEndByte  int    `json:"oldEndByte"`
+	NewEndByte  int    `json:"newEndByte"`
+	StartPoint  [2]int `json:"startPoint"`
+	OldEndPoint [2]int `json:"oldEndPoint"`
+	NewEndPoint [2]int `json:"newEndPoint"`
+}
+
+// shiftPoint maps a point before the edit to itself and a point after the
+// old end of the edit to its new position
+func (e InputEdit) shiftPoint(point [2]int) [2]int {
+	if comparePoints(point, e.StartPoint) < 0 {
+		return point
+	}
+	if point[0] == e.OldEndPoint[0] {
+		return [2]int{e.NewEndPoint[0], point[1] - e.OldEndPoint[1] + e.NewEndPoint[1]}
+	}
+	return [2]int{point[0] - e.OldEndPoint[0] + e.NewEndPoint[0], point[1]}
+}
+
+// shiftByte maps a byte offset the same way as shiftPoint
+func (e InputEdit) shiftByte(offset int) int {
+	if offset < e.StartByte {
+		return offset
+	}
+	return offset - e.OldEndByte + e.NewEndByte
+}
+
+// touches reports whether a span overlaps or borders the edited range
+func (e InputEdit) touches(start, end [2]int) bool {
+	return comparePoints(start, e.OldEndPoint) <= 0 && comparePoints(end, e.StartPoint) >= 0
+}
+
+// comparePoints orders 0-based points
+func comparePoints(a, b [2]int) int {
+	if a[0] != b[0] {
+		return a[0] - b[0]
+	}
+	return a[1] - b[1]
+}
+
+// reuseKey identifies a node by its CST type and its span after the edits
+type reuseKey struct {
+	tsType string
+	loc    Location
+}
+
+// ConvertIncremental converts the CST of edited source, reusing the subtrees
+// of prev that the edits don't touch. The edits are those applied to the
+// source since prev was converted, in order, as passed to tree-sitter before
+// reparsing. Reused nodes keep their IDs and get their positions shifted, so
+// prev must not be used afterwards. prev must come from a converter with the
+// same configuration; with Simplify enabled fewer subtrees can be matched.
+func (c *Converter) ConvertIncremental(prev *UAST, root *TreeSitterNode, edits []InputEdit) (*UAST, error) {
+	if prev == nil {
+		return nil, fmt.Errorf("previous UAST cannot be nil")
+	}
+	if root == nil {
+		return nil, ErrNilRoot
+	}
+	var counts *conversionCounts
+	var start time.Time
+	if c.conversionStats {
+		counts, start = new(conversionCounts), time.Now()
+	}
+
+	done := c.phase(PhaseCheck)
+	faults, diagnostics, err := c.checkInput(root)
+	done()
+	if err != nil {
+		return nil, err
+	}
+
+	prev.mu.Lock()
+	reusable := reusableSubtrees(prev.Root, edits)
+	language := prev.Language
+	if c.idGenerator == nil && c.idStrategy == SequentialIDs {
+		c.skipPastIDs(prev.Root)
+	}
+	prev.mu.Unlock()
+
+	// reuse returns the old subtree matching a CST node, moved to its new position
+	reuse := func(tsNode *TreeSitterNode, parent *Node) *Node {
+		if faults[tsNode] != nil {
+			return nil
+		}
+		node, ok := reusable[reuseKey{tsNode.Type, tsLocation(tsNode)}]
+		if !ok {
+			return nil
+		}
+		delete(reusable, reuseKey{tsNode.Type, tsLocation(tsNode)})
+
+		walk(node, func(n *Node, _ int) { shiftNode(n, edits) })
+		// Roles can depend on the parent, which may have changed
+		node.Roles = c.roleRules.infer(node.Type, tsNode, parent)
+		for _, role := range registeredRoles(node.Type) {
+			addRole(node, role)
+		}
+		return node
+	}
+
+	type frame struct {
+		node     *Node
+		children []*TreeSitterNode
+		next     int
+	}
+
+	done = c.phase(PhaseConvert)
+	uastRoot := reuse(root, nil)
+	if uastRoot == nil {
+		var children []*TreeSitterNode
+		uastRoot, children = c.newNode(root, nil, nil, faults)
+		stack := []frame{{uastRoot, children, 0}}
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.next == len(top.children) {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			child := top.children[top.next]
+			top.next++
+			if child == nil {
+				continue
+			}
+
+			if node := reuse(child, top.node); node != nil {
+				top.node.Children = append(top.node.Children, node)
+				continue
+			}
+			node, grandchildren := c.newNode(child, top.node, nil, faults)
+			top.node.Children = append(top.node.Children, node)
+			stack = append(stack, frame{node, grandchildren, 0})
+		}
+	}
+
+	if c.idGenerator == nil && c.idStrategy == ContentHashIDs {
+		// Hashes cover locations, so shifted nodes need new IDs too
+		rehashIDs(uastRoot)
+	}
+	done()
+
+	return c.finish(uastRoot, language, diagnostics, start, counts), nil
+}
+
+// reusableSubtrees indexes the outermost subtrees of root that no edit
+// touches, keyed by their span after the edits
+func reusableSubtrees(root *Node, edits []InputEdit) map[reuseKey]*Node {
+	reusable := make(map[reuseKey]*Node)
+	if root == nil {
+		return reusable
+	}
+
+	stack := []*Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if node.Location == nil {
+			continue
+		}
+		start, end := toPoint(node.Location.Start), toPoint(node.Location.End)
+		touched := false
+		for _, edit := range edits {
+			if edit.touches(start, end) {
+				touched = true
+				break
+			}
+			start, end = edit.shiftPoint(start), edit.shiftPoint(end)
+		}
+
+		if !touched {
+			key := reuseKey{node.Properties["ts_type"], Location{Start: fromPoint(start), End: fromPoint(end)}}
+			reusable[key] = node
+			continue
+		}
+		for _, child := range node.Children {
+			if child != nil {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return reusable
+}
+
+// shiftNode moves a node's positions and byte offsets through the edits
+func shiftNode(node *Node, edits []InputEdit) {
+	shift := func(loc *Location) {
+		if loc == nil {
+			return
+		}
+		start, end := toPoint(loc.Start), toPoint(loc.End)
+		for _, edit := range edits {
+			start, end = edit.shiftPoint(start), edit.shiftPoint(end)
+		}
+		loc.Start, loc.End = fromPoint(start), fromPoint(end)
+	}
+	shift(node.Location)
+	shift(node.NameLocation)
+
+	for _, key := range []string{"start_byte", "end_byte"} {
+		text, ok := node.Properties[key]
+		if !ok {
+			continue
+		}
+		offset, err := strconv.Atoi(text)
+		if err != nil {
+			continue
+		}
+		for _, edit := range edits {
+			offset = edit.shiftByte(offset)
+		}
+		node.Properties[key] = strconv.Itoa(offset)
+	}
+}
+
+// skipPastIDs advances the sequential ID counter past the numeric IDs in a
+// tree, so new nodes don't collide with reused ones
+func (c *Converter) skipPastIDs(root *Node) {
+	var highest uint64
+	walk(root, func(node *Node, _ int) {
+		if id, err := strconv.ParseUint(node.ID, 10, 64); err == nil && id > highest {
+			highest = id
+		}
+	})
+	for {
+		current := atomic.LoadUint64(&c.nodeIDCounter)
+		if current >= highest || atomic.CompareAndSwapUint64(&c.nodeIDCounter, current, highest) {
+			return
+		}
+	}
+}
+
+// rehashIDs recomputes content hash IDs bottom-up
+func rehashIDs(root *Node) {
+	var order []*Node
+	walk(root, func(node *Node, _ int) { order = append(order, node) })
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		node.ID = contentHashID(node.Properties["ts_type"], node)
+	}
+}
+
+// toPoint converts a 1-based position to a 0-based point
+func toPoint(pos Position) [2]int {
+	return [2]int{int(pos.Line) - 1, int(pos.Column) - 1}
+}
+
+// fromPoint converts a 0-based point to a 1-based position
+func fromPoint(point [2]int) Position {
+	return Position{Line: uint32(point[0] + 1), Column: uint32(point[1] + 1)}
+}
@@ -0,0 +1,139 @@
+package uast
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// parallelIndexMinChildren is the minimum fan-out at which index construction
+// is split across goroutines
+const parallelIndexMinChildren = 8
+
+// indexConfig selects what building an indexSet does besides indexing types,
+// tokens and roles
+type indexConfig struct {
+	linkParents bool // Unset for frozen trees, whose nodes may be shared
+	foldTokens  bool // Also index tokens by their folded form
+}
+
+// indexSet holds the lookup indices of a UAST or of a part of it
+type indexSet struct {
+	types  map[NodeType][]*Node
+	tokens map[string][]*Node
+	roles  map[Role][]*Node
+	folded map[string][]*Node // nil unless foldTokens is set
+	indexConfig
+}
+
+// newIndexSet creates an empty indexSet
+func newIndexSet(config indexConfig) *indexSet {
+	set := &indexSet{
+		types:       make(map[NodeType][]*Node),
+		tokens:      make(map[string][]*Node),
+		roles:       make(map[Role][]*Node),
+		indexConfig: config,
+	}
+	if config.foldTokens {
+		set.folded = make(map[string][]*Node)
+	}
+	return set
+}
+
+// add indexes a single node and links its children to it
+func (s *indexSet) add(node *Node) {
+	s.types[node.Type] = append(s.types[node.Type], node)
+
+	if node.Token != "" {
+		s.tokens[node.Token] = append(s.tokens[node.Token], node)
+		if s.foldTokens {
+			folded := foldToken(node.Token)
+			s.folded[folded] = append(s.folded[folded], node)
+		}
+	}
+	for i, role := range node.Roles {
+		if !slices.Contains(node.Roles[:i], role) {
+			s.roles[role] = append(s.roles[role], node)
+		}
+	}
+
+	if !s.linkParents {
+		return
+	}
+	for _, child := range node.Children {
+		if child != nil {
+			child.parent = node
+		}
+	}
+}
+
+// merge appends the entries of other after the entries already in s
+func (s *indexSet) merge(other *indexSet) {
+	for nodeType, nodes := range other.types {
+		s.types[nodeType] = append(s.types[nodeType], nodes...)
+	}
+	for token, nodes := range other.tokens {
+		s.tokens[token] = append(s.tokens[token], nodes...)
+	}
+	for role, nodes := range other.roles {
+		s.roles[role] = append(s.roles[role], nodes...)
+	}
+	for folded, nodes := range other.folded {
+		s.folded[folded] = append(s.folded[folded], nodes...)
+	}
+}
+
+// buildIndexSet indexes the subtree rooted at root in pre-order. Wide trees
+// are partitioned into contiguous runs of children that are indexed
+// concurrently and merged in order, so the result matches a sequential walk.
+func buildIndexSet(root *Node, config indexConfig) *indexSet {
+	set := newIndexSet(config)
+	if root != nil && config.linkParents {
+		root.parent = nil
+	}
+
+	// Index the single-child chain above the first wide node directly
+	split := root
+	for split != nil && len(split.Children) == 1 {
+		set.add(split)
+		split = split.Children[0]
+	}
+	if split == nil {
+		return set
+	}
+
+	workers := min(runtime.GOMAXPROCS(0), len(split.Children))
+	if len(split.Children) < parallelIndexMinChildren || workers < 2 {
+		walk(split, func(node *Node, _ int) { set.add(node) })
+		return set
+	}
+
+	set.add(split)
+
+	parts := make([]*indexSet, workers)
+	chunk := (len(split.Children) + workers - 1) / workers
+	var wg sync.WaitGroup
+
+	for w := range parts {
+		start := min(w*chunk, len(split.Children))
+		end := min(start+chunk, len(split.Children))
+
+		wg.Add(1)
+		go func(w int, children []*Node) {
+			defer wg.Done()
+
+			part := newIndexSet(config)
+			for _, child := range children {
+				walk(child, func(node *Node, _ int) { part.add(node) })
+			}
+			parts[w] = part
+		}(w, split.Children[start:end])
+	}
+
+	wg.Wait()
+
+	for _, part := range parts {
+		set.merge(part)
+	}
+	return set
+}
@@ -0,0 +1,113 @@
+package uast
+
+import (
+	"fmt"
+	"slices"
+)
+
+// languageProperty tags the root of an embedded subtree with its language
+const languageProperty = "language"
+
+// Inject attaches the tree of source embedded in another language, such as a
+// script element in HTML, a fenced code block in Markdown or SQL in a string,
+// as the last child of host. The injected tree should be converted on its own
+// with its language's profile. Its root is tagged with its language, its node
+// IDs get the host's ID as a prefix so they stay unique, and its diagnostics
+// are added to u's.
+//
+// origin is the 1-based host position where the embedded source starts, and
+// injected locations are shifted from it; pass the zero Position if they are
+// already host positions. Byte offset properties are left relative to the
+// embedded source. The injected tree must not be used afterwards.
+func (u *UAST) Inject(host *Node, injected *UAST, origin Position) error {
+	if host == nil {
+		return fmt.Errorf("host cannot be nil")
+	}
+	if injected == nil || injected.Root == nil {
+		return fmt.Errorf("failed to inject UAST: %w", ErrNilRoot)
+	}
+	if injected.Frozen() {
+		return fmt.Errorf("failed to inject UAST: %w", ErrFrozen)
+	}
+	if injected.Language == "" {
+		return fmt.Errorf("injected UAST has no language")
+	}
+
+	root := injected.Root
+	if err := u.AppendChild(host, root); err != nil {
+		return fmt.Errorf("failed to inject %s: %w", injected.Language, err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	ids := make(map[string]string)
+	walk(root, func(node *Node, _ int) {
+		if origin != (Position{}) {
+			shiftInjected(node.Location, origin)
+			shiftInjected(node.NameLocation, origin)
+		}
+		if node.ID != "" {
+			ids[node.ID] = host.ID + ":" + node.ID
+			node.ID = ids[node.ID]
+		}
+	})
+	root.SetProperty(languageProperty, injected.Language)
+
+	for _, diagnostic := range injected.Diagnostics {
+		if diagnostic.NodeID != "" {
+			diagnostic.NodeID = ids[diagnostic.NodeID]
+		}
+		u.Diagnostics = append(u.Diagnostics, diagnostic)
+	}
+	return nil
+}
+
+// shiftInjected moves a location relative to an embedded source's start to
+// the host position origin
+func shiftInjected(loc *Location, origin Position) {
+	if loc == nil {
+		return
+	}
+	for _, pos := range []*Position{&loc.Start, &loc.End} {
+		if pos.Line == 1 {
+			pos.Column += origin.Column - 1
+		}
+		pos.Line += origin.Line - 1
+	}
+}
+
+// LanguageOf returns the language of a node: that of the innermost injected
+// subtree containing it, or the UAST's language
+func (u *UAST) LanguageOf(node *Node) string {
+	for ; node != nil; node = node.Parent() {
+		if language, ok := node.Properties[languageProperty]; ok {
+			return language
+		}
+	}
+	return u.Language
+}
+
+// Languages returns the UAST's language, if it has one, followed by those of
+// its tagged subtrees, in tree order and without duplicates
+func (u *UAST) Languages() []string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var languages []string
+	if u.Language != "" {
+		languages = append(languages, u.Language)
+	}
+	walk(u.Root, func(node *Node, _ int) {
+		if language, ok := node.Properties[languageProperty]; ok && !slices.Contains(languages, language) {
+			languages = append(languages, language)
+		}
+	})
+	return languages
+}
+
+// FindByTypeInLanguage returns the nodes of a type written in a language,
+// such as the Functions of the JavaScript embedded in an HTML file
+func (u *UAST) FindByTypeInLanguage(language string, nodeType NodeType) []*Node {
+	return u.Query().Type(nodeType).Where(func(node *Node) bool { return u.LanguageOf(node) == language }).All()
+}
@@ -0,0 +1,77 @@
+package uast
+
+import "iter"
+
+// Descendants iterates over the nodes below n in pre-order. Like walk, it
+// uses an explicit stack, so deep subtrees don't exhaust the call stack.
+func (n *Node) Descendants() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		stack := make([]*Node, 0, 32)
+		for i := len(n.Children) - 1; i >= 0; i-- {
+			if child := n.Children[i]; child != nil {
+				stack = append(stack, child)
+			}
+		}
+
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if !yield(node) {
+				return
+			}
+			for i := len(node.Children) - 1; i >= 0; i-- {
+				if child := node.Children[i]; child != nil {
+					stack = append(stack, child)
+				}
+			}
+		}
+	}
+}
+
+// DescendantsOfType iterates over the nodes of the given type below n in
+// pre-order
+func (n *Node) DescendantsOfType(nodeType NodeType) iter.Seq[*Node] {
+	return filterNodes(n.Descendants(), func(node *Node) bool { return node.Type == nodeType })
+}
+
+// DescendantsWithRole iterates over the nodes with the given role below n in
+// pre-order
+func (n *Node) DescendantsWithRole(role Role) iter.Seq[*Node] {
+	return filterNodes(n.Descendants(), func(node *Node) bool { return node.HasRole(role) })
+}
+
+// Ancestors iterates over the ancestors of n, from its parent up to the
+// root. Parent links are maintained by the UAST that indexes the node.
+func (n *Node) Ancestors() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for node := n.parent; node != nil; node = node.parent {
+			if !yield(node) {
+				return
+			}
+		}
+	}
+}
+
+// AncestorsOfType iterates over the ancestors of n with the given type,
+// nearest first
+func (n *Node) AncestorsOfType(nodeType NodeType) iter.Seq[*Node] {
+	return filterNodes(n.Ancestors(), func(node *Node) bool { return node.Type == nodeType })
+}
+
+// AncestorsWithRole iterates over the ancestors of n with the given role,
+// nearest first
+func (n *Node) AncestorsWithRole(role Role) iter.Seq[*Node] {
+	return filterNodes(n.Ancestors(), func(node *Node) bool { return node.HasRole(role) })
+}
+
+// filterNodes returns the nodes of seq satisfying keep
+func filterNodes(seq iter.Seq[*Node], keep func(*Node) bool) iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for node := range seq {
+			if keep(node) && !yield(node) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package uast
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// decodeBufferPool recycles input buffers between limited decodes
+var decodeBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// ErrLimitExceeded is matched by errors.Is for every LimitError
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// LimitError reports which decode limit was exceeded
+type LimitError struct {
+	Limit string // "MaxBytes", "MaxDepth", "MaxNodes" or "MaxTextLen"
+	Max   int
+}
+
+// Error implements the error interface
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d exceeded", e.Limit, e.Max)
+}
+
+// Is reports whether target is ErrLimitExceeded
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// DecodeLimits bounds the resources used when decoding untrusted CSTs.
+// Zero values mean no limit.
+type DecodeLimits struct {
+	MaxBytes   int // Maximum size of the JSON input
+	MaxDepth   int // Maximum nesting depth of nodes
+	MaxNodes   int // Maximum total number of nodes
+	MaxTextLen int // Maximum length of any string value
+}
+
+// DefaultDecodeLimits returns conservative limits suitable for untrusted input
+func DefaultDecodeLimits() DecodeLimits {
+	return DecodeLimits{
+		MaxBytes:   64 << 20,
+		MaxDepth:   5000,
+		MaxNodes:   1_000_000,
+		MaxTextLen: 1 << 20,
+	}
+}
+
+// LoadTreeSitterCSTWithLimits loads a Tree-sitter CST from a JSON file,
+// enforcing the given limits
+func LoadTreeSitterCSTWithLimits(filename string, limits DecodeLimits) (*TreeSitterNode, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return DecodeTreeSitterCSTWithLimits(file, limits)
+}
+
+// DecodeTreeSitterCSTWithLimits decodes a Tree-sitter CST from a reader,
+// returning a *LimitError if the input exceeds any of the limits. The input is
+// validated with a streaming scan before any nodes are allocated.
+func DecodeTreeSitterCSTWithLimits(r io.Reader, limits DecodeLimits) (*TreeSitterNode, error) {
+	if r == nil {
+		return nil, fmt.Errorf("reader cannot be nil")
+	}
+
+	if limits.MaxBytes > 0 {
+		r = io.LimitReader(r, int64(limits.MaxBytes)+1)
+	}
+
+	buf := decodeBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		decodeBufferPool.Put(buf)
+	}()
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	data := buf.Bytes()
+	if limits.MaxBytes > 0 && len(data) > limits.MaxBytes {
+		return nil, &LimitError{Limit: "MaxBytes", Max: limits.MaxBytes}
+	}
+
+	if err := checkDecodeLimits(data, limits); err != nil {
+		return nil, err
+	}
+
+	return DecodeTreeSitterCST(bytes.NewReader(data))
+}
+
+// checkDecodeLimits scans the JSON tokens, counting objects as nodes
+func checkDecodeLimits(data []byte, limits DecodeLimits) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	depth, nodes := 0, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w JSON: %w", ErrDecode, err)
+		}
+
+		switch v := token.(type) {
+		case json.Delim:
+			switch v {
+			case '{':
+				depth++
+				nodes++
+				if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+					return &LimitError{Limit: "MaxDepth", Max: limits.MaxDepth}
+				}
+				if limits.MaxNodes > 0 && nodes > limits.MaxNodes {
+					return &LimitError{Limit: "MaxNodes", Max: limits.MaxNodes}
+				}
+			case '}':
+				depth--
+			}
+		case string:
+			if limits.MaxTextLen > 0 && len(v) > limits.MaxTextLen {
+				return &LimitError{Limit: "MaxTextLen", Max: limits.MaxTextLen}
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package uast
+
+import "sort"
+
+// LineIndex converts between byte offsets into a source and the 1-based
+// line and column positions of UAST locations. Columns count bytes, as
+// Tree-sitter's do. A source ending in a newline has an empty last line.
+type LineIndex struct {
+	source []byte
+	starts []int // Offset of the first byte of each line
+}
+
+// NewLineIndex indexes the lines of source, which must not change afterwards
+func NewLineIndex(source []byte) *LineIndex {
+	starts := []int{0}
+	for i, b := range source {
+		if b == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &LineIndex{source: source, starts: starts}
+}
+
+// LineCount returns the number of lines
+func (li *LineIndex) LineCount() int {
+	return len(li.starts)
+}
+
+// lineEnd returns the offset of the end of a 1-based line, before its newline
+func (li *LineIndex) lineEnd(line int) int {
+	if line < len(li.starts) {
+		return li.starts[line] - 1
+	}
+	return len(li.source)
+}
+
+// OffsetToPosition returns the position of a byte offset, which may be the
+// length of the source to mean its end. ok is false for offsets outside it.
+func (li *LineIndex) OffsetToPosition(offset int) (pos Position, ok bool) {
+	if offset < 0 || offset > len(li.source) {
+		return Position{}, false
+	}
+	line := sort.Search(len(li.starts), func(i int) bool { return li.starts[i] > offset })
+	return Position{Line: uint32(line), Column: uint32(offset-li.starts[line-1]) + 1}, true
+}
+
+// PositionToOffset returns the byte offset of a position. The column may be
+// one past the end of its line, as the end of a location often is. ok is
+// false for positions outside the source.
+func (li *LineIndex) PositionToOffset(pos Position) (offset int, ok bool) {
+	line, column := int(pos.Line), int(pos.Column)
+	if line < 1 || line > len(li.starts) || column < 1 {
+		return 0, false
+	}
+	offset = li.starts[line-1] + column - 1
+	if offset > li.lineEnd(line) {
+		return 0, false
+	}
+	return offset, true
+}
+
+// Slice returns the source a location spans, reporting false if it lies
+// outside the source or ends before it starts
+func (li *LineIndex) Slice(loc Location) ([]byte, bool) {
+	start, ok := li.PositionToOffset(loc.Start)
+	if !ok {
+		return nil, false
+	}
+	end, ok := li.PositionToOffset(loc.End)
+	if !ok || end < start {
+		return nil, false
+	}
+	return li.source[start:end], true
+}
+
+// Lines returns the source of the 1-based lines first to last, without the
+// newline ending the last, reporting false if any is outside the source
+func (li *LineIndex) Lines(first, last uint32) ([]byte, bool) {
+	if first < 1 || last < first || int(last) > len(li.starts) {
+		return nil, false
+	}
+	return li.source[li.starts[first-1]:li.lineEnd(int(last))], true
+}
+
+// Line returns the source of a 1-based line without its newline
+func (li *LineIndex) Line(line uint32) ([]byte, bool) {
+	return li.Lines(line, line)
+}
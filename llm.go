@@ -1,7 +1,10 @@
 package uast
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"maps"
 	"strings"
 )
 
@@ -10,10 +13,15 @@ type LLMProcessor struct {
 	MaxTokensPerNode    int
 	MaxTotalTokens      int
 	IncludeLocations    bool
-	SimplifyNestedNodes bool
+	SimplifyNestedNodes bool // Collapse wrapper chains and summarize long runs of siblings
 	PrioritizeTypes     []NodeType
 	ExcludeTypes        []NodeType
 	format              LLMFormat
+	summarizer          Summarizer
+	summaries           *summaryCache
+	tokenizer           Tokenizer
+	typeWeights         map[NodeType]int
+	typeFormatters      map[NodeType]func(*Node) string
 }
 
 // SetPrioritizeTypes sets the node types to prioritize during processing
@@ -39,6 +47,20 @@ func NewLLMProcessor() *LLMProcessor {
 	}
 }
 
+// RegisterTypeFormatter sets how nodes of a type render, such as calls as
+// one-line signatures. The text replaces the node and its subtree: formats
+// show it as the node's token, and the default output as its line.
+func (p *LLMProcessor) RegisterTypeFormatter(nodeType NodeType, formatter func(*Node) string) {
+	if formatter == nil {
+		delete(p.typeFormatters, nodeType)
+		return
+	}
+	if p.typeFormatters == nil {
+		p.typeFormatters = make(map[NodeType]func(*Node) string)
+	}
+	p.typeFormatters[nodeType] = formatter
+}
+
 // SetFormat sets the format for the LLMProcessor
 func (p *LLMProcessor) SetFormat(format LLMFormat) {
 	p.format = format
@@ -46,17 +68,114 @@ func (p *LLMProcessor) SetFormat(format LLMFormat) {
 
 // Process processes the UAST for LLM consumption
 func (p *LLMProcessor) Process(uast *UAST) (string, error) {
+	return p.ProcessContext(context.Background(), uast)
+}
+
+// ProcessTo writes the processed UAST to w. Output is streamed by a
+// StreamingFormat when there is no MaxTotalTokens to measure it against.
+func (p *LLMProcessor) ProcessTo(ctx context.Context, w io.Writer, uast *UAST) error {
+	if f, ok := p.format.(StreamingFormat); ok && p.MaxTotalTokens <= 0 {
+		if uast == nil || uast.Root == nil {
+			return fmt.Errorf("failed to process UAST: %w", ErrNilRoot)
+		}
+		return f.FormatTo(w, p.view(uast))
+	}
+
+	text, err := p.ProcessContext(ctx, uast)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, text); err != nil {
+		return fmt.Errorf("failed to write processed UAST: %w", err)
+	}
+	return nil
+}
+
+// process formats the UAST without summarizing it, eliding subtrees of
+// over-budget output if elide is set
+func (p *LLMProcessor) process(uast *UAST, elide bool) (string, error) {
 	if uast == nil || uast.Root == nil {
-		return "", fmt.Errorf("UAST or root node cannot be nil")
+		return "", fmt.Errorf("failed to process UAST: %w", ErrNilRoot)
+	}
+
+	if p.format == nil {
+		return p.processDefault(uast)
+	}
+
+	// The format renders a view of the tree reflecting the settings, with
+	// the least important subtrees elided if it is over budget
+	view := p.view(uast)
+	text, err := p.format.Format(view)
+	if err != nil || !elide || p.MaxTotalTokens <= 0 || p.countTokens(text) <= p.MaxTotalTokens {
+		return text, err
+	}
+	return p.elide(view, text)
+}
+
+// countTokens measures text with the processor's tokenizer
+func (p *LLMProcessor) countTokens(text string) int {
+	if p.tokenizer == nil {
+		return ApproxTokenizer{}.CountTokens(text)
+	}
+	return p.tokenizer.CountTokens(text)
+}
+
+// tokenTruncation returns the truncation cutting tokens to MaxTokensPerNode
+// runes, with no limit if it is not positive
+func (p *LLMProcessor) tokenTruncation() Truncation {
+	if p.MaxTokensPerNode <= 0 {
+		return Truncation{MaxTokenLength: -1}
 	}
+	return Truncation{MaxTokenLength: p.MaxTokensPerNode}
+}
 
-	// If we have a format set, use it directly
-	if p.format != nil {
-		return p.format.Format(uast)
+// view returns a copy of the UAST for a format to render, without nodes of
+// the excluded types and with tokens cut to MaxTokensPerNode. The children
+// of excluded nodes take their place, and with SimplifyNestedNodes wrapper
+// chains are collapsed and long runs of siblings summarized.
+func (p *LLMProcessor) view(u *UAST) *UAST {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	truncation := p.tokenTruncation()
+
+	// show copies a node into the view without its children. Nodes with a
+	// type formatter stand for their whole subtree.
+	show := func(node *Node) *Node {
+		copied := shallowCopy(node)
+		if formatter, ok := p.typeFormatters[node.Type]; ok {
+			copied.Token = formatter(node)
+		} else {
+			copied.Token = truncation.token(node.Token)
+		}
+		return copied
 	}
 
-	// Otherwise, use the default simple processing
-	return p.processDefault(uast)
+	// The children of excluded nodes take their place; an explicit stack
+	// keeps deep trees from overflowing the goroutine stack
+	type entry struct{ node, copied *Node }
+	filter := NodeFilter{ExcludeTypes: p.ExcludeTypes}
+	root := show(u.Root)
+	stack := []entry{{u.Root, root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := p.typeFormatters[top.node.Type]; ok {
+			continue
+		}
+		for _, child := range filter.children(top.node) {
+			copied := show(child)
+			top.copied.Children = append(top.copied.Children, copied)
+			stack = append(stack, entry{child, copied})
+		}
+	}
+
+	if p.SimplifyNestedNodes {
+		root = simplifyView(root)
+	}
+	view := NewUAST(root, u.Language)
+	maps.Copy(view.Metadata, u.Metadata)
+	return view
 }
 
 // processDefault processes the UAST using a default approach
@@ -132,6 +251,10 @@ func (p *LLMProcessor) processUnprocessedNodes(
 	// Format this node
 	p.formatNodeForLLM(sb, node, indent)
 	processedIDs[node.ID] = true
+	if _, ok := p.typeFormatters[node.Type]; ok {
+		markNodeProcessed(node, processedIDs)
+		return
+	}
 
 	// Process children
 	for _, child := range node.Children {
@@ -149,14 +272,16 @@ func (p *LLMProcessor) formatNodeForLLM(sb *strings.Builder, node *Node, indent
 
 	// Basic node info
 	sb.WriteString(indentStr)
+	if formatter, ok := p.typeFormatters[node.Type]; ok {
+		sb.WriteString(formatter(node))
+		sb.WriteString("\n")
+		return
+	}
 	sb.WriteString(string(node.Type))
 
 	if node.Token != "" {
 		// Trim token if it's too long
-		token := node.Token
-		if p.MaxTokensPerNode > 0 && len(token) > p.MaxTokensPerNode {
-			token = token[:p.MaxTokensPerNode] + "..."
-		}
+		token := p.tokenTruncation().token(node.Token)
 		sb.WriteString(fmt.Sprintf(": %s", token))
 	}
 
@@ -195,10 +320,7 @@ func (p *LLMProcessor) GenerateNodeSummary(node *Node) string {
 
 	if node.Token != "" {
 		// Trim token if it's too long
-		token := node.Token
-		if p.MaxTokensPerNode > 0 && len(token) > p.MaxTokensPerNode {
-			token = token[:p.MaxTokensPerNode] + "..."
-		}
+		token := p.tokenTruncation().token(node.Token)
 		sb.WriteString(fmt.Sprintf("Token: %s\n", token))
 	}
 
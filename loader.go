@@ -0,0 +1,306 @@
+package uast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Parser produces Tree-sitter CSTs from source code. Implement it on top of
+// tree-sitter bindings to let LoadDir index source files directly.
+type Parser interface {
+	Parse(ctx context.Context, source []byte, language string) (*TreeSitterNode, error)
+}
+
+// CommandParser is a Parser that runs an external command, such as a script
+// wrapping the tree-sitter CLI, with the source on stdin. The command must
+// write a CST JSON dump to stdout. The language is passed in the
+// UAST_LANGUAGE environment variable.
+type CommandParser struct {
+	Command string
+	Args    []string
+}
+
+// Parse runs the command and decodes its output
+func (p CommandParser) Parse(ctx context.Context, source []byte, language string) (*TreeSitterNode, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Env = append(os.Environ(), "UAST_LANGUAGE="+language)
+	cmd.Stdin = bytes.NewReader(source)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w: %s", p.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	return DecodeTreeSitterCST(&stdout)
+}
+
+// CSTFileSuffix marks JSON files holding pre-parsed CSTs, such as
+// "main.go.cst.json". LoadDir converts them when no Parser is configured.
+const CSTFileSuffix = ".cst.json"
+
+// languageExtensions maps file extensions to language names
+var languageExtensions = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".jsx":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".java":  "java",
+	".rs":    "rust",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cxx":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "c_sharp",
+	".rb":    "ruby",
+	".php":   "php",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".scala": "scala",
+	".lua":   "lua",
+	".sh":    "bash",
+	".html":  "html",
+	".css":   "css",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".md":    "markdown",
+	".sql":   "sql",
+}
+
+// DetectLanguage returns the language of a file from its extension, or ""
+// if it is not recognized. CST dumps are detected by their inner extension.
+func DetectLanguage(path string) string {
+	path = strings.TrimSuffix(path, CSTFileSuffix)
+	return languageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// LoadOptions configures LoadDir
+type LoadOptions struct {
+	Converter *Converter // Defaults to NewConverter()
+	Parser    Parser     // Without a parser only CST dumps are loaded
+
+	// DetectLanguage overrides extension-based detection, for example with
+	// go-enry. Returning "" skips the file.
+	DetectLanguage func(path string, content []byte) string
+
+	Languages   []string // If set, only files in these languages are loaded
+	SkipDirs    []string // Directory names to skip, defaults to .git and node_modules
+	MaxFileSize int64    // Larger files are skipped; zero means no limit
+	Workers     int      // Concurrent conversions, defaults to GOMAXPROCS
+
+	// Cache, if set, holds the UASTs of files converted before, keyed by
+	// their content, so unchanged files are not parsed again
+	Cache *ConversionCache
+}
+
+// LoadDir walks a directory tree, detects each file's language, parses it
+// with the configured Parser (or decodes it if it is a CST dump), converts it,
+// and passes the result to fn. Results are delivered one at a time in no
+// particular order. Returning an error from fn stops the walk and LoadDir
+// returns that error.
+func LoadDir(ctx context.Context, root string, opts LoadOptions, fn func(FileResult) error) error {
+	if fn == nil {
+		return fmt.Errorf("callback cannot be nil")
+	}
+
+	converter := opts.Converter
+	if converter == nil {
+		converter = NewConverter()
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	paths := make(chan string)
+	results := make(chan FileResult)
+
+	walkErrs := make(chan error, 1)
+	go func() {
+		defer close(paths)
+		walkErrs <- walkSourceFiles(ctx, root, opts, paths)
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				result, ok := loadFile(ctx, converter, opts, path)
+				if !ok {
+					continue
+				}
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var fnErr error
+	for result := range results {
+		if fnErr != nil {
+			continue // Drain so workers can exit
+		}
+		if err := fn(result); err != nil {
+			fnErr = err
+			cancel()
+		}
+	}
+
+	// Workers stop early once ctx is done, so wait for the walker too
+	walkErr := <-walkErrs
+	if fnErr != nil {
+		return fnErr
+	}
+	if walkErr != nil && !errors.Is(walkErr, context.Canceled) {
+		return walkErr
+	}
+	return ctx.Err()
+}
+
+// LoadFile parses and converts a single file the way LoadDir does. It
+// reports false if the file is skipped because of its size or language, or
+// because it is not a CST dump and no Parser is configured.
+func LoadFile(ctx context.Context, path string, opts LoadOptions) (FileResult, bool) {
+	if opts.Parser == nil && !strings.HasSuffix(path, CSTFileSuffix) {
+		return FileResult{Path: path}, false
+	}
+	converter := opts.Converter
+	if converter == nil {
+		converter = NewConverter()
+	}
+	return loadFile(ctx, converter, opts, path)
+}
+
+// walkSourceFiles sends the paths of candidate files to paths
+func walkSourceFiles(ctx context.Context, root string, opts LoadOptions, paths chan<- string) error {
+	skipDirs := opts.SkipDirs
+	if skipDirs == nil {
+		skipDirs = []string{".git", "node_modules"}
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && slices.Contains(skipDirs, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if opts.Parser == nil && !strings.HasSuffix(path, CSTFileSuffix) {
+			return nil
+		}
+
+		select {
+		case paths <- path:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// loadFile parses and converts a single file. It reports false for files
+// that are skipped because of their size or language.
+func loadFile(ctx context.Context, converter *Converter, opts LoadOptions, path string) (FileResult, bool) {
+	result := FileResult{Path: path}
+
+	if opts.MaxFileSize > 0 {
+		info, err := os.Stat(path)
+		if err != nil {
+			result.Err = fmt.Errorf("failed to stat %s: %w", path, err)
+			return result, true
+		}
+		if info.Size() > opts.MaxFileSize {
+			return result, false
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to read %s: %w", path, err)
+		return result, true
+	}
+
+	language := DetectLanguage(path)
+	if opts.DetectLanguage != nil {
+		language = opts.DetectLanguage(path, content)
+	}
+	if language == "" || (len(opts.Languages) > 0 && !slices.Contains(opts.Languages, language)) {
+		return result, false
+	}
+
+	parse := func() (*TreeSitterNode, error) {
+		var root *TreeSitterNode
+		var err error
+		if strings.HasSuffix(path, CSTFileSuffix) {
+			root, err = DecodeTreeSitterCST(bytes.NewReader(content))
+		} else {
+			root, err = opts.Parser.Parse(ctx, content, language)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return root, nil
+	}
+
+	var entry string
+	if opts.Cache != nil {
+		if err := ctx.Err(); err != nil {
+			result.Err = err
+			return result, true
+		}
+		entry = opts.Cache.entryPath(converter, content, language)
+		if u, ok := opts.Cache.lookup(converter, entry); ok {
+			u.AddMetadata("path", path)
+			result.UAST = u
+			return result, true
+		}
+	}
+
+	root, err := parse()
+	if err != nil {
+		result.Err = err
+		return result, true
+	}
+	result = converter.convertFile(ctx, FileInput{Path: path, Language: language, CST: root})
+	if opts.Cache != nil && result.Err == nil {
+		if err := opts.Cache.store(entry, result.UAST); err != nil {
+			return FileResult{Path: path, Err: fmt.Errorf("failed to cache %s: %w", path, err)}, true
+		}
+	}
+	return result, true
+}
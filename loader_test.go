@@ -0,0 +1,169 @@
+package uast_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+)
+
+type stubParser struct{}
+
+func (stubParser) Parse(_ context.Context, source []byte, _ string) (*uast.TreeSitterNode, error) {
+	return &uast.TreeSitterNode{Type: "program", Text: string(source)}, nil
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+
+	cst, err := os.ReadFile("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error reading CST: %v", err)
+	}
+
+	files := map[string][]byte{
+		"main.go.cst.json":        cst,
+		"lib/util.go":             []byte("package lib"),
+		"README.md":               []byte("# readme"),
+		".git/objects/x.cst.json": cst,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+	}
+
+	load := func(opts uast.LoadOptions) []string {
+		var paths []string
+		err := uast.LoadDir(context.Background(), dir, opts, func(result uast.FileResult) error {
+			if result.Err != nil {
+				t.Errorf("Unexpected error for %s: %v", result.Path, result.Err)
+				return nil
+			}
+			if result.UAST.Language != "go" {
+				t.Errorf("Expected %s to be detected as go, got %s", result.Path, result.UAST.Language)
+			}
+			rel, _ := filepath.Rel(dir, result.Path)
+			paths = append(paths, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error loading directory: %v", err)
+		}
+		slices.Sort(paths)
+		return paths
+	}
+
+	if got := load(uast.LoadOptions{}); !slices.Equal(got, []string{"main.go.cst.json"}) {
+		t.Errorf("Expected only the CST dump without a parser, got %v", got)
+	}
+
+	got := load(uast.LoadOptions{Parser: stubParser{}, Languages: []string{"go"}})
+	if !slices.Equal(got, []string{"lib/util.go", "main.go.cst.json"}) {
+		t.Errorf("Expected Go sources and dumps with a parser, got %v", got)
+	}
+}
+
+func TestLoadDirCancel(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 64 {
+		path := filepath.Join(dir, fmt.Sprintf("f%d.go", i))
+		if err := os.WriteFile(path, []byte("package f"), 0644); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+	}
+	opts := uast.LoadOptions{Parser: stubParser{}, Languages: []string{"go"}, Workers: 2}
+
+	// Cancelled part-way, while the walker may still be sending paths
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := uast.LoadDir(ctx, dir, opts, func(uast.FileResult) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled load to fail with context.Canceled, got %v", err)
+	}
+
+	// Cancelled before the walk starts
+	err = uast.LoadDir(ctx, dir, opts, func(uast.FileResult) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+type countingParser struct {
+	calls int
+}
+
+func (p *countingParser) Parse(_ context.Context, source []byte, _ string) (*uast.TreeSitterNode, error) {
+	p.calls++
+	return uast.DecodeTreeSitterCST(bytes.NewReader(source))
+}
+
+func TestConversionCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	cst, err := os.ReadFile("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error reading CST: %v", err)
+	}
+	if err := os.WriteFile(path, cst, 0644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	cache, err := uast.NewConversionCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("Error creating cache: %v", err)
+	}
+	parser := &countingParser{}
+	opts := uast.LoadOptions{Parser: parser, Cache: cache}
+
+	first, _ := uast.LoadFile(context.Background(), path, opts)
+	second, _ := uast.LoadFile(context.Background(), path, opts)
+	if first.Err != nil || second.Err != nil {
+		t.Fatalf("Error loading file: %v, %v", first.Err, second.Err)
+	}
+	if parser.calls != 1 {
+		t.Errorf("Expected the second load to hit the cache, parsed %d times", parser.calls)
+	}
+
+	want, _ := first.UAST.ToJSON()
+	got, _ := second.UAST.ToJSON()
+	if want != got {
+		t.Errorf("Expected the cached UAST to match the converted one")
+	}
+	root := second.UAST.Root
+	if len(second.UAST.FindByType(root.Type)) != len(first.UAST.FindByType(root.Type)) {
+		t.Errorf("Expected the cached UAST to be indexed")
+	}
+
+	cache.SetVersion("v2")
+	uast.LoadFile(context.Background(), path, opts)
+	if parser.calls != 2 {
+		t.Errorf("Expected a new version to miss the cache, parsed %d times", parser.calls)
+	}
+
+	opts.Converter = uast.NewConverter()
+	opts.Converter.AddMappingRule("source_file", uast.Package)
+	uast.LoadFile(context.Background(), path, opts)
+	if parser.calls != 3 {
+		t.Errorf("Expected a changed mapping rule to miss the cache, parsed %d times", parser.calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result, _ := uast.LoadFile(ctx, path, opts); result.Err == nil {
+		t.Errorf("Expected a cancelled load to fail")
+	}
+}
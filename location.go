@@ -0,0 +1,69 @@
+package uast
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Compare returns -1, 0 or +1 as p is before, at or after other
+func (p Position) Compare(other Position) int {
+	if c := cmp.Compare(p.Line, other.Line); c != 0 {
+		return c
+	}
+	return cmp.Compare(p.Column, other.Column)
+}
+
+// Before reports whether p comes strictly before other
+func (p Position) Before(other Position) bool {
+	return p.Compare(other) < 0
+}
+
+// After reports whether p comes strictly after other
+func (p Position) After(other Position) bool {
+	return p.Compare(other) > 0
+}
+
+// Compare orders locations by start position, then by end position, so
+// enclosing nodes sort before the nodes they contain. It returns -1, 0 or +1.
+func (l Location) Compare(other Location) int {
+	if c := l.Start.Compare(other.Start); c != 0 {
+		return c
+	}
+	// The longer span encloses the shorter one
+	return other.End.Compare(l.End)
+}
+
+// Contains reports whether the position lies within the location, including
+// both ends, so a cursor just after a token still selects it
+func (l Location) Contains(pos Position) bool {
+	return !pos.Before(l.Start) && !pos.After(l.End)
+}
+
+// ContainsRange reports whether other lies within the location, including
+// both ends, so a node contains itself and each of its children
+func (l Location) ContainsRange(other Location) bool {
+	return !other.Start.Before(l.Start) && !other.End.After(l.End)
+}
+
+// Overlaps reports whether the two locations share any source text. Ends are
+// exclusive, as in Tree-sitter, so adjacent locations don't overlap.
+func (l Location) Overlaps(other Location) bool {
+	return l.Start.Before(other.End) && other.Start.Before(l.End)
+}
+
+// SortNodesByLocation sorts nodes into source order in place, using
+// Location.Compare. Nodes without a location keep their relative order and
+// sort after those with one.
+func SortNodesByLocation(nodes []*Node) {
+	slices.SortStableFunc(nodes, func(a, b *Node) int {
+		switch {
+		case a.Location == nil && b.Location == nil:
+			return 0
+		case a.Location == nil:
+			return 1
+		case b.Location == nil:
+			return -1
+		}
+		return a.Location.Compare(*b.Location)
+	})
+}
@@ -0,0 +1,73 @@
+package uast
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru is a fixed-size cache that evicts its least recently used entry, safe
+// for concurrent use
+type lru[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Front is the most recently used
+	entries map[K]*list.Element
+}
+
+// lruEntry is an element of an lru's order list
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRU creates a cache holding up to size entries
+func newLRU[K comparable, V any](size int) *lru[K, V] {
+	return &lru[K, V]{size: size, order: list.New(), entries: make(map[K]*list.Element)}
+}
+
+// get returns the value cached under key, marking it as recently used
+func (c *lru[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry[K, V]).value, true
+}
+
+// add caches value under key, evicting the least recently used entry if the
+// cache is full
+func (c *lru[K, V]) add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// cached returns the value cached under key, or computes it with compile
+// and caches it if compile succeeds
+func cached[K comparable, V any](c *lru[K, V], key K, compile func(K) (V, error)) (V, error) {
+	if value, ok := c.get(key); ok {
+		return value, nil
+	}
+	value, err := compile(key)
+	if err != nil {
+		return value, err
+	}
+	c.add(key, value)
+	return value, nil
+}
@@ -0,0 +1,409 @@
+package uast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// The mapped format lays out a CompactUAST as fixed-size little-endian
+// records that can be read in place: a header, the metadata pairs, one
+// record per node, the child list, the role list, the property pairs and
+// finally the blob holding every string once. Strings are referenced by
+// their offset in the blob and their length.
+const (
+	mappedMagic      = "UASTMAP\x01"
+	mappedHeaderSize = 8 + 5*4 + mappedStringSize
+	mappedStringSize = 12 // uint64 offset, uint32 length
+	mappedNodeSize   = 3*mappedStringSize + 4 + 3*8 + 4 + 2*16
+)
+
+// Flags of a node record
+const (
+	mappedHasLocation     = 1 << 0
+	mappedHasNameLocation = 1 << 1
+)
+
+// mappedWriter accumulates the sections of the mapped format
+type mappedWriter struct {
+	w       *bufio.Writer
+	blob    bytes.Buffer
+	strings map[string]uint64
+	buf     [8]byte
+}
+
+// uint32 writes an integer
+func (mw *mappedWriter) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(mw.buf[:4], v)
+	mw.w.Write(mw.buf[:4])
+}
+
+// string writes a reference to s, adding s to the blob if it is new
+func (mw *mappedWriter) string(s string) {
+	offset, ok := mw.strings[s]
+	if !ok {
+		offset = uint64(mw.blob.Len())
+		mw.strings[s] = offset
+		mw.blob.WriteString(s)
+	}
+	binary.LittleEndian.PutUint64(mw.buf[:], offset)
+	mw.w.Write(mw.buf[:])
+	mw.uint32(uint32(len(s)))
+}
+
+// location writes the positions of a location
+func (mw *mappedWriter) location(loc Location) {
+	mw.uint32(loc.Start.Line)
+	mw.uint32(loc.Start.Column)
+	mw.uint32(loc.End.Line)
+	mw.uint32(loc.End.Column)
+}
+
+// WriteMapped writes the tree in the mapped format read by OpenMapped
+func (c *CompactUAST) WriteMapped(w io.Writer) error {
+	mw := &mappedWriter{w: bufio.NewWriter(w), strings: make(map[string]uint64)}
+	keys := sortedKeys(c.Metadata)
+
+	mw.w.WriteString(mappedMagic)
+	for _, count := range []int{c.Len(), len(keys), len(c.ChildList), len(c.RoleList), len(c.PropKeys)} {
+		if count > math.MaxUint32 {
+			return fmt.Errorf("failed to write mapped UAST: %d entries exceed the format's limit", count)
+		}
+		mw.uint32(uint32(count))
+	}
+	mw.string(c.Language)
+
+	for _, key := range keys {
+		mw.string(key)
+		mw.string(c.Metadata[key])
+	}
+	for i := range c.Len() {
+		mw.string(c.IDs[i])
+		mw.string(string(c.Types[i]))
+		mw.string(c.Tokens[i])
+		mw.uint32(uint32(c.Parents[i]))
+		for _, offsets := range [][]int32{c.ChildOffsets, c.RoleOffsets, c.PropOffsets} {
+			mw.uint32(uint32(offsets[i]))
+			mw.uint32(uint32(offsets[i+1] - offsets[i]))
+		}
+
+		var flags uint32
+		nameLocation, hasName := c.NameLocations[int32(i)]
+		if c.HasLoc[i] {
+			flags |= mappedHasLocation
+		}
+		if hasName {
+			flags |= mappedHasNameLocation
+		}
+		mw.uint32(flags)
+		mw.location(c.Locations[i])
+		mw.location(nameLocation)
+	}
+	for _, child := range c.ChildList {
+		mw.uint32(uint32(child))
+	}
+	for _, role := range c.RoleList {
+		mw.string(string(role))
+	}
+	for i, key := range c.PropKeys {
+		mw.string(key)
+		mw.string(c.PropValues[i])
+	}
+
+	if _, err := mw.w.Write(mw.blob.Bytes()); err != nil {
+		return fmt.Errorf("failed to write mapped UAST: %w", err)
+	}
+	if err := mw.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write mapped UAST: %w", err)
+	}
+	return nil
+}
+
+// MappedUAST is a UAST in the mapped format, read in place from a
+// memory-mapped file. Nodes are materialized only when asked for, so opening
+// even a very large tree takes little memory beyond the operating system's
+// page cache. Nodes are numbered in pre-order, as in CompactUAST, and the
+// returned strings and nodes stay valid after Close, but the MappedUAST
+// itself must not be used afterwards.
+type MappedUAST struct {
+	data  []byte
+	unmap func() error
+
+	nodes, metadata, children, roles, props int
+	metadataAt, nodesAt, childrenAt         int
+	rolesAt, propsAt, stringsAt             int
+}
+
+// OpenMapped maps a file written by WriteMapped into memory. On platforms
+// without mmap the file is read instead.
+func OpenMapped(path string) (*MappedUAST, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mapped UAST: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mapped UAST: %w", err)
+	}
+	if info.Size() < mappedHeaderSize || info.Size() > math.MaxInt {
+		return nil, fmt.Errorf("%w mapped UAST: invalid size %d", ErrDecode, info.Size())
+	}
+
+	data, unmap, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to map %s: %w", path, err)
+	}
+	m, err := newMappedUAST(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	m.unmap = unmap
+	return m, nil
+}
+
+// newMappedUAST checks the header of data and locates its sections
+func newMappedUAST(data []byte) (*MappedUAST, error) {
+	if string(data[:len(mappedMagic)]) != mappedMagic {
+		return nil, fmt.Errorf("%w mapped UAST: bad magic number", ErrDecode)
+	}
+
+	m := &MappedUAST{data: data}
+	counts := []*int{&m.nodes, &m.metadata, &m.children, &m.roles, &m.props}
+	for i, count := range counts {
+		*count = int(binary.LittleEndian.Uint32(data[len(mappedMagic)+4*i:]))
+	}
+
+	sizes := []int64{
+		int64(m.metadata) * 2 * mappedStringSize,
+		int64(m.nodes) * mappedNodeSize,
+		int64(m.children) * 4,
+		int64(m.roles) * mappedStringSize,
+		int64(m.props) * 2 * mappedStringSize,
+	}
+	starts := []*int{&m.metadataAt, &m.nodesAt, &m.childrenAt, &m.rolesAt, &m.propsAt}
+	at := int64(mappedHeaderSize)
+	for i, size := range sizes {
+		*starts[i] = int(at)
+		at += size
+	}
+	if at > int64(len(data)) {
+		return nil, fmt.Errorf("%w mapped UAST: sections exceed the file", ErrDecode)
+	}
+	m.stringsAt = int(at)
+	return m, nil
+}
+
+// Close unmaps the file
+func (m *MappedUAST) Close() error {
+	if m.unmap == nil {
+		return nil
+	}
+	err := m.unmap()
+	m.data, m.unmap = nil, nil
+	if err != nil {
+		return fmt.Errorf("failed to unmap UAST: %w", err)
+	}
+	return nil
+}
+
+// uint32 reads the integer at offset
+func (m *MappedUAST) uint32(offset int) uint32 {
+	return binary.LittleEndian.Uint32(m.data[offset:])
+}
+
+// bytes returns the mapped bytes of the string referenced at offset, or nil
+// for references outside the blob
+func (m *MappedUAST) bytes(offset int) []byte {
+	start := binary.LittleEndian.Uint64(m.data[offset:])
+	length := uint64(m.uint32(offset + 8))
+	blob := m.data[m.stringsAt:]
+	if start > uint64(len(blob)) || length > uint64(len(blob))-start {
+		return nil
+	}
+	return blob[start : start+length]
+}
+
+// string copies the string referenced at offset out of the mapping
+func (m *MappedUAST) string(offset int) string {
+	return string(m.bytes(offset))
+}
+
+// record returns the offset of the record of node i
+func (m *MappedUAST) record(i int) int {
+	return m.nodesAt + i*mappedNodeSize
+}
+
+// span reads the start and length of one of node i's lists, clamped to
+// total entries
+func (m *MappedUAST) span(i, field, total int) (int, int) {
+	at := m.record(i) + 3*mappedStringSize + 4 + 8*field
+	start := min(int(m.uint32(at)), total)
+	return start, min(start+int(m.uint32(at+4)), total)
+}
+
+// Len returns the number of nodes
+func (m *MappedUAST) Len() int {
+	return m.nodes
+}
+
+// Language returns the language of the tree
+func (m *MappedUAST) Language() string {
+	return m.string(len(mappedMagic) + 5*4)
+}
+
+// Metadata returns a copy of the tree's metadata
+func (m *MappedUAST) Metadata() map[string]string {
+	metadata := make(map[string]string, m.metadata)
+	for i := range m.metadata {
+		at := m.metadataAt + 2*mappedStringSize*i
+		metadata[m.string(at)] = m.string(at + mappedStringSize)
+	}
+	return metadata
+}
+
+// ID returns the ID of node i
+func (m *MappedUAST) ID(i int) string {
+	return m.string(m.record(i))
+}
+
+// Type returns the type of node i
+func (m *MappedUAST) Type(i int) NodeType {
+	return NodeType(m.string(m.record(i) + mappedStringSize))
+}
+
+// Token returns the token of node i
+func (m *MappedUAST) Token(i int) string {
+	return m.string(m.record(i) + 2*mappedStringSize)
+}
+
+// Parent returns the index of the parent of node i, or -1 for the root
+func (m *MappedUAST) Parent(i int) int {
+	return int(int32(m.uint32(m.record(i) + 3*mappedStringSize)))
+}
+
+// Children returns the indices of the children of node i
+func (m *MappedUAST) Children(i int) []int32 {
+	start, end := m.span(i, 0, m.children)
+	children := make([]int32, 0, end-start)
+	for j := start; j < end; j++ {
+		if child := int32(m.uint32(m.childrenAt + 4*j)); child >= 0 && int(child) < m.nodes {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Roles returns the roles of node i
+func (m *MappedUAST) Roles(i int) []Role {
+	start, end := m.span(i, 1, m.roles)
+	roles := make([]Role, 0, end-start)
+	for j := start; j < end; j++ {
+		roles = append(roles, Role(m.string(m.rolesAt+mappedStringSize*j)))
+	}
+	return roles
+}
+
+// Property returns the value of a property of node i
+func (m *MappedUAST) Property(i int, key string) (string, bool) {
+	start, end := m.span(i, 2, m.props)
+	at := func(j int) int { return m.propsAt + 2*mappedStringSize*j }
+	j := start + sort.Search(end-start, func(j int) bool { return m.string(at(start+j)) >= key })
+	if j < end && m.string(at(j)) == key {
+		return m.string(at(j) + mappedStringSize), true
+	}
+	return "", false
+}
+
+// location reads the location at offset
+func (m *MappedUAST) location(offset int) *Location {
+	return &Location{
+		Start: Position{Line: m.uint32(offset), Column: m.uint32(offset + 4)},
+		End:   Position{Line: m.uint32(offset + 8), Column: m.uint32(offset + 12)},
+	}
+}
+
+// Node materializes node i without its children
+func (m *MappedUAST) Node(i int) *Node {
+	node := &Node{
+		ID:    m.ID(i),
+		Type:  m.Type(i),
+		Token: m.Token(i),
+	}
+	if roles := m.Roles(i); len(roles) > 0 {
+		node.Roles = roles
+	}
+
+	at := m.record(i) + 3*mappedStringSize + 4 + 3*8
+	flags := m.uint32(at)
+	if flags&mappedHasLocation != 0 {
+		node.Location = m.location(at + 4)
+	}
+	if flags&mappedHasNameLocation != 0 {
+		node.NameLocation = m.location(at + 20)
+	}
+
+	start, end := m.span(i, 2, m.props)
+	for j := start; j < end; j++ {
+		at := m.propsAt + 2*mappedStringSize*j
+		node.SetProperty(m.string(at), m.string(at+mappedStringSize))
+	}
+	return node
+}
+
+// Subtree materializes node i and its descendants
+func (m *MappedUAST) Subtree(i int) *Node {
+	root := m.Node(i)
+	type pending struct {
+		index int
+		node  *Node
+	}
+	stack := []pending{{i, root}}
+	seen := map[int]bool{i: true} // Guards against cycles in corrupt files
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range m.Children(top.index) {
+			if seen[int(child)] {
+				continue
+			}
+			seen[int(child)] = true
+			node := m.Node(int(child))
+			top.node.Children = append(top.node.Children, node)
+			stack = append(stack, pending{int(child), node})
+		}
+	}
+	return root
+}
+
+// FindByType returns the indices of the nodes of a type, in pre-order,
+// without materializing any node
+func (m *MappedUAST) FindByType(nodeType NodeType) []int {
+	var indices []int
+	for i := range m.nodes {
+		if string(m.bytes(m.record(i)+mappedStringSize)) == string(nodeType) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// ToUAST materializes the whole tree
+func (m *MappedUAST) ToUAST() *UAST {
+	var root *Node
+	if m.nodes > 0 {
+		root = m.Subtree(0)
+	}
+	u := NewUAST(root, m.Language())
+	for k, v := range m.Metadata() {
+		u.Metadata[k] = v
+	}
+	return u
+}
@@ -0,0 +1,209 @@
+package uast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+)
+
+// MappingRule maps Tree-sitter node types to a UAST node type. A rule names
+// either one type exactly or a pattern of them. Exact rules take precedence
+// over pattern rules, which take precedence over the defaults, so a profile
+// can override a whole family of types and still single one out.
+type MappingRule struct {
+	TSType   string   `json:"tsType,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"` // Glob such as "*_statement", in path.Match syntax
+	NodeType NodeType `json:"nodeType"`
+
+	// Priority orders the rules for the same type or pattern, and the
+	// patterns matching a type. The higher priority wins, and of equal ones
+	// the rule added last.
+	Priority int `json:"priority,omitempty"`
+
+	// Default marks a fallback rule, such as the built-in mapping, used only
+	// when no other rule matches
+	Default bool `json:"default,omitempty"`
+}
+
+// validate checks that the rule names one type or pattern and maps it to a
+// type
+func (r MappingRule) validate() error {
+	switch {
+	case r.NodeType == "":
+		return fmt.Errorf("node type cannot be empty")
+	case (r.TSType == "") == (r.Pattern == ""):
+		return fmt.Errorf("rule needs either a Tree-sitter type or a pattern")
+	case r.Pattern != "" && r.Default:
+		return fmt.Errorf("pattern %q cannot be a default rule", r.Pattern)
+	}
+	if r.Pattern != "" {
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", r.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// AddMapping adds a mapping rule. An exact or pattern rule replaces the rule
+// for the same type or pattern unless that one has a higher priority; a
+// default rule replaces the default for its type.
+func (c *Converter) AddMapping(rule MappingRule) error {
+	if err := rule.validate(); err != nil {
+		return fmt.Errorf("failed to add mapping rule: %w", err)
+	}
+	c.patternMatches = new(sync.Map)
+
+	switch {
+	case rule.Default:
+		c.defaultRules[rule.TSType] = rule.NodeType
+	case rule.TSType != "":
+		if existing, ok := c.mappingRules[rule.TSType]; !ok || existing.Priority <= rule.Priority {
+			c.mappingRules[rule.TSType] = rule
+		}
+	default:
+		for i, existing := range c.patternRules {
+			if existing.Pattern == rule.Pattern {
+				if existing.Priority <= rule.Priority {
+					c.patternRules = append(c.patternRules[:i:i], c.patternRules[i+1:]...)
+					c.patternRules = append(c.patternRules, rule)
+				}
+				return nil
+			}
+		}
+		c.patternRules = append(c.patternRules, rule)
+	}
+	return nil
+}
+
+// RemoveMappingRule removes the exact and default rules for a Tree-sitter
+// type, so it falls back to the pattern rules and registered node types. It
+// reports whether there was a rule to remove.
+func (c *Converter) RemoveMappingRule(treeType string) bool {
+	_, exact := c.mappingRules[treeType]
+	_, fallback := c.defaultRules[treeType]
+	delete(c.mappingRules, treeType)
+	delete(c.defaultRules, treeType)
+	c.patternMatches = new(sync.Map)
+	return exact || fallback
+}
+
+// RemovePatternRule removes the rule for a pattern, reporting whether there
+// was one
+func (c *Converter) RemovePatternRule(pattern string) bool {
+	for i, rule := range c.patternRules {
+		if rule.Pattern == pattern {
+			c.patternRules = append(c.patternRules[:i:i], c.patternRules[i+1:]...)
+			c.patternMatches = new(sync.Map)
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern returns the type of the pattern rule that wins for a
+// Tree-sitter type, or "" if none matches. Results are cached until the
+// rules change.
+func (c *Converter) matchPattern(tsType string) NodeType {
+	if len(c.patternRules) == 0 {
+		return ""
+	}
+	if nodeType, ok := c.patternMatches.Load(tsType); ok {
+		return nodeType.(NodeType)
+	}
+
+	var best *MappingRule
+	for i, rule := range c.patternRules {
+		if ok, _ := path.Match(rule.Pattern, tsType); ok && (best == nil || rule.Priority >= best.Priority) {
+			best = &c.patternRules[i]
+		}
+	}
+	var nodeType NodeType
+	if best != nil {
+		nodeType = best.NodeType
+	}
+	c.patternMatches.Store(tsType, nodeType)
+	return nodeType
+}
+
+// MappingRules returns the converter's rules in order of precedence: the
+// exact rules sorted by Tree-sitter type, the pattern rules in the order
+// added, then the defaults, including those of registered node types, sorted
+// by Tree-sitter type
+func (c *Converter) MappingRules() []MappingRule {
+	rules := make([]MappingRule, 0, len(c.mappingRules)+len(c.patternRules)+len(c.defaultRules))
+	for _, tsType := range sortedKeys(c.mappingRules) {
+		rules = append(rules, c.mappingRules[tsType])
+	}
+	rules = append(rules, c.patternRules...)
+
+	defaults := make(map[string]NodeType, len(c.defaultRules))
+	if registry := nodeTypes.Load(); registry != nil {
+		for tsType, nodeType := range registry.byTSType {
+			defaults[tsType] = nodeType
+		}
+	}
+	for tsType, nodeType := range c.defaultRules {
+		defaults[tsType] = nodeType
+	}
+	for _, tsType := range sortedKeys(defaults) {
+		rules = append(rules, MappingRule{TSType: tsType, NodeType: defaults[tsType], Default: true})
+	}
+	return rules
+}
+
+// DumpMappingRules writes the rules returned by MappingRules as an indented
+// JSON array, which LoadMappingRules reads back
+func (c *Converter) DumpMappingRules(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c.MappingRules()); err != nil {
+		return fmt.Errorf("failed to write mapping rules: %w", err)
+	}
+	return nil
+}
+
+// DecodeMappingRules reads a JSON array of mapping rules, rejecting invalid
+// rules and types or patterns with several rules of the same kind
+func DecodeMappingRules(r io.Reader) ([]MappingRule, error) {
+	var rules []MappingRule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%w mapping rules: %w", ErrDecode, err)
+	}
+
+	type key struct {
+		tsType, pattern string
+		fallback        bool
+	}
+	seen := make(map[key]bool, len(rules))
+	for i, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("%w mapping rules: rule %d: %w", ErrDecode, i, err)
+		}
+		k := key{rule.TSType, rule.Pattern, rule.Default}
+		if seen[k] {
+			return nil, fmt.Errorf("%w mapping rules: rule %d repeats %q", ErrDecode, i, rule.TSType+rule.Pattern)
+		}
+		seen[k] = true
+	}
+	return rules, nil
+}
+
+// LoadMappingRules replaces the converter's mapping rules, defaults
+// included, with those read from r by DecodeMappingRules. The rules are
+// left unchanged if r cannot be decoded.
+func (c *Converter) LoadMappingRules(r io.Reader) error {
+	rules, err := DecodeMappingRules(r)
+	if err != nil {
+		return err
+	}
+
+	c.mappingRules = make(map[string]MappingRule, len(rules))
+	c.patternRules = nil
+	c.defaultRules = make(map[string]NodeType)
+	for _, rule := range rules {
+		_ = c.AddMapping(rule) // Validated by DecodeMappingRules
+	}
+	return nil
+}
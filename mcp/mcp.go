@@ -0,0 +1,209 @@
+// Package mcp serves a Workspace to coding agents over the Model Context
+// Protocol. Serve speaks JSON-RPC on the stdio transport and exposes tools
+// to outline files, find symbols, read function source and run structural
+// queries.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/flaticols/uast-go"
+)
+
+// ProtocolVersion is the latest MCP revision the server implements
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions are the MCP revisions the server can speak, which agree
+// on everything it uses
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// Options configures a Server
+type Options struct {
+	// Source returns the source code of a workspace file, for
+	// get_function_source. It defaults to reading the file, or the source
+	// file next to a CST dump such as main.go.cst.json.
+	Source func(path string) ([]byte, error)
+
+	Version string // Reported to clients, defaults to "dev"
+}
+
+// Server answers MCP requests about a Workspace
+type Server struct {
+	workspace *uast.Workspace
+	opts      Options
+}
+
+// NewServer creates a Server for a workspace
+func NewServer(w *uast.Workspace, opts Options) *Server {
+	if opts.Source == nil {
+		opts.Source = func(path string) ([]byte, error) {
+			return os.ReadFile(strings.TrimSuffix(path, uast.CSTFileSuffix))
+		}
+	}
+	if opts.Version == "" {
+		opts.Version = "dev"
+	}
+	return &Server{workspace: w, opts: opts}
+}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// request is a JSON-RPC request or notification
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // Absent for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC response
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Serve reads newline-delimited JSON-RPC messages from r and writes the
+// responses to w until r is exhausted or ctx is done
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+	encoder := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if resp := s.handle(ctx, line); resp != nil {
+			if err := encoder.Encode(resp); err != nil {
+				return fmt.Errorf("failed to write response: %w", err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read request: %w", err)
+	}
+	return nil
+}
+
+// handle answers one message, returning nil for notifications
+func (s *Server) handle(ctx context.Context, message []byte) *response {
+	var req request
+	if err := json.Unmarshal(message, &req); err != nil {
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, err.Error()}}
+	}
+	if req.ID == nil {
+		return nil
+	}
+
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	switch req.Method {
+	case "initialize":
+		resp.Result = s.initialize(req.Params)
+	case "ping":
+		resp.Result = struct{}{}
+	case "tools/list":
+		resp.Result = map[string]any{"tools": toolList}
+	case "tools/call":
+		result, err := s.callTool(ctx, req.Params)
+		if err != nil {
+			resp.Error = err
+		} else {
+			resp.Result = result
+		}
+	case "":
+		resp.Error = &rpcError{codeInvalidRequest, "missing method"}
+	default:
+		resp.Error = &rpcError{codeMethodNotFound, fmt.Sprintf("unknown method %q", req.Method)}
+	}
+	return resp
+}
+
+// initialize answers the initialize handshake with the client's protocol
+// version if the server supports it, or else its latest, which the client
+// may then decline
+func (s *Server) initialize(params json.RawMessage) any {
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	json.Unmarshal(params, &init)
+	version := ProtocolVersion
+	if slices.Contains(supportedVersions, init.ProtocolVersion) {
+		version = init.ProtocolVersion
+	}
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities":    map[string]any{"tools": map[string]any{}},
+		"serverInfo":      map[string]string{"name": "uast-go", "version": s.opts.Version},
+	}
+}
+
+// toolResult is the result of tools/call
+type toolResult struct {
+	Content []textContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+// textContent is a text content block
+type textContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// callTool runs a tool. Failures of the tool itself are reported in the
+// result so the agent can see them; only malformed calls are protocol errors.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (*toolResult, *rpcError) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+	tool, ok := tools[call.Name]
+	if !ok {
+		return nil, &rpcError{codeInvalidParams, fmt.Sprintf("unknown tool %q", call.Name)}
+	}
+
+	var args toolArgs
+	if len(call.Arguments) > 0 {
+		if err := json.Unmarshal(call.Arguments, &args); err != nil {
+			return nil, &rpcError{codeInvalidParams, fmt.Sprintf("invalid arguments: %v", err)}
+		}
+	}
+
+	text, err := tool.run(ctx, s, args)
+	if err != nil {
+		return &toolResult{Content: []textContent{{"text", err.Error()}}, IsError: true}, nil
+	}
+	return &toolResult{Content: []textContent{{"text", text}}}, nil
+}
+
+// errNoMatch reports a tool call that found nothing
+var errNoMatch = errors.New("no matching declarations")
@@ -0,0 +1,111 @@
+package mcp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/mcp"
+)
+
+func TestServe(t *testing.T) {
+	w := uast.NewWorkspace()
+	for path, file := range map[string]string{"main.go": "../testdata/example.json", "test.go": "../testdata/test_cst.json"} {
+		tsNode, err := uast.LoadTreeSitterCST(file)
+		if err != nil {
+			t.Fatalf("Error loading CST: %v", err)
+		}
+		u, err := uast.NewConverter().Convert(tsNode, "go")
+		if err != nil {
+			t.Fatalf("Error converting to UAST: %v", err)
+		}
+		w.Add(path, u)
+	}
+
+	// Each source line reads "line N"
+	server := mcp.NewServer(w, mcp.Options{Source: func(string) ([]byte, error) {
+		var lines []string
+		for i := 1; i <= 40; i++ {
+			lines = append(lines, fmt.Sprintf("line %d", i))
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	}})
+
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"get_outline","arguments":{"path":"test.go"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"find_symbol","arguments":{"symbol":"hello"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"get_function_source","arguments":{"symbol":"hello"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"query_ast","arguments":{"pattern":"(Call \"add\" ...)"}}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"find_symbol","arguments":{"symbol":"missing"}}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":9,"method":"initialize","params":{"protocolVersion":"2099-01-01"}}`,
+	}
+	var out bytes.Buffer
+	if err := server.Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Error serving: %v", err)
+	}
+
+	type response struct {
+		Result struct {
+			ProtocolVersion string `json:"protocolVersion"`
+			Tools           []any  `json:"tools"`
+			Content         []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool `json:"isError"`
+		} `json:"result"`
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	var responses []response
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var resp response
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 9 {
+		t.Fatalf("Expected 9 responses without one for the notification, got %d", len(responses))
+	}
+	text := func(i int) string {
+		if content := responses[i].Result.Content; len(content) == 1 {
+			return content[0].Text
+		}
+		return ""
+	}
+
+	if responses[0].Result.ProtocolVersion != "2025-03-26" || len(responses[1].Result.Tools) != 4 {
+		t.Errorf("Expected the client's protocol version and 4 tools, got %+v %+v", responses[0], responses[1])
+	}
+	if got := text(2); got != "Function hello:1-11\nClass Example:12-20\n" {
+		t.Errorf("Unexpected outline %q", got)
+	}
+	if got := text(3); got != "test.go:1-11\tFunction\thello\n" {
+		t.Errorf("Unexpected symbol location %q", got)
+	}
+	if got := text(4); !strings.Contains(got, "\nline 1\n") || !strings.HasSuffix(got, "line 11\n") || strings.Contains(got, "line 12") {
+		t.Errorf("Expected lines 1-11 of the source, got %q", got)
+	}
+	if got := text(5); !strings.HasPrefix(got, "main.go:19:12\tCall") {
+		t.Errorf("Expected the call to add, got %q", got)
+	}
+	if !responses[6].Result.IsError {
+		t.Errorf("Expected a tool error for a missing symbol")
+	}
+	if responses[7].Error == nil || responses[7].Error.Code != -32601 {
+		t.Errorf("Expected method not found, got %+v", responses[7])
+	}
+	if got := responses[8].Result.ProtocolVersion; got != mcp.ProtocolVersion {
+		t.Errorf("Expected the server's version for an unsupported one, got %q", got)
+	}
+}
@@ -0,0 +1,226 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flaticols/uast-go"
+)
+
+// tool is an MCP tool served by the server
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+	run         func(ctx context.Context, s *Server, args toolArgs) (string, error)
+}
+
+// toolArgs holds the arguments of every tool
+type toolArgs struct {
+	Path    string `json:"path"`
+	Symbol  string `json:"symbol"`
+	Pattern string `json:"pattern"`
+	Limit   int    `json:"limit"`
+}
+
+// schema builds a JSON Schema for an object of string arguments
+func schema(required []string, properties map[string]string) map[string]any {
+	props := make(map[string]any, len(properties))
+	for name, description := range properties {
+		kind := "string"
+		if name == "limit" {
+			kind = "integer"
+		}
+		props[name] = map[string]string{"type": kind, "description": description}
+	}
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+// toolList holds the tools in the order tools/list reports them
+var toolList = []*tool{
+	{
+		Name:        "get_outline",
+		Description: "List the declarations in a file, nested by scope, with their line ranges.",
+		InputSchema: schema([]string{"path"}, map[string]string{"path": "File path in the workspace"}),
+		run:         getOutline,
+	},
+	{
+		Name:        "find_symbol",
+		Description: "Find where a symbol is declared, by qualified name such as main.Server.Start or by plain name.",
+		InputSchema: schema([]string{"symbol"}, map[string]string{"symbol": "Qualified or unqualified symbol name"}),
+		run:         findSymbol,
+	},
+	{
+		Name:        "get_function_source",
+		Description: "Return the source code of a declared function, method or type.",
+		InputSchema: schema([]string{"symbol"}, map[string]string{
+			"symbol": "Qualified or unqualified symbol name",
+			"path":   "Only consider declarations in this file",
+		}),
+		run: getFunctionSource,
+	},
+	{
+		Name:        "query_ast",
+		Description: `Find nodes matching a structural pattern such as (Call "add" ...), where _ matches any node, ... any run of children and $name captures a node.`,
+		InputSchema: schema([]string{"pattern"}, map[string]string{
+			"pattern": "Structural pattern",
+			"path":    "Only search this file",
+			"limit":   "Maximum number of matches, defaults to 100",
+		}),
+		run: queryAST,
+	},
+}
+
+// tools indexes toolList by name
+var tools = func() map[string]*tool {
+	byName := make(map[string]*tool, len(toolList))
+	for _, t := range toolList {
+		byName[t.Name] = t
+	}
+	return byName
+}()
+
+// getOutline implements get_outline
+func getOutline(_ context.Context, s *Server, args toolArgs) (string, error) {
+	if _, ok := s.workspace.Get(args.Path); !ok {
+		return "", fmt.Errorf("no file %q in the workspace", args.Path)
+	}
+
+	var b strings.Builder
+	for _, decl := range s.workspace.SymbolIndex().DeclarationsIn(args.Path) {
+		depth := 0
+		for range decl.Node.AncestorsWithRole(uast.RoleDeclaration) {
+			depth++
+		}
+		fmt.Fprintf(&b, "%s%s %s%s\n", strings.Repeat("  ", depth), decl.Node.Type, decl.Name, lineRange(decl.Node.Location))
+	}
+	if b.Len() == 0 {
+		return "No declarations.", nil
+	}
+	return b.String(), nil
+}
+
+// findSymbol implements find_symbol
+func findSymbol(_ context.Context, s *Server, args toolArgs) (string, error) {
+	decls := s.resolve(args.Symbol, "")
+	if len(decls) == 0 {
+		return "", fmt.Errorf("%w for %q", errNoMatch, args.Symbol)
+	}
+
+	var b strings.Builder
+	for _, decl := range decls {
+		fmt.Fprintf(&b, "%s%s\t%s\t%s\n", decl.Path, lineRange(decl.Node.Location), decl.Node.Type, decl.Symbol)
+	}
+	return b.String(), nil
+}
+
+// getFunctionSource implements get_function_source
+func getFunctionSource(_ context.Context, s *Server, args toolArgs) (string, error) {
+	decls := s.resolve(args.Symbol, args.Path)
+	if len(decls) == 0 {
+		return "", fmt.Errorf("%w for %q", errNoMatch, args.Symbol)
+	}
+
+	var b strings.Builder
+	for _, decl := range decls {
+		loc := decl.Node.Location
+		if loc == nil {
+			continue
+		}
+		source, err := s.opts.Source(decl.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read source of %s: %w", decl.Path, err)
+		}
+		text, ok := uast.NewLineIndex(source).Lines(loc.Start.Line, loc.End.Line)
+		if !ok {
+			return "", fmt.Errorf("source of %s does not match its tree", decl.Path)
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "// %s%s %s\n", decl.Path, lineRange(loc), decl.Symbol)
+		b.Write(text)
+		b.WriteString("\n")
+	}
+	if b.Len() == 0 {
+		return "", fmt.Errorf("declarations of %q have no locations", args.Symbol)
+	}
+	return b.String(), nil
+}
+
+// queryAST implements query_ast
+func queryAST(ctx context.Context, s *Server, args toolArgs) (string, error) {
+	query, err := uast.Compile(args.Pattern)
+	if err != nil {
+		return "", err
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	paths := s.workspace.Paths()
+	if args.Path != "" {
+		if _, ok := s.workspace.Get(args.Path); !ok {
+			return "", fmt.Errorf("no file %q in the workspace", args.Path)
+		}
+		paths = []string{args.Path}
+	}
+
+	var b strings.Builder
+	found := 0
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		u, _ := s.workspace.Get(path)
+		for _, match := range query.Search(u) {
+			found++
+			if found > limit {
+				continue
+			}
+			node := match.Node
+			line, column := uint32(0), uint32(0)
+			if node.Location != nil {
+				line, column = node.Location.Start.Line, node.Location.Start.Column
+			}
+			fmt.Fprintf(&b, "%s:%d:%d\t%s\t%s\n", path, line, column, node.Type, node.Token)
+		}
+	}
+	switch {
+	case found == 0:
+		return "No matches.", nil
+	case found > limit:
+		fmt.Fprintf(&b, "... %d more matches\n", found-limit)
+	}
+	return b.String(), nil
+}
+
+// resolve finds declarations by qualified name, falling back to plain name,
+// optionally limited to one file
+func (s *Server) resolve(symbol, path string) []uast.Declaration {
+	decls := s.workspace.ResolveSymbol(symbol)
+	if len(decls) == 0 {
+		decls = s.workspace.DeclarationsOf(symbol)
+	}
+	if path == "" {
+		return decls
+	}
+	var inPath []uast.Declaration
+	for _, decl := range decls {
+		if decl.Path == path {
+			inPath = append(inPath, decl)
+		}
+	}
+	return inPath
+}
+
+// lineRange formats the lines of a location as ":start-end"
+func lineRange(loc *uast.Location) string {
+	if loc == nil {
+		return ""
+	}
+	return fmt.Sprintf(":%d-%d", loc.Start.Line, loc.End.Line)
+}
@@ -0,0 +1,158 @@
+package uast
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ConflictPolicy chooses how Merge resolves a metadata key set to different
+// values in several trees
+type ConflictPolicy int
+
+const (
+	// KeepFirst keeps the value of the first tree that sets the key
+	KeepFirst ConflictPolicy = iota
+	// KeepLast keeps the value of the last tree that sets the key
+	KeepLast
+	// FailOnConflict makes Merge return an error
+	FailOnConflict
+)
+
+// IDPolicy chooses how Merge keeps node IDs unique across trees
+type IDPolicy int
+
+const (
+	// PrefixIDs prefixes each tree's IDs with its path, such as
+	// "main.go:12", or with its index if it has none
+	PrefixIDs IDPolicy = iota
+	// KeepIDs keeps IDs as they are, such as content hashes, and makes
+	// Merge return an error if two nodes share one
+	KeepIDs
+)
+
+// MergePolicy configures MergeWithPolicy. The zero value prefixes IDs and
+// keeps the first value of conflicting metadata.
+type MergePolicy struct {
+	Metadata ConflictPolicy
+	IDs      IDPolicy
+}
+
+// mergedRootID is the ID of the synthetic root, which sequential IDs never use
+const mergedRootID = "0"
+
+// Merge combines trees into one queryable UAST, as MergeWithPolicy does with
+// the zero MergePolicy
+func Merge(trees ...*UAST) (*UAST, error) {
+	return MergeWithPolicy(MergePolicy{}, trees...)
+}
+
+// MergeWithPolicy combines trees, such as the files of a package, into one
+// UAST under a synthetic Package root, with combined indices and
+// diagnostics. Each tree's root records its "path" and "filename" metadata
+// as properties, and the rest of the metadata is merged by the policy. If
+// the trees are in different languages, the merged tree has none and each
+// root is tagged with its own, as injected trees are. Frozen trees cannot be
+// merged, and the trees must not be used after a successful merge.
+func MergeWithPolicy(policy MergePolicy, trees ...*UAST) (*UAST, error) {
+	language := ""
+	prefixes := make([]string, len(trees))
+	for i, tree := range trees {
+		if tree == nil {
+			return nil, fmt.Errorf("failed to merge tree %d: %w", i, ErrNilRoot)
+		}
+
+		tree.mu.RLock()
+		treeRoot, frozen, treeLanguage := tree.Root, tree.frozen, tree.Language
+		prefixes[i] = tree.Metadata["path"]
+		if prefixes[i] == "" {
+			prefixes[i] = tree.Metadata["filename"]
+		}
+		tree.mu.RUnlock()
+
+		if treeRoot == nil {
+			return nil, fmt.Errorf("failed to merge tree %d: %w", i, ErrNilRoot)
+		}
+		if frozen {
+			return nil, fmt.Errorf("failed to merge tree %d: %w", i, ErrFrozen)
+		}
+		if i == 0 {
+			language = treeLanguage
+		} else if treeLanguage != language {
+			language = ""
+		}
+		if prefixes[i] == "" {
+			prefixes[i] = strconv.Itoa(i)
+		}
+	}
+
+	// Check for conflicts before changing any tree
+	newID := func(i int, id string) string {
+		if policy.IDs == PrefixIDs && id != "" {
+			return prefixes[i] + ":" + id
+		}
+		return id
+	}
+	ids := map[string]bool{mergedRootID: true}
+	metadata := make(map[string]string)
+	for i, tree := range trees {
+		tree.mu.RLock()
+		var duplicate string
+		walk(tree.Root, func(node *Node, _ int) {
+			id := newID(i, node.ID)
+			if ids[id] && duplicate == "" {
+				duplicate = id
+			}
+			ids[id] = true
+		})
+		var conflict error
+		for _, key := range sortedKeys(tree.Metadata) {
+			if key == "path" || key == "filename" {
+				continue
+			}
+			value := tree.Metadata[key]
+			existing, ok := metadata[key]
+			switch {
+			case !ok || existing == value || policy.Metadata == KeepLast:
+				metadata[key] = value
+			case policy.Metadata == FailOnConflict && conflict == nil:
+				conflict = fmt.Errorf("failed to merge tree %d: metadata %q is %q, not %q", i, key, value, existing)
+			}
+		}
+		tree.mu.RUnlock()
+
+		if duplicate != "" {
+			return nil, fmt.Errorf("failed to merge tree %d: duplicate node ID %q", i, duplicate)
+		}
+		if conflict != nil {
+			return nil, conflict
+		}
+	}
+
+	root := &Node{ID: mergedRootID, Type: Package}
+	var diagnostics []Diagnostic
+	for i, tree := range trees {
+		tree.mu.Lock()
+		walk(tree.Root, func(node *Node, _ int) { node.ID = newID(i, node.ID) })
+		for _, key := range []string{"path", "filename"} {
+			if value, ok := tree.Metadata[key]; ok {
+				tree.Root.SetProperty(key, value)
+			}
+		}
+		if language == "" && tree.Language != "" {
+			tree.Root.SetProperty(languageProperty, tree.Language)
+		}
+		for _, diagnostic := range tree.Diagnostics {
+			if diagnostic.NodeID != "" {
+				diagnostic.NodeID = newID(i, diagnostic.NodeID)
+			}
+			diagnostics = append(diagnostics, diagnostic)
+		}
+		root.Children = append(root.Children, tree.Root)
+		tree.mu.Unlock()
+	}
+
+	merged := NewUAST(root, language)
+	merged.Metadata = metadata
+	merged.Diagnostics = diagnostics
+	return merged, nil
+}
@@ -0,0 +1,128 @@
+package uast
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetadataKey joins a namespace and a name into a metadata key such as
+// "git.commit". Keys without a namespace, such as "filename" and "path", are
+// reserved for this package.
+func MetadataKey(namespace, name string) string {
+	return namespace + "." + name
+}
+
+// MetadataNamespace returns the metadata in a namespace, keyed by name
+func (u *UAST) MetadataNamespace(namespace string) map[string]string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	values := make(map[string]string)
+	for key, value := range u.Metadata {
+		if name, ok := strings.CutPrefix(key, namespace+"."); ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// SetMetadataInt sets an integer metadata value, stored in base 10
+func (u *UAST) SetMetadataInt(key string, value int64) {
+	u.AddMetadata(key, strconv.FormatInt(value, 10))
+}
+
+// SetMetadataBool sets a boolean metadata value, stored as "true" or "false"
+func (u *UAST) SetMetadataBool(key string, value bool) {
+	u.AddMetadata(key, strconv.FormatBool(value))
+}
+
+// SetMetadataTime sets a time metadata value, stored in RFC 3339 format
+func (u *UAST) SetMetadataTime(key string, value time.Time) {
+	u.AddMetadata(key, value.Format(time.RFC3339Nano))
+}
+
+// SetMetadataStrings sets a list metadata value, stored as a JSON array
+func (u *UAST) SetMetadataStrings(key string, values []string) {
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values) // Strings always marshal
+	u.AddMetadata(key, string(data))
+}
+
+// SetMetadataJSON sets a metadata value of any type, stored as JSON
+func (u *UAST) SetMetadataJSON(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata %q: %w", key, err)
+	}
+	u.AddMetadata(key, string(data))
+	return nil
+}
+
+// metadata returns a metadata value
+func (u *UAST) metadata(key string) (string, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	value, ok := u.Metadata[key]
+	return value, ok
+}
+
+// MetadataInt returns an integer metadata value. ok is false if the key is
+// not set or its value is not an integer.
+func (u *UAST) MetadataInt(key string) (value int64, ok bool) {
+	text, ok := u.metadata(key)
+	if !ok {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	return value, err == nil
+}
+
+// MetadataBool returns a boolean metadata value. ok is false if the key is
+// not set or its value is not a boolean.
+func (u *UAST) MetadataBool(key string) (value, ok bool) {
+	text, ok := u.metadata(key)
+	if !ok {
+		return false, false
+	}
+	value, err := strconv.ParseBool(text)
+	return value, err == nil
+}
+
+// MetadataTime returns a time metadata value. ok is false if the key is not
+// set or its value is not an RFC 3339 time.
+func (u *UAST) MetadataTime(key string) (value time.Time, ok bool) {
+	text, ok := u.metadata(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	value, err := time.Parse(time.RFC3339Nano, text)
+	return value, err == nil
+}
+
+// MetadataStrings returns a list metadata value. ok is false if the key is
+// not set or its value is not a JSON array of strings.
+func (u *UAST) MetadataStrings(key string) (values []string, ok bool) {
+	text, ok := u.metadata(key)
+	if !ok || json.Unmarshal([]byte(text), &values) != nil {
+		return nil, false
+	}
+	return values, true
+}
+
+// MetadataJSON decodes a metadata value set with SetMetadataJSON into target
+func (u *UAST) MetadataJSON(key string, target any) error {
+	text, ok := u.metadata(key)
+	if !ok {
+		return fmt.Errorf("metadata %q is not set", key)
+	}
+	if err := json.Unmarshal([]byte(text), target); err != nil {
+		return fmt.Errorf("%w metadata %q: %w", ErrDecode, key, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/flaticols/uast-go"
+)
+
+// decisionOperators are short-circuit operators that add a branch
+var decisionOperators = map[string]bool{
+	"&&":  true,
+	"||":  true,
+	"??":  true,
+	"and": true,
+	"or":  true,
+}
+
+// defaultCases are the case clauses taken when no other case matches, which
+// add no path of their own
+var defaultCases = map[string]bool{
+	"default_case":   true,
+	"default_clause": true,
+	"switch_default": true,
+}
+
+// FunctionComplexity is the cyclomatic complexity of a single function
+type FunctionComplexity struct {
+	Symbol     string     `json:"symbol"`
+	Node       *uast.Node `json:"-"`
+	Complexity int        `json:"complexity"`
+}
+
+// Cyclomatic returns the cyclomatic complexity of a function: one plus the
+// number of conditions, loops, non-default case clauses and short-circuit
+// operators in its body. Nested functions are not counted.
+func Cyclomatic(fn *uast.Node) int {
+	if fn == nil {
+		return 0
+	}
+
+	complexity := 1
+	walkBody(fn, func(node *uast.Node, _ int) {
+		if isDecisionPoint(node) {
+			complexity++
+		}
+	})
+	return complexity
+}
+
+// isDecisionPoint reports whether the node adds a path through the code
+func isDecisionPoint(node *uast.Node) bool {
+	switch node.Type {
+	case uast.Condition, uast.Loop:
+		return true
+	}
+
+	tsType := node.Properties["ts_type"]
+	if defaultCases[tsType] {
+		return false
+	}
+	if strings.HasSuffix(tsType, "case_clause") || strings.HasSuffix(tsType, "_case") ||
+		tsType == "catch_clause" || tsType == "conditional_expression" {
+		return true
+	}
+
+	return len(node.Children) == 0 && decisionOperators[node.Token]
+}
+
+// CyclomaticReport returns the complexity of every function and method in the
+// UAST, keyed by qualified symbol. Duplicate symbols get a "#n" suffix.
+func CyclomaticReport(u *uast.UAST) map[string]FunctionComplexity {
+	report := make(map[string]FunctionComplexity)
+	seen := make(map[string]int)
+
+	for _, fn := range Functions(u) {
+		symbol := uniqueSymbol(Symbol(fn), seen)
+		report[symbol] = FunctionComplexity{
+			Symbol:     symbol,
+			Node:       fn,
+			Complexity: Cyclomatic(fn),
+		}
+	}
+	return report
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"math"
+
+	"github.com/flaticols/uast-go"
+)
+
+// TokenClass classifies leaf tokens for Halstead metrics
+type TokenClass int
+
+const (
+	// NotToken marks nodes that are not counted, such as inner nodes and comments
+	NotToken TokenClass = iota
+	// OperatorToken marks operators, keywords and punctuation
+	OperatorToken
+	// OperandToken marks identifiers and literals
+	OperandToken
+)
+
+// Classify returns the Halstead class of a node. Only leaves with a token are
+// counted: identifiers, literals and declaration names are operands, while
+// Operator nodes and other keyword or punctuation leaves are operators.
+func Classify(node *uast.Node) TokenClass {
+	if node == nil || len(node.Children) > 0 || node.Token == "" {
+		return NotToken
+	}
+
+	switch node.Type {
+	case uast.Comment:
+		return NotToken
+	case uast.Identifier, uast.Literal, uast.Variable, uast.Parameter, uast.Argument,
+		uast.Function, uast.Method, uast.Class:
+		return OperandToken
+	}
+	return OperatorToken
+}
+
+// Halstead holds Halstead software science measures
+type Halstead struct {
+	DistinctOperators int     `json:"distinctOperators"` // n1
+	DistinctOperands  int     `json:"distinctOperands"`  // n2
+	TotalOperators    int     `json:"totalOperators"`    // N1
+	TotalOperands     int     `json:"totalOperands"`     // N2
+	Vocabulary        int     `json:"vocabulary"`        // n = n1 + n2
+	Length            int     `json:"length"`            // N = N1 + N2
+	Volume            float64 `json:"volume"`            // N * log2(n)
+	Difficulty        float64 `json:"difficulty"`        // n1/2 * N2/n2
+	Effort            float64 `json:"effort"`            // D * V
+}
+
+// HalsteadOf computes Halstead measures for a function, excluding nested
+// functions, or for any other node including everything beneath it
+func HalsteadOf(node *uast.Node) Halstead {
+	var h Halstead
+	if node == nil {
+		return h
+	}
+
+	operators := make(map[string]bool)
+	operands := make(map[string]bool)
+
+	count := func(n *uast.Node, _ int) {
+		switch Classify(n) {
+		case OperatorToken:
+			h.TotalOperators++
+			operators[n.Token] = true
+		case OperandToken:
+			h.TotalOperands++
+			operands[n.Token] = true
+		}
+	}
+	walkDescendants(node, isFunction(node), count)
+
+	h.DistinctOperators = len(operators)
+	h.DistinctOperands = len(operands)
+	h.Vocabulary = h.DistinctOperators + h.DistinctOperands
+	h.Length = h.TotalOperators + h.TotalOperands
+
+	if h.Vocabulary > 0 {
+		h.Volume = float64(h.Length) * math.Log2(float64(h.Vocabulary))
+	}
+	if h.DistinctOperands > 0 {
+		h.Difficulty = float64(h.DistinctOperators) / 2 * float64(h.TotalOperands) / float64(h.DistinctOperands)
+	}
+	h.Effort = h.Difficulty * h.Volume
+	return h
+}
+
+// Maintainability combines Halstead volume, cyclomatic complexity and length
+type Maintainability struct {
+	Symbol     string     `json:"symbol"`
+	Node       *uast.Node `json:"-"`
+	Halstead   Halstead   `json:"halstead"`
+	Cyclomatic int        `json:"cyclomatic"`
+	Lines      int        `json:"lines"`
+	Index      float64    `json:"index"` // 0 (unmaintainable) to 100
+}
+
+// MaintainabilityIndex computes the maintainability index of a function or
+// file, normalized to the range 0-100:
+//
+//	max(0, (171 - 5.2*ln(V) - 0.23*CC - 16.2*ln(LOC)) * 100/171)
+func MaintainabilityIndex(node *uast.Node) float64 {
+	return measureMaintainability(node).Index
+}
+
+// measureMaintainability computes all inputs of the maintainability index
+func measureMaintainability(node *uast.Node) Maintainability {
+	m := Maintainability{
+		Node:     node,
+		Halstead: HalsteadOf(node),
+		Lines:    max(Lines(node), 1),
+	}
+	if node == nil {
+		return m
+	}
+
+	if isFunction(node) {
+		m.Cyclomatic = Cyclomatic(node)
+	} else {
+		m.Cyclomatic = 1
+		walkDescendants(node, false, func(n *uast.Node, _ int) {
+			if isDecisionPoint(n) {
+				m.Cyclomatic++
+			}
+		})
+	}
+
+	volume := max(m.Halstead.Volume, 1)
+	mi := 171 - 5.2*math.Log(volume) - 0.23*float64(m.Cyclomatic) - 16.2*math.Log(float64(m.Lines))
+	m.Index = max(0, mi*100/171)
+	return m
+}
+
+// MaintainabilityReport returns the maintainability of the whole file and of
+// every function and method in it, keyed by qualified symbol
+func MaintainabilityReport(u *uast.UAST) (Maintainability, map[string]Maintainability) {
+	functions := make(map[string]Maintainability)
+	if u == nil {
+		return Maintainability{}, functions
+	}
+
+	file := measureMaintainability(u.Root)
+	file.Symbol = u.Metadata["filename"]
+
+	seen := make(map[string]int)
+	for _, fn := range Functions(u) {
+		m := measureMaintainability(fn)
+		m.Symbol = uniqueSymbol(Symbol(fn), seen)
+		functions[m.Symbol] = m
+	}
+	return file, functions
+}
@@ -0,0 +1,89 @@
+// Package metrics computes code metrics from UASTs
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/flaticols/uast-go"
+)
+
+// isFunction reports whether the node is a function-like declaration
+func isFunction(node *uast.Node) bool {
+	return node.Type == uast.Function || node.Type == uast.Method
+}
+
+// lambdaTypes are the tree-sitter types of anonymous functions, which
+// profiles leave unmapped
+var lambdaTypes = map[string]bool{
+	"func_literal":        true,
+	"lambda":              true,
+	"lambda_expression":   true,
+	"arrow_function":      true,
+	"function_expression": true,
+}
+
+// isLambda reports whether a node is an anonymous function
+func isLambda(node *uast.Node) bool {
+	return lambdaTypes[node.Properties["ts_type"]]
+}
+
+// Functions returns every Function and Method node in the UAST
+func Functions(u *uast.UAST) []*uast.Node {
+	if u == nil {
+		return nil
+	}
+	return u.Query().Type(uast.Function, uast.Method).All()
+}
+
+// Symbol returns a qualified name for a declaration, such as
+// "Example.test", built from the names of its enclosing classes and functions
+func Symbol(node *uast.Node) string {
+	return uast.QualifiedName(node)
+}
+
+// walkBody visits the nodes of a function body in pre-order, without
+// descending into nested functions, which are measured separately
+func walkBody(fn *uast.Node, visit func(node *uast.Node, depth int)) {
+	walkDescendants(fn, true, visit)
+}
+
+// walkDescendants visits the descendants of root in pre-order, optionally
+// skipping nested functions and their subtrees
+func walkDescendants(root *uast.Node, skipFunctions bool, visit func(node *uast.Node, depth int)) {
+	type entry struct {
+		node  *uast.Node
+		depth int
+	}
+
+	stack := make([]entry, 0, len(root.Children))
+	for i := len(root.Children) - 1; i >= 0; i-- {
+		if root.Children[i] != nil {
+			stack = append(stack, entry{root.Children[i], 1})
+		}
+	}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if skipFunctions && isFunction(top.node) {
+			continue
+		}
+		visit(top.node, top.depth)
+
+		for i := len(top.node.Children) - 1; i >= 0; i-- {
+			if child := top.node.Children[i]; child != nil {
+				stack = append(stack, entry{child, top.depth + 1})
+			}
+		}
+	}
+}
+
+// uniqueSymbol returns symbol, suffixed with "#n" if it is already in seen
+func uniqueSymbol(symbol string, seen map[string]int) string {
+	seen[symbol]++
+	if n := seen[symbol]; n > 1 {
+		return fmt.Sprintf("%s#%d", symbol, n)
+	}
+	return symbol
+}
@@ -0,0 +1,124 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/metrics"
+)
+
+func loadExample(t *testing.T) *uast.UAST {
+	t.Helper()
+
+	tsNode, err := uast.LoadTreeSitterCST("../testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	converter := uast.NewConverter()
+	if profile, ok := uast.LookupProfile("go"); ok {
+		converter.ApplyProfile(profile)
+	}
+
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	return u
+}
+
+func TestCyclomaticReport(t *testing.T) {
+	report := metrics.CyclomaticReport(loadExample(t))
+
+	want := map[string]int{
+		"add":  1,
+		"main": 3,
+	}
+	if len(report) != len(want) {
+		t.Fatalf("Expected %d functions, got %d: %v", len(want), len(report), report)
+	}
+	for symbol, complexity := range want {
+		if got := report[symbol].Complexity; got != complexity {
+			t.Errorf("Expected complexity of %s to be %d, got %d", symbol, complexity, got)
+		}
+	}
+}
+
+func TestCyclomaticSwitch(t *testing.T) {
+	clause := func(tsType string) *uast.Node {
+		return uast.B(uast.Unknown, "").WithProperty("ts_type", tsType)
+	}
+	switchOf := func(clauses ...*uast.Node) *uast.Node {
+		return uast.B(uast.Function, "f", uast.B(uast.Unknown, "", clauses...).WithProperty("ts_type", "expression_switch_statement"))
+	}
+
+	// switch x { case 1: }
+	if got := metrics.Cyclomatic(switchOf(clause("expression_case"))); got != 2 {
+		t.Errorf("Expected a single case to add one path, got %d", got)
+	}
+	// switch x { case 1: default: }, in Go and as other grammars name default cases
+	for _, tsType := range []string{"default_case", "default_clause", "switch_default"} {
+		if got := metrics.Cyclomatic(switchOf(clause("expression_case"), clause(tsType))); got != 2 {
+			t.Errorf("Expected %s to add no path, got %d", tsType, got)
+		}
+	}
+}
+
+func TestParameterCount(t *testing.T) {
+	ident := func(name string) *uast.Node {
+		return uast.B(uast.Identifier, name).WithProperty("ts_type", "identifier")
+	}
+	param := func(children ...*uast.Node) *uast.Node {
+		return uast.B(uast.Parameter, "", children...).WithProperty("ts_type", "parameter_declaration")
+	}
+	funcType := uast.B(uast.Unknown, "", param(ident("x"), uast.B(uast.Identifier, "int"))).WithProperty("ts_type", "function_type")
+	closure := uast.B(uast.Unknown, "", param(ident("y"), uast.B(uast.Identifier, "int"))).WithProperty("ts_type", "func_literal")
+
+	// func f(g func(x int), a, b int) { h := func(y int) {} }
+	fn := uast.B(uast.Function, "f",
+		param(ident("g"), funcType),
+		param(ident("a"), ident("b"), uast.B(uast.Identifier, "int")),
+		uast.B(uast.Unknown, "", uast.B(uast.Assignment, "", ident("h"), closure)).WithProperty("ts_type", "block"),
+	)
+	if got := metrics.ParameterCount(fn); got != 3 {
+		t.Errorf("Expected g, a and b to count, got %d", got)
+	}
+}
+
+func TestFunctionReport(t *testing.T) {
+	report := metrics.FunctionReport(loadExample(t))
+
+	add, ok := report["add"]
+	if !ok {
+		t.Fatalf("Expected report to contain add")
+	}
+	if add.Parameters != 2 || add.Lines != 3 || add.MaxNesting != 0 {
+		t.Errorf("Unexpected metrics for add: %+v", add)
+	}
+
+	main := report["main"]
+	if main.Parameters != 0 || main.MaxNesting != 1 || main.Cyclomatic != 3 {
+		t.Errorf("Unexpected metrics for main: %+v", main)
+	}
+}
+
+func TestHalstead(t *testing.T) {
+	_, functions := metrics.MaintainabilityReport(loadExample(t))
+
+	// func add(a, b int) int { return a + b }
+	add := functions["add"].Halstead
+	if add.DistinctOperators != 3 || add.TotalOperators != 3 {
+		t.Errorf("Expected operators func, return and +, got %+v", add)
+	}
+	if add.DistinctOperands != 4 || add.TotalOperands != 7 {
+		t.Errorf("Expected operands add, a, b and int, got %+v", add)
+	}
+
+	index := functions["add"].Index
+	if index <= 0 || index > 100 {
+		t.Errorf("Expected maintainability index in (0, 100], got %f", index)
+	}
+	if main := functions["main"].Index; main >= index {
+		t.Errorf("Expected main (%f) to be less maintainable than add (%f)", main, index)
+	}
+}
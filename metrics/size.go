@@ -0,0 +1,114 @@
+package metrics
+
+import "github.com/flaticols/uast-go"
+
+// FunctionMetrics holds size and structure metrics for a single function
+type FunctionMetrics struct {
+	Symbol     string     `json:"symbol"`
+	Node       *uast.Node `json:"-"`
+	Lines      int        `json:"lines"`
+	MaxNesting int        `json:"maxNesting"`
+	Parameters int        `json:"parameters"`
+	Cyclomatic int        `json:"cyclomatic"`
+}
+
+// Lines returns the number of source lines spanned by the node, or 0 if it
+// has no location
+func Lines(node *uast.Node) int {
+	if node == nil || node.Location == nil {
+		return 0
+	}
+	return int(node.Location.End.Line) - int(node.Location.Start.Line) + 1
+}
+
+// MaxNesting returns the deepest nesting of conditions and loops in a
+// function body. A body without any has nesting 0.
+func MaxNesting(fn *uast.Node) int {
+	if fn == nil {
+		return 0
+	}
+
+	// Track the nesting level of each control-flow node by walking upwards
+	// to the function, since walkBody only reports syntactic depth
+	levels := make(map[*uast.Node]int)
+	maxNesting := 0
+
+	walkBody(fn, func(node *uast.Node, _ int) {
+		level := 0
+		if parent := node.Parent(); parent != nil {
+			level = levels[parent]
+		}
+		if node.Type == uast.Condition || node.Type == uast.Loop {
+			level++
+			maxNesting = max(maxNesting, level)
+		}
+		levels[node] = level
+	})
+	return maxNesting
+}
+
+// ParameterCount returns the number of parameters a function declares.
+// Declarations naming several parameters, such as Go's "a, b int", count
+// each name. Parameters of closures in the body, or of a function type
+// within a parameter's type, are not the function's own.
+func ParameterCount(fn *uast.Node) int {
+	if fn == nil {
+		return 0
+	}
+
+	count := 0
+	stack := []*uast.Node{fn}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, child := range node.Children {
+			switch {
+			case child == nil, isFunction(child), isLambda(child):
+			case child.Type == uast.Parameter:
+				count += parameterNames(child)
+			default:
+				stack = append(stack, child)
+			}
+		}
+	}
+	return count
+}
+
+// parameterNames returns the number of names a parameter declaration binds,
+// counting an unnamed parameter as one
+func parameterNames(param *uast.Node) int {
+	names := 0
+	for _, child := range param.Children {
+		if child != nil && child.Properties["ts_type"] == "identifier" {
+			names++
+		}
+	}
+	return max(names, 1)
+}
+
+// Measure computes all function metrics for a single function
+func Measure(fn *uast.Node) FunctionMetrics {
+	return FunctionMetrics{
+		Symbol:     Symbol(fn),
+		Node:       fn,
+		Lines:      Lines(fn),
+		MaxNesting: MaxNesting(fn),
+		Parameters: ParameterCount(fn),
+		Cyclomatic: Cyclomatic(fn),
+	}
+}
+
+// FunctionReport returns metrics for every function and method in the UAST,
+// keyed by qualified symbol. Duplicate symbols get a "#n" suffix.
+func FunctionReport(u *uast.UAST) map[string]FunctionMetrics {
+	report := make(map[string]FunctionMetrics)
+	seen := make(map[string]int)
+
+	for _, fn := range Functions(u) {
+		m := Measure(fn)
+		m.Symbol = uniqueSymbol(m.Symbol, seen)
+		report[m.Symbol] = m
+	}
+	return report
+}
@@ -0,0 +1,409 @@
+package uast
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// indexKey records the type, token and roles a node is indexed under
+type indexKey struct {
+	nodeType NodeType
+	token    string
+	roles    []Role // Sorted and without duplicates
+}
+
+// keyOf returns the index key of a node as it is now
+func keyOf(node *Node) indexKey {
+	return indexKey{nodeType: node.Type, token: node.Token, roles: sortedRoles(node.Roles)}
+}
+
+// matches reports whether a node is still indexed correctly under the key
+func (k indexKey) matches(node *Node) bool {
+	return k.nodeType == node.Type && k.token == node.Token && slices.Equal(k.roles, sortedRoles(node.Roles))
+}
+
+// sortedRoles returns a sorted copy of roles without duplicates
+func sortedRoles(roles []Role) []Role {
+	if len(roles) == 0 {
+		return nil
+	}
+	return slices.Compact(slices.Sorted(slices.Values(roles)))
+}
+
+// ensureIndexedAs builds the indexedAs map from the current indices; the
+// caller must hold the write lock
+func (u *UAST) ensureIndexedAs() {
+	if u.indexedAs != nil {
+		return
+	}
+
+	u.indexedAs = make(map[*Node]indexKey)
+	for nodeType, nodes := range u.TypeIndex {
+		for _, node := range nodes {
+			u.indexedAs[node] = indexKey{nodeType: nodeType}
+		}
+	}
+	for token, nodes := range u.TokenIndex {
+		for _, node := range nodes {
+			key := u.indexedAs[node]
+			key.token = token
+			u.indexedAs[node] = key
+		}
+	}
+	for _, role := range slices.Sorted(maps.Keys(u.RoleIndex)) {
+		for _, node := range u.RoleIndex[role] {
+			key := u.indexedAs[node]
+			key.roles = append(key.roles, role)
+			u.indexedAs[node] = key
+		}
+	}
+}
+
+// indexNodesLocked appends nodes to the indices
+func (u *UAST) indexNodesLocked(nodes []*Node) {
+	u.scopes = nil
+	u.generation++
+	set := &indexSet{
+		types:       u.TypeIndex,
+		tokens:      u.TokenIndex,
+		roles:       u.RoleIndex,
+		folded:      u.FoldIndex,
+		indexConfig: indexConfig{linkParents: true, foldTokens: u.fold},
+	}
+	for _, node := range nodes {
+		set.add(node)
+		u.indexedAs[node] = keyOf(node)
+	}
+}
+
+// unindexNodesLocked removes nodes from the indices. Each affected index
+// bucket is filtered once, so the cost is proportional to the size of the
+// affected buckets rather than the whole tree.
+func (u *UAST) unindexNodesLocked(nodes []*Node) {
+	u.scopes = nil
+	u.generation++
+	removed := make(map[*Node]bool, len(nodes))
+	types := make(map[NodeType]bool)
+	tokens := make(map[string]bool)
+	roles := make(map[Role]bool)
+
+	for _, node := range nodes {
+		key, ok := u.indexedAs[node]
+		if !ok {
+			continue
+		}
+		removed[node] = true
+		types[key.nodeType] = true
+		if key.token != "" {
+			tokens[key.token] = true
+		}
+		for _, role := range key.roles {
+			roles[role] = true
+		}
+		delete(u.indexedAs, node)
+	}
+
+	isRemoved := func(node *Node) bool { return removed[node] }
+
+	for nodeType := range types {
+		if bucket := slices.DeleteFunc(u.TypeIndex[nodeType], isRemoved); len(bucket) > 0 {
+			u.TypeIndex[nodeType] = bucket
+		} else {
+			delete(u.TypeIndex, nodeType)
+		}
+	}
+	for token := range tokens {
+		if bucket := slices.DeleteFunc(u.TokenIndex[token], isRemoved); len(bucket) > 0 {
+			u.TokenIndex[token] = bucket
+		} else {
+			delete(u.TokenIndex, token)
+		}
+		if !u.fold {
+			continue
+		}
+		folded := foldToken(token)
+		if bucket := slices.DeleteFunc(u.FoldIndex[folded], isRemoved); len(bucket) > 0 {
+			u.FoldIndex[folded] = bucket
+		} else {
+			delete(u.FoldIndex, folded)
+		}
+	}
+	for role := range roles {
+		if bucket := slices.DeleteFunc(u.RoleIndex[role], isRemoved); len(bucket) > 0 {
+			u.RoleIndex[role] = bucket
+		} else {
+			delete(u.RoleIndex, role)
+		}
+	}
+}
+
+// subtreeNodes returns the nodes of the subtree rooted at root in pre-order
+func subtreeNodes(root *Node) []*Node {
+	var nodes []*Node
+	walk(root, func(node *Node, _ int) {
+		nodes = append(nodes, node)
+	})
+	return nodes
+}
+
+// ReindexSubtree brings the indices up to date after nodes in the subtree
+// rooted at node were edited in place or had descendants added, so the whole
+// tree doesn't have to be reindexed. Descendants detached from the subtree
+// must be removed with RemoveNode, or a full rebuild is needed. It returns
+// ErrFrozen for a frozen UAST.
+func (u *UAST) ReindexSubtree(node *Node) error {
+	if node == nil {
+		return fmt.Errorf("node cannot be nil")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	u.reindexSubtreeLocked(node)
+	return nil
+}
+
+// reindexSubtreeLocked reindexes only the nodes whose index keys changed
+func (u *UAST) reindexSubtreeLocked(node *Node) {
+	u.ensureIndexedAs()
+
+	var stale []*Node
+	var changed []*Node
+	walk(node, func(n *Node, _ int) {
+		for _, child := range n.Children {
+			if child != nil {
+				child.parent = n
+			}
+		}
+
+		key, ok := u.indexedAs[n]
+		if ok && key.matches(n) {
+			return
+		}
+		if ok {
+			stale = append(stale, n)
+		}
+		changed = append(changed, n)
+	})
+
+	u.unindexNodesLocked(stale)
+	u.indexNodesLocked(changed)
+}
+
+// MarkDirty records that the subtree rooted at node was edited in place. Dirty
+// subtrees are reindexed before the next query. It returns ErrFrozen for a
+// frozen UAST.
+func (u *UAST) MarkDirty(node *Node) error {
+	if node == nil {
+		return fmt.Errorf("node cannot be nil")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	u.dirty = append(u.dirty, node)
+	return nil
+}
+
+// indexGeneration returns a counter that changes whenever the indices do,
+// after reindexing subtrees marked dirty
+func (u *UAST) indexGeneration() uint64 {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.generation
+}
+
+// flushDirty reindexes subtrees marked dirty since the last query
+func (u *UAST) flushDirty() {
+	u.mu.RLock()
+	pending := len(u.dirty)
+	u.mu.RUnlock()
+
+	if pending == 0 {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, node := range u.dirty {
+		u.reindexSubtreeLocked(node)
+	}
+	u.dirty = nil
+}
+
+// checkMember returns an error unless node is indexed by this UAST
+func (u *UAST) checkMember(node *Node, name string) error {
+	if node == nil {
+		return fmt.Errorf("%s cannot be nil", name)
+	}
+	if _, ok := u.indexedAs[node]; !ok {
+		return fmt.Errorf("%s is not part of this UAST", name)
+	}
+	return nil
+}
+
+// checkDetached returns an error if root or any node below it is indexed by
+// this UAST, since a node can only be in the tree once
+func (u *UAST) checkDetached(root *Node, name string) error {
+	for _, node := range subtreeNodes(root) {
+		if _, ok := u.indexedAs[node]; !ok {
+			continue
+		}
+		if node == root {
+			return fmt.Errorf("%s is already part of this UAST", name)
+		}
+		return fmt.Errorf("%s holds a node already part of this UAST", name)
+	}
+	return nil
+}
+
+// AppendChild appends child as the last child of parent and indexes it
+func (u *UAST) AppendChild(parent, child *Node) error {
+	return u.InsertChild(parent, -1, child)
+}
+
+// InsertChild inserts child into parent's children at index and indexes it.
+// A negative index appends.
+func (u *UAST) InsertChild(parent *Node, index int, child *Node) error {
+	if child == nil {
+		return fmt.Errorf("child cannot be nil")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	u.ensureIndexedAs()
+	if err := u.checkMember(parent, "parent"); err != nil {
+		return err
+	}
+	if err := u.checkDetached(child, "child"); err != nil {
+		return err
+	}
+
+	if index < 0 || index > len(parent.Children) {
+		index = len(parent.Children)
+	}
+	parent.Children = slices.Insert(parent.Children, index, child)
+	child.parent = parent
+
+	u.indexNodesLocked(subtreeNodes(child))
+	return nil
+}
+
+// RemoveNode detaches node and its subtree from the tree and the indices
+func (u *UAST) RemoveNode(node *Node) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	u.ensureIndexedAs()
+	if err := u.checkMember(node, "node"); err != nil {
+		return err
+	}
+	if node == u.Root {
+		return fmt.Errorf("cannot remove the root node")
+	}
+
+	parent := node.parent
+	i := slices.Index(parent.Children, node)
+	if i < 0 {
+		return fmt.Errorf("node is not a child of its recorded parent")
+	}
+	parent.Children = slices.Delete(parent.Children, i, i+1)
+	node.parent = nil
+
+	u.unindexNodesLocked(subtreeNodes(node))
+	return nil
+}
+
+// ReplaceNode replaces old and its subtree with replacement, updating the
+// indices for both subtrees
+func (u *UAST) ReplaceNode(old, replacement *Node) error {
+	if replacement == nil {
+		return fmt.Errorf("replacement cannot be nil")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	u.ensureIndexedAs()
+	if err := u.checkMember(old, "node"); err != nil {
+		return err
+	}
+	if err := u.checkDetached(replacement, "replacement"); err != nil {
+		return err
+	}
+
+	if old == u.Root {
+		u.Root = replacement
+	} else {
+		parent := old.parent
+		i := slices.Index(parent.Children, old)
+		if i < 0 {
+			return fmt.Errorf("node is not a child of its recorded parent")
+		}
+		parent.Children[i] = replacement
+	}
+	replacement.parent = old.parent
+	old.parent = nil
+
+	u.unindexNodesLocked(subtreeNodes(old))
+	u.indexNodesLocked(subtreeNodes(replacement))
+	return nil
+}
+
+// SetNodeType changes a node's type and updates the type index
+func (u *UAST) SetNodeType(node *Node, nodeType NodeType) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	u.ensureIndexedAs()
+	if err := u.checkMember(node, "node"); err != nil {
+		return err
+	}
+
+	node.Type = nodeType
+	u.unindexNodesLocked([]*Node{node})
+	u.indexNodesLocked([]*Node{node})
+	return nil
+}
+
+// SetNodeToken changes a node's token and updates the token index
+func (u *UAST) SetNodeToken(node *Node, token string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	u.ensureIndexedAs()
+	if err := u.checkMember(node, "node"); err != nil {
+		return err
+	}
+
+	node.Token = token
+	u.unindexNodesLocked([]*Node{node})
+	u.indexNodesLocked([]*Node{node})
+	return nil
+}
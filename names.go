@@ -0,0 +1,71 @@
+package uast
+
+import "slices"
+
+// NameRule tells the converter where the name of a declaration is in the CST,
+// so it can be set as the node's "name" property, its NameLocation and, if
+// the node has no text of its own, its Token
+type NameRule struct {
+	TSType     string   `json:"tsType"`          // Declaration node type, such as function_declaration
+	Field      string   `json:"field,omitempty"` // Field holding the name, when the CST records fields
+	ChildTypes []string `json:"childTypes,omitempty"`
+}
+
+// AddNameRule adds or replaces the name rule for a Tree-sitter type
+func (c *Converter) AddNameRule(rule NameRule) {
+	c.nameRules[rule.TSType] = rule
+}
+
+// nameChild returns the child holding the name: the child in the rule's
+// field if the CST records one, otherwise the first child of one of the
+// rule's types
+func (r *NameRule) nameChild(tsNode *TreeSitterNode) *TreeSitterNode {
+	if r.Field != "" {
+		for _, child := range tsNode.Children {
+			if child != nil && child.Field == r.Field {
+				return child
+			}
+		}
+	}
+	for _, child := range tsNode.Children {
+		if child != nil && slices.Contains(r.ChildTypes, child.Type) {
+			return child
+		}
+	}
+	return nil
+}
+
+// defaultNameTypes are the CST types taken as the name of a Function, Method
+// or Class node that has no name rule
+var defaultNameTypes = []string{"identifier", "field_identifier", "type_identifier", "property_identifier", "name", "constant"}
+
+// extractName sets the name and name location of a declaration node from its
+// CST children. Without a name rule, only the name location of functions,
+// methods and classes is set.
+func (c *Converter) extractName(tsNode *TreeSitterNode, node *Node) {
+	rule, ok := c.nameRules[tsNode.Type]
+	if !ok {
+		switch node.Type {
+		case Function, Method, Class:
+			rule = NameRule{Field: "name", ChildTypes: defaultNameTypes}
+		default:
+			return
+		}
+	}
+
+	child := rule.nameChild(tsNode)
+	if child == nil {
+		return
+	}
+	location := tsLocation(child)
+	node.NameLocation = &location
+
+	if !ok || child.Text == "" {
+		return
+	}
+	name := c.intern(child.Text)
+	node.SetProperty("name", name)
+	if node.Token == "" {
+		node.Token = name
+	}
+}
@@ -0,0 +1,116 @@
+package uast
+
+// EnclosingFunction returns the nearest Function or Method ancestor of the
+// node, or nil if it is not inside one
+func (n *Node) EnclosingFunction() *Node {
+	return closest(n.parent, Function, Method)
+}
+
+// EnclosingClass returns the nearest Class ancestor of the node, or nil if it
+// is not inside one
+func (n *Node) EnclosingClass() *Node {
+	return closest(n.parent, Class)
+}
+
+// closest returns node or its nearest ancestor with one of the given types
+func closest(node *Node, types ...NodeType) *Node {
+	for ; node != nil; node = node.parent {
+		for _, t := range types {
+			if node.Type == t {
+				return node
+			}
+		}
+	}
+	return nil
+}
+
+// NodeAt returns the innermost node whose location contains the position, or
+// nil if the root doesn't contain it. Children without a location are
+// skipped.
+func (u *UAST) NodeAt(pos Position) *Node {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return nodeAt(u.Root, pos)
+}
+
+// nodeAt descends from root to the innermost node containing pos
+func nodeAt(root *Node, pos Position) *Node {
+	if root == nil || (root.Location != nil && !root.Location.Contains(pos)) {
+		return nil
+	}
+
+	node := root
+	for {
+		var next *Node
+		for _, child := range node.Children {
+			if child != nil && child.Location != nil && child.Location.Contains(pos) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+}
+
+// FunctionAt returns the innermost Function or Method containing the
+// position, or nil if there is none
+func (u *UAST) FunctionAt(pos Position) *Node {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return closest(nodeAt(u.Root, pos), Function, Method)
+}
+
+// ClassAt returns the innermost Class containing the position, or nil if
+// there is none
+func (u *UAST) ClassAt(pos Position) *Node {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return closest(nodeAt(u.Root, pos), Class)
+}
+
+// IndexInParent returns the node's index in its parent's children, or -1 for
+// the root or a detached node
+func (n *Node) IndexInParent() int {
+	if n.parent == nil {
+		return -1
+	}
+	for i, child := range n.parent.Children {
+		if child == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// NextSibling returns the node after n among its parent's children, or nil
+// if n is the last one
+func (n *Node) NextSibling() *Node {
+	index := n.IndexInParent()
+	if index < 0 {
+		return nil
+	}
+	for _, sibling := range n.parent.Children[index+1:] {
+		if sibling != nil {
+			return sibling
+		}
+	}
+	return nil
+}
+
+// PrevSibling returns the node before n among its parent's children, or nil
+// if n is the first one
+func (n *Node) PrevSibling() *Node {
+	index := n.IndexInParent()
+	for i := index - 1; i >= 0; i-- {
+		if sibling := n.parent.Children[i]; sibling != nil {
+			return sibling
+		}
+	}
+	return nil
+}
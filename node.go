@@ -0,0 +1,118 @@
+package uast
+
+import (
+	"fmt"
+	"slices"
+)
+
+// NodeOption sets a field of a node made by NewNode
+type NodeOption func(*Node)
+
+// NodeID sets the node's ID
+func NodeID(id string) NodeOption {
+	return func(n *Node) { n.ID = id }
+}
+
+// NodeToken sets the node's token
+func NodeToken(token string) NodeOption {
+	return func(n *Node) { n.Token = token }
+}
+
+// NodeRoles adds roles to the node
+func NodeRoles(roles ...Role) NodeOption {
+	return func(n *Node) { n.WithRoles(roles...) }
+}
+
+// NodeProperty sets a property of the node
+func NodeProperty(key, value string) NodeOption {
+	return func(n *Node) { n.SetProperty(key, value) }
+}
+
+// NodeLocation sets the node's location
+func NodeLocation(start, end Position) NodeOption {
+	return func(n *Node) { n.Location = &Location{Start: start, End: end} }
+}
+
+// NodeNameLocation sets the location of the node's name
+func NodeNameLocation(start, end Position) NodeOption {
+	return func(n *Node) { n.NameLocation = &Location{Start: start, End: end} }
+}
+
+// NodeChildren appends children to the node
+func NodeChildren(children ...*Node) NodeOption {
+	return func(n *Node) { n.Children = append(n.Children, children...) }
+}
+
+// exclusiveRoles lists groups of roles of which a node has at most one
+var exclusiveRoles = [][]Role{
+	{RoleLeft, RoleRight},
+	{RoleThen, RoleElse},
+	{RoleBinary, RoleUnary},
+	{RoleString, RoleNumber, RoleBoolean, RoleNull},
+}
+
+// NewNode makes a node of a type with the given options, checking the
+// invariants the indices and formatters rely on: the node has a type and an
+// ID, its locations end no earlier than they start, its name and children
+// lie within its location, its children are not nil, and it has at most one
+// role of each exclusive group, such as RoleLeft and RoleRight. A failed
+// check returns an error wrapping ErrInvalidNode.
+func NewNode(nodeType NodeType, opts ...NodeOption) (*Node, error) {
+	node := &Node{Type: nodeType}
+	for _, opt := range opts {
+		opt(node)
+	}
+
+	fail := func(format string, args ...any) (*Node, error) {
+		return nil, fmt.Errorf("%w %s %q: %s", ErrInvalidNode, nodeType, node.ID, fmt.Sprintf(format, args...))
+	}
+	if nodeType == "" {
+		return fail("type cannot be empty")
+	}
+	if node.ID == "" {
+		return fail("ID cannot be empty")
+	}
+
+	for _, loc := range []*Location{node.Location, node.NameLocation} {
+		if loc != nil && loc.End.Before(loc.Start) {
+			return fail("location ends at %d:%d before it starts at %d:%d", loc.End.Line, loc.End.Column, loc.Start.Line, loc.Start.Column)
+		}
+	}
+	if node.Location != nil && node.NameLocation != nil && !node.Location.ContainsRange(*node.NameLocation) {
+		return fail("name lies outside the node")
+	}
+
+	for i, child := range node.Children {
+		if child == nil {
+			return fail("child %d is nil", i)
+		}
+		if node.Location != nil && child.Location != nil && !node.Location.ContainsRange(*child.Location) {
+			return fail("child %d %q lies outside the node", i, child.ID)
+		}
+	}
+
+	if conflict := roleConflicts(node); conflict != nil {
+		return fail("roles %v are exclusive", conflict)
+	}
+	return node, nil
+}
+
+// MustNewNode is NewNode for nodes known to be valid, panicking on error
+func MustNewNode(nodeType NodeType, opts ...NodeOption) *Node {
+	node, err := NewNode(nodeType, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+// roleConflicts returns the roles of a node that share an exclusive group
+func roleConflicts(node *Node) []Role {
+	for _, group := range exclusiveRoles {
+		found := slices.DeleteFunc(slices.Clone(group), func(role Role) bool { return !node.HasRole(role) })
+		if len(found) > 1 {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package uast
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// builtinNodeTypes lists the node types defined by this package
+var builtinNodeTypes = []NodeType{
+	File, Function, Class, Method, Variable, Literal, Expression, Statement,
+	Identifier, Comment, Argument, Parameter, Return, Loop, Condition,
+	Assignment, Operator, Call, Import, Package, Unknown,
+}
+
+// NodeTypeOptions describes a custom node type
+type NodeTypeOptions struct {
+	Description     string
+	TreeSitterTypes []string // CST node types converted to this type unless a converter maps them otherwise
+	Roles           []Role   // Roles given to every node of this type
+}
+
+// nodeTypeRegistry is an immutable snapshot of the registered node types.
+// Registration replaces the snapshot, so conversions read it without locking.
+type nodeTypeRegistry struct {
+	types    map[NodeType]NodeTypeOptions
+	byTSType map[string]NodeType
+}
+
+var (
+	nodeTypesMu sync.Mutex // Serialises registrations
+	nodeTypes   atomic.Pointer[nodeTypeRegistry]
+)
+
+// RegisterNodeType registers a custom node type, such as "Decorator" or
+// "Macro", replacing any earlier registration of the same name. Converters
+// map the given Tree-sitter types to it when they have no rule of their own.
+func RegisterNodeType(name NodeType, options NodeTypeOptions) error {
+	if name == "" {
+		return fmt.Errorf("failed to register node type: name cannot be empty")
+	}
+	if slices.Contains(builtinNodeTypes, name) {
+		return fmt.Errorf("failed to register node type %q: it is a built-in type", name)
+	}
+
+	nodeTypesMu.Lock()
+	defer nodeTypesMu.Unlock()
+
+	registry := cloneNodeTypeRegistry(nodeTypes.Load())
+	removeNodeType(registry, name)
+	options.TreeSitterTypes = slices.Clone(options.TreeSitterTypes)
+	options.Roles = slices.Clone(options.Roles)
+	registry.types[name] = options
+	for _, tsType := range options.TreeSitterTypes {
+		registry.byTSType[tsType] = name
+	}
+	nodeTypes.Store(registry)
+	return nil
+}
+
+// UnregisterNodeType removes a custom node type, reporting whether it was
+// registered
+func UnregisterNodeType(name NodeType) bool {
+	nodeTypesMu.Lock()
+	defer nodeTypesMu.Unlock()
+
+	current := nodeTypes.Load()
+	if current == nil {
+		return false
+	}
+	if _, ok := current.types[name]; !ok {
+		return false
+	}
+
+	registry := cloneNodeTypeRegistry(current)
+	removeNodeType(registry, name)
+	nodeTypes.Store(registry)
+	return true
+}
+
+// LookupNodeType returns the options a custom node type was registered with
+func LookupNodeType(name NodeType) (NodeTypeOptions, bool) {
+	registry := nodeTypes.Load()
+	if registry == nil {
+		return NodeTypeOptions{}, false
+	}
+	options, ok := registry.types[name]
+	return options, ok
+}
+
+// IsKnownNodeType reports whether a node type is built in or registered
+func IsKnownNodeType(nodeType NodeType) bool {
+	if slices.Contains(builtinNodeTypes, nodeType) {
+		return true
+	}
+	_, ok := LookupNodeType(nodeType)
+	return ok
+}
+
+// NodeTypes returns the built-in node types followed by the registered ones
+// in sorted order
+func NodeTypes() []NodeType {
+	types := slices.Clone(builtinNodeTypes)
+	if registry := nodeTypes.Load(); registry != nil {
+		types = append(types, slices.Sorted(maps.Keys(registry.types))...)
+	}
+	return types
+}
+
+// cloneNodeTypeRegistry copies a registry snapshot, which may be nil
+func cloneNodeTypeRegistry(registry *nodeTypeRegistry) *nodeTypeRegistry {
+	if registry == nil {
+		return &nodeTypeRegistry{
+			types:    make(map[NodeType]NodeTypeOptions),
+			byTSType: make(map[string]NodeType),
+		}
+	}
+	return &nodeTypeRegistry{
+		types:    maps.Clone(registry.types),
+		byTSType: maps.Clone(registry.byTSType),
+	}
+}
+
+// removeNodeType removes a type and its Tree-sitter mappings from a registry
+// that isn't yet published
+func removeNodeType(registry *nodeTypeRegistry, name NodeType) {
+	delete(registry.types, name)
+	maps.DeleteFunc(registry.byTSType, func(_ string, nodeType NodeType) bool {
+		return nodeType == name
+	})
+}
+
+// registeredNodeType returns the custom type registered for a Tree-sitter type
+func registeredNodeType(tsType string) (NodeType, bool) {
+	registry := nodeTypes.Load()
+	if registry == nil {
+		return "", false
+	}
+	nodeType, ok := registry.byTSType[tsType]
+	return nodeType, ok
+}
+
+// registeredRoles returns the roles of a custom node type
+func registeredRoles(nodeType NodeType) []Role {
+	registry := nodeTypes.Load()
+	if registry == nil {
+		return nil
+	}
+	return registry.types[nodeType].Roles
+}
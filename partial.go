@@ -0,0 +1,77 @@
+package uast
+
+// Diagnostic describes a CST subtree that partial conversion left out of the
+// UAST
+type Diagnostic struct {
+	Path    string `json:"path"`             // JSON Pointer to the CST node, such as "/children/3"
+	Type    string `json:"type,omitempty"`   // Tree-sitter type of the node
+	NodeID  string `json:"nodeId,omitempty"` // ID of the stub that replaced it; empty if it was skipped
+	Message string `json:"message"`
+
+	stub *Node
+}
+
+// cstFaults maps the malformed nodes of a CST to their diagnostics. It is
+// only read during conversion, so concurrent conversions may share it.
+type cstFaults map[*TreeSitterNode]*Diagnostic
+
+// SetPartialConversion configures whether subtrees that fail CST validation
+// are stubbed out rather than failing the conversion. Each malformed node is
+// replaced by an Unknown leaf with a "conversion_error" property, nil
+// children are skipped, and both are recorded in the UAST's Diagnostics.
+// Nodes are checked at the SetCSTValidation strictness, or CSTStandard if
+// validation is not enabled.
+func (c *Converter) SetPartialConversion(enabled bool) {
+	c.partial = enabled
+}
+
+// checkInput validates a CST before conversion. In partial mode it returns
+// the faults to stub out and every diagnostic in CST order; otherwise any
+// fault fails the conversion.
+func (c *Converter) checkInput(root *TreeSitterNode) (cstFaults, []*Diagnostic, error) {
+	if !c.partial {
+		return nil, nil, c.validateCST(root)
+	}
+
+	strictness := c.cstStrictness
+	if strictness <= CSTSkipValidation {
+		strictness = CSTStandard
+	}
+	var faults cstFaults
+	var diagnostics []*Diagnostic
+	checkCST(root, strictness, func(err *CSTError) bool {
+		diagnostic := &Diagnostic{Path: err.Path, Type: err.Type, Message: err.Message}
+		diagnostics = append(diagnostics, diagnostic)
+		if err.Node != nil {
+			if faults == nil {
+				faults = make(cstFaults)
+			}
+			faults[err.Node] = diagnostic
+		}
+		return true
+	})
+	return faults, diagnostics, nil
+}
+
+// newStub creates the Unknown leaf standing in for a malformed CST subtree
+func (c *Converter) newStub(tsNode *TreeSitterNode, arena *nodeArena, diagnostic *Diagnostic) *Node {
+	node, _ := arena.alloc()
+	node.Type = Unknown
+	node.SetProperty("ts_type", c.intern(tsNode.Type))
+	node.SetProperty("conversion_error", diagnostic.Message)
+	c.assignID(node)
+	diagnostic.stub = node
+	return node
+}
+
+// collectDiagnostics records the diagnostics of a conversion on its UAST,
+// once the stubs have their final IDs
+func collectDiagnostics(u *UAST, diagnostics []*Diagnostic) {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.stub != nil {
+			diagnostic.NodeID = diagnostic.stub.ID
+			diagnostic.stub = nil
+		}
+		u.Diagnostics = append(u.Diagnostics, *diagnostic)
+	}
+}
@@ -0,0 +1,216 @@
+package uast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path returns an address for the node built from its ancestors, such as
+// "File/Class[Example]/Method[test]/Return[0]". Declarations are addressed
+// by name when it is unique among their siblings of the same type, and other
+// nodes by their index among those siblings, so paths survive serialization
+// and reconversion of unchanged code. Characters '/', '[', ']' and '\' in
+// names are escaped with a backslash. Paths rely on the parent links
+// maintained by the UAST that indexes the node.
+func (n *Node) Path() string {
+	var segments []string
+	for node := n; node != nil; node = node.parent {
+		segments = append(segments, pathSegment(node))
+	}
+
+	var sb strings.Builder
+	for i := len(segments) - 1; i >= 0; i-- {
+		sb.WriteString(segments[i])
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+	}
+	return sb.String()
+}
+
+// pathSegment returns the path segment addressing node within its parent
+func pathSegment(node *Node) string {
+	parent := node.parent
+	if parent == nil {
+		return string(node.Type)
+	}
+
+	name := pathName(node)
+	index, named := 0, name != ""
+	if _, err := strconv.Atoi(name); err == nil {
+		named = false // It would read back as an index
+	}
+	seen := false
+	for _, sibling := range parent.Children {
+		if sibling == nil || sibling.Type != node.Type {
+			continue
+		}
+		if sibling == node {
+			seen = true
+		} else {
+			if !seen {
+				index++
+			}
+			if named && pathName(sibling) == name {
+				named = false
+			}
+		}
+	}
+
+	if named {
+		return string(node.Type) + "[" + escapePathName(name) + "]"
+	}
+	return string(node.Type) + "[" + strconv.Itoa(index) + "]"
+}
+
+// pathName returns the name a node is addressed by, or "" if it has none
+func pathName(node *Node) string {
+	if name := node.Properties["name"]; name != "" {
+		return name
+	}
+	switch node.Type {
+	case Function, Method, Class:
+		if name := DeclarationName(node); !strings.HasPrefix(name, "<anonymous") {
+			return name
+		}
+	}
+	return ""
+}
+
+// escapePathName escapes the characters with a meaning in paths
+func escapePathName(name string) string {
+	if !strings.ContainsAny(name, `/[]\`) {
+		return name
+	}
+
+	var sb strings.Builder
+	for _, r := range name {
+		switch r {
+		case '/', '[', ']', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// ResolvePath returns the node addressed by a path produced by Node.Path
+func (u *UAST) ResolvePath(path string) (*Node, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	segments, err := compilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if u.Root == nil || len(segments) == 0 || segments[0].typ != string(u.Root.Type) || segments[0].hasKey {
+		return nil, fmt.Errorf("failed to resolve path %q: root does not match", path)
+	}
+
+	node := u.Root
+	for _, segment := range segments[1:] {
+		var next *Node
+		if segment.hasKey {
+			next = resolveSegment(node, segment)
+		}
+		if next == nil {
+			return nil, fmt.Errorf("failed to resolve path %q: no node at %s", path, segment)
+		}
+		node = next
+	}
+	return node, nil
+}
+
+// pathStep is a parsed path segment
+type pathStep struct {
+	typ    string
+	key    string // Name or index
+	hasKey bool
+}
+
+// String formats the segment as it appears in a path
+func (s pathStep) String() string {
+	if !s.hasKey {
+		return s.typ
+	}
+	return s.typ + "[" + escapePathName(s.key) + "]"
+}
+
+// resolveSegment returns the child of parent addressed by a segment. An
+// index addresses the nth child of the type, and a name the child of the
+// type with that name.
+func resolveSegment(parent *Node, segment pathStep) *Node {
+	index, err := strconv.Atoi(segment.key)
+	isIndex := err == nil && index >= 0
+
+	count := 0
+	for _, child := range parent.Children {
+		if child == nil || string(child.Type) != segment.typ {
+			continue
+		}
+		if isIndex && count == index {
+			return child
+		}
+		if !isIndex && pathName(child) == segment.key {
+			return child
+		}
+		count++
+	}
+	return nil
+}
+
+// splitPath parses a path into segments, honouring backslash escapes
+func splitPath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	var current pathStep
+	var sb strings.Builder
+	inKey, closed := false, false
+
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '\\':
+			if !inKey || i+1 >= len(path) {
+				return nil, fmt.Errorf("failed to parse path %q: invalid escape at offset %d", path, i)
+			}
+			i++
+			sb.WriteByte(path[i])
+		case inKey && c == ']':
+			current.key, current.hasKey = sb.String(), true
+			sb.Reset()
+			inKey, closed = false, true
+		case inKey:
+			sb.WriteByte(c)
+		case c == '[' && !closed:
+			current.typ = sb.String()
+			sb.Reset()
+			inKey = true
+		case c == '/':
+			if !closed {
+				current.typ = sb.String()
+			}
+			if current.typ == "" {
+				return nil, fmt.Errorf("failed to parse path %q: empty segment at offset %d", path, i)
+			}
+			steps = append(steps, current)
+			current, closed = pathStep{}, false
+			sb.Reset()
+		case closed:
+			return nil, fmt.Errorf("failed to parse path %q: unexpected %q at offset %d", path, c, i)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	if inKey {
+		return nil, fmt.Errorf("failed to parse path %q: missing ]", path)
+	}
+	if !closed {
+		current.typ = sb.String()
+	}
+	if current.typ == "" {
+		return nil, fmt.Errorf("failed to parse path %q: empty segment at end", path)
+	}
+	return append(steps, current), nil
+}
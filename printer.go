@@ -0,0 +1,166 @@
+package uast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Printer regenerates source text from a UAST
+type Printer interface {
+	Print(w io.Writer, u *UAST) error
+}
+
+// TokenPrinter prints the tokens of a UAST's leaf nodes in order. Leaves with
+// a location keep their original line breaks and column gaps, so renamed or
+// removed nodes shift the rest of their line rather than disturbing the
+// layout. Leaves without one, such as nodes added after conversion, are
+// separated by a space where needed to keep words apart.
+//
+// Only tokens present in the tree are printed. Convert with KeepTrivialNodes
+// for runnable output, as dropped or folded keywords and punctuation are lost.
+type TokenPrinter struct {
+	IndentChar byte // Repeated once per column of leading indentation; a space if zero
+}
+
+// Print writes the regenerated source to w
+func (p TokenPrinter) Print(w io.Writer, u *UAST) error {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if u.Root == nil {
+		return fmt.Errorf("failed to print UAST: %w", ErrNilRoot)
+	}
+	indent := p.IndentChar
+	if indent == 0 {
+		indent = ' '
+	}
+
+	bw := bufio.NewWriter(w)
+	var prev string
+	var prevEnd *Position // End of the last leaf with a location
+	walk(u.Root, func(node *Node, _ int) {
+		if len(node.Children) > 0 || node.Token == "" {
+			return
+		}
+		if prev != "" {
+			bw.WriteString(separator(prev, prevEnd, node, indent))
+		}
+		bw.WriteString(node.Token)
+
+		prev = node.Token
+		if node.Location != nil {
+			end := node.Location.End
+			prevEnd = &end
+		}
+	})
+
+	// Restore trailing newlines, such as the one ending a Go file
+	if root := u.Root.Location; root != nil && prevEnd != nil && root.End.Line > prevEnd.Line {
+		bw.WriteString(strings.Repeat("\n", int(root.End.Line-prevEnd.Line)))
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write source: %w", err)
+	}
+	return nil
+}
+
+// separator returns the whitespace to print between the previous token and
+// node's token
+func separator(prev string, prevEnd *Position, node *Node, indent byte) string {
+	fallback := ""
+	if needsSpace(prev, node.Token) {
+		fallback = " "
+	}
+	if node.Location == nil || prevEnd == nil {
+		return fallback
+	}
+
+	start := node.Location.Start
+	switch {
+	case start.Line > prevEnd.Line:
+		return strings.Repeat("\n", int(start.Line-prevEnd.Line)) +
+			strings.Repeat(string(indent), int(start.Column)-1)
+	case start.Line == prevEnd.Line && start.Column > prevEnd.Column:
+		return strings.Repeat(" ", int(start.Column-prevEnd.Column))
+	}
+	return fallback
+}
+
+var (
+	printersMu sync.RWMutex
+	printers   = map[string]Printer{
+		"go": TokenPrinter{IndentChar: '\t'},
+	}
+)
+
+// RegisterPrinter registers the printer used to regenerate source for a
+// language, replacing any existing one
+func RegisterPrinter(language string, printer Printer) {
+	if language == "" || printer == nil {
+		return
+	}
+
+	printersMu.Lock()
+	defer printersMu.Unlock()
+
+	printers[language] = printer
+}
+
+// LookupPrinter returns the printer registered for the given language
+func LookupPrinter(language string) (Printer, bool) {
+	printersMu.RLock()
+	defer printersMu.RUnlock()
+
+	printer, ok := printers[language]
+	return printer, ok
+}
+
+// Regenerate returns the source text of the UAST, printed with the printer
+// registered for its language or a TokenPrinter
+func (u *UAST) Regenerate() (string, error) {
+	var sb strings.Builder
+	if err := u.RegenerateTo(&sb); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// RegenerateTo writes the source text of the UAST to w, as Regenerate
+func (u *UAST) RegenerateTo(w io.Writer) error {
+	u.mu.RLock()
+	language := u.Language
+	u.mu.RUnlock()
+
+	printer, ok := LookupPrinter(language)
+	if !ok {
+		printer = TokenPrinter{}
+	}
+	return printer.Print(w, u)
+}
+
+// SourceFormat implements LLMFormat by regenerating source text
+type SourceFormat struct {
+	RootSelector string // Path or declaration name of the subtree to print; empty means the whole tree
+	MaxDepth     int    // Deeper subtrees are printed as "..."; zero means no limit
+}
+
+// Format returns the regenerated source of the UAST
+func (f SourceFormat) Format(u *UAST) (string, error) {
+	return formatString(f, u)
+}
+
+// FormatTo writes the regenerated source of the UAST to w
+func (f SourceFormat) FormatTo(w io.Writer, u *UAST) error {
+	if u == nil {
+		return fmt.Errorf("cannot format nil UAST")
+	}
+	u, err := selectSubtree(u, f.RootSelector, f.MaxDepth, "...", NodeFilter{})
+	if err != nil {
+		return err
+	}
+	return u.RegenerateTo(w)
+}
@@ -0,0 +1,129 @@
+package uast
+
+import "sync"
+
+// Profile bundles the language-specific settings used when converting CSTs
+// produced by a particular Tree-sitter grammar
+type Profile struct {
+	Language     string
+	MappingRules map[string]NodeType
+	Rules        []MappingRule // Pattern and prioritized rules, added after MappingRules
+	SkipTypes    []string      // Wrapper node types whose children are attached to their parent
+	RoleRules    []RoleRule
+	NameRules    []NameRule
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]*Profile{
+		"go": goProfile(),
+	}
+)
+
+// RegisterProfile registers a profile for its language, replacing any
+// existing one
+func RegisterProfile(profile *Profile) {
+	if profile == nil || profile.Language == "" {
+		return
+	}
+
+	profilesMu.Lock()
+	profiles[profile.Language] = profile
+	profilesMu.Unlock()
+
+	forgetConverter(profile.Language)
+}
+
+// LookupProfile returns the profile registered for the given language
+func LookupProfile(language string) (*Profile, bool) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+
+	profile, ok := profiles[language]
+	return profile, ok
+}
+
+// goProfile returns the built-in profile for tree-sitter-go
+func goProfile() *Profile {
+	return &Profile{
+		Language: "go",
+		MappingRules: map[string]NodeType{
+			"source_file":                File,
+			"function_declaration":       Function,
+			"method_declaration":         Method,
+			"type_declaration":           Statement, // Can declare several types
+			"type_spec":                  Class,
+			"type_alias":                 Class,
+			"parameter_declaration":      Parameter,
+			"short_var_declaration":      Assignment,
+			"assignment_statement":       Assignment,
+			"var_declaration":            Variable,
+			"const_declaration":          Variable,
+			"type_identifier":            Identifier,
+			"field_identifier":           Identifier,
+			"package_identifier":         Identifier,
+			"interpreted_string_literal": Literal,
+			"raw_string_literal":         Literal,
+			"int_literal":                Literal,
+			"float_literal":              Literal,
+			"true":                       Literal,
+			"false":                      Literal,
+			"nil":                        Literal,
+			"selector_expression":        Expression,
+			"unary_expression":           Expression,
+			"expression_statement":       Statement,
+			"inc_statement":              Statement,
+			"dec_statement":              Statement,
+			"import_declaration":         Import,
+			"import_spec":                Import,
+			"+":                          Operator,
+			"-":                          Operator,
+			"*":                          Operator,
+			"/":                          Operator,
+			"%":                          Operator,
+			"&":                          Operator,
+			"|":                          Operator,
+			"^":                          Operator,
+			"<<":                         Operator,
+			">>":                         Operator,
+			"&^":                         Operator,
+			"&&":                         Operator,
+			"||":                         Operator,
+			"!":                          Operator,
+			"==":                         Operator,
+			"!=":                         Operator,
+			"<":                          Operator,
+			"<=":                         Operator,
+			">":                          Operator,
+			">=":                         Operator,
+			"=":                          Operator,
+			":=":                         Operator,
+			"+=":                         Operator,
+			"-=":                         Operator,
+			"*=":                         Operator,
+			"/=":                         Operator,
+			"++":                         Operator,
+			"--":                         Operator,
+			"<-":                         Operator,
+		},
+		SkipTypes: []string{
+			"import_spec_list",
+			"parameter_list",
+			"argument_list",
+		},
+		RoleRules: append(CommonRoleRules(),
+			RoleRule{TSType: "block", ParentType: Function, Roles: []Role{RoleBody}},
+			RoleRule{TSType: "block", ParentType: Method, Roles: []Role{RoleBody}},
+			RoleRule{NodeType: Identifier, ParentTSType: "inc_statement", Roles: []Role{RoleWrite}},
+			RoleRule{NodeType: Identifier, ParentTSType: "dec_statement", Roles: []Role{RoleWrite}},
+		),
+		NameRules: []NameRule{
+			{TSType: "function_declaration", Field: "name", ChildTypes: []string{"identifier"}},
+			{TSType: "method_declaration", Field: "name", ChildTypes: []string{"field_identifier"}},
+			{TSType: "type_spec", Field: "name", ChildTypes: []string{"type_identifier"}},
+			{TSType: "type_alias", Field: "name", ChildTypes: []string{"type_identifier"}},
+			{TSType: "package_clause", ChildTypes: []string{"package_identifier"}},
+			{TSType: "package_declaration", ChildTypes: []string{"identifier"}},
+		},
+	}
+}
@@ -0,0 +1,238 @@
+package prompt
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/flaticols/uast-go"
+)
+
+// resolver computes placeholder values for one rendering
+type resolver struct {
+	src    Source
+	values []string
+	marker string // Delimits value indices in the executed template
+}
+
+// funcs returns the placeholder functions of the template language
+func (r *resolver) funcs() template.FuncMap {
+	return template.FuncMap{
+		"outline":  r.placeholder(r.outline),
+		"imports":  r.placeholder(r.imports),
+		"function": r.placeholderArg(r.function),
+		"format":   r.placeholderArg(r.format),
+	}
+}
+
+// placeholder wraps a value function, recording its result and returning
+// the marker that stands for it
+func (r *resolver) placeholder(value func() (string, error)) func() (string, error) {
+	return func() (string, error) {
+		text, err := value()
+		if err != nil {
+			return "", err
+		}
+		r.values = append(r.values, text)
+		return r.marker + strconv.Itoa(len(r.values)-1) + r.marker, nil
+	}
+}
+
+// placeholderArg is placeholder for value functions taking an argument
+func (r *resolver) placeholderArg(value func(string) (string, error)) func(string) (string, error) {
+	return func(arg string) (string, error) {
+		return r.placeholder(func() (string, error) { return value(arg) })()
+	}
+}
+
+// file is a tree to resolve placeholders against
+type file struct {
+	path string
+	uast *uast.UAST
+}
+
+// files returns the trees of the source in path order
+func (r *resolver) files() []file {
+	var files []file
+	if u := r.src.UAST; u != nil {
+		path := u.Metadata["filename"]
+		if path == "" {
+			path = u.Metadata["path"]
+		}
+		files = append(files, file{path, u})
+	}
+	if w := r.src.Workspace; w != nil {
+		for _, path := range w.Paths() {
+			u, _ := w.Get(path)
+			files = append(files, file{path, u})
+		}
+	}
+	return files
+}
+
+// header writes a file's path before its part of a placeholder, when the
+// placeholder spans several files
+func header(b *strings.Builder, files []file, f file) {
+	if len(files) > 1 && f.path != "" {
+		fmt.Fprintf(b, "%s:\n", f.path)
+	}
+}
+
+// outline lists the declarations of each file, nested by scope
+func (r *resolver) outline() (string, error) {
+	var b strings.Builder
+	files := r.files()
+	for _, f := range files {
+		header(&b, files, f)
+		for node := range f.uast.Root.DescendantsWithRole(uast.RoleDeclaration) {
+			depth := 0
+			for range node.AncestorsWithRole(uast.RoleDeclaration) {
+				depth++
+			}
+			fmt.Fprintf(&b, "%s%s %s%s\n", strings.Repeat("  ", depth), node.Type, uast.DeclarationName(node), lines(node.Location))
+		}
+	}
+	return b.String(), nil
+}
+
+// imports lists the imports of each file, one per line
+func (r *resolver) imports() (string, error) {
+	var b strings.Builder
+	files := r.files()
+	for _, f := range files {
+		header(&b, files, f)
+		for _, node := range f.uast.FindByType(uast.Import) {
+			// Grouped imports list each spec rather than the group
+			if hasDescendant(node, uast.Import) {
+				continue
+			}
+			b.WriteString(strings.Join(leafTokens(node), " "))
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// function shows the declarations with a qualified or plain name, as source
+// if ReadSource is set and as a tree otherwise
+func (r *resolver) function(name string) (string, error) {
+	var b strings.Builder
+	found := false
+	for _, f := range r.files() {
+		for node := range f.uast.Root.DescendantsWithRole(uast.RoleDeclaration) {
+			if uast.QualifiedName(node) != name && uast.DeclarationName(node) != name {
+				continue
+			}
+			found = true
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			text, err := r.declarationText(f, node)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(text)
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("no declaration named %q", name)
+	}
+	return b.String(), nil
+}
+
+// declarationText returns the source lines of a declaration, or its tree
+func (r *resolver) declarationText(f file, node *uast.Node) (string, error) {
+	if loc := node.Location; r.src.ReadSource != nil && f.path != "" && loc != nil && loc.Start.Line > 0 {
+		source, err := r.src.ReadSource(f.path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read source of %s: %w", f.path, err)
+		}
+		if text, ok := uast.NewLineIndex(source).Lines(loc.Start.Line, loc.End.Line); ok {
+			return string(text) + "\n", nil
+		}
+	}
+
+	var b strings.Builder
+	writeTree(&b, node, 0)
+	return b.String(), nil
+}
+
+// format renders every file with a registered format
+func (r *resolver) format(name string) (string, error) {
+	format, ok := uast.LookupFormat(name)
+	if !ok {
+		return "", fmt.Errorf("unknown format %q", name)
+	}
+
+	var b strings.Builder
+	files := r.files()
+	for _, f := range files {
+		header(&b, files, f)
+		text, err := uast.ToLLMFormat(f.uast, format)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(strings.TrimSuffix(text, "\n"))
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// writeTree writes a subtree with one indented line per node. It uses an
+// explicit stack, so deep trees can't overflow the goroutine stack.
+func writeTree(b *strings.Builder, root *uast.Node, depth int) {
+	type entry struct {
+		node  *uast.Node
+		depth int
+	}
+
+	stack := []entry{{root, depth}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		b.WriteString(strings.Repeat("  ", top.depth))
+		b.WriteString(string(top.node.Type))
+		if top.node.Token != "" {
+			fmt.Fprintf(b, ": %s", top.node.Token)
+		}
+		b.WriteString("\n")
+		for _, child := range slices.Backward(top.node.Children) {
+			if child != nil {
+				stack = append(stack, entry{child, top.depth + 1})
+			}
+		}
+	}
+}
+
+// hasDescendant reports whether a node has a descendant of the given type
+func hasDescendant(node *uast.Node, nodeType uast.NodeType) bool {
+	for range node.DescendantsOfType(nodeType) {
+		return true
+	}
+	return false
+}
+
+// leafTokens returns the tokens of the leaves below a node
+func leafTokens(node *uast.Node) []string {
+	var tokens []string
+	for d := range node.Descendants() {
+		if len(d.Children) == 0 && d.Token != "" {
+			tokens = append(tokens, d.Token)
+		}
+	}
+	if len(tokens) == 0 && node.Token != "" {
+		tokens = append(tokens, node.Token)
+	}
+	return tokens
+}
+
+// lines formats the line range of a location
+func lines(loc *uast.Location) string {
+	if loc == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (lines %d-%d)", loc.Start.Line, loc.End.Line)
+}
@@ -0,0 +1,147 @@
+// Package prompt assembles LLM prompts from templates whose placeholders are
+// resolved against a UAST or workspace:
+//
+//	Review {{function "Server.Start"}} given this outline:
+//	{{outline}}
+//	Imports: {{imports}}
+//
+// Templates use text/template syntax. When a token budget is set, the text
+// of the placeholders is truncated to fit it, sharing what the template's
+// own text leaves over.
+package prompt
+
+import (
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/flaticols/uast-go"
+)
+
+// Source holds the code a template's placeholders are resolved against. At
+// least one of UAST and Workspace must be set.
+type Source struct {
+	UAST      *uast.UAST      // A single file, named by its "filename" or "path" metadata
+	Workspace *uast.Workspace // Many files
+
+	// ReadSource returns the source code of a file, letting {{function}}
+	// show the original text. Without it functions are shown as trees.
+	ReadSource func(path string) ([]byte, error)
+}
+
+// Options configures rendering
+type Options struct {
+	Budget    int            // Maximum tokens of the rendered prompt; zero means no limit
+	Tokenizer uast.Tokenizer // Defaults to uast.ApproxTokenizer
+	Data      any            // Passed to the template as dot
+}
+
+// Template is a parsed prompt template
+type Template struct {
+	tmpl *template.Template
+}
+
+// Parse parses a prompt template
+func Parse(name, text string) (*Template, error) {
+	var r resolver
+	tmpl, err := template.New(name).Funcs(r.funcs()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Render resolves the placeholders against src and executes the template
+func (t *Template) Render(src Source, opts Options) (string, error) {
+	if src.UAST == nil && src.Workspace == nil {
+		return "", fmt.Errorf("prompt source needs a UAST or a workspace")
+	}
+	if opts.Tokenizer == nil {
+		opts.Tokenizer = uast.ApproxTokenizer{}
+	}
+
+	// Placeholders write markers, replaced once every value is known and
+	// the budget can be shared out
+	r := &resolver{src: src, marker: "\x00" + rand.Text() + "\x00"}
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Funcs(r.funcs()).Execute(&out, opts.Data); err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+
+	parts := strings.Split(out.String(), r.marker)
+	limits := make([]int, len(r.values))
+	for i, value := range r.values {
+		limits[i] = opts.Tokenizer.CountTokens(value)
+	}
+	if opts.Budget > 0 {
+		literal := 0
+		for i := 0; i < len(parts); i += 2 {
+			literal += opts.Tokenizer.CountTokens(parts[i])
+		}
+		limits = share(limits, opts.Budget-literal)
+	}
+
+	var b strings.Builder
+	for i, part := range parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+			continue
+		}
+		index, err := strconv.Atoi(part)
+		if err != nil || index < 0 || index >= len(r.values) {
+			return "", fmt.Errorf("failed to render prompt: malformed placeholder marker")
+		}
+		b.WriteString(truncate(r.values[index], limits[index], opts.Tokenizer))
+	}
+	return b.String(), nil
+}
+
+// share divides a budget between values of the given sizes. Values smaller
+// than an even share keep their size and leave the rest to larger ones.
+func share(sizes []int, budget int) []int {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return sizes[a] - sizes[b] })
+
+	limits := make([]int, len(sizes))
+	left := max(budget, 0)
+	for n, i := range order {
+		limits[i] = min(sizes[i], left/(len(order)-n))
+		left -= limits[i]
+	}
+	return limits
+}
+
+// truncate cuts text to whole lines fitting within limit tokens, noting how
+// many lines were dropped
+func truncate(text string, limit int, tokenizer uast.Tokenizer) string {
+	if tokenizer.CountTokens(text) <= limit {
+		return text
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+	note := func(dropped int) string { return fmt.Sprintf("... (%d more lines)\n", dropped) }
+	used := tokenizer.CountTokens(note(len(lines)))
+	kept := 0
+	for kept < len(lines) {
+		cost := tokenizer.CountTokens(lines[kept])
+		if used+cost > limit {
+			break
+		}
+		used += cost
+		kept++
+	}
+	if kept == len(lines) {
+		return text
+	}
+	return strings.Join(lines[:kept], "") + note(len(lines)-kept)
+}
@@ -0,0 +1,81 @@
+package prompt_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/prompt"
+)
+
+func TestRender(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("../testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+	converter := uast.NewConverter()
+	if profile, ok := uast.LookupProfile("go"); ok {
+		converter.ApplyProfile(profile)
+	}
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	u.AddMetadata("filename", "main.go")
+
+	tmpl, err := prompt.Parse("review", "Review {{.}}:\n{{function \"add\"}}Outline:\n{{outline}}Imports:\n{{imports}}")
+	if err != nil {
+		t.Fatalf("Error parsing template: %v", err)
+	}
+	// Each source line reads "line N"
+	src := prompt.Source{UAST: u, ReadSource: func(string) ([]byte, error) {
+		var b strings.Builder
+		for i := 1; i <= 30; i++ {
+			fmt.Fprintf(&b, "line %d\n", i)
+		}
+		return []byte(b.String()), nil
+	}}
+
+	text, err := tmpl.Render(src, prompt.Options{Data: "add"})
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	for _, want := range []string{"Review add:\nline ", "Function add (lines ", "Function main (lines ", "Imports:\n\"fmt\"\n"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in the prompt, got:\n%s", want, text)
+		}
+	}
+
+	// A tight budget truncates placeholders but keeps the template's text
+	budget := 30
+	short, err := tmpl.Render(src, prompt.Options{Data: "add", Budget: budget})
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	if got := (uast.ApproxTokenizer{}).CountTokens(short); got > budget+5 || !strings.Contains(short, "more lines)") || !strings.Contains(short, "Imports:") {
+		t.Errorf("Expected a truncated prompt of about %d tokens, got %d:\n%s", budget, got, short)
+	}
+
+	// Without source, a function is written as its indented tree
+	function, _ := prompt.Parse("function", `{{function "add"}}`)
+	text, err = function.Render(prompt.Source{UAST: u}, prompt.Options{})
+	if err != nil || !strings.HasPrefix(text, "Function: add\n  Unknown: func\n  Identifier: add\n  Unknown\n    Parameter\n      Identifier: a\n") {
+		t.Errorf("Expected the function's tree in pre-order, got %q (%v)", text, err)
+	}
+
+	missing, _ := prompt.Parse("missing", `{{function "nope"}}`)
+	if _, err := missing.Render(src, prompt.Options{}); err == nil {
+		t.Errorf("Expected an error for an unknown function")
+	}
+	if _, err := prompt.Parse("bad", `{{unknown}}`); err == nil {
+		t.Errorf("Expected an error for an unknown placeholder")
+	}
+
+	// NUL bytes in the template or its data are kept as they are
+	nul, _ := prompt.Parse("nul", "a\x00b {{.}} {{imports}}")
+	text, err = nul.Render(src, prompt.Options{Data: "\x007\x00"})
+	if err != nil || !strings.HasPrefix(text, "a\x00b \x007\x00 ") {
+		t.Errorf("Expected NUL bytes to pass through, got %q (%v)", text, err)
+	}
+}
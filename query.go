@@ -0,0 +1,247 @@
+package uast
+
+import (
+	"fmt"
+	"iter"
+	"regexp"
+	"slices"
+)
+
+// Query selects nodes by type, role, token and position in the tree. Its
+// methods narrow the selection and return the query, so conditions can be
+// chained:
+//
+//	tests := u.Query().Type(Function).WithRole(RoleDefinition).TokenMatches(`^Test`).All()
+//
+// A query is executed against the smallest index its conditions allow,
+// checking the remaining conditions on each candidate, and stops as soon as
+// First, Exists or a consumer of Nodes has what it needs.
+type Query struct {
+	u       *UAST
+	types   []NodeType
+	roles   []Role
+	token   *string
+	pattern *regexp.Regexp
+	within  *Node
+	where   []func(*Node) bool
+	offset  int
+	limit   int // Zero means no limit
+	err     error
+}
+
+// Query returns a query selecting every node of the UAST
+func (u *UAST) Query() *Query {
+	return &Query{u: u}
+}
+
+// Type keeps nodes of any of the given types
+func (q *Query) Type(types ...NodeType) *Query {
+	q.types = append(q.types, types...)
+	return q
+}
+
+// WithRole keeps nodes that have every given role
+func (q *Query) WithRole(roles ...Role) *Query {
+	q.roles = append(q.roles, roles...)
+	return q
+}
+
+// Token keeps nodes with exactly the given token
+func (q *Query) Token(token string) *Query {
+	q.token = &token
+	return q
+}
+
+// TokenMatches keeps nodes whose token matches a regular expression. If the
+// expression is invalid the query matches nothing, and Err reports why.
+func (q *Query) TokenMatches(pattern string) *Query {
+	re, err := compileRegexp(pattern)
+	if err != nil {
+		q.err = fmt.Errorf("invalid token pattern %q: %w", pattern, err)
+	}
+	q.pattern = re
+	return q
+}
+
+// Within keeps the nodes of the subtree rooted at node, including node
+func (q *Query) Within(node *Node) *Query {
+	q.within = node
+	return q
+}
+
+// Where keeps nodes satisfying a predicate, which is checked after the other
+// conditions
+func (q *Query) Where(keep func(*Node) bool) *Query {
+	q.where = append(q.where, keep)
+	return q
+}
+
+// Offset skips the first n matching nodes
+func (q *Query) Offset(n int) *Query {
+	q.offset = max(n, 0)
+	return q
+}
+
+// Limit keeps at most n matching nodes; zero or less means no limit
+func (q *Query) Limit(n int) *Query {
+	q.limit = max(n, 0)
+	return q
+}
+
+// Err returns the error of an invalid condition, if any
+func (q *Query) Err() error {
+	return q.err
+}
+
+// Nodes iterates over the matching nodes, in the order of the index the
+// query runs against, which is tree order unless the tree has been edited.
+// Nodes are found as the iteration goes, so stopping early skips the rest of
+// the search.
+func (q *Query) Nodes() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		skipped, yielded := 0, 0
+		q.run(func(node *Node) bool {
+			if skipped < q.offset {
+				skipped++
+				return true
+			}
+			if q.limit > 0 && yielded >= q.limit {
+				return false
+			}
+			yielded++
+			return yield(node)
+		})
+	}
+}
+
+// All returns the matching nodes in the order of Nodes
+func (q *Query) All() []*Node {
+	nodes := []*Node{}
+	for node := range q.Nodes() {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// First returns the first matching node, or nil if none matches
+func (q *Query) First() *Node {
+	for node := range q.Nodes() {
+		return node
+	}
+	return nil
+}
+
+// Count returns the number of matching nodes
+func (q *Query) Count() int {
+	count := 0
+	for range q.Nodes() {
+		count++
+	}
+	return count
+}
+
+// Exists reports whether any node matches
+func (q *Query) Exists() bool {
+	return q.First() != nil
+}
+
+// run passes each matching node to yield until it returns false
+func (q *Query) run(yield func(*Node) bool) {
+	if q.err != nil || q.u == nil {
+		return
+	}
+
+	q.u.flushDirty()
+
+	q.u.mu.RLock()
+	candidates, ok := q.candidates()
+	q.u.mu.RUnlock()
+
+	if !ok {
+		root := q.within
+		if root == nil {
+			root = q.u.Root
+		}
+		if root == nil || (q.matches(root) && !yield(root)) {
+			return
+		}
+		for node := range root.Descendants() {
+			if q.matches(node) && !yield(node) {
+				return
+			}
+		}
+		return
+	}
+	for _, node := range candidates {
+		if q.matches(node) && !yield(node) {
+			return
+		}
+	}
+}
+
+// candidates returns the nodes of the smallest index bucket the conditions
+// select from, or false if no index applies; the caller must hold the read
+// lock
+func (q *Query) candidates() ([]*Node, bool) {
+	u := q.u
+	var best []*Node
+	found := false
+	consider := func(nodes []*Node) {
+		if !found || len(nodes) < len(best) {
+			best, found = nodes, true
+		}
+	}
+
+	if len(q.types) > 0 {
+		var nodes []*Node
+		for _, nodeType := range compactTypes(q.types) {
+			nodes = append(nodes, u.TypeIndex[nodeType]...)
+		}
+		consider(nodes)
+	}
+	for _, role := range q.roles {
+		consider(u.RoleIndex[role])
+	}
+	if q.token != nil {
+		consider(u.TokenIndex[*q.token])
+	}
+	return slices.Clone(best), found
+}
+
+// compactTypes returns types without duplicates, keeping the first of each
+func compactTypes(types []NodeType) []NodeType {
+	var unique []NodeType
+	for _, nodeType := range types {
+		if !slices.Contains(unique, nodeType) {
+			unique = append(unique, nodeType)
+		}
+	}
+	return unique
+}
+
+// matches checks every condition against a node, cheapest first
+func (q *Query) matches(node *Node) bool {
+	if len(q.types) > 0 && !slices.Contains(q.types, node.Type) {
+		return false
+	}
+	for _, role := range q.roles {
+		if !node.HasRole(role) {
+			return false
+		}
+	}
+	if q.token != nil && node.Token != *q.token {
+		return false
+	}
+	if q.pattern != nil && !q.pattern.MatchString(node.Token) {
+		return false
+	}
+	if q.within != nil && depthBelow(node, q.within) < 0 {
+		return false
+	}
+	for _, keep := range q.where {
+		if !keep(node) {
+			return false
+		}
+	}
+	return true
+}
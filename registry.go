@@ -0,0 +1,81 @@
+package uast
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+var (
+	convertersMu      sync.Mutex
+	converterDefaults = make(map[string]func(*Converter))
+	converters        = make(map[string]*Converter) // Configured templates by language
+)
+
+// RegisterConverterDefaults sets the options ConverterFor applies to a
+// language's converters after its profile, such as an ID strategy or
+// trivial node mode, replacing any set before. configure must not call
+// ConverterFor.
+func RegisterConverterDefaults(language string, configure func(*Converter)) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+
+	if configure == nil {
+		delete(converterDefaults, language)
+	} else {
+		converterDefaults[language] = configure
+	}
+	delete(converters, language)
+}
+
+// ConverterFor returns a Converter for a language, with its registered
+// profile and converter defaults applied. The configured converter is built
+// once and cached, and each call returns a clone of it that the caller may
+// adjust further.
+func ConverterFor(language string) *Converter {
+	// The template is built under the lock, so a profile registered
+	// meanwhile either lands in it or evicts it afterwards
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+
+	template, ok := converters[language]
+	if !ok {
+		template = NewConverter()
+		if profile, ok := LookupProfile(language); ok {
+			template.ApplyProfile(profile)
+		}
+		if configure := converterDefaults[language]; configure != nil {
+			configure(template)
+		}
+		converters[language] = template
+	}
+	return template.Clone()
+}
+
+// forgetConverter drops the cached converter of a language, so the next
+// ConverterFor picks up a changed profile
+func forgetConverter(language string) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+
+	delete(converters, language)
+}
+
+// Clone returns a Converter with the same configuration and fresh
+// per-conversion state, so its sequential IDs start from 1 and its timing
+// report is empty
+func (c *Converter) Clone() *Converter {
+	clone := *c
+	clone.nodeIDCounter = 0
+	clone.mappingRules = maps.Clone(c.mappingRules)
+	clone.patternRules = slices.Clone(c.patternRules)
+	clone.defaultRules = maps.Clone(c.defaultRules)
+	clone.patternMatches = new(sync.Map)
+	clone.skipTypes = maps.Clone(c.skipTypes)
+	clone.nameRules = maps.Clone(c.nameRules)
+	if c.roleRules != nil {
+		clone.roleRules = newRoleRuleSet(c.roleRules.rules())
+	}
+	clone.SetInstrumentation(c.instruments != nil)
+	return &clone
+}
@@ -0,0 +1,152 @@
+package uast
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RepoMapOptions configures Workspace.RepoMap
+type RepoMapOptions struct {
+	Budget    int       // Maximum tokens of the map, defaults to 1024
+	Tokenizer Tokenizer // Defaults to ApproxTokenizer
+}
+
+// RepoMap renders a map of the workspace for seeding an LLM's context: the
+// files and their key declarations with signatures, nested by scope. The
+// declarations referenced most across the workspace are kept when the map
+// must be cut to the token budget, and files are listed by the references to
+// what they declare.
+func (w *Workspace) RepoMap(opts RepoMapOptions) string {
+	if opts.Budget <= 0 {
+		opts.Budget = 1024
+	}
+	if opts.Tokenizer == nil {
+		opts.Tokenizer = ApproxTokenizer{}
+	}
+
+	type ranked struct {
+		decl  Declaration
+		refs  int
+		order int // Position in the file
+	}
+	var decls []ranked
+	unresolved := w.unresolvedNames()
+	index := w.SymbolIndex()
+	for _, path := range w.Paths() {
+		u, _ := w.Get(path)
+		for i, decl := range index.DeclarationsIn(path) {
+			refs := len(u.References(decl.Node))
+			if isTopLevel(decl.Node) {
+				for other, names := range unresolved {
+					if other != path {
+						refs += names[decl.Name]
+					}
+				}
+			}
+			decls = append(decls, ranked{decl, refs, i})
+		}
+	}
+	slices.SortStableFunc(decls, func(a, b ranked) int {
+		if c := cmp.Compare(b.refs, a.refs); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.decl.Path, b.decl.Path); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.order, b.order)
+	})
+
+	// Take declarations by rank while they fit, counting each file's header
+	// with its first declaration
+	kept := make(map[string][]ranked)
+	fileRefs := make(map[string]int)
+	used := 0
+	for _, d := range decls {
+		cost := opts.Tokenizer.CountTokens(repoMapLine(d.decl))
+		if _, ok := kept[d.decl.Path]; !ok {
+			cost += opts.Tokenizer.CountTokens(d.decl.Path + ":\n")
+		}
+		if used+cost > opts.Budget {
+			continue
+		}
+		used += cost
+		kept[d.decl.Path] = append(kept[d.decl.Path], d)
+		fileRefs[d.decl.Path] += d.refs
+	}
+
+	paths := make([]string, 0, len(kept))
+	for path := range kept {
+		paths = append(paths, path)
+	}
+	slices.SortFunc(paths, func(a, b string) int {
+		if c := cmp.Compare(fileRefs[b], fileRefs[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	var b strings.Builder
+	for _, path := range paths {
+		b.WriteString(path + ":\n")
+		file := kept[path]
+		slices.SortFunc(file, func(a, b ranked) int { return cmp.Compare(a.order, b.order) })
+		for _, d := range file {
+			b.WriteString(repoMapLine(d.decl))
+		}
+	}
+	return b.String()
+}
+
+// unresolvedNames counts the unresolved identifiers of each file by name
+func (w *Workspace) unresolvedNames() map[string]map[string]int {
+	names := make(map[string]map[string]int)
+	for _, path := range w.Paths() {
+		u, ok := w.Get(path)
+		if !ok {
+			continue
+		}
+		counts := make(map[string]int)
+		for _, ref := range u.Scopes().Unresolved() {
+			counts[ref.Token]++
+		}
+		names[path] = counts
+	}
+	return names
+}
+
+// repoMapLine renders a declaration as an indented line, with its signature
+// if one was extracted
+func repoMapLine(decl Declaration) string {
+	depth := 1
+	for range decl.Node.AncestorsWithRole(RoleDeclaration) {
+		depth++
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(kindWord(decl.Node))
+	b.WriteString(" ")
+	sig, ok := SignatureOf(decl.Node)
+	if ok && sig.Receiver != nil {
+		fmt.Fprintf(&b, "(%s) ", sig.Receiver)
+	}
+	b.WriteString(decl.Name)
+	if ok {
+		params := make([]string, len(sig.Params))
+		for i, param := range sig.Params {
+			params[i] = param.String()
+		}
+		fmt.Fprintf(&b, "(%s)", strings.Join(params, ", "))
+		switch len(sig.Returns) {
+		case 0:
+		case 1:
+			b.WriteString(" " + sig.Returns[0])
+		default:
+			fmt.Fprintf(&b, " (%s)", strings.Join(sig.Returns, ", "))
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
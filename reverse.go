@@ -0,0 +1,97 @@
+package uast
+
+import "strconv"
+
+// SetByteOffsets configures whether each node's CST byte range is recorded
+// in the "start_byte" and "end_byte" properties, so ToTreeSitterCST can
+// restore it
+func (c *Converter) SetByteOffsets(enabled bool) {
+	c.byteOffsets = enabled
+}
+
+// SetRecordCSTDetails configures whether each node's field name within its
+// parent is recorded in the "ts_field" property, so ToTreeSitterCST can
+// restore it
+func (c *Converter) SetRecordCSTDetails(enabled bool) {
+	c.cstDetails = enabled
+}
+
+// recordCSTDetails records the parts of a CST node that the UAST doesn't
+// otherwise keep
+func (c *Converter) recordCSTDetails(tsNode *TreeSitterNode, node *Node) {
+	if c.byteOffsets {
+		node.SetProperty("start_byte", strconv.Itoa(tsNode.StartByte))
+		node.SetProperty("end_byte", strconv.Itoa(tsNode.EndByte))
+	}
+	if c.cstDetails && tsNode.Field != "" {
+		node.SetProperty("ts_field", c.intern(tsNode.Field))
+	}
+}
+
+// ToTreeSitterCST reconstructs a Tree-sitter CST from the UAST, so transformed
+// trees can be handed back to tree-sitter-centric tooling. Node types come
+// from the ts_type property, falling back to the UAST type for nodes added
+// after conversion, and leaves get their token as text. Byte offsets are
+// and field names are only restored if the converter recorded them (see
+// SetByteOffsets and SetRecordCSTDetails). CST
+// nodes that were dropped, folded or collapsed during conversion are not
+// recreated.
+func (u *UAST) ToTreeSitterCST() *TreeSitterNode {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if u.Root == nil {
+		return nil
+	}
+
+	type entry struct {
+		node   *Node
+		tsNode *TreeSitterNode
+	}
+
+	root := toTreeSitterNode(u.Root)
+	stack := []entry{{u.Root, root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if len(top.node.Children) == 0 {
+			continue
+		}
+		top.tsNode.Children = make([]*TreeSitterNode, 0, len(top.node.Children))
+		for _, child := range top.node.Children {
+			if child == nil {
+				continue
+			}
+			tsChild := toTreeSitterNode(child)
+			top.tsNode.Children = append(top.tsNode.Children, tsChild)
+			stack = append(stack, entry{child, tsChild})
+		}
+	}
+	return root
+}
+
+// toTreeSitterNode converts a single node without its children
+func toTreeSitterNode(node *Node) *TreeSitterNode {
+	tsNode := &TreeSitterNode{
+		Type:  node.Properties["ts_type"],
+		Field: node.Properties["ts_field"],
+	}
+	if tsNode.Type == "" {
+		tsNode.Type = string(node.Type)
+	}
+
+	// Interior nodes only carry a token when it came from the CST, rather
+	// than being derived from the declaration's name
+	if len(node.Children) == 0 || node.Token != node.Properties["name"] {
+		tsNode.Text = node.Token
+	}
+
+	if node.Location != nil {
+		tsNode.StartPoint = [2]int{int(node.Location.Start.Line) - 1, int(node.Location.Start.Column) - 1}
+		tsNode.EndPoint = [2]int{int(node.Location.End.Line) - 1, int(node.Location.End.Column) - 1}
+	}
+	tsNode.StartByte, _ = strconv.Atoi(node.Properties["start_byte"])
+	tsNode.EndByte, _ = strconv.Atoi(node.Properties["end_byte"])
+	return tsNode
+}
@@ -0,0 +1,326 @@
+package uast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// RoleRule assigns roles to the nodes matching all of its non-empty
+// conditions. Every matching rule contributes its roles.
+type RoleRule struct {
+	NodeType     NodeType `json:"nodeType,omitempty"`
+	TSType       string   `json:"tsType,omitempty"`
+	Field        string   `json:"field,omitempty"` // Field name of the node within its CST parent
+	ParentType   NodeType `json:"parentType,omitempty"`
+	ParentTSType string   `json:"parentTsType,omitempty"`
+	Roles        []Role   `json:"roles"`
+}
+
+// matches reports whether the rule applies to a node being converted
+func (r *RoleRule) matches(nodeType NodeType, tsNode *TreeSitterNode, parent *Node) bool {
+	if r.NodeType != "" && r.NodeType != nodeType {
+		return false
+	}
+	if r.TSType != "" && r.TSType != tsNode.Type {
+		return false
+	}
+	if r.Field != "" && r.Field != tsNode.Field {
+		return false
+	}
+	if r.ParentType != "" && (parent == nil || r.ParentType != parent.Type) {
+		return false
+	}
+	if r.ParentTSType != "" && (parent == nil || r.ParentTSType != parent.Properties["ts_type"]) {
+		return false
+	}
+	return true
+}
+
+// DefaultRoleRules returns the rules used by a new Converter
+func DefaultRoleRules() []RoleRule {
+	return []RoleRule{
+		{NodeType: Function, Roles: []Role{RoleDeclaration, RoleDefinition}},
+		{NodeType: Method, Roles: []Role{RoleDeclaration, RoleDefinition}},
+		{NodeType: Class, Roles: []Role{RoleDeclaration, RoleDefinition}},
+		{NodeType: Call, Roles: []Role{RoleCall}},
+		{NodeType: Identifier, Roles: []Role{RoleReference}},
+		{NodeType: Import, Roles: []Role{RoleImport}},
+		{NodeType: Statement, Roles: []Role{RoleStatement}},
+		{NodeType: Expression, Roles: []Role{RoleExpression}},
+		{NodeType: Argument, Roles: []Role{RoleArgument}},
+		{NodeType: Parameter, Roles: []Role{RoleArgument}},
+		{NodeType: Condition, Roles: []Role{RoleCondition}},
+		{TSType: "method_receiver", Roles: []Role{RoleReceiver}},
+		{TSType: "function_body", Roles: []Role{RoleBody}},
+		{TSType: "method_body", Roles: []Role{RoleBody}},
+	}
+}
+
+// CommonRoleRules returns rules for the finer-grained roles, such as Write,
+// Name and Type, based on node types, Tree-sitter types and field names
+// shared by many grammars. They complement DefaultRoleRules and are included
+// in the built-in profiles. Field rules only apply when the CST records
+// field names.
+func CommonRoleRules() []RoleRule {
+	return []RoleRule{
+		// Node types
+		{NodeType: Variable, Roles: []Role{RoleDeclaration}},
+		{NodeType: Package, Roles: []Role{RolePackage}},
+		{NodeType: Assignment, Roles: []Role{RoleAssignment}},
+		{NodeType: Operator, Roles: []Role{RoleOperator}},
+		{NodeType: Return, Roles: []Role{RoleReturn}},
+		{NodeType: Loop, Roles: []Role{RoleLoop}},
+		{NodeType: Literal, Roles: []Role{RoleLiteral}},
+		{NodeType: Comment, Roles: []Role{RoleComment}},
+
+		// Tree-sitter types
+		{TSType: "block", Roles: []Role{RoleBlock}},
+		{TSType: "if_statement", Roles: []Role{RoleIf}},
+		{TSType: "binary_expression", Roles: []Role{RoleBinary}},
+		{TSType: "unary_expression", Roles: []Role{RoleUnary}},
+		{TSType: "type_identifier", Roles: []Role{RoleType}},
+		{TSType: "predefined_type", Roles: []Role{RoleType}},
+		{TSType: "primitive_type", Roles: []Role{RoleType}},
+		{TSType: "string", Roles: []Role{RoleString}},
+		{TSType: "string_literal", Roles: []Role{RoleString}},
+		{TSType: "interpreted_string_literal", Roles: []Role{RoleString}},
+		{TSType: "raw_string_literal", Roles: []Role{RoleString}},
+		{TSType: "number", Roles: []Role{RoleNumber}},
+		{TSType: "number_literal", Roles: []Role{RoleNumber}},
+		{TSType: "integer_literal", Roles: []Role{RoleNumber}},
+		{TSType: "int_literal", Roles: []Role{RoleNumber}},
+		{TSType: "float_literal", Roles: []Role{RoleNumber}},
+		{TSType: "true", Roles: []Role{RoleBoolean}},
+		{TSType: "false", Roles: []Role{RoleBoolean}},
+		{TSType: "boolean_literal", Roles: []Role{RoleBoolean}},
+		{TSType: "nil", Roles: []Role{RoleNull}},
+		{TSType: "null", Roles: []Role{RoleNull}},
+		{TSType: "none", Roles: []Role{RoleNull}},
+		{TSType: "null_literal", Roles: []Role{RoleNull}},
+		{TSType: "modifiers", Roles: []Role{RoleVisibility}},
+		{TSType: "accessibility_modifier", Roles: []Role{RoleVisibility}},
+		{TSType: "visibility_modifier", Roles: []Role{RoleVisibility}},
+		{NodeType: Identifier, ParentTSType: "update_expression", Roles: []Role{RoleWrite}},
+
+		// Field names
+		{Field: "name", Roles: []Role{RoleName}},
+		{Field: "left", Roles: []Role{RoleLeft}},
+		{Field: "right", Roles: []Role{RoleRight}},
+		{Field: "left", ParentType: Assignment, Roles: []Role{RoleWrite}},
+		{Field: "right", ParentType: Assignment, Roles: []Role{RoleValue}},
+		{Field: "value", Roles: []Role{RoleValue}},
+		{Field: "type", Roles: []Role{RoleType}},
+		{Field: "result", Roles: []Role{RoleType}},
+		{Field: "return_type", Roles: []Role{RoleType}},
+		{Field: "operator", Roles: []Role{RoleOperator}},
+		{Field: "body", Roles: []Role{RoleBody}},
+		{Field: "condition", Roles: []Role{RoleCondition}},
+		{Field: "consequence", Roles: []Role{RoleThen}},
+		{Field: "alternative", Roles: []Role{RoleElse}},
+		{Field: "initializer", Roles: []Role{RoleInitializer}},
+		{Field: "update", Roles: []Role{RoleUpdate}},
+		{Field: "function", ParentType: Call, Roles: []Role{RoleCallee}},
+		{Field: "arguments", Roles: []Role{RoleArgument}},
+		{Field: "receiver", Roles: []Role{RoleReceiver}},
+		{Field: "path", ParentType: Import, Roles: []Role{RolePath}},
+	}
+}
+
+// roleRuleSet groups rules by their most selective condition so only
+// candidate rules are checked for each node
+type roleRuleSet struct {
+	byNodeType map[NodeType][]RoleRule
+	byTSType   map[string][]RoleRule
+	other      []RoleRule
+}
+
+// newRoleRuleSet builds a rule set from rules
+func newRoleRuleSet(rules []RoleRule) *roleRuleSet {
+	set := &roleRuleSet{
+		byNodeType: make(map[NodeType][]RoleRule),
+		byTSType:   make(map[string][]RoleRule),
+	}
+	for _, rule := range rules {
+		set.add(rule)
+	}
+	return set
+}
+
+// add adds a rule to the set
+func (s *roleRuleSet) add(rule RoleRule) {
+	switch {
+	case rule.TSType != "":
+		s.byTSType[rule.TSType] = append(s.byTSType[rule.TSType], rule)
+	case rule.NodeType != "":
+		s.byNodeType[rule.NodeType] = append(s.byNodeType[rule.NodeType], rule)
+	default:
+		s.other = append(s.other, rule)
+	}
+}
+
+// rules returns every rule in the set
+func (s *roleRuleSet) rules() []RoleRule {
+	if s == nil {
+		return nil
+	}
+	var rules []RoleRule
+	for _, nodeType := range sortedKeys(s.byNodeType) {
+		rules = append(rules, s.byNodeType[nodeType]...)
+	}
+	for _, tsType := range sortedKeys(s.byTSType) {
+		rules = append(rules, s.byTSType[tsType]...)
+	}
+	return append(rules, s.other...)
+}
+
+// infer returns the roles of a node being converted, or nil if it has none.
+// Roles from node type rules come first, then those from Tree-sitter type
+// and other rules.
+func (s *roleRuleSet) infer(nodeType NodeType, tsNode *TreeSitterNode, parent *Node) []Role {
+	if s == nil {
+		return nil
+	}
+	var roles []Role
+	apply := func(rules []RoleRule) {
+		for i := range rules {
+			if !rules[i].matches(nodeType, tsNode, parent) {
+				continue
+			}
+			for _, role := range rules[i].Roles {
+				if !slices.Contains(roles, role) {
+					roles = append(roles, role)
+				}
+			}
+		}
+	}
+
+	apply(s.byNodeType[nodeType])
+	apply(s.byTSType[tsNode.Type])
+	apply(s.other)
+	return roles
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// SetStructuralRoles configures whether roles that depend on a node's
+// siblings are inferred after conversion: Documentation for comments directly
+// above a declaration, and Left, Right and Write for the sides of assignments
+// whose CST doesn't record field names. It is disabled by default.
+func (c *Converter) SetStructuralRoles(enabled bool) {
+	c.structuralRoles = enabled
+}
+
+// inferStructuralRoles adds the roles that rules on single nodes can't express
+func inferStructuralRoles(root *Node) {
+	walk(root, func(node *Node, _ int) {
+		for i, child := range node.Children {
+			if child != nil && slices.Contains(child.Roles, RoleDeclaration) {
+				markDocumentation(node.Children[:i], child)
+			}
+		}
+
+		if node.Type != Assignment || slices.ContainsFunc(node.Children, func(child *Node) bool {
+			return child != nil && slices.Contains(child.Roles, RoleLeft)
+		}) {
+			return
+		}
+		split := slices.IndexFunc(node.Children, func(child *Node) bool {
+			return child != nil && child.Type == Operator
+		})
+		if split < 0 {
+			return
+		}
+		for i, child := range node.Children {
+			if child == nil || i == split {
+				continue
+			}
+			if i < split {
+				addRole(child, RoleLeft)
+			} else {
+				addRole(child, RoleRight)
+			}
+		}
+		for _, target := range assignmentTargets(node.Children[:split]) {
+			addRole(target, RoleWrite)
+		}
+	})
+}
+
+// markDocumentation marks the run of comments ending directly above decl
+func markDocumentation(preceding []*Node, decl *Node) {
+	if decl.Location == nil {
+		return
+	}
+
+	line := decl.Location.Start.Line
+	for i := len(preceding) - 1; i >= 0; i-- {
+		comment := preceding[i]
+		if comment == nil || comment.Type != Comment || comment.Location == nil || comment.Location.End.Line+1 < line {
+			return
+		}
+		addRole(comment, RoleDocumentation)
+		line = comment.Location.Start.Line
+	}
+}
+
+// addRole adds a role to a node unless it already has it
+func addRole(node *Node, role Role) {
+	if !slices.Contains(node.Roles, role) {
+		node.Roles = append(node.Roles, role)
+	}
+}
+
+// SetRoleRules replaces the converter's role rules. Passing nil leaves nodes
+// without inferred roles.
+func (c *Converter) SetRoleRules(rules []RoleRule) {
+	c.roleRules = newRoleRuleSet(rules)
+}
+
+// AddRoleRule adds a role rule alongside the existing ones
+func (c *Converter) AddRoleRule(rule RoleRule) {
+	if c.roleRules == nil {
+		c.roleRules = newRoleRuleSet(nil)
+	}
+	c.roleRules.add(rule)
+}
+
+// RoleRules returns the converter's role rules
+func (c *Converter) RoleRules() []RoleRule {
+	return c.roleRules.rules()
+}
+
+// DecodeRoleRules reads a JSON array of role rules
+func DecodeRoleRules(r io.Reader) ([]RoleRule, error) {
+	var rules []RoleRule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%w role rules: %w", ErrDecode, err)
+	}
+	for i, rule := range rules {
+		if len(rule.Roles) == 0 {
+			return nil, fmt.Errorf("%w role rules: rule %d assigns no roles", ErrDecode, i)
+		}
+	}
+	return rules, nil
+}
+
+// LoadRoleRules loads role rules from a JSON file
+func LoadRoleRules(filename string) ([]RoleRule, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open role rules: %w", err)
+	}
+	defer file.Close()
+
+	return DecodeRoleRules(file)
+}
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/flaticols/uast-go"
+)
+
+// ToProto flattens a UAST to its protobuf form. It works from a compact
+// snapshot taken under the tree's lock, so the result shares no maps with u.
+func ToProto(u *uast.UAST) *UAST {
+	c := u.Compact()
+	p := &UAST{Language: c.Language, Metadata: c.Metadata}
+	for i := range c.Len() {
+		p.Nodes = append(p.Nodes, nodeToProto(c.Node(i), c.Parents[i]))
+	}
+	return p
+}
+
+// nodeToProto converts a node without its children
+func nodeToProto(n *uast.Node, parent int32) *Node {
+	p := &Node{
+		Id:           n.ID,
+		Type:         string(n.Type),
+		Token:        n.Token,
+		Properties:   n.Properties,
+		Location:     locationToProto(n.Location),
+		NameLocation: locationToProto(n.NameLocation),
+		Parent:       parent,
+	}
+	for _, role := range n.Roles {
+		p.Roles = append(p.Roles, string(role))
+	}
+	return p
+}
+
+// locationToProto converts a location, keeping nil as nil
+func locationToProto(loc *uast.Location) *Location {
+	if loc == nil {
+		return nil
+	}
+	return &Location{
+		Start: &Position{Line: loc.Start.Line, Column: loc.Start.Column},
+		End:   &Position{Line: loc.End.Line, Column: loc.End.Column},
+	}
+}
+
+// FromProto rebuilds a UAST from its protobuf form. Nodes must be in
+// pre-order, each after its parent. The UAST shares no maps with p.
+func FromProto(p *UAST) (*uast.UAST, error) {
+	nodes := make([]*uast.Node, len(p.Nodes))
+	for i, pn := range p.Nodes {
+		node := &uast.Node{
+			ID:           pn.Id,
+			Type:         uast.NodeType(pn.Type),
+			Token:        pn.Token,
+			Properties:   maps.Clone(pn.Properties),
+			Location:     locationFromProto(pn.Location),
+			NameLocation: locationFromProto(pn.NameLocation),
+		}
+		for _, role := range pn.Roles {
+			node.Roles = append(node.Roles, uast.Role(role))
+		}
+		nodes[i] = node
+
+		switch {
+		case i == 0 && pn.Parent != -1:
+			return nil, fmt.Errorf("root node has parent %d", pn.Parent)
+		case i > 0 && (pn.Parent < 0 || int(pn.Parent) >= i):
+			return nil, fmt.Errorf("node %d has invalid parent %d", i, pn.Parent)
+		case i > 0:
+			parent := nodes[pn.Parent]
+			parent.Children = append(parent.Children, node)
+		}
+	}
+
+	var root *uast.Node
+	if len(nodes) > 0 {
+		root = nodes[0]
+	}
+	u := uast.NewUAST(root, p.Language)
+	for key, value := range p.Metadata {
+		u.AddMetadata(key, value)
+	}
+	return u, nil
+}
+
+// locationFromProto converts a location, keeping nil as nil
+func locationFromProto(loc *Location) *uast.Location {
+	if loc == nil {
+		return nil
+	}
+	return &uast.Location{
+		Start: uast.Position{Line: loc.GetStart().GetLine(), Column: loc.GetStart().GetColumn()},
+		End:   uast.Position{Line: loc.GetEnd().GetLine(), Column: loc.GetEnd().GetColumn()},
+	}
+}
@@ -0,0 +1,181 @@
+// Package rpc serves UAST conversion over gRPC. The API is defined in
+// uast.proto; trees travel flattened to their nodes in pre-order, and the
+// streaming call splits large trees across several messages.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative uast.proto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/flaticols/uast-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Options configures a Server
+type Options struct {
+	// Parser parses requests carrying source. Without one only CST JSON is
+	// accepted.
+	Parser uast.Parser
+
+	// NewConverter returns the converter for a language. It defaults to
+	// uast.ConverterFor.
+	NewConverter func(language string) *uast.Converter
+
+	Limits     uast.DecodeLimits // Limits for CST JSON, defaults to uast.DefaultDecodeLimits
+	ChunkNodes int               // Nodes per streamed response, defaults to 10000
+}
+
+// Server implements ConversionServiceServer
+type Server struct {
+	UnimplementedConversionServiceServer
+	opts Options
+}
+
+// NewServer creates a Server, to be registered with
+// RegisterConversionServiceServer
+func NewServer(opts Options) *Server {
+	if opts.NewConverter == nil {
+		opts.NewConverter = uast.ConverterFor
+	}
+	if opts.Limits == (uast.DecodeLimits{}) {
+		opts.Limits = uast.DefaultDecodeLimits()
+	}
+	if opts.ChunkNodes <= 0 {
+		opts.ChunkNodes = 10000
+	}
+	return &Server{opts: opts}
+}
+
+// Convert converts a single file
+func (s *Server) Convert(ctx context.Context, req *ConvertRequest) (*ConvertResponse, error) {
+	u, err := s.convert(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ConvertResponse{Path: req.Path, Uast: ToProto(u)}, nil
+}
+
+// ConvertStream converts files as they arrive. A file that fails to convert
+// is reported in its response and does not end the stream.
+func (s *Server) ConvertStream(stream ConversionService_ConvertStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		u, err := s.convert(stream.Context(), req)
+		if err != nil {
+			if err := stream.Send(&ConvertResponse{Path: req.Path, Error: status.Convert(err).Message()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tree := ToProto(u)
+		nodes := tree.Nodes
+		tree.Nodes = nil
+		for first := true; first || len(nodes) > 0; first = false {
+			chunk := nodes[:min(s.opts.ChunkNodes, len(nodes))]
+			nodes = nodes[len(chunk):]
+			if !first {
+				tree = &UAST{}
+			}
+			tree.Nodes = chunk
+			if err := stream.Send(&ConvertResponse{Path: req.Path, Uast: tree, More: len(nodes) > 0}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// convert parses and converts the input of a request
+func (s *Server) convert(ctx context.Context, req *ConvertRequest) (*uast.UAST, error) {
+	language := req.Language
+	if language == "" {
+		language = uast.DetectLanguage(req.Path)
+	}
+
+	var root *uast.TreeSitterNode
+	var err error
+	switch input := req.Input.(type) {
+	case *ConvertRequest_CstJson:
+		root, err = uast.DecodeTreeSitterCSTWithLimits(bytes.NewReader(input.CstJson), s.opts.Limits)
+	case *ConvertRequest_Source:
+		if s.opts.Parser == nil {
+			return nil, status.Error(codes.Unimplemented, "no parser configured for source input")
+		}
+		if s.opts.Limits.MaxBytes > 0 && len(input.Source) > s.opts.Limits.MaxBytes {
+			err = fmt.Errorf("source exceeds %d bytes: %w", s.opts.Limits.MaxBytes, uast.ErrLimitExceeded)
+		} else {
+			root, err = s.opts.Parser.Parse(ctx, input.Source, language)
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "request has no input")
+	}
+	if err != nil {
+		code := codes.InvalidArgument
+		if errors.Is(err, uast.ErrLimitExceeded) {
+			code = codes.ResourceExhausted
+		}
+		return nil, status.Errorf(code, "failed to parse %s: %v", req.Path, err)
+	}
+
+	u, err := s.opts.NewConverter(language).Convert(root, language)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to convert %s: %v", req.Path, err)
+	}
+	if req.Path != "" {
+		u.AddMetadata("path", req.Path)
+	}
+	return u, nil
+}
+
+// ReceiveTrees reads a ConvertStream until it ends, reassembling trees split
+// across responses and calling fn with each file in request order
+func ReceiveTrees(stream ConversionService_ConvertStreamClient, fn func(path string, u *uast.UAST, err error) error) error {
+	var pending *UAST
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if resp.Error != "" {
+			if err := fn(resp.Path, nil, errors.New(resp.Error)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch {
+		case pending == nil && resp.Uast != nil:
+			pending = resp.Uast
+		case pending == nil:
+			pending = &UAST{}
+		default:
+			pending.Nodes = append(pending.Nodes, resp.Uast.GetNodes()...)
+		}
+		if resp.More {
+			continue
+		}
+
+		u, err := FromProto(pending)
+		pending = nil
+		if err := fn(resp.Path, u, err); err != nil {
+			return err
+		}
+	}
+}
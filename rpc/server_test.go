@@ -0,0 +1,126 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestConversionService(t *testing.T) {
+	cst, err := os.ReadFile("../testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error reading CST: %v", err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	rpc.RegisterConversionServiceServer(server, rpc.NewServer(rpc.Options{ChunkNodes: 5}))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer conn.Close()
+	client := rpc.NewConversionServiceClient(conn)
+	ctx := context.Background()
+
+	resp, err := client.Convert(ctx, &rpc.ConvertRequest{Path: "main.go", Input: &rpc.ConvertRequest_CstJson{CstJson: cst}})
+	if err != nil {
+		t.Fatalf("Error converting: %v", err)
+	}
+	u, err := rpc.FromProto(resp.Uast)
+	if err != nil {
+		t.Fatalf("Error rebuilding tree: %v", err)
+	}
+	want, _ := uast.DecodeTreeSitterCST(bytes.NewReader(cst))
+	converter := uast.NewConverter()
+	if profile, ok := uast.LookupProfile("go"); ok {
+		converter.ApplyProfile(profile)
+	}
+	expected, _ := converter.Convert(want, "go")
+	if got, want := mustJSON(t, u.Root), mustJSON(t, expected.Root); got != want {
+		t.Errorf("Expected the tree to survive the round trip")
+	}
+
+	_, err = client.Convert(ctx, &rpc.ConvertRequest{Path: "main.go", Input: &rpc.ConvertRequest_Source{Source: []byte("package main")}})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("Expected Unimplemented without a parser, got %v", err)
+	}
+
+	// Streamed trees are split into chunks and reassembled in order
+	stream, err := client.ConvertStream(ctx)
+	if err != nil {
+		t.Fatalf("Error opening stream: %v", err)
+	}
+	stream.Send(&rpc.ConvertRequest{Path: "a.go", Input: &rpc.ConvertRequest_CstJson{CstJson: cst}})
+	stream.Send(&rpc.ConvertRequest{Path: "bad.go", Input: &rpc.ConvertRequest_CstJson{CstJson: []byte("{")}})
+	stream.Send(&rpc.ConvertRequest{Path: "b.go", Input: &rpc.ConvertRequest_CstJson{CstJson: cst}})
+	stream.CloseSend()
+
+	var paths []string
+	err = rpc.ReceiveTrees(stream, func(path string, u *uast.UAST, err error) error {
+		paths = append(paths, path)
+		switch {
+		case path == "bad.go" && err == nil:
+			t.Errorf("Expected an error for bad.go")
+		case path != "bad.go" && err != nil:
+			t.Errorf("Unexpected error for %s: %v", path, err)
+		case path != "bad.go" && mustJSON(t, u.Root) != mustJSON(t, expected.Root):
+			t.Errorf("Expected %s to be reassembled", path)
+		}
+		return nil
+	})
+	if err != nil || len(paths) != 3 || paths[0] != "a.go" || paths[2] != "b.go" {
+		t.Errorf("Expected three files in order, got %v (%v)", paths, err)
+	}
+}
+
+// mustJSON encodes a subtree for comparison
+func mustJSON(t *testing.T, node *uast.Node) string {
+	t.Helper()
+	data, err := json.Marshal(node)
+	if err != nil {
+		t.Fatalf("Error encoding node: %v", err)
+	}
+	return string(data)
+}
+
+// stubParser returns a one-node CST for any source
+type stubParser struct{}
+
+func (stubParser) Parse(_ context.Context, source []byte, _ string) (*uast.TreeSitterNode, error) {
+	return &uast.TreeSitterNode{Type: "source_file", Text: string(source)}, nil
+}
+
+func TestPartialLimits(t *testing.T) {
+	// MaxBytes is left zero, meaning no limit
+	server := rpc.NewServer(rpc.Options{Parser: stubParser{}, Limits: uast.DecodeLimits{MaxDepth: 100}})
+	resp, err := server.Convert(context.Background(), &rpc.ConvertRequest{Path: "main.go", Input: &rpc.ConvertRequest_Source{Source: []byte("package main")}})
+	if err != nil {
+		t.Fatalf("Expected source to be accepted without a byte limit, got %v", err)
+	}
+
+	u, err := rpc.FromProto(resp.Uast)
+	if err != nil {
+		t.Fatalf("Error rebuilding tree: %v", err)
+	}
+	u.Root.SetProperty("edited", "true")
+	if _, ok := resp.Uast.Nodes[0].Properties["edited"]; ok {
+		t.Errorf("Expected the rebuilt tree not to share properties with the message")
+	}
+}
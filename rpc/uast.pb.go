@@ -0,0 +1,575 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: uast.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ConvertRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Path     string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`         // Reported back in the response, and used to detect the language
+	Language string                 `protobuf:"bytes,2,opt,name=language,proto3" json:"language,omitempty"` // Detected from path if empty
+	// Types that are valid to be assigned to Input:
+	//
+	//	*ConvertRequest_CstJson
+	//	*ConvertRequest_Source
+	Input         isConvertRequest_Input `protobuf_oneof:"input"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConvertRequest) Reset() {
+	*x = ConvertRequest{}
+	mi := &file_uast_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConvertRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertRequest) ProtoMessage() {}
+
+func (x *ConvertRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uast_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertRequest.ProtoReflect.Descriptor instead.
+func (*ConvertRequest) Descriptor() ([]byte, []int) {
+	return file_uast_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ConvertRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ConvertRequest) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *ConvertRequest) GetInput() isConvertRequest_Input {
+	if x != nil {
+		return x.Input
+	}
+	return nil
+}
+
+func (x *ConvertRequest) GetCstJson() []byte {
+	if x != nil {
+		if x, ok := x.Input.(*ConvertRequest_CstJson); ok {
+			return x.CstJson
+		}
+	}
+	return nil
+}
+
+func (x *ConvertRequest) GetSource() []byte {
+	if x != nil {
+		if x, ok := x.Input.(*ConvertRequest_Source); ok {
+			return x.Source
+		}
+	}
+	return nil
+}
+
+type isConvertRequest_Input interface {
+	isConvertRequest_Input()
+}
+
+type ConvertRequest_CstJson struct {
+	CstJson []byte `protobuf:"bytes,3,opt,name=cst_json,json=cstJson,proto3,oneof"` // A Tree-sitter CST dump
+}
+
+type ConvertRequest_Source struct {
+	Source []byte `protobuf:"bytes,4,opt,name=source,proto3,oneof"` // Source code, parsed by the server's parser
+}
+
+func (*ConvertRequest_CstJson) isConvertRequest_Input() {}
+
+func (*ConvertRequest_Source) isConvertRequest_Input() {}
+
+type ConvertResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Path  string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Uast  *UAST                  `protobuf:"bytes,2,opt,name=uast,proto3" json:"uast,omitempty"`
+	Error string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"` // Set instead of uast when a streamed file fails
+	// More is set when the next response continues this tree. Continuation
+	// responses carry only further nodes.
+	More          bool `protobuf:"varint,4,opt,name=more,proto3" json:"more,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConvertResponse) Reset() {
+	*x = ConvertResponse{}
+	mi := &file_uast_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConvertResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertResponse) ProtoMessage() {}
+
+func (x *ConvertResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uast_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertResponse.ProtoReflect.Descriptor instead.
+func (*ConvertResponse) Descriptor() ([]byte, []int) {
+	return file_uast_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ConvertResponse) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ConvertResponse) GetUast() *UAST {
+	if x != nil {
+		return x.Uast
+	}
+	return nil
+}
+
+func (x *ConvertResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ConvertResponse) GetMore() bool {
+	if x != nil {
+		return x.More
+	}
+	return false
+}
+
+// UAST is a tree flattened to its nodes in pre-order, so deep trees do not
+// hit message nesting limits and large ones can be streamed in parts
+type UAST struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Language      string                 `protobuf:"bytes,1,opt,name=language,proto3" json:"language,omitempty"`
+	Metadata      map[string]string      `protobuf:"bytes,2,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Nodes         []*Node                `protobuf:"bytes,3,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UAST) Reset() {
+	*x = UAST{}
+	mi := &file_uast_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UAST) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UAST) ProtoMessage() {}
+
+func (x *UAST) ProtoReflect() protoreflect.Message {
+	mi := &file_uast_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UAST.ProtoReflect.Descriptor instead.
+func (*UAST) Descriptor() ([]byte, []int) {
+	return file_uast_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UAST) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *UAST) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *UAST) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+type Node struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Token         string                 `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`
+	Roles         []string               `protobuf:"bytes,4,rep,name=roles,proto3" json:"roles,omitempty"`
+	Properties    map[string]string      `protobuf:"bytes,5,rep,name=properties,proto3" json:"properties,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Location      *Location              `protobuf:"bytes,6,opt,name=location,proto3" json:"location,omitempty"`
+	NameLocation  *Location              `protobuf:"bytes,7,opt,name=name_location,json=nameLocation,proto3" json:"name_location,omitempty"`
+	Parent        int32                  `protobuf:"varint,8,opt,name=parent,proto3" json:"parent,omitempty"` // Index of the parent in UAST.nodes, -1 for the root
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Node) Reset() {
+	*x = Node{}
+	mi := &file_uast_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Node) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Node) ProtoMessage() {}
+
+func (x *Node) ProtoReflect() protoreflect.Message {
+	mi := &file_uast_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Node.ProtoReflect.Descriptor instead.
+func (*Node) Descriptor() ([]byte, []int) {
+	return file_uast_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Node) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Node) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Node) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Node) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+func (x *Node) GetProperties() map[string]string {
+	if x != nil {
+		return x.Properties
+	}
+	return nil
+}
+
+func (x *Node) GetLocation() *Location {
+	if x != nil {
+		return x.Location
+	}
+	return nil
+}
+
+func (x *Node) GetNameLocation() *Location {
+	if x != nil {
+		return x.NameLocation
+	}
+	return nil
+}
+
+func (x *Node) GetParent() int32 {
+	if x != nil {
+		return x.Parent
+	}
+	return 0
+}
+
+type Location struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         *Position              `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           *Position              `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Location) Reset() {
+	*x = Location{}
+	mi := &file_uast_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Location) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Location) ProtoMessage() {}
+
+func (x *Location) ProtoReflect() protoreflect.Message {
+	mi := &file_uast_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Location.ProtoReflect.Descriptor instead.
+func (*Location) Descriptor() ([]byte, []int) {
+	return file_uast_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Location) GetStart() *Position {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *Location) GetEnd() *Position {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+type Position struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Line          uint32                 `protobuf:"varint,1,opt,name=line,proto3" json:"line,omitempty"`
+	Column        uint32                 `protobuf:"varint,2,opt,name=column,proto3" json:"column,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Position) Reset() {
+	*x = Position{}
+	mi := &file_uast_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Position) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Position) ProtoMessage() {}
+
+func (x *Position) ProtoReflect() protoreflect.Message {
+	mi := &file_uast_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Position.ProtoReflect.Descriptor instead.
+func (*Position) Descriptor() ([]byte, []int) {
+	return file_uast_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Position) GetLine() uint32 {
+	if x != nil {
+		return x.Line
+	}
+	return 0
+}
+
+func (x *Position) GetColumn() uint32 {
+	if x != nil {
+		return x.Column
+	}
+	return 0
+}
+
+var File_uast_proto protoreflect.FileDescriptor
+
+const file_uast_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"uast.proto\x12\auast.v1\"\x80\x01\n" +
+	"\x0eConvertRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1a\n" +
+	"\blanguage\x18\x02 \x01(\tR\blanguage\x12\x1b\n" +
+	"\bcst_json\x18\x03 \x01(\fH\x00R\acstJson\x12\x18\n" +
+	"\x06source\x18\x04 \x01(\fH\x00R\x06sourceB\a\n" +
+	"\x05input\"r\n" +
+	"\x0fConvertResponse\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12!\n" +
+	"\x04uast\x18\x02 \x01(\v2\r.uast.v1.UASTR\x04uast\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x12\n" +
+	"\x04more\x18\x04 \x01(\bR\x04more\"\xbd\x01\n" +
+	"\x04UAST\x12\x1a\n" +
+	"\blanguage\x18\x01 \x01(\tR\blanguage\x127\n" +
+	"\bmetadata\x18\x02 \x03(\v2\x1b.uast.v1.UAST.MetadataEntryR\bmetadata\x12#\n" +
+	"\x05nodes\x18\x03 \x03(\v2\r.uast.v1.NodeR\x05nodes\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xd3\x02\n" +
+	"\x04Node\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x14\n" +
+	"\x05token\x18\x03 \x01(\tR\x05token\x12\x14\n" +
+	"\x05roles\x18\x04 \x03(\tR\x05roles\x12=\n" +
+	"\n" +
+	"properties\x18\x05 \x03(\v2\x1d.uast.v1.Node.PropertiesEntryR\n" +
+	"properties\x12-\n" +
+	"\blocation\x18\x06 \x01(\v2\x11.uast.v1.LocationR\blocation\x126\n" +
+	"\rname_location\x18\a \x01(\v2\x11.uast.v1.LocationR\fnameLocation\x12\x16\n" +
+	"\x06parent\x18\b \x01(\x05R\x06parent\x1a=\n" +
+	"\x0fPropertiesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"X\n" +
+	"\bLocation\x12'\n" +
+	"\x05start\x18\x01 \x01(\v2\x11.uast.v1.PositionR\x05start\x12#\n" +
+	"\x03end\x18\x02 \x01(\v2\x11.uast.v1.PositionR\x03end\"6\n" +
+	"\bPosition\x12\x12\n" +
+	"\x04line\x18\x01 \x01(\rR\x04line\x12\x16\n" +
+	"\x06column\x18\x02 \x01(\rR\x06column2\x99\x01\n" +
+	"\x11ConversionService\x12<\n" +
+	"\aConvert\x12\x17.uast.v1.ConvertRequest\x1a\x18.uast.v1.ConvertResponse\x12F\n" +
+	"\rConvertStream\x12\x17.uast.v1.ConvertRequest\x1a\x18.uast.v1.ConvertResponse(\x010\x01B\"Z github.com/flaticols/uast-go/rpcb\x06proto3"
+
+var (
+	file_uast_proto_rawDescOnce sync.Once
+	file_uast_proto_rawDescData []byte
+)
+
+func file_uast_proto_rawDescGZIP() []byte {
+	file_uast_proto_rawDescOnce.Do(func() {
+		file_uast_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_uast_proto_rawDesc), len(file_uast_proto_rawDesc)))
+	})
+	return file_uast_proto_rawDescData
+}
+
+var file_uast_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_uast_proto_goTypes = []any{
+	(*ConvertRequest)(nil),  // 0: uast.v1.ConvertRequest
+	(*ConvertResponse)(nil), // 1: uast.v1.ConvertResponse
+	(*UAST)(nil),            // 2: uast.v1.UAST
+	(*Node)(nil),            // 3: uast.v1.Node
+	(*Location)(nil),        // 4: uast.v1.Location
+	(*Position)(nil),        // 5: uast.v1.Position
+	nil,                     // 6: uast.v1.UAST.MetadataEntry
+	nil,                     // 7: uast.v1.Node.PropertiesEntry
+}
+var file_uast_proto_depIdxs = []int32{
+	2,  // 0: uast.v1.ConvertResponse.uast:type_name -> uast.v1.UAST
+	6,  // 1: uast.v1.UAST.metadata:type_name -> uast.v1.UAST.MetadataEntry
+	3,  // 2: uast.v1.UAST.nodes:type_name -> uast.v1.Node
+	7,  // 3: uast.v1.Node.properties:type_name -> uast.v1.Node.PropertiesEntry
+	4,  // 4: uast.v1.Node.location:type_name -> uast.v1.Location
+	4,  // 5: uast.v1.Node.name_location:type_name -> uast.v1.Location
+	5,  // 6: uast.v1.Location.start:type_name -> uast.v1.Position
+	5,  // 7: uast.v1.Location.end:type_name -> uast.v1.Position
+	0,  // 8: uast.v1.ConversionService.Convert:input_type -> uast.v1.ConvertRequest
+	0,  // 9: uast.v1.ConversionService.ConvertStream:input_type -> uast.v1.ConvertRequest
+	1,  // 10: uast.v1.ConversionService.Convert:output_type -> uast.v1.ConvertResponse
+	1,  // 11: uast.v1.ConversionService.ConvertStream:output_type -> uast.v1.ConvertResponse
+	10, // [10:12] is the sub-list for method output_type
+	8,  // [8:10] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_uast_proto_init() }
+func file_uast_proto_init() {
+	if File_uast_proto != nil {
+		return
+	}
+	file_uast_proto_msgTypes[0].OneofWrappers = []any{
+		(*ConvertRequest_CstJson)(nil),
+		(*ConvertRequest_Source)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_uast_proto_rawDesc), len(file_uast_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_uast_proto_goTypes,
+		DependencyIndexes: file_uast_proto_depIdxs,
+		MessageInfos:      file_uast_proto_msgTypes,
+	}.Build()
+	File_uast_proto = out.File
+	file_uast_proto_goTypes = nil
+	file_uast_proto_depIdxs = nil
+}
@@ -0,0 +1,179 @@
+package uast
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//go:embed uast.schema.json
+var uastSchema []byte
+
+// UASTSchema returns the JSON Schema of the UAST JSON layout written by
+// SaveUAST, for consumers in other languages
+func UASTSchema() []byte {
+	return slices.Clone(uastSchema)
+}
+
+// SchemaViolation is a place where a document breaks the UAST schema
+type SchemaViolation struct {
+	Path    string // JSON Pointer to the value, such as "/root/children/0/type"
+	Message string
+}
+
+// SchemaError lists the violations of the UAST schema found in a document
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+// Error implements the error interface
+func (e *SchemaError) Error() string {
+	first := e.Violations[0]
+	msg := fmt.Sprintf("invalid UAST JSON at %q: %s", first.Path, first.Message)
+	if len(e.Violations) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Violations)-1)
+	}
+	return msg
+}
+
+// ValidateUASTJSON checks a UAST JSON document against UASTSchema,
+// returning a *SchemaError listing every violation
+func ValidateUASTJSON(r io.Reader) error {
+	if r == nil {
+		return fmt.Errorf("reader cannot be nil")
+	}
+
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return fmt.Errorf("%w JSON: %w", ErrDecode, err)
+	}
+
+	root := parsedSchema()
+	v := schemaValidator{defs: root["$defs"].(map[string]any)}
+	v.validate(root, document, "")
+	if len(v.violations) > 0 {
+		return &SchemaError{Violations: v.violations}
+	}
+	return nil
+}
+
+// parsedSchema decodes the embedded schema once
+var parsedSchema = sync.OnceValue(func() map[string]any {
+	var schema map[string]any
+	if err := json.Unmarshal(uastSchema, &schema); err != nil {
+		panic(err) // The embedded schema is valid JSON
+	}
+	return schema
+})
+
+// schemaValidator checks values against the subset of JSON Schema used by
+// the UAST schema
+type schemaValidator struct {
+	defs       map[string]any
+	violations []SchemaViolation
+}
+
+// fail records a violation
+func (v *schemaValidator) fail(path, format string, args ...any) {
+	v.violations = append(v.violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate checks a value at path against a schema
+func (v *schemaValidator) validate(schema map[string]any, value any, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = v.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+	}
+	if kind, ok := schema["type"].(string); ok && !hasSchemaType(value, kind) {
+		v.fail(path, "expected %s, got %s", kind, schemaTypeOf(value))
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				v.fail(path, "missing required property %q", name)
+			}
+		}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			child := path + "/" + escapePointer(key)
+			if property, ok := properties[key].(map[string]any); ok {
+				v.validate(property, value[key], child)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					v.fail(child, "unexpected property %q", key)
+				}
+			case map[string]any:
+				v.validate(additional, value[key], child)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range value {
+				v.validate(items, item, path+"/"+strconv.Itoa(i))
+			}
+		}
+	case string:
+		if minLength, ok := schema["minLength"].(float64); ok && float64(utf8.RuneCountInString(value)) < minLength {
+			v.fail(path, "expected at least %v characters", minLength)
+		}
+	case json.Number:
+		n, _ := value.Float64()
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			v.fail(path, "expected at least %v, got %s", minimum, value)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			v.fail(path, "expected at most %v, got %s", maximum, value)
+		}
+	}
+}
+
+// hasSchemaType reports whether a decoded JSON value has a schema type
+func hasSchemaType(value any, kind string) bool {
+	if number, ok := value.(json.Number); ok && kind == "integer" {
+		_, err := strconv.ParseInt(number.String(), 10, 64)
+		return err == nil
+	}
+	return schemaTypeOf(value) == kind
+}
+
+// schemaTypeOf returns the schema type of a decoded JSON value
+func schemaTypeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// escapePointer escapes a key for use in a JSON Pointer
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
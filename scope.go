@@ -0,0 +1,378 @@
+package uast
+
+import (
+	"slices"
+	"strings"
+)
+
+// ScopeKind identifies the construct that opens a lexical scope
+type ScopeKind string
+
+// Scope kinds
+const (
+	ScopeFile     ScopeKind = "File"
+	ScopeClass    ScopeKind = "Class"
+	ScopeFunction ScopeKind = "Function"
+	ScopeBlock    ScopeKind = "Block"
+)
+
+// Binding is a name declared in a scope
+type Binding struct {
+	Name  string
+	Node  *Node    // The identifier or declaration node introducing the name
+	Kind  NodeType // The kind of declaration, such as Function or Parameter
+	Scope *Scope
+}
+
+// Scope is a lexical scope and the names declared directly in it
+type Scope struct {
+	Kind     ScopeKind
+	Node     *Node
+	Parent   *Scope
+	Children []*Scope
+	Bindings map[string][]*Binding
+}
+
+// ScopeTree holds the scopes of a UAST and the resolution of identifier
+// references to the bindings they refer to
+type ScopeTree struct {
+	Root   *Scope
+	byNode map[*Node]*Scope
+
+	declares   map[*Node]bool     // Identifiers that introduce a name
+	resolved   map[*Node]*Binding // Reference -> binding
+	references map[*Binding][]*Node
+	unresolved []*Node
+}
+
+// Lookup resolves a name in this scope or its ancestors, returning the
+// innermost binding, or nil if the name is not declared
+func (s *Scope) Lookup(name string) *Binding {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if bindings := scope.Bindings[name]; len(bindings) > 0 {
+			return bindings[0]
+		}
+	}
+	return nil
+}
+
+// Names returns the names declared directly in this scope in sorted order
+func (s *Scope) Names() []string {
+	names := make([]string, 0, len(s.Bindings))
+	for name := range s.Bindings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// declare adds a binding to the scope
+func (s *Scope) declare(name string, node *Node, kind NodeType) {
+	if name == "" {
+		return
+	}
+	s.Bindings[name] = append(s.Bindings[name], &Binding{Name: name, Node: node, Kind: kind, Scope: s})
+}
+
+// ScopeOf returns the scope opened by node, or nil if it doesn't open one
+func (t *ScopeTree) ScopeOf(node *Node) *Scope {
+	return t.byNode[node]
+}
+
+// EnclosingScope returns the innermost scope containing node
+func (t *ScopeTree) EnclosingScope(node *Node) *Scope {
+	for n := node; n != nil; n = n.Parent() {
+		if scope, ok := t.byNode[n]; ok {
+			return scope
+		}
+	}
+	return t.Root
+}
+
+// ScopeAt returns the innermost scope whose node spans the position
+func (t *ScopeTree) ScopeAt(pos Position) *Scope {
+	scope := t.Root
+	for {
+		var inner *Scope
+		for _, child := range scope.Children {
+			if child.Node.Location != nil && child.Node.Location.Contains(pos) {
+				inner = child
+				break
+			}
+		}
+		if inner == nil {
+			return scope
+		}
+		scope = inner
+	}
+}
+
+// Scopes returns the UAST's scope tree, building it on first use. The tree is
+// rebuilt after the UAST is modified through its mutation API.
+func (u *UAST) Scopes() *ScopeTree {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.scopes == nil {
+		u.scopes = buildScopes(u.Root)
+	}
+	return u.scopes
+}
+
+// ScopeAt returns the innermost scope at a source position
+func (u *UAST) ScopeAt(pos Position) *Scope {
+	return u.Scopes().ScopeAt(pos)
+}
+
+// LookupInScope resolves a name from the given scope outwards
+func (u *UAST) LookupInScope(scope *Scope, name string) *Binding {
+	if scope == nil {
+		scope = u.Scopes().Root
+	}
+	return scope.Lookup(name)
+}
+
+// DefinitionOf returns the binding an identifier refers to within the file
+func (u *UAST) DefinitionOf(ref *Node) *Binding {
+	return u.Scopes().DefinitionOf(ref)
+}
+
+// References returns the identifiers in the file referring to a declaration,
+// given either the declaring node (such as a Function or a parameter's
+// identifier) or a reference to it
+func (u *UAST) References(decl *Node) []*Node {
+	scopes := u.Scopes()
+
+	binding := scopes.DefinitionOf(decl)
+	if binding == nil {
+		binding = scopes.BindingOf(decl)
+	}
+	if binding == nil {
+		return nil
+	}
+	return scopes.References(binding)
+}
+
+// opensScope returns the kind of scope a node opens, if any
+func opensScope(node *Node) (ScopeKind, bool) {
+	switch node.Type {
+	case Function, Method:
+		return ScopeFunction, true
+	case Class:
+		return ScopeClass, true
+	case Loop, Condition:
+		return ScopeBlock, true
+	}
+
+	tsType := node.Properties["ts_type"]
+	if tsType == "block" || strings.HasSuffix(tsType, "_block") || tsType == "compound_statement" {
+		return ScopeBlock, true
+	}
+	return "", false
+}
+
+// buildScopes builds the scope tree for the subtree rooted at root
+func buildScopes(root *Node) *ScopeTree {
+	tree := &ScopeTree{byNode: make(map[*Node]*Scope)}
+	tree.Root = &Scope{Kind: ScopeFile, Node: root, Bindings: make(map[string][]*Binding)}
+	if root == nil {
+		return tree
+	}
+	tree.byNode[root] = tree.Root
+
+	type entry struct {
+		node  *Node
+		scope *Scope
+	}
+
+	stack := []entry{{root, tree.Root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		node, scope := top.node, top.scope
+
+		// Declarations are bound in the scope enclosing them, except
+		// parameters, which belong to their function
+		declareNames(node, scope)
+
+		inner := scope
+		if node != root {
+			if kind, ok := opensScope(node); ok {
+				inner = &Scope{Kind: kind, Node: node, Parent: scope, Bindings: make(map[string][]*Binding)}
+				scope.Children = append(scope.Children, inner)
+				tree.byNode[node] = inner
+			}
+		}
+
+		for i := len(node.Children) - 1; i >= 0; i-- {
+			if child := node.Children[i]; child != nil {
+				stack = append(stack, entry{child, inner})
+			}
+		}
+	}
+
+	// Children were discovered in reverse, so restore source order
+	for _, scope := range tree.byNode {
+		slices.Reverse(scope.Children)
+	}
+
+	tree.resolveReferences(root)
+	return tree
+}
+
+// resolveReferences links each identifier that doesn't declare a name to the
+// innermost visible binding of that name
+func (t *ScopeTree) resolveReferences(root *Node) {
+	t.declares = make(map[*Node]bool)
+	t.resolved = make(map[*Node]*Binding)
+	t.references = make(map[*Binding][]*Node)
+
+	for _, scope := range t.byNode {
+		for _, bindings := range scope.Bindings {
+			for _, binding := range bindings {
+				t.declares[binding.Node] = true
+				switch binding.Kind {
+				case Function, Method, Class:
+					if name := declarationNameNode(binding.Node); name != nil {
+						t.declares[name] = true
+					}
+				}
+			}
+		}
+	}
+
+	walk(root, func(node *Node, _ int) {
+		if !isReference(node) || t.declares[node] {
+			return
+		}
+
+		binding := t.EnclosingScope(node).Lookup(node.Token)
+		if binding == nil {
+			t.unresolved = append(t.unresolved, node)
+			return
+		}
+		t.resolved[node] = binding
+		t.references[binding] = append(t.references[binding], node)
+	})
+}
+
+// isReference reports whether node is an identifier that may refer to a
+// binding. Member names such as the Println in fmt.Println are excluded.
+func isReference(node *Node) bool {
+	if node.Type != Identifier || node.Token == "" {
+		return false
+	}
+	switch node.Properties["ts_type"] {
+	case "field_identifier", "property_identifier":
+		return false
+	}
+	return true
+}
+
+// DefinitionOf returns the binding an identifier refers to, or nil if it
+// is unresolved or is itself a declaration
+func (t *ScopeTree) DefinitionOf(ref *Node) *Binding {
+	return t.resolved[ref]
+}
+
+// References returns the identifiers referring to a binding, in source order
+func (t *ScopeTree) References(binding *Binding) []*Node {
+	return slices.Clone(t.references[binding])
+}
+
+// BindingOf returns the binding introduced by a declaration node, such as a
+// Function node or the identifier of a parameter, or nil if it has none
+func (t *ScopeTree) BindingOf(decl *Node) *Binding {
+	scope := t.EnclosingScope(decl.Parent())
+	for _, bindings := range scope.Bindings {
+		for _, binding := range bindings {
+			if binding.Node == decl {
+				return binding
+			}
+		}
+	}
+	return nil
+}
+
+// Unresolved returns the identifiers that don't resolve to any binding in
+// the file, such as imported or cross-file names
+func (t *ScopeTree) Unresolved() []*Node {
+	return slices.Clone(t.unresolved)
+}
+
+// declareNames binds the names a node declares into scope
+func declareNames(node *Node, scope *Scope) {
+	switch node.Type {
+	case Function, Method, Class:
+		scope.declare(DeclarationName(node), node, node.Type)
+	case Parameter:
+		names := declaredIdentifiers(node)
+		for _, name := range names {
+			scope.declare(name.Token, name, Parameter)
+		}
+		if len(names) == 0 && node.Token != "" {
+			scope.declare(node.Token, node, Parameter)
+		}
+	case Variable, Assignment:
+		if node.Type == Assignment && !isDeclaringAssignment(node) {
+			return
+		}
+		for _, name := range declaredIdentifiers(node) {
+			scope.declare(name.Token, name, Variable)
+		}
+	}
+}
+
+// isDeclaringAssignment reports whether an assignment also declares its
+// targets, as Go's := or a JavaScript variable declarator does
+func isDeclaringAssignment(node *Node) bool {
+	tsType := node.Properties["ts_type"]
+	return strings.Contains(tsType, "declaration") || strings.Contains(tsType, "declarator")
+}
+
+// declaredIdentifiers returns the identifiers a declaration binds: the names
+// of each of its specs, as in a Go var or const block, or else its leading
+// names
+func declaredIdentifiers(node *Node) []*Node {
+	var names []*Node
+	for _, child := range node.Children {
+		if child == nil {
+			continue
+		}
+		switch child.Properties["ts_type"] {
+		case "var_spec", "const_spec":
+			names = append(names, leadingIdentifiers(child)...)
+		case "var_spec_list":
+			names = append(names, declaredIdentifiers(child)...)
+		}
+	}
+	if len(names) > 0 {
+		return names
+	}
+	return leadingIdentifiers(node)
+}
+
+// leadingIdentifiers returns the first run of identifier children of a node,
+// skipping leading keywords and the commas between names, and stopping at the
+// operator, value or type that follows them. A leading expression list holds
+// the names, as on the left of Go's x, y := 1, 2.
+func leadingIdentifiers(node *Node) []*Node {
+	var names []*Node
+	for _, child := range node.Children {
+		if child == nil {
+			continue
+		}
+		tsType := child.Properties["ts_type"]
+		switch {
+		case child.Type == Identifier && tsType == "identifier":
+			names = append(names, child)
+		case tsType == ",":
+		case len(names) > 0:
+			return names
+		case tsType == "expression_list":
+			return leadingIdentifiers(child)
+		}
+	}
+	return names
+}
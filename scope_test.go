@@ -0,0 +1,365 @@
+package uast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+)
+
+func loadGoExample(t *testing.T) *uast.UAST {
+	t.Helper()
+
+	return convertGoExample(t, goConverter(t))
+}
+
+// goConverter returns a converter with the built-in go profile applied
+func goConverter(t *testing.T) *uast.Converter {
+	t.Helper()
+
+	profile, ok := uast.LookupProfile("go")
+	if !ok {
+		t.Fatal("Expected a built-in go profile")
+	}
+	converter := uast.NewConverter()
+	converter.ApplyProfile(profile)
+	return converter
+}
+
+// convertGoExample converts the example CST with converter
+func convertGoExample(t *testing.T, converter *uast.Converter) *uast.UAST {
+	t.Helper()
+
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	return u
+}
+
+// findFunction returns the function declared with the given name
+func findFunction(t *testing.T, u *uast.UAST, name string) *uast.Node {
+	t.Helper()
+
+	for _, fn := range u.FindByType(uast.Function) {
+		if uast.DeclarationName(fn) == name {
+			return fn
+		}
+	}
+	t.Fatalf("Expected to find function %s", name)
+	return nil
+}
+
+func TestScopes(t *testing.T) {
+	u := loadGoExample(t)
+	scopes := u.Scopes()
+
+	if got := scopes.Root.Names(); len(got) != 2 || got[0] != "add" || got[1] != "main" {
+		t.Errorf("Expected file scope to declare add and main, got %v", got)
+	}
+
+	// Inside the body of add: return a + b
+	scope := u.ScopeAt(uast.Position{Line: 10, Column: 12})
+	if binding := scope.Lookup("a"); binding == nil || binding.Kind != uast.Parameter {
+		t.Errorf("Expected a to resolve to a parameter, got %+v", binding)
+	}
+	if binding := scope.Lookup("message"); binding != nil {
+		t.Errorf("Expected message not to be visible in add, got %+v", binding)
+	}
+
+	// Inside the loop in main
+	scope = u.ScopeAt(uast.Position{Line: 26, Column: 20})
+	if binding := u.LookupInScope(scope, "i"); binding == nil || binding.Scope.Kind != uast.ScopeBlock {
+		t.Errorf("Expected i to be declared in the loop scope, got %+v", binding)
+	}
+	if binding := u.LookupInScope(scope, "sum"); binding == nil || binding.Kind != uast.Variable {
+		t.Errorf("Expected sum to resolve to a variable, got %+v", binding)
+	}
+	if binding := u.LookupInScope(scope, "add"); binding == nil || binding.Kind != uast.Function {
+		t.Errorf("Expected add to resolve to a function, got %+v", binding)
+	}
+}
+
+func TestDefinitionOf(t *testing.T) {
+	u := loadGoExample(t)
+
+	var addFn *uast.Node
+	for _, fn := range u.FindByType(uast.Function) {
+		if uast.DeclarationName(fn) == "add" {
+			addFn = fn
+		}
+	}
+	if addFn == nil {
+		t.Fatal("Expected to find function add")
+	}
+
+	refs := u.References(addFn)
+	if len(refs) != 1 {
+		t.Fatalf("Expected one reference to add, got %d", len(refs))
+	}
+	if binding := u.DefinitionOf(refs[0]); binding == nil || binding.Node != addFn {
+		t.Errorf("Expected reference to resolve to add, got %+v", binding)
+	}
+
+	// The use of a in add's body resolves to the parameter
+	resolved := 0
+	for _, ref := range u.FindByToken("a") {
+		binding := u.DefinitionOf(ref)
+		if binding == nil {
+			continue
+		}
+		resolved++
+		if binding.Kind != uast.Parameter {
+			t.Errorf("Expected a to resolve to a parameter, got %+v", binding)
+		}
+		if got := u.References(binding.Node); len(got) == 0 {
+			t.Errorf("Expected the parameter a to have references")
+		}
+	}
+	if resolved == 0 {
+		t.Error("Expected a use of a to resolve")
+	}
+}
+
+func TestDataFlow(t *testing.T) {
+	u := loadGoExample(t)
+
+	mainFn := findFunction(t, u, "main")
+	flow := u.DataFlow(mainFn)
+
+	counts := make(map[string]int)
+	for _, def := range flow.Definitions() {
+		counts[def.Binding.Name]++
+	}
+	if counts["message"] != 1 || counts["sum"] != 1 || counts["i"] != 2 {
+		t.Errorf("Expected definitions of message, sum and i (twice), got %v", counts)
+	}
+
+	// Inside the loop body, i may come from the initialiser or the increment
+	for _, ref := range u.FindByToken("i") {
+		if ref.Location == nil || ref.Location.Start.Line != 26 {
+			continue
+		}
+		if defs := flow.ReachingDefinitions(ref); len(defs) != 2 {
+			t.Errorf("Expected two definitions of i to reach line 26, got %d", len(defs))
+		}
+	}
+
+	// The increment reads the previous value of i, so the initialiser flows
+	// into it
+	defs := flow.Definitions()
+	var initI, incI *uast.Definition
+	for _, def := range defs {
+		if def.Binding.Name == "i" {
+			if initI == nil {
+				initI = def
+			} else {
+				incI = def
+			}
+		}
+	}
+	if !flow.FlowsTo(initI, incI) {
+		t.Error("Expected the initialiser of i to flow into its increment")
+	}
+	if got := flow.DefinitionsOf(initI.Binding); len(got) != 2 {
+		t.Errorf("Expected two definitions for the binding of i, got %d", len(got))
+	}
+}
+
+// TestGoLocals uses the CST tree-sitter-go exports for declarations that
+// nest their names in expression lists and specs:
+//
+//	x, y := 1, 2
+//	var a, b int = 3, 4
+//	var (
+//		c = 5
+//	)
+//	const d = 6
+//	println(x, y, a, b, c, d)
+func TestGoLocals(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/locals.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+	u, err := goConverter(t).Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	mainFn := findFunction(t, u, "main")
+	scope := u.Scopes().ScopeOf(mainFn)
+	if scope == nil {
+		t.Fatal("Expected main to open a scope")
+	}
+	var names []string
+	for _, s := range append([]*uast.Scope{scope}, scope.Children...) {
+		names = append(names, s.Names()...)
+	}
+	slices.Sort(names)
+	if want := []string{"a", "b", "c", "d", "x", "y"}; !slices.Equal(names, want) {
+		t.Errorf("Expected main to declare %v, got %v", want, names)
+	}
+
+	flow := u.DataFlow(mainFn)
+	for _, name := range []string{"x", "y", "a", "b", "c", "d"} {
+		var decl, use *uast.Node
+		for _, ref := range u.FindByToken(name) {
+			if ref.Type != uast.Identifier {
+				continue
+			}
+			if ref.Location.Start.Line == 10 {
+				use = ref
+			} else {
+				decl = ref
+			}
+		}
+		if decl == nil || use == nil {
+			t.Fatalf("Expected a declaration and a use of %s", name)
+		}
+
+		binding := u.DefinitionOf(use)
+		if binding == nil || binding.Node != decl || binding.Kind != uast.Variable {
+			t.Errorf("Expected %s to resolve to its declaration, got %+v", name, binding)
+		}
+		if u.DefinitionOf(decl) != nil {
+			t.Errorf("Expected the declaring %s not to be a reference", name)
+		}
+		if defs := flow.ReachingDefinitions(use); len(defs) != 1 || defs[0].Node != decl {
+			t.Errorf("Expected the declaration of %s to reach its use, got %v", name, defs)
+		}
+	}
+}
+
+func TestNodePath(t *testing.T) {
+	u := loadGoExample(t)
+
+	mainFn := findFunction(t, u, "main")
+	if got := mainFn.Path(); got != "File/Function[main]" {
+		t.Errorf("Expected path File/Function[main], got %s", got)
+	}
+
+	// Every node resolves back to itself, including after a JSON round trip
+	data, err := json.Marshal(u)
+	if err != nil {
+		t.Fatalf("Error encoding UAST: %v", err)
+	}
+	decoded, err := uast.DecodeUAST(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error decoding UAST: %v", err)
+	}
+	for _, node := range u.FindByType(uast.Identifier) {
+		path := node.Path()
+		if got, err := u.ResolvePath(path); err != nil || got != node {
+			t.Errorf("Expected %s to resolve to its node, got %v (%v)", path, got, err)
+		}
+		if got, err := decoded.ResolvePath(path); err != nil || got.Token != node.Token || got.Path() != path {
+			t.Errorf("Expected %s to resolve in the decoded tree, got %v (%v)", path, got, err)
+		}
+	}
+
+	for _, path := range []string{"", "Class", "File/Function[missing]", "File/Function[main", "File//Identifier[0]"} {
+		if _, err := u.ResolvePath(path); err == nil {
+			t.Errorf("Expected an error resolving %q", path)
+		}
+	}
+}
+
+func TestEnclosingFunction(t *testing.T) {
+	u := loadGoExample(t)
+
+	// Inside the loop in main
+	fn := u.FunctionAt(uast.Position{Line: 26, Column: 20})
+	if got := uast.DeclarationName(fn); got != "main" {
+		t.Fatalf("Expected the position to be inside main, got %q", got)
+	}
+	node := u.NodeAt(uast.Position{Line: 26, Column: 20})
+	if node == nil || node.EnclosingFunction() != fn {
+		t.Errorf("Expected the node at the position to be enclosed by main, got %v", node)
+	}
+	if fn.EnclosingFunction() != nil {
+		t.Error("Expected main not to be nested in a function")
+	}
+
+	if got := u.FunctionAt(uast.Position{Line: 1, Column: 1}); got != nil {
+		t.Errorf("Expected no function around the package clause, got %v", got)
+	}
+	if got := u.ClassAt(uast.Position{Line: 26, Column: 20}); got != nil {
+		t.Errorf("Expected no class in the example, got %v", got)
+	}
+}
+
+func TestNodeIterators(t *testing.T) {
+	u := loadGoExample(t)
+
+	mainFn := findFunction(t, u, "main")
+
+	var calls []string
+	for call := range mainFn.DescendantsOfType(uast.Call) {
+		calls = append(calls, call.Token)
+	}
+	if len(calls) != 5 {
+		t.Errorf("Expected 5 calls in main, got %d", len(calls))
+	}
+
+	// Iteration stops early
+	count := 0
+	for range mainFn.Descendants() {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	if count != 3 {
+		t.Errorf("Expected iteration to stop after 3 nodes, got %d", count)
+	}
+
+	for call := range mainFn.DescendantsOfType(uast.Call) {
+		var funcs []*uast.Node
+		for fn := range call.AncestorsOfType(uast.Function) {
+			funcs = append(funcs, fn)
+		}
+		if len(funcs) != 1 || funcs[0] != mainFn {
+			t.Errorf("Expected main to be the only function around the call, got %v", funcs)
+		}
+		bodies := 0
+		for range call.AncestorsWithRole(uast.RoleBody) {
+			bodies++
+		}
+		if bodies == 0 {
+			t.Errorf("Expected the call to %s to be inside a body", call.Token)
+		}
+	}
+}
+
+func TestSiblings(t *testing.T) {
+	u := loadGoExample(t)
+
+	root := u.Root
+	if root.IndexInParent() != -1 || root.NextSibling() != nil || root.PrevSibling() != nil {
+		t.Error("Expected the root to have no siblings")
+	}
+
+	for i, child := range root.Children {
+		if got := child.IndexInParent(); got != i {
+			t.Errorf("Expected child %d to report index %d, got %d", i, i, got)
+		}
+		if i > 0 && child.PrevSibling() != root.Children[i-1] {
+			t.Errorf("Expected the previous sibling of child %d to be child %d", i, i-1)
+		}
+		if i < len(root.Children)-1 && child.NextSibling() != root.Children[i+1] {
+			t.Errorf("Expected the next sibling of child %d to be child %d", i, i+1)
+		}
+	}
+	if first := root.Children[0]; first.PrevSibling() != nil {
+		t.Error("Expected the first child to have no previous sibling")
+	}
+	if last := root.Children[len(root.Children)-1]; last.NextSibling() != nil {
+		t.Error("Expected the last child to have no next sibling")
+	}
+}
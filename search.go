@@ -0,0 +1,326 @@
+package uast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pattern is a tree pattern for structural search. The zero Pattern matches
+// any single node.
+type Pattern struct {
+	Type     string     // NodeType or ts_type the node must have, or "" for any
+	Token    string     // Token the node must have, or "" for any
+	Capture  string     // Name to bind the matched node to, if any
+	Children []*Pattern // Child sequence to match; nil leaves children unconstrained
+	Ellipsis bool       // Matches zero or more siblings in a child sequence
+}
+
+// Match is a node matching a pattern and the nodes bound to its captures
+type Match struct {
+	Node     *Node
+	Captures map[string]*Node
+}
+
+// capture is a capture binding made while matching
+type capture struct {
+	name string
+	node *Node
+}
+
+// Search returns the nodes matching the pattern in pre-order. Comments are
+// skipped when matching child sequences. A capture name used more than once
+// must bind structurally identical subtrees.
+func (u *UAST) Search(pattern *Pattern) []Match {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var matches []Match
+	var captures []capture
+	walk(u.Root, func(node *Node, _ int) {
+		captures = captures[:0]
+		if !matchPattern(pattern, node, &captures) {
+			return
+		}
+
+		match := Match{Node: node}
+		if len(captures) > 0 {
+			match.Captures = make(map[string]*Node, len(captures))
+			for _, c := range captures {
+				match.Captures[c.name] = c.node
+			}
+		}
+		matches = append(matches, match)
+	})
+	return matches
+}
+
+// SearchString compiles a pattern and searches for it
+func (u *UAST) SearchString(pattern string) ([]Match, error) {
+	q, err := Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return q.Search(u), nil
+}
+
+// matchPattern reports whether node matches p, appending capture bindings.
+// On failure the bindings are left as they were.
+func matchPattern(p *Pattern, node *Node, captures *[]capture) bool {
+	if p.Type != "" && string(node.Type) != p.Type && node.Properties["ts_type"] != p.Type {
+		return false
+	}
+	if p.Token != "" && node.Token != p.Token {
+		return false
+	}
+
+	mark := len(*captures)
+	if p.Capture != "" {
+		// A repeated capture must bind the same structure each time
+		for _, c := range *captures {
+			if c.name == p.Capture && !sameStructure(c.node, node) {
+				return false
+			}
+		}
+		*captures = append(*captures, capture{p.Capture, node})
+	}
+
+	if p.Children != nil {
+		if !matchSequence(p.Children, structuralChildren(node), captures) {
+			*captures = (*captures)[:mark]
+			return false
+		}
+	}
+	return true
+}
+
+// matchSequence matches a child pattern sequence against nodes, backtracking
+// over ellipses
+func matchSequence(patterns []*Pattern, nodes []*Node, captures *[]capture) bool {
+	if len(patterns) == 0 {
+		return len(nodes) == 0
+	}
+
+	p := patterns[0]
+	if p.Ellipsis {
+		for skip := 0; skip <= len(nodes); skip++ {
+			if matchSequence(patterns[1:], nodes[skip:], captures) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(nodes) == 0 {
+		return false
+	}
+	mark := len(*captures)
+	if matchPattern(p, nodes[0], captures) && matchSequence(patterns[1:], nodes[1:], captures) {
+		return true
+	}
+	*captures = (*captures)[:mark]
+	return false
+}
+
+// sameStructure reports whether two subtrees have the same types, tokens and
+// shape, ignoring IDs, locations and comments
+func sameStructure(a, b *Node) bool {
+	type pair struct{ a, b *Node }
+
+	stack := []pair{{a, b}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.a.Type != top.b.Type || top.a.Token != top.b.Token {
+			return false
+		}
+		ac, bc := structuralChildren(top.a), structuralChildren(top.b)
+		if len(ac) != len(bc) {
+			return false
+		}
+		for i := range ac {
+			stack = append(stack, pair{ac[i], bc[i]})
+		}
+	}
+	return true
+}
+
+// structuralChildren returns a node's children without nils and comments
+func structuralChildren(node *Node) []*Node {
+	children := make([]*Node, 0, len(node.Children))
+	for _, child := range node.Children {
+		if child != nil && child.Type != Comment {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// ParsePattern parses a pattern string. The syntax is:
+//
+//	_                 any node
+//	Call              a node of type Call (or ts_type "Call"), any children
+//	"fmt"             any node with token "fmt"
+//	Identifier="fmt"  a node with both the type and the token
+//	(Call a b ...)    a node whose children match a, b, then zero or more nodes
+//	$name             any node, captured as name
+//	$name:pattern     a node matching pattern, captured as name
+//
+// For example, (Call (Expression "fmt" _ $fn) ...) matches calls to
+// functions in package fmt and captures the function name.
+func ParsePattern(s string) (*Pattern, error) {
+	parser := &patternParser{input: s}
+	p, err := parser.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	parser.skipSpace()
+	if parser.pos < len(parser.input) {
+		return nil, fmt.Errorf("failed to parse pattern: unexpected %q at offset %d", parser.input[parser.pos:], parser.pos)
+	}
+	return p, nil
+}
+
+// patternParser is a recursive-descent parser for pattern strings
+type patternParser struct {
+	input string
+	pos   int
+}
+
+// parse parses one pattern element. Ellipses are only allowed in child lists.
+func (p *patternParser) parse(inList bool) (*Pattern, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("failed to parse pattern: unexpected end of input")
+	}
+
+	switch c := p.input[p.pos]; {
+	case c == '$':
+		p.pos++
+		name := p.readWhile(func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) })
+		if name == "" {
+			return nil, fmt.Errorf("failed to parse pattern: missing capture name at offset %d", p.pos)
+		}
+		pattern := &Pattern{}
+		if p.pos < len(p.input) && p.input[p.pos] == ':' {
+			p.pos++
+			var err error
+			if pattern, err = p.parse(false); err != nil {
+				return nil, err
+			}
+		}
+		pattern.Capture = name
+		return pattern, nil
+
+	case c == '(':
+		p.pos++
+		p.skipSpace()
+		pattern, err := p.parseWord()
+		if err != nil {
+			return nil, err
+		}
+		pattern.Children = []*Pattern{}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.input) {
+				return nil, fmt.Errorf("failed to parse pattern: missing )")
+			}
+			if p.input[p.pos] == ')' {
+				p.pos++
+				return pattern, nil
+			}
+			child, err := p.parse(true)
+			if err != nil {
+				return nil, err
+			}
+			pattern.Children = append(pattern.Children, child)
+		}
+
+	case c == '"':
+		token, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &Pattern{Token: token}, nil
+
+	case strings.HasPrefix(p.input[p.pos:], "..."):
+		if !inList {
+			return nil, fmt.Errorf("failed to parse pattern: ... outside a child list at offset %d", p.pos)
+		}
+		p.pos += 3
+		return &Pattern{Ellipsis: true}, nil
+	}
+
+	return p.parseWord()
+}
+
+// parseWord parses a type name, _, or a type with a token constraint
+func (p *patternParser) parseWord() (*Pattern, error) {
+	start := p.pos
+	word := p.readWhile(func(r rune) bool {
+		return !unicode.IsSpace(r) && r != '(' && r != ')' && r != '"' && r != '='
+	})
+	if word == "" {
+		return nil, fmt.Errorf("failed to parse pattern: expected a type at offset %d", start)
+	}
+
+	pattern := &Pattern{}
+	if word != "_" {
+		pattern.Type = word
+	}
+	if p.pos < len(p.input) && p.input[p.pos] == '=' {
+		p.pos++
+		token, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		pattern.Token = token
+	}
+	return pattern, nil
+}
+
+// parseString parses a double-quoted Go string literal
+func (p *patternParser) parseString() (string, error) {
+	if p.pos >= len(p.input) || p.input[p.pos] != '"' {
+		return "", fmt.Errorf("failed to parse pattern: expected a quoted token at offset %d", p.pos)
+	}
+
+	end := p.pos + 1
+	for end < len(p.input) && p.input[end] != '"' {
+		if p.input[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(p.input) {
+		return "", fmt.Errorf("failed to parse pattern: unterminated string at offset %d", p.pos)
+	}
+
+	token, err := strconv.Unquote(p.input[p.pos : end+1])
+	if err != nil {
+		return "", fmt.Errorf("failed to parse pattern: invalid string at offset %d: %w", p.pos, err)
+	}
+	p.pos = end + 1
+	return token, nil
+}
+
+// readWhile consumes and returns the runes satisfying keep
+func (p *patternParser) readWhile(keep func(rune) bool) string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+		if !keep(r) {
+			break
+		}
+		p.pos += size
+	}
+	return p.input[start:p.pos]
+}
+
+// skipSpace consumes whitespace
+func (p *patternParser) skipSpace() {
+	p.readWhile(unicode.IsSpace)
+}
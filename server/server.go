@@ -0,0 +1,260 @@
+// Package server exposes conversion and queries over HTTP, so uast-go can
+// run as a sidecar service for tools written in other languages:
+//
+//	POST /convert?language=go[&format=tree]   convert a CST JSON dump or source
+//	GET  /query?id=ID&type=T&token=X&pattern=P find nodes in a converted tree
+//
+// Converted trees are kept in memory and addressed by the ID that /convert
+// returns, in the response body or the X-UAST-ID header.
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/flaticols/uast-go"
+)
+
+// Options configures a Server
+type Options struct {
+	// Parser parses source sent to /convert with a non-JSON content type.
+	// Without one only CST JSON is accepted.
+	Parser uast.Parser
+
+	// NewConverter returns the converter for a language. It defaults to
+	// uast.ConverterFor.
+	NewConverter func(language string) *uast.Converter
+
+	Limits   uast.DecodeLimits // Limits for CST JSON, defaults to uast.DefaultDecodeLimits
+	MaxTrees int               // Converted trees kept for /query, defaults to 100
+}
+
+// Server is an http.Handler serving the conversion API
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+
+	mu    sync.Mutex
+	trees map[string]*uast.UAST
+	order []string // Tree IDs, oldest first
+}
+
+// New creates a Server
+func New(opts Options) *Server {
+	if opts.NewConverter == nil {
+		opts.NewConverter = uast.ConverterFor
+	}
+	if opts.Limits == (uast.DecodeLimits{}) {
+		opts.Limits = uast.DefaultDecodeLimits()
+	}
+	if opts.MaxTrees <= 0 {
+		opts.MaxTrees = 100
+	}
+
+	s := &Server{opts: opts, mux: http.NewServeMux(), trees: make(map[string]*uast.UAST)}
+	s.mux.HandleFunc("POST /convert", s.handleConvert)
+	s.mux.HandleFunc("GET /query", s.handleQuery)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// convertResponse is the JSON body returned by /convert
+type convertResponse struct {
+	ID   string     `json:"id"`
+	UAST *uast.UAST `json:"uast"`
+}
+
+// handleConvert converts the request body and stores the result
+func (s *Server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	language := r.URL.Query().Get("language")
+	body := io.Reader(r.Body)
+	if s.opts.Limits.MaxBytes > 0 {
+		body = io.LimitReader(body, int64(s.opts.Limits.MaxBytes)+1)
+	}
+
+	var root *uast.TreeSitterNode
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "" || mediaType == "application/json" {
+		root, err = uast.DecodeTreeSitterCSTWithLimits(body, s.opts.Limits)
+	} else if s.opts.Parser == nil {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("no parser configured for %s content", mediaType))
+		return
+	} else {
+		var source []byte
+		if source, err = io.ReadAll(body); err == nil {
+			if s.opts.Limits.MaxBytes > 0 && len(source) > s.opts.Limits.MaxBytes {
+				err = fmt.Errorf("source exceeds %d bytes: %w", s.opts.Limits.MaxBytes, uast.ErrLimitExceeded)
+			} else {
+				root, err = s.opts.Parser.Parse(r.Context(), source, language)
+			}
+		}
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, uast.ErrLimitExceeded) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, fmt.Errorf("failed to parse request body: %w", err))
+		return
+	}
+
+	u, err := s.opts.NewConverter(language).Convert(root, language)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	id := s.store(u)
+	w.Header().Set("X-UAST-ID", id)
+
+	format, contentType, err := negotiate(r)
+	if err != nil {
+		writeError(w, http.StatusNotAcceptable, err)
+		return
+	}
+	if format == nil {
+		writeJSON(w, http.StatusOK, convertResponse{ID: id, UAST: u})
+		return
+	}
+
+	text, err := uast.ToLLMFormat(u, format)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	io.WriteString(w, text)
+}
+
+// negotiate picks the response format from the format parameter or the
+// Accept header. A nil format means the JSON envelope.
+func negotiate(r *http.Request) (uast.LLMFormat, string, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		format, ok := uast.LookupFormat(name)
+		if !ok {
+			return nil, "", fmt.Errorf("unknown format %q, expected one of %s", name, strings.Join(uast.FormatNames(), ", "))
+		}
+		switch format.(type) {
+		case uast.JSONFormat, uast.StructuredFormat:
+			return format, "application/json", nil
+		}
+		return format, "text/plain; charset=utf-8", nil
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return nil, "", nil
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(part))
+		switch mediaType {
+		case "application/json", "*/*", "application/*":
+			return nil, "", nil
+		case "text/plain", "text/*":
+			format, _ := uast.LookupFormat("tree")
+			return format, "text/plain; charset=utf-8", nil
+		}
+	}
+	return nil, "", fmt.Errorf("cannot produce %s, use application/json or text/plain", accept)
+}
+
+// store keeps a converted tree, evicting the oldest beyond MaxTrees
+func (s *Server) store(u *uast.UAST) string {
+	var b [8]byte
+	rand.Read(b[:]) // Never returns an error
+	id := hex.EncodeToString(b[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trees[id] = u
+	s.order = append(s.order, id)
+	for len(s.order) > s.opts.MaxTrees {
+		delete(s.trees, s.order[0])
+		s.order = s.order[1:]
+	}
+	return id
+}
+
+// queryMatch is a node found by /query
+type queryMatch struct {
+	ID       string            `json:"id"`
+	Path     string            `json:"path"`
+	Type     uast.NodeType     `json:"type"`
+	Token    string            `json:"token,omitempty"`
+	Location *uast.Location    `json:"location,omitempty"`
+	Captures map[string]string `json:"captures,omitempty"` // Capture name -> node path
+}
+
+// handleQuery searches a stored tree
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	s.mu.Lock()
+	u, ok := s.trees[params.Get("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no tree with id %q", params.Get("id")))
+		return
+	}
+
+	var found []uast.Match
+	if text := params.Get("pattern"); text != "" {
+		query, err := uast.Compile(text)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		found = query.Search(u)
+	} else {
+		found = u.Search(&uast.Pattern{Type: params.Get("type"), Token: params.Get("token")})
+	}
+
+	matches := []queryMatch{}
+	for _, match := range found {
+		m := queryMatch{
+			ID:       match.Node.ID,
+			Path:     match.Node.Path(),
+			Type:     match.Node.Type,
+			Token:    match.Node.Token,
+			Location: match.Node.Location,
+		}
+		for name, node := range match.Captures {
+			if m.Captures == nil {
+				m.Captures = make(map[string]string, len(match.Captures))
+			}
+			m.Captures[name] = node.Path()
+		}
+		matches = append(matches, m)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"matches": matches})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/server"
+)
+
+// stubParser returns a one-node CST for any source
+type stubParser struct{}
+
+func (stubParser) Parse(_ context.Context, source []byte, _ string) (*uast.TreeSitterNode, error) {
+	return &uast.TreeSitterNode{Type: "source_file", Text: string(source)}, nil
+}
+
+func TestServer(t *testing.T) {
+	cst, err := os.ReadFile("../testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error reading CST: %v", err)
+	}
+	ts := httptest.NewServer(server.New(server.Options{}))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/convert?language=go", "application/json", bytes.NewReader(cst))
+	if err != nil {
+		t.Fatalf("Error posting CST: %v", err)
+	}
+	var converted struct {
+		ID   string `json:"id"`
+		UAST struct {
+			Language string `json:"language"`
+		} `json:"uast"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&converted); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a converted tree, got %d (%v)", resp.StatusCode, err)
+	}
+	resp.Body.Close()
+	if converted.ID == "" || converted.UAST.Language != "go" {
+		t.Errorf("Expected an ID and a go tree, got %+v", converted)
+	}
+
+	resp, err = http.Get(ts.URL + "/query?" + url.Values{"id": {converted.ID}, "pattern": {`(Call "add" ...)`}}.Encode())
+	if err != nil {
+		t.Fatalf("Error querying: %v", err)
+	}
+	var result struct {
+		Matches []struct {
+			Path string `json:"path"`
+		} `json:"matches"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result.Matches) != 1 {
+		t.Errorf("Expected one call to add, got %+v (%v)", result, err)
+	}
+	resp.Body.Close()
+
+	// Text formats are negotiated with Accept or chosen by name
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/convert?language=go", bytes.NewReader(cst))
+	req.Header.Set("Accept", "text/plain")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error posting CST: %v", err)
+	}
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") || !strings.Contains(body.String(), "Function") || resp.Header.Get("X-UAST-ID") == "" {
+		t.Errorf("Expected a tree rendering, got %s: %q", resp.Header.Get("Content-Type"), body.String())
+	}
+
+	for _, tt := range []struct {
+		method, target, contentType, body string
+		status                            int
+	}{
+		{http.MethodPost, "/convert?format=nope", "application/json", string(cst), http.StatusNotAcceptable},
+		{http.MethodPost, "/convert", "application/json", "{", http.StatusBadRequest},
+		{http.MethodPost, "/convert", "text/x-go", "package main", http.StatusUnsupportedMediaType},
+		{http.MethodGet, "/query?id=missing&type=Call", "", "", http.StatusNotFound},
+		{http.MethodGet, "/convert", "", "", http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.target, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error sending request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.target, tt.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestServerPartialLimits(t *testing.T) {
+	cst, err := os.ReadFile("../testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error reading CST: %v", err)
+	}
+	// MaxBytes is left zero, meaning no limit
+	ts := httptest.NewServer(server.New(server.Options{Parser: stubParser{}, Limits: uast.DecodeLimits{MaxDepth: 100}}))
+	defer ts.Close()
+
+	for _, tt := range []struct{ contentType, body string }{
+		{"application/json", string(cst)},
+		{"text/x-go", "package main"},
+	} {
+		resp, err := http.Post(ts.URL+"/convert?language=go", tt.contentType, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("Error posting %s: %v", tt.contentType, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", tt.contentType, http.StatusOK, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package uast
+
+import "strings"
+
+// Param is a parameter, receiver or named result of a function
+type Param struct {
+	Name string // Empty for unnamed parameters
+	Type string // Empty when the grammar doesn't declare one
+}
+
+// String renders the parameter as "name type"
+func (p Param) String() string {
+	switch {
+	case p.Name == "":
+		return p.Type
+	case p.Type == "":
+		return p.Name
+	}
+	return p.Name + " " + p.Type
+}
+
+// Signature is the receiver, parameters and result types of a function
+type Signature struct {
+	Receiver *Param
+	Params   []Param
+	Returns  []string
+}
+
+// parameterListTypes are the CST node types of parameter lists
+var parameterListTypes = map[string]bool{
+	"parameter_list":    true, // Go
+	"formal_parameters": true, // Java, TypeScript, JavaScript
+	"parameters":        true, // Python, Rust
+}
+
+// SetSignatureExtraction configures whether the receiver, parameters and
+// result types of functions and methods are recorded as the "receiver",
+// "parameters" and "returns" properties, read back with SignatureOf
+func (c *Converter) SetSignatureExtraction(enabled bool) {
+	c.extractSignatures = enabled
+}
+
+// captureSignature records the signature of a Function or Method CST node
+func (c *Converter) captureSignature(tsNode *TreeSitterNode, node *Node) {
+	sig := ExtractSignature(tsNode)
+	if sig.Receiver != nil {
+		node.SetProperty("receiver", c.intern(sig.Receiver.String()))
+		node.SetProperty("receiver_name", c.intern(sig.Receiver.Name))
+	}
+
+	params := make([]string, len(sig.Params))
+	names := make([]string, len(sig.Params))
+	for i, param := range sig.Params {
+		params[i] = param.String()
+		names[i] = param.Name
+	}
+	node.SetProperty("parameters", c.intern(strings.Join(params, ", ")))
+	node.SetProperty("parameter_names", c.intern(strings.Join(names, ", ")))
+	if len(sig.Returns) > 0 {
+		node.SetProperty("returns", c.intern(strings.Join(sig.Returns, ", ")))
+	}
+}
+
+// ExtractSignature reads the signature of a function or method CST node. It
+// uses field names where the CST records them and otherwise the position of
+// parameter lists around the name, as in Go's func (r T) name(p T) (R, error).
+func ExtractSignature(tsNode *TreeSitterNode) Signature {
+	var sig Signature
+	var receiver, params, results *TreeSitterNode
+
+	name := -1
+	var lists []*TreeSitterNode
+	for i, child := range tsNode.Children {
+		if child == nil {
+			continue
+		}
+		switch child.Field {
+		case "receiver":
+			receiver = child
+			continue
+		case "parameters":
+			params = child
+			continue
+		case "result", "return_type":
+			results = child
+			continue
+		}
+		if name < 0 && (child.Field == "name" || child.Type == "identifier" || child.Type == "field_identifier") {
+			name = i
+			continue
+		}
+		if parameterListTypes[child.Type] {
+			if name < 0 && len(lists) == 0 && tsNode.Type == "method_declaration" {
+				// A list before the name is a Go receiver
+				receiver = child
+				continue
+			}
+			lists = append(lists, child)
+		}
+	}
+	if params == nil && len(lists) > 0 {
+		params = lists[0]
+	}
+	if results == nil && len(lists) > 1 {
+		results = lists[1]
+	}
+
+	if receiver != nil {
+		if receivers := listParams(receiver); len(receivers) > 0 {
+			sig.Receiver = &receivers[0]
+		}
+	}
+	if params != nil {
+		sig.Params = listParams(params)
+	}
+
+	switch {
+	case results != nil && parameterListTypes[results.Type]:
+		for _, result := range listParams(results) {
+			sig.Returns = append(sig.Returns, result.Type)
+		}
+	case results != nil:
+		sig.Returns = []string{typeText(results)}
+	default:
+		if text := returnTypeText(tsNode); text != "" {
+			sig.Returns = []string{text}
+		}
+	}
+	return sig
+}
+
+// listParams returns the parameters declared in a parameter list. Grouped
+// declarations such as Go's a, b int yield one parameter per name.
+func listParams(list *TreeSitterNode) []Param {
+	var params []Param
+	for _, decl := range list.Children {
+		switch {
+		case decl == nil || decl.IsAnonymous():
+		case decl.Type == "identifier":
+			params = append(params, Param{Name: decl.Text})
+		case isTypeNode(decl.Type):
+			params = append(params, Param{Type: typeText(decl)})
+		default:
+			var typ string
+			if typeNode := firstTypeChild(decl); typeNode != nil {
+				typ = typeText(typeNode)
+			}
+
+			var names []string
+			for _, child := range decl.Children {
+				if child != nil && (child.Type == "identifier" || child.Field == "name" || child.Field == "pattern") {
+					names = append(names, typeText(child))
+				}
+			}
+			if len(names) == 0 && typ == "" {
+				// Such as Rust's &self
+				names = []string{typeText(decl)}
+			}
+			if len(names) == 0 {
+				params = append(params, Param{Type: typ})
+			}
+			for _, name := range names {
+				params = append(params, Param{Name: name, Type: typ})
+			}
+		}
+	}
+	return params
+}
+
+// SignatureOf returns the signature recorded on a Function or Method node by
+// a converter with signature extraction enabled
+func SignatureOf(fn *Node) (Signature, bool) {
+	paramText, ok := fn.Properties["parameters"]
+	if !ok {
+		return Signature{}, false
+	}
+
+	var sig Signature
+	if receiver, ok := fn.Properties["receiver"]; ok {
+		sig.Receiver = parseParam(receiver, fn.Properties["receiver_name"])
+	}
+
+	params := splitTopLevel(paramText)
+	names := splitTopLevel(fn.Properties["parameter_names"])
+	for i, param := range params {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		sig.Params = append(sig.Params, *parseParam(param, name))
+	}
+
+	sig.Returns = splitTopLevel(fn.Properties["returns"])
+	return sig, true
+}
+
+// parseParam splits a rendered parameter given its name
+func parseParam(text, name string) *Param {
+	if name == "" {
+		return &Param{Type: text}
+	}
+	return &Param{Name: name, Type: strings.TrimPrefix(strings.TrimPrefix(text, name), " ")}
+}
+
+// splitTopLevel splits a comma-separated list, ignoring commas nested in
+// brackets, as in "map[K]V, func(a, b int) error"
+func splitTopLevel(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(', '[', '{', '<':
+			depth++
+		case '>':
+			if i > 0 && s[i-1] == '-' {
+				continue // An arrow, as in fn(i32) -> i32
+			}
+			depth--
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
@@ -0,0 +1,167 @@
+package uast
+
+import (
+	"maps"
+	"slices"
+)
+
+// Simplify collapses chains of single-child wrapper nodes, such as
+// expression_statement -> expression -> call_expression, into the innermost
+// meaningful node. The Tree-sitter types of the collapsed wrappers are recorded
+// outermost first in the surviving node's "collapsed_path" property, and their
+// roles are merged into it. It returns the number of nodes removed, or
+// ErrFrozen for a frozen UAST.
+func (u *UAST) Simplify() (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return 0, ErrFrozen
+	}
+	removed := 0
+	u.Root = simplifyNode(u.Root, &removed)
+	if removed > 0 {
+		u.buildIndicesLocked()
+	}
+	return removed, nil
+}
+
+// simplifyNode collapses the chain starting at node and those below it. It
+// uses an explicit stack, so deep trees can't overflow the goroutine stack.
+func simplifyNode(node *Node, removed *int) *Node {
+	if node == nil {
+		return nil
+	}
+	collapse := func(node *Node) *Node {
+		for isCollapsible(node) {
+			node = collapseInto(node, node.Children[0])
+			*removed++
+		}
+		return node
+	}
+
+	node = collapse(node)
+	stack := []*Node{node}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for i, child := range top.Children {
+			if child != nil {
+				top.Children[i] = collapse(child)
+				stack = append(stack, top.Children[i])
+			}
+		}
+	}
+	return node
+}
+
+// isCollapsible reports whether node is a generic wrapper around a single child
+// that carries no information of its own
+func isCollapsible(node *Node) bool {
+	if len(node.Children) != 1 || node.Children[0] == nil {
+		return false
+	}
+
+	child := node.Children[0]
+	if node.Token != "" && node.Token != child.Token {
+		return false
+	}
+
+	switch node.Type {
+	case Unknown, Expression, Statement:
+		return true
+	}
+	return node.Type == child.Type
+}
+
+// collapseInto merges the wrapper's roles and Tree-sitter type into child
+func collapseInto(wrapper, child *Node) *Node {
+	path := wrapper.Properties["ts_type"]
+	if wrapperPath := wrapper.Properties["collapsed_path"]; wrapperPath != "" {
+		path = wrapperPath + "/" + path
+	}
+	if childPath := child.Properties["collapsed_path"]; childPath != "" {
+		path = path + "/" + childPath
+	}
+	child.SetProperty("collapsed_path", path)
+
+	for _, role := range wrapper.Roles {
+		if !slices.Contains(child.Roles, role) {
+			child.Roles = append(child.Roles, role)
+		}
+	}
+
+	return child
+}
+
+// Lists with runs of at least simplifiedRunLength nodes of one type show
+// the first simplifiedRunKept of them and summarize the rest
+const (
+	simplifiedRunLength = 10
+	simplifiedRunKept   = 3
+)
+
+// simplifyView collapses wrapper chains in a copied tree, as Simplify does,
+// and summarizes long runs of same-type siblings by a node such as
+// "…29 statements". Copies share properties and roles with the original
+// tree, so those are cloned before collapsing. It uses an explicit stack, so
+// deep trees can't overflow the goroutine stack.
+func simplifyView(node *Node) *Node {
+	collapse := func(node *Node) *Node {
+		for isCollapsible(node) {
+			child := node.Children[0]
+			child.Properties = maps.Clone(child.Properties)
+			child.Roles = slices.Clone(child.Roles)
+			node = collapseInto(node, child)
+		}
+		return node
+	}
+
+	node = collapse(node)
+	stack := []*Node{node}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Runs are found among the collapsed children
+		for i, child := range top.Children {
+			top.Children[i] = collapse(child)
+		}
+		top.Children = summarizeRuns(top.Children)
+		stack = append(stack, top.Children...)
+	}
+	return node
+}
+
+// summarizeRuns returns children with each long run of same-type nodes cut
+// to its first few and a summary of the rest
+func summarizeRuns(children []*Node) []*Node {
+	var kept []*Node
+	for start := 0; start < len(children); {
+		end := start + 1
+		for end < len(children) && children[end].Type == children[start].Type {
+			end++
+		}
+		run := children[start:end]
+		if len(run) >= simplifiedRunLength {
+			run = append(slices.Clip(run[:simplifiedRunKept]), summarizeRun(run[simplifiedRunKept:]))
+		}
+		kept = append(kept, run...)
+		start = end
+	}
+	return kept
+}
+
+// summarizeRun returns a node standing for a run of same-type nodes
+func summarizeRun(run []*Node) *Node {
+	summary := &Node{
+		ID:         run[0].ID,
+		Type:       run[0].Type,
+		Token:      "…" + countNodes(run),
+		Properties: map[string]string{"summary": "true"},
+	}
+	if first, last := run[0].Location, run[len(run)-1].Location; first != nil && last != nil {
+		summary.Location = &Location{Start: first.Start, End: last.End}
+	}
+	return summary
+}
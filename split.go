@@ -0,0 +1,96 @@
+package uast
+
+import (
+	"maps"
+	"slices"
+)
+
+// SplitByType returns a standalone UAST for each outermost node of the given
+// types, such as each top-level Function and Class, in tree order. Nodes of
+// the types nested in one already split stay part of it. Each UAST is rooted
+// at a deep copy of its node, keeps the language, metadata and node IDs of u
+// and the diagnostics of its subtree, and records the node's path in u as
+// its "node_path" metadata.
+func (u *UAST) SplitByType(types ...NodeType) []*UAST {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var roots []*Node
+	var stack []*Node
+	stack = append(stack, u.Root)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		if slices.Contains(types, node.Type) {
+			roots = append(roots, node)
+			continue
+		}
+		for _, child := range slices.Backward(node.Children) {
+			stack = append(stack, child)
+		}
+	}
+
+	parts := make([]*UAST, 0, len(roots))
+	for _, root := range roots {
+		part := newUAST(deepCopy(root), u.Language, u.fold)
+		maps.Copy(part.Metadata, u.Metadata)
+		part.Metadata["node_path"] = root.Path()
+		ids := make(map[string]bool)
+		walk(root, func(node *Node, _ int) { ids[node.ID] = true })
+		for _, diagnostic := range u.Diagnostics {
+			if diagnostic.NodeID != "" && ids[diagnostic.NodeID] {
+				part.Diagnostics = append(part.Diagnostics, diagnostic)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// deepCopy copies a subtree, sharing nothing with the original but the
+// values of annotations. It uses an explicit stack, so deep trees can't
+// overflow the goroutine stack.
+func deepCopy(root *Node) *Node {
+	type entry struct{ node, copied *Node }
+
+	copied := cloneNode(root)
+	stack := []entry{{root, copied}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range top.node.Children {
+			if child != nil {
+				childCopy := cloneNode(child)
+				top.copied.Children = append(top.copied.Children, childCopy)
+				stack = append(stack, entry{child, childCopy})
+			}
+		}
+	}
+	return copied
+}
+
+// cloneNode copies a node without its children
+func cloneNode(node *Node) *Node {
+	copied := &Node{
+		ID:          node.ID,
+		Type:        node.Type,
+		Token:       node.Token,
+		Roles:       slices.Clone(node.Roles),
+		Properties:  maps.Clone(node.Properties),
+		Annotations: maps.Clone(node.Annotations),
+	}
+	if node.Location != nil {
+		loc := *node.Location
+		copied.Location = &loc
+	}
+	if node.NameLocation != nil {
+		loc := *node.NameLocation
+		copied.NameLocation = &loc
+	}
+	return copied
+}
@@ -0,0 +1,88 @@
+package uast
+
+import "unsafe"
+
+// Stats summarizes the size and shape of a UAST
+type Stats struct {
+	TotalNodes     int              `json:"totalNodes"`
+	LeafNodes      int              `json:"leafNodes"`
+	MaxDepth       int              `json:"maxDepth"` // The root has depth 0
+	AvgDepth       float64          `json:"avgDepth"`
+	TypeCounts     map[NodeType]int `json:"typeCounts"`
+	RoleCounts     map[Role]int     `json:"roleCounts"`
+	TokenNodes     int              `json:"tokenNodes"`   // Nodes with a non-empty token
+	UniqueTokens   int              `json:"uniqueTokens"` // Distinct non-empty tokens
+	TokenBytes     int              `json:"tokenBytes"`   // Total length of all tokens
+	EstimatedBytes int              `json:"estimatedBytes"`
+}
+
+// Approximate per-entry overheads used for the in-memory size estimate
+const (
+	nodeSize       = int(unsafe.Sizeof(Node{}))
+	locationSize   = int(unsafe.Sizeof(Location{}))
+	pointerSize    = int(unsafe.Sizeof(&Node{}))
+	roleSize       = int(unsafe.Sizeof(Role("")))
+	mapEntrySize   = 2 * int(unsafe.Sizeof(""))
+	mapHeaderBytes = 48
+)
+
+// Stats walks the tree and returns node counts, depth and size figures
+func (u *UAST) Stats() Stats {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	stats := Stats{
+		TypeCounts: make(map[NodeType]int),
+		RoleCounts: make(map[Role]int),
+	}
+	tokens := make(map[string]struct{})
+	totalDepth := 0
+
+	walk(u.Root, func(node *Node, depth int) {
+		stats.TotalNodes++
+		stats.TypeCounts[node.Type]++
+		totalDepth += depth
+		stats.MaxDepth = max(stats.MaxDepth, depth)
+
+		if len(node.Children) == 0 {
+			stats.LeafNodes++
+		}
+		for _, role := range node.Roles {
+			stats.RoleCounts[role]++
+		}
+		if node.Token != "" {
+			stats.TokenNodes++
+			stats.TokenBytes += len(node.Token)
+			tokens[node.Token] = struct{}{}
+		}
+
+		stats.EstimatedBytes += estimateNodeBytes(node)
+	})
+
+	stats.UniqueTokens = len(tokens)
+	if stats.TotalNodes > 0 {
+		stats.AvgDepth = float64(totalDepth) / float64(stats.TotalNodes)
+	}
+	return stats
+}
+
+// estimateNodeBytes approximates the heap used by a single node
+func estimateNodeBytes(node *Node) int {
+	size := nodeSize + len(node.ID) + len(node.Token)
+	size += cap(node.Children) * pointerSize
+	size += cap(node.Roles) * roleSize
+
+	if node.Location != nil {
+		size += locationSize
+	}
+	if node.NameLocation != nil {
+		size += locationSize
+	}
+	if node.Properties != nil {
+		size += mapHeaderBytes
+		for k, v := range node.Properties {
+			size += mapEntrySize + len(k) + len(v)
+		}
+	}
+	return size
+}
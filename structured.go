@@ -0,0 +1,248 @@
+package uast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// QueryResults is the structured form of query results, for tool responses
+// that must conform to QueryResultsSchema
+type QueryResults struct {
+	Language string        `json:"language" description:"Language of the searched tree"`
+	Matches  []ResultMatch `json:"matches" description:"Matching nodes in source order"`
+}
+
+// ResultMatch is a matching node and its captures
+type ResultMatch struct {
+	ResultNode
+	Captures []ResultCapture `json:"captures" description:"Nodes bound to the pattern's $name captures"`
+}
+
+// ResultCapture is a node bound to a named capture
+type ResultCapture struct {
+	Name string     `json:"name" description:"Capture name without the $"`
+	Node ResultNode `json:"node"`
+}
+
+// ResultNode describes a node without its children
+type ResultNode struct {
+	ID       string    `json:"id"`
+	Type     NodeType  `json:"type" description:"UAST node type such as Function or Call"`
+	Token    string    `json:"token" description:"Token text, empty for inner nodes"`
+	Name     string    `json:"name" description:"Declared name for declarations, otherwise empty"`
+	Roles    []Role    `json:"roles"`
+	Path     string    `json:"path" description:"Node path that ResolvePath accepts"`
+	Location *Location `json:"location" description:"Source span with 1-based lines and columns, if known"`
+}
+
+// NewQueryResults converts search matches to their structured form
+func NewQueryResults(u *UAST, matches []Match) QueryResults {
+	results := QueryResults{Language: u.Language, Matches: make([]ResultMatch, 0, len(matches))}
+	for _, match := range matches {
+		m := ResultMatch{ResultNode: newResultNode(match.Node), Captures: []ResultCapture{}}
+		for name, node := range match.Captures {
+			m.Captures = append(m.Captures, ResultCapture{Name: name, Node: newResultNode(node)})
+		}
+		slices.SortFunc(m.Captures, func(a, b ResultCapture) int { return strings.Compare(a.Name, b.Name) })
+		results.Matches = append(results.Matches, m)
+	}
+	return results
+}
+
+// newResultNode describes a node for QueryResults
+func newResultNode(node *Node) ResultNode {
+	result := ResultNode{
+		ID:       node.ID,
+		Type:     node.Type,
+		Token:    node.Token,
+		Roles:    node.Roles,
+		Path:     node.Path(),
+		Location: node.Location,
+	}
+	if result.Roles == nil {
+		result.Roles = []Role{}
+	}
+	if node.HasRole(RoleDeclaration) {
+		result.Name = DeclarationName(node)
+	}
+	return result
+}
+
+// StructuredFormat implements LLMFormat by emitting QueryResults JSON. Query
+// is a structural pattern; without one the results are the tree's
+// declarations.
+type StructuredFormat struct {
+	Query        string
+	Pretty       bool
+	RootSelector string // Path or declaration name of the subtree to search; empty means the whole tree
+	MaxDepth     int    // Deeper results are left out; zero means no limit
+}
+
+// Format searches the UAST and encodes the results
+func (f StructuredFormat) Format(u *UAST) (string, error) {
+	text, err := formatString(f, u)
+	return strings.TrimSuffix(text, "\n"), err
+}
+
+// FormatTo writes the query results as JSON to w, followed by a newline
+func (f StructuredFormat) FormatTo(w io.Writer, u *UAST) error {
+	if u == nil {
+		return fmt.Errorf("cannot format nil UAST")
+	}
+
+	root, err := selectRoot(u, f.RootSelector)
+	if err != nil {
+		return err
+	}
+
+	var matches []Match
+	if f.Query != "" {
+		found, err := u.SearchString(f.Query)
+		if err != nil {
+			return err
+		}
+		u.mu.RLock()
+		for _, match := range found {
+			if depth := depthBelow(match.Node, root); depth >= 0 && (f.MaxDepth <= 0 || depth <= f.MaxDepth) {
+				matches = append(matches, match)
+			}
+		}
+		u.mu.RUnlock()
+	} else {
+		u.mu.RLock()
+		walk(root, func(node *Node, depth int) {
+			if node.HasRole(RoleDeclaration) && (f.MaxDepth <= 0 || depth <= f.MaxDepth) {
+				matches = append(matches, Match{Node: node})
+			}
+		})
+		u.mu.RUnlock()
+	}
+
+	encoder := json.NewEncoder(w)
+	if f.Pretty {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(NewQueryResults(u, matches)); err != nil {
+		return fmt.Errorf("failed to marshal query results: %w", err)
+	}
+	return nil
+}
+
+// QueryResultsSchema returns the JSON Schema of QueryResults, in the strict
+// form accepted by OpenAI structured outputs and function calling
+func QueryResultsSchema() map[string]any {
+	schema, err := GenerateSchema(QueryResults{})
+	if err != nil {
+		panic(err) // QueryResults only uses supported types
+	}
+	return schema
+}
+
+// GenerateSchema derives a JSON Schema from the type of v. Structs become
+// closed objects with every field required, as strict structured outputs
+// demand, so optional values must be pointers, which become nullable.
+// Fields are named by their json tags and described by "description" tags.
+// Maps, interfaces and recursive types are not supported.
+func GenerateSchema(v any) (map[string]any, error) {
+	schema, err := schemaFor(reflect.TypeOf(v), nil)
+	if err != nil {
+		return nil, err
+	}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	return schema, nil
+}
+
+// schemaFor builds the schema of a type; seen holds the structs being built
+// to detect recursion
+func schemaFor(t reflect.Type, seen []reflect.Type) (map[string]any, error) {
+	if t == nil {
+		return nil, fmt.Errorf("cannot generate a schema for nil")
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema, err := schemaFor(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return nullable(schema), nil
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaFor(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	case reflect.Struct:
+		if slices.Contains(seen, t) {
+			return nil, fmt.Errorf("cannot generate a schema for recursive type %s", t)
+		}
+		properties := make(map[string]any)
+		required := []string{}
+		if err := structProperties(t, append(seen, t), properties, &required); err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}, nil
+	default:
+		return nil, fmt.Errorf("cannot generate a schema for %s", t)
+	}
+}
+
+// structProperties adds the schema of each field of a struct, flattening
+// embedded structs as encoding/json does
+func structProperties(t reflect.Type, seen []reflect.Type, properties map[string]any, required *[]string) error {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := structProperties(field.Type, seen, properties, required); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema, err := schemaFor(field.Type, seen)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			schema["description"] = description
+		}
+		properties[name] = schema
+		*required = append(*required, name)
+	}
+	return nil
+}
+
+// nullable allows a schema to also match null
+func nullable(schema map[string]any) map[string]any {
+	if kind, ok := schema["type"].(string); ok {
+		schema["type"] = []string{kind, "null"}
+		return schema
+	}
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+}
@@ -0,0 +1,187 @@
+package uast
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// selectRoot returns the node a format renders from. The selector is a path
+// such as "File/Function[main]", or a qualified or plain declaration name;
+// an empty selector selects the root.
+func selectRoot(u *UAST, selector string) (*Node, error) {
+	if selector == "" {
+		return u.Root, nil
+	}
+	if node, err := u.ResolvePath(selector); err == nil {
+		return node, nil
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var qualified, plain *Node
+	walk(u.Root, func(node *Node, _ int) {
+		if !node.HasRole(RoleDeclaration) {
+			return
+		}
+		if qualified == nil && QualifiedName(node) == selector {
+			qualified = node
+		}
+		if plain == nil && DeclarationName(node) == selector {
+			plain = node
+		}
+	})
+	switch {
+	case qualified != nil:
+		return qualified, nil
+	case plain != nil:
+		return plain, nil
+	}
+	return nil, fmt.Errorf("no node matches root selector %q", selector)
+}
+
+// NodeFilter omits nodes from a format's output without changing the tree.
+// The children of an omitted node take its place, and the root is always
+// kept.
+type NodeFilter struct {
+	IncludeTypes []NodeType // Only these types are kept; empty means every type
+	ExcludeTypes []NodeType
+	ExcludeRoles []Role
+	Keep         func(*Node) bool // Only nodes it returns true for are kept; nil keeps every node
+}
+
+// active reports whether the filter omits anything
+func (f NodeFilter) active() bool {
+	return len(f.IncludeTypes) > 0 || len(f.ExcludeTypes) > 0 || len(f.ExcludeRoles) > 0 || f.Keep != nil
+}
+
+// keep reports whether a node passes the filter
+func (f NodeFilter) keep(node *Node) bool {
+	if len(f.IncludeTypes) > 0 && !slices.Contains(f.IncludeTypes, node.Type) {
+		return false
+	}
+	if slices.Contains(f.ExcludeTypes, node.Type) {
+		return false
+	}
+	for _, role := range f.ExcludeRoles {
+		if node.HasRole(role) {
+			return false
+		}
+	}
+	return f.Keep == nil || f.Keep(node)
+}
+
+// children returns the children of a node the filter keeps, with the kept
+// descendants of omitted children in their place. Omitted nodes are expanded
+// with an explicit stack, so long chains of them can't overflow the
+// goroutine stack.
+func (f NodeFilter) children(node *Node) []*Node {
+	children := make([]*Node, 0, len(node.Children))
+	stack := slices.Clone(node.Children)
+	slices.Reverse(stack)
+	for len(stack) > 0 {
+		child := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch {
+		case child == nil:
+		case f.keep(child):
+			children = append(children, child)
+		default:
+			for i := len(child.Children) - 1; i >= 0; i-- {
+				stack = append(stack, child.Children[i])
+			}
+		}
+	}
+	return children
+}
+
+// selectSubtree returns a UAST of the selected subtree without the nodes
+// the filter omits, and with those more than maxDepth levels below it
+// dropped. Inner nodes that lose their children get placeholder as their
+// token. The UAST itself is returned when nothing is selected or dropped.
+func selectSubtree(u *UAST, selector string, maxDepth int, placeholder string, filter NodeFilter) (*UAST, error) {
+	root, err := selectRoot(u, selector)
+	if err != nil {
+		return nil, err
+	}
+	if root == u.Root && maxDepth <= 0 && !filter.active() {
+		return u, nil
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	c := subtreeCopy{maxDepth: maxDepth, placeholder: placeholder, filter: filter}
+	subtree := NewUAST(c.copy(root, 0), u.Language)
+	maps.Copy(subtree.Metadata, u.Metadata)
+	return subtree, nil
+}
+
+// subtreeCopy copies subtrees for rendering, leaving out nodes below
+// maxDepth and those the filter omits
+type subtreeCopy struct {
+	maxDepth    int // Zero means no limit
+	placeholder string
+	filter      NodeFilter
+}
+
+// copy copies a node at depth and what it keeps of its subtree. It uses an
+// explicit stack, so deep trees can't overflow the goroutine stack.
+func (c subtreeCopy) copy(root *Node, depth int) *Node {
+	type entry struct {
+		node, copied *Node
+		depth        int
+	}
+
+	copied := shallowCopy(root)
+	stack := []entry{{root, copied, depth}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if c.maxDepth > 0 && top.depth >= c.maxDepth {
+			if len(top.node.Children) > 0 && c.placeholder != "" {
+				top.copied.Token = c.placeholder
+			}
+			continue
+		}
+
+		// Omitted children are replaced by their own kept children
+		kept := c.filter.children(top.node)
+		top.copied.Children = make([]*Node, len(kept))
+		for i, child := range kept {
+			top.copied.Children[i] = shallowCopy(child)
+			stack = append(stack, entry{child, top.copied.Children[i], top.depth + 1})
+		}
+	}
+	return copied
+}
+
+// shallowCopy copies a node without its children, sharing its roles,
+// properties, annotations and locations
+func shallowCopy(node *Node) *Node {
+	return &Node{
+		ID:           node.ID,
+		Type:         node.Type,
+		Token:        node.Token,
+		Roles:        node.Roles,
+		Properties:   node.Properties,
+		Annotations:  node.Annotations,
+		Location:     node.Location,
+		NameLocation: node.NameLocation,
+	}
+}
+
+// depthBelow returns how many levels a node is below root, or -1 if it is
+// not in root's subtree
+func depthBelow(node, root *Node) int {
+	depth := 0
+	for ; node != nil; node = node.Parent() {
+		if node == root {
+			return depth
+		}
+		depth++
+	}
+	return -1
+}
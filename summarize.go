@@ -0,0 +1,212 @@
+package uast
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Summarizer compresses the text of a subtree, typically by asking a model
+// for a one-line description
+type Summarizer interface {
+	Summarize(ctx context.Context, text string) (string, error)
+}
+
+// SummarizerFunc adapts an ordinary function to the Summarizer interface
+type SummarizerFunc func(ctx context.Context, text string) (string, error)
+
+// Summarize calls f(ctx, text)
+func (f SummarizerFunc) Summarize(ctx context.Context, text string) (string, error) {
+	return f(ctx, text)
+}
+
+// summaryCache holds summaries by the hash of the summarized text
+type summaryCache struct {
+	mu        sync.Mutex
+	summaries map[[sha256.Size]byte]string
+}
+
+// SetSummarizer sets the Summarizer used when the output exceeds
+// MaxTotalTokens. The largest subtrees of the prioritized types are then
+// replaced by one-line summaries until the output fits. Summaries are cached
+// by subtree text across calls.
+func (p *LLMProcessor) SetSummarizer(summarizer Summarizer) {
+	p.summarizer = summarizer
+	p.summaries = &summaryCache{summaries: make(map[[sha256.Size]byte]string)}
+}
+
+// SetTokenizer sets the Tokenizer used to measure output against
+// MaxTotalTokens, defaulting to ApproxTokenizer
+func (p *LLMProcessor) SetTokenizer(tokenizer Tokenizer) {
+	p.tokenizer = tokenizer
+}
+
+// ProcessContext is Process with a context for the Summarizer
+func (p *LLMProcessor) ProcessContext(ctx context.Context, u *UAST) (string, error) {
+	// Summaries are tried before elision, which covers any remaining overrun
+	text, err := p.process(u, p.summarizer == nil)
+	if err != nil || p.summarizer == nil || p.MaxTotalTokens <= 0 {
+		return text, err
+	}
+
+	if p.countTokens(text) <= p.MaxTotalTokens {
+		return text, nil
+	}
+
+	// Summarize the largest candidates first, as they save the most. Sizes
+	// are estimated once and the summaries applied to a single copy, as
+	// re-rendering after each one would be quadratic in the tree's size.
+	type candidate struct {
+		node   *Node
+		tokens int
+	}
+	var candidates []candidate
+	u.mu.RLock()
+	for node, tokens := range p.subtreeTokens(u.Root) {
+		if node != u.Root && len(node.Children) > 0 && slices.Contains(p.PrioritizeTypes, node.Type) {
+			candidates = append(candidates, candidate{node, tokens})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int { return cmp.Compare(b.tokens, a.tokens) })
+
+	summaries := make(map[*Node]string)
+	excess := p.countTokens(text) - p.MaxTotalTokens
+	for _, c := range candidates {
+		if excess <= 0 {
+			break
+		}
+		if hasSummarizedAncestor(c.node, summaries) {
+			continue
+		}
+		var sb strings.Builder
+		formatNode(&sb, c.node, 0, SimpleTextFormat{IncludeLocations: p.IncludeLocations})
+
+		// The summarizer may be slow, so writers aren't held up meanwhile
+		u.mu.RUnlock()
+		summary, err := p.summarize(ctx, sb.String())
+		if err != nil {
+			return "", fmt.Errorf("failed to summarize %s %s: %w", c.node.Type, c.node.ID, err)
+		}
+		u.mu.RLock()
+		summaries[c.node] = summary
+		excess -= c.tokens - p.countTokens(summary)
+	}
+	summarized := NewUAST(summarizedCopy(u.Root, summaries), u.Language)
+	maps.Copy(summarized.Metadata, u.Metadata)
+	u.mu.RUnlock()
+
+	if text, err = p.process(summarized, false); err != nil || p.countTokens(text) <= p.MaxTotalTokens {
+		return text, err
+	}
+	return p.process(summarized, true)
+}
+
+// subtreeTokens estimates the tokens of every subtree below root rendered
+// in the SimpleTextFormat, summing the lines of its nodes bottom-up, in
+// pre-order
+func (p *LLMProcessor) subtreeTokens(root *Node) iter.Seq2[*Node, int] {
+	type entry struct {
+		node   *Node
+		parent int
+	}
+	var order []entry
+	stack := []entry{{root, -1}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		index := len(order)
+		order = append(order, top)
+		for i := len(top.node.Children) - 1; i >= 0; i-- {
+			if child := top.node.Children[i]; child != nil {
+				stack = append(stack, entry{child, index})
+			}
+		}
+	}
+
+	tokens := make([]int, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		tokens[i] += p.countTokens(simpleText(shallowCopy(order[i].node)))
+		if parent := order[i].parent; parent >= 0 {
+			tokens[parent] += tokens[i]
+		}
+	}
+	return func(yield func(*Node, int) bool) {
+		for i, e := range order {
+			if !yield(e.node, tokens[i]) {
+				return
+			}
+		}
+	}
+}
+
+// summarize returns the cached summary of text or asks the Summarizer,
+// folding the result onto one line
+func (p *LLMProcessor) summarize(ctx context.Context, text string) (string, error) {
+	key := sha256.Sum256([]byte(text))
+	p.summaries.mu.Lock()
+	summary, ok := p.summaries.summaries[key]
+	p.summaries.mu.Unlock()
+	if ok {
+		return summary, nil
+	}
+
+	summary, err := p.summarizer.Summarize(ctx, text)
+	if err != nil {
+		return "", err
+	}
+	summary = strings.Join(strings.Fields(summary), " ")
+
+	p.summaries.mu.Lock()
+	p.summaries.summaries[key] = summary
+	p.summaries.mu.Unlock()
+	return summary, nil
+}
+
+// hasSummarizedAncestor reports whether a node is inside a summarized subtree
+func hasSummarizedAncestor(node *Node, summaries map[*Node]string) bool {
+	for ancestor := range node.Ancestors() {
+		if _, ok := summaries[ancestor]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizedCopy copies a tree, replacing summarized subtrees by childless
+// nodes whose token is the summary and which have a "summary" property. It
+// uses an explicit stack, so deep trees can't overflow the goroutine stack.
+func summarizedCopy(root *Node, summaries map[*Node]string) *Node {
+	if root == nil {
+		return nil
+	}
+
+	type entry struct{ node, copied *Node }
+	copied := shallowCopy(root)
+	stack := []entry{{root, copied}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if summary, ok := summaries[top.node]; ok {
+			top.copied.Token = summary
+			top.copied.Properties = maps.Clone(top.node.Properties)
+			top.copied.SetProperty("summary", "true")
+			continue
+		}
+		top.copied.Children = make([]*Node, 0, len(top.node.Children))
+		for _, child := range top.node.Children {
+			if child != nil {
+				childCopy := shallowCopy(child)
+				top.copied.Children = append(top.copied.Children, childCopy)
+				stack = append(stack, entry{child, childCopy})
+			}
+		}
+	}
+	return copied
+}
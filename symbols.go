@@ -0,0 +1,273 @@
+package uast
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DeclarationName returns the name of a declaration node: its "name"
+// property, its token, or the token of its first Identifier child
+func DeclarationName(node *Node) string {
+	if node == nil {
+		return ""
+	}
+	if name := node.Properties["name"]; name != "" {
+		return name
+	}
+	if node.Token != "" {
+		return node.Token
+	}
+	if name := declarationNameNode(node); name != nil {
+		return name.Token
+	}
+	if node.Location != nil {
+		return fmt.Sprintf("<anonymous@%d:%d>", node.Location.Start.Line, node.Location.Start.Column)
+	}
+	return "<anonymous>"
+}
+
+// declarationNameNode returns the identifier child naming a declaration
+func declarationNameNode(node *Node) *Node {
+	for _, child := range node.Children {
+		if child != nil && child.Type == Identifier && child.Token != "" {
+			return child
+		}
+	}
+	return nil
+}
+
+// QualifiedName returns the name of a declaration qualified by its
+// enclosing classes and functions, such as "Example.test"
+func QualifiedName(node *Node) string {
+	if node == nil {
+		return ""
+	}
+
+	parts := []string{DeclarationName(node)}
+	for ancestor := node.Parent(); ancestor != nil; ancestor = ancestor.Parent() {
+		switch ancestor.Type {
+		case Class, Function, Method:
+			parts = append(parts, DeclarationName(ancestor))
+		}
+	}
+
+	slices.Reverse(parts)
+	return strings.Join(parts, ".")
+}
+
+// PackageName returns the name declared by the UAST's first Package node, or
+// "" if it has none
+func (u *UAST) PackageName() string {
+	packages := u.FindByType(Package)
+	if len(packages) == 0 {
+		return ""
+	}
+
+	pkg := packages[0]
+	for _, child := range pkg.Children {
+		if child != nil && child.Type == Identifier && child.Token != "" {
+			return child.Token
+		}
+	}
+	return pkg.Token
+}
+
+// Declaration is a declared symbol found in a workspace
+type Declaration struct {
+	Symbol string // Qualified name, prefixed with the package name if any
+	Name   string // Unqualified name
+	Path   string
+	Node   *Node
+}
+
+// SymbolIndex maps symbol names to their declarations across a workspace
+type SymbolIndex struct {
+	byQualified map[string][]Declaration
+	byName      map[string][]Declaration
+	byPath      map[string][]Declaration
+}
+
+// buildSymbolIndex indexes every node with the Declaration role, returning
+// the index generation of each file it was built from
+func buildSymbolIndex(w *Workspace) (*SymbolIndex, map[string]uint64) {
+	generations := make(map[string]uint64)
+	index := &SymbolIndex{
+		byQualified: make(map[string][]Declaration),
+		byName:      make(map[string][]Declaration),
+		byPath:      make(map[string][]Declaration),
+	}
+
+	for _, path := range w.Paths() {
+		u, ok := w.Get(path)
+		if !ok {
+			continue
+		}
+
+		generations[path] = u.indexGeneration()
+		pkg := u.PackageName()
+		declarations := u.Query().WithRole(RoleDeclaration).All()
+		u.mu.RLock()
+		for _, node := range declarations {
+			symbol := QualifiedName(node)
+			if pkg != "" {
+				symbol = pkg + "." + symbol
+			}
+			decl := Declaration{
+				Symbol: symbol,
+				Name:   DeclarationName(node),
+				Path:   path,
+				Node:   node,
+			}
+
+			index.byQualified[decl.Symbol] = append(index.byQualified[decl.Symbol], decl)
+			index.byName[decl.Name] = append(index.byName[decl.Name], decl)
+			index.byPath[path] = append(index.byPath[path], decl)
+		}
+		u.mu.RUnlock()
+	}
+	return index, generations
+}
+
+// ResolveSymbol returns the declarations of a qualified symbol such as
+// "main.Example.test". Names are also tried without the package prefix.
+func (s *SymbolIndex) ResolveSymbol(symbol string) []Declaration {
+	if decls, ok := s.byQualified[symbol]; ok {
+		return slices.Clone(decls)
+	}
+
+	var decls []Declaration
+	for qualified, candidates := range s.byQualified {
+		if strings.HasSuffix(qualified, "."+symbol) {
+			decls = append(decls, candidates...)
+		}
+	}
+	sortDeclarations(decls)
+	return decls
+}
+
+// DeclarationsOf returns every declaration with the given unqualified name
+func (s *SymbolIndex) DeclarationsOf(name string) []Declaration {
+	return slices.Clone(s.byName[name])
+}
+
+// DeclarationsIn returns every declaration in the file at path
+func (s *SymbolIndex) DeclarationsIn(path string) []Declaration {
+	return slices.Clone(s.byPath[path])
+}
+
+// Symbols returns every qualified symbol in sorted order
+func (s *SymbolIndex) Symbols() []string {
+	symbols := make([]string, 0, len(s.byQualified))
+	for symbol := range s.byQualified {
+		symbols = append(symbols, symbol)
+	}
+	slices.Sort(symbols)
+	return symbols
+}
+
+// sortDeclarations orders declarations by path, then by symbol
+func sortDeclarations(decls []Declaration) {
+	slices.SortStableFunc(decls, func(a, b Declaration) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Symbol, b.Symbol)
+	})
+}
+
+// symbolCache lazily builds a workspace's symbol index
+type symbolCache struct {
+	once        sync.Once
+	index       *SymbolIndex
+	generations map[string]uint64 // Of each file when the index was built
+}
+
+// build builds the index on first use and returns it
+func (c *symbolCache) build(w *Workspace) *SymbolIndex {
+	c.once.Do(func() {
+		c.index, c.generations = buildSymbolIndex(w)
+	})
+	return c.index
+}
+
+// current reports whether no file was edited since the index was built
+func (c *symbolCache) current(w *Workspace) bool {
+	for path, generation := range c.generations {
+		u, ok := w.Get(path)
+		if !ok || u.indexGeneration() != generation {
+			return false
+		}
+	}
+	return true
+}
+
+// DefinitionOf resolves an identifier in the file at path, first within the
+// file's scopes and then against top-level declarations in other files
+func (w *Workspace) DefinitionOf(path string, ref *Node) []Declaration {
+	u, ok := w.Get(path)
+	if !ok || ref == nil {
+		return nil
+	}
+
+	if binding := u.DefinitionOf(ref); binding != nil {
+		return []Declaration{{
+			Symbol: QualifiedName(binding.Node),
+			Name:   binding.Name,
+			Path:   path,
+			Node:   binding.Node,
+		}}
+	}
+
+	var decls []Declaration
+	for _, decl := range w.DeclarationsOf(ref.Token) {
+		if decl.Path != path && isTopLevel(decl.Node) {
+			decls = append(decls, decl)
+		}
+	}
+	return decls
+}
+
+// References returns the identifiers across the workspace referring to a
+// declaration. References from other files are those left unresolved in
+// their own file whose name matches a top-level declaration.
+func (w *Workspace) References(decl Declaration) []WorkspaceMatch {
+	var matches []WorkspaceMatch
+
+	if u, ok := w.Get(decl.Path); ok {
+		for _, ref := range u.References(decl.Node) {
+			matches = append(matches, WorkspaceMatch{Path: decl.Path, Node: ref})
+		}
+	}
+	if !isTopLevel(decl.Node) {
+		return matches
+	}
+
+	for _, path := range w.Paths() {
+		if path == decl.Path {
+			continue
+		}
+		u, ok := w.Get(path)
+		if !ok {
+			continue
+		}
+		for _, ref := range u.Scopes().Unresolved() {
+			if ref.Token == decl.Name {
+				matches = append(matches, WorkspaceMatch{Path: path, Node: ref})
+			}
+		}
+	}
+	return matches
+}
+
+// isTopLevel reports whether a declaration is outside any class or function
+func isTopLevel(node *Node) bool {
+	for ancestor := node.Parent(); ancestor != nil; ancestor = ancestor.Parent() {
+		switch ancestor.Type {
+		case Class, Function, Method:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package uast
+
+import (
+	"maps"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Phases recorded by an instrumented Converter
+const (
+	PhaseCheck    = "check"    // CST validation
+	PhaseConvert  = "convert"  // Building the UAST nodes
+	PhaseRoles    = "roles"    // Structural role inference
+	PhaseSimplify = "simplify" // Removing redundant nodes
+	PhaseIndex    = "index"    // Building the indices
+	PhaseFormat   = "format"   // Formatting with Converter.Format
+)
+
+// PhaseStats holds the measurements of one phase, summed over its calls.
+// Allocations are counted for the whole process, so they include those of
+// other goroutines running at the same time, such as concurrent conversions.
+type PhaseStats struct {
+	Calls    int           `json:"calls"`
+	Duration time.Duration `json:"duration"`
+	Allocs   uint64        `json:"allocs"`
+	Bytes    uint64        `json:"bytes"`
+}
+
+// TimingReport holds the measurements of an instrumented Converter since
+// instrumentation was enabled, with the parallelization parameters in
+// effect, to help tune them
+type TimingReport struct {
+	Phases            map[string]PhaseStats `json:"phases"`
+	ParallelThreshold int                   `json:"parallelThreshold"`
+	MaxGoRoutines     int                   `json:"maxGoRoutines"`
+	ParallelSplits    int64                 `json:"parallelSplits"` // Nodes whose children were converted in parallel
+	Goroutines        int64                 `json:"goroutines"`     // Goroutines started for them
+}
+
+// instrumentation accumulates a Converter's measurements
+type instrumentation struct {
+	mu         sync.Mutex
+	phases     map[string]PhaseStats
+	splits     atomic.Int64
+	goroutines atomic.Int64
+}
+
+// SetInstrumentation configures whether Convert, ConvertFiles and Format
+// record the duration and allocations of each phase, retrievable with
+// Report. Enabling it starts a new report. Allocation counts stop the world
+// briefly, so leave it off in production.
+func (c *Converter) SetInstrumentation(enabled bool) {
+	c.instruments = nil
+	if enabled {
+		c.instruments = &instrumentation{phases: make(map[string]PhaseStats)}
+	}
+}
+
+// Report returns the measurements recorded since instrumentation was
+// enabled, or an empty report if it is not
+func (c *Converter) Report() TimingReport {
+	report := TimingReport{
+		Phases:            make(map[string]PhaseStats),
+		ParallelThreshold: c.parallelThreshold,
+		MaxGoRoutines:     c.maxGoRoutines,
+	}
+	if c.instruments == nil {
+		return report
+	}
+
+	c.instruments.mu.Lock()
+	maps.Copy(report.Phases, c.instruments.phases)
+	c.instruments.mu.Unlock()
+	report.ParallelSplits = c.instruments.splits.Load()
+	report.Goroutines = c.instruments.goroutines.Load()
+	return report
+}
+
+// Format formats u with format, recording the format phase if
+// instrumentation is enabled
+func (c *Converter) Format(u *UAST, format LLMFormat) (string, error) {
+	defer c.phase(PhaseFormat)()
+	return ToLLMFormat(u, format)
+}
+
+// phase starts measuring a phase and returns the function that ends it
+func (c *Converter) phase(name string) func() {
+	in := c.instruments
+	if in == nil {
+		return func() {}
+	}
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	return func() {
+		elapsed := time.Since(start)
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+
+		in.mu.Lock()
+		defer in.mu.Unlock()
+		stats := in.phases[name]
+		stats.Calls++
+		stats.Duration += elapsed
+		stats.Allocs += after.Mallocs - before.Mallocs
+		stats.Bytes += after.TotalAlloc - before.TotalAlloc
+		in.phases[name] = stats
+	}
+}
+
+// recordSplit counts a parallel conversion of a node's children, in counts
+// too if not nil
+func (c *Converter) recordSplit(goroutines int, counts *conversionCounts) {
+	if counts != nil {
+		counts.splits.Add(1)
+		counts.goroutines.Add(int64(goroutines))
+	}
+	if c.instruments != nil {
+		c.instruments.splits.Add(1)
+		c.instruments.goroutines.Add(int64(goroutines))
+	}
+}
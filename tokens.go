@@ -0,0 +1,90 @@
+package uast
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the LLM tokens in a piece of text
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerFunc adapts an ordinary function to the Tokenizer interface
+type TokenizerFunc func(text string) int
+
+// CountTokens calls f(text)
+func (f TokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// ApproxTokenizer estimates token counts from text length, which is close
+// enough for budgeting when the model's real tokenizer isn't available
+type ApproxTokenizer struct {
+	CharsPerToken float64 // Defaults to 4, a typical ratio for code and English
+}
+
+// CountTokens estimates the number of tokens in text
+func (t ApproxTokenizer) CountTokens(text string) int {
+	charsPerToken := t.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = 4
+	}
+
+	chars := utf8.RuneCountInString(text)
+	if chars == 0 {
+		return 0
+	}
+	return int(float64(chars)/charsPerToken + 0.999)
+}
+
+// EstimateTokens formats the UAST and counts the tokens of the result. A nil
+// format uses SimpleTextFormat and a nil tokenizer uses ApproxTokenizer.
+func EstimateTokens(u *UAST, format LLMFormat, tokenizer Tokenizer) (int, error) {
+	if format == nil {
+		format = &SimpleTextFormat{}
+	}
+	if tokenizer == nil {
+		tokenizer = ApproxTokenizer{}
+	}
+
+	text, err := ToLLMFormat(u, format)
+	if err != nil {
+		return 0, fmt.Errorf("failed to format UAST: %w", err)
+	}
+	return tokenizer.CountTokens(text), nil
+}
+
+// EstimateNodeTokens counts the tokens of a subtree rendered as simple text.
+// A nil tokenizer uses ApproxTokenizer.
+func EstimateNodeTokens(node *Node, tokenizer Tokenizer) int {
+	if node == nil {
+		return 0
+	}
+	if tokenizer == nil {
+		tokenizer = ApproxTokenizer{}
+	}
+
+	var sb strings.Builder
+	formatNode(&sb, node, 0, SimpleTextFormat{})
+	return tokenizer.CountTokens(sb.String())
+}
+
+// CompareFormats estimates the token cost of the UAST in each of the given
+// formats, keyed by the same names
+func CompareFormats(u *UAST, formats map[string]LLMFormat, tokenizer Tokenizer) (map[string]int, error) {
+	costs := make(map[string]int, len(formats))
+	for name, format := range formats {
+		if format == nil {
+			return nil, fmt.Errorf("format %q cannot be nil", name)
+		}
+
+		tokens, err := EstimateTokens(u, format, tokenizer)
+		if err != nil {
+			return nil, fmt.Errorf("format %q: %w", name, err)
+		}
+		costs[name] = tokens
+	}
+	return costs, nil
+}
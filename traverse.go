@@ -0,0 +1,47 @@
+package uast
+
+import "sync"
+
+// walkEntry is a pending node on the walk stack
+type walkEntry struct {
+	node  *Node
+	depth int
+}
+
+// walkPool recycles walk stacks between traversals
+var walkPool = sync.Pool{
+	New: func() any {
+		stack := make([]walkEntry, 0, 64)
+		return &stack
+	},
+}
+
+// walk visits every node in the subtree rooted at root in pre-order, passing
+// its depth relative to root. It uses an explicit stack, so arbitrarily deep
+// trees are visited completely.
+func walk(root *Node, visit func(node *Node, depth int)) {
+	if root == nil {
+		return
+	}
+
+	stackPtr := walkPool.Get().(*[]walkEntry)
+	stack := append((*stackPtr)[:0], walkEntry{root, 0})
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		visit(top.node, top.depth)
+
+		// Push children in reverse so they are visited in order
+		for i := len(top.node.Children) - 1; i >= 0; i-- {
+			if child := top.node.Children[i]; child != nil {
+				stack = append(stack, walkEntry{child, top.depth + 1})
+			}
+		}
+	}
+
+	clear(stack[:cap(stack)]) // Drop references so pooled stacks don't pin trees
+	*stackPtr = stack[:0]
+	walkPool.Put(stackPtr)
+}
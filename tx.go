@@ -0,0 +1,278 @@
+package uast
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Tx is a set of edits made within Update. Edits change the tree at once, so
+// later edits see earlier ones, but the indices are brought up to date only
+// when the transaction commits.
+type Tx struct {
+	u       *UAST
+	edited  []*Node  // Nodes whose index keys may have changed
+	removed []*Node  // Roots of detached subtrees
+	undo    []func() // Reverts the edits, in reverse order
+	done    bool
+}
+
+// Update applies the edits fn makes through tx atomically: the write lock is
+// held throughout, so readers see the tree before or after all of them, and
+// the indices are refreshed once at commit. If fn returns an error or
+// panics, every edit is rolled back.
+func (u *UAST) Update(fn func(tx *Tx) error) (err error) {
+	u.flushDirty()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.frozen {
+		return ErrFrozen
+	}
+	u.ensureIndexedAs()
+
+	tx := &Tx{u: u}
+	defer func() {
+		tx.done = true
+		if r := recover(); r != nil {
+			tx.rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	tx.commit()
+	return nil
+}
+
+// rollback reverts the edits of the transaction
+func (tx *Tx) rollback() {
+	for _, undo := range slices.Backward(tx.undo) {
+		undo()
+	}
+}
+
+// commit updates the indices for the nodes the transaction added, removed or
+// changed
+func (tx *Tx) commit() {
+	u := tx.u
+
+	// Nodes of removed subtrees may have been attached again elsewhere
+	seen := make(map[*Node]bool)
+	var stale []*Node
+	for _, root := range tx.removed {
+		for _, node := range subtreeNodes(root) {
+			if !seen[node] && !tx.attached(node) {
+				seen[node] = true
+				stale = append(stale, node)
+			}
+		}
+	}
+
+	clear(seen)
+	var changed []*Node
+	for _, node := range tx.edited {
+		if seen[node] || !tx.attached(node) {
+			continue
+		}
+		seen[node] = true
+
+		key, ok := u.indexedAs[node]
+		if ok && key.matches(node) {
+			continue
+		}
+		if ok {
+			stale = append(stale, node)
+		}
+		changed = append(changed, node)
+	}
+
+	u.unindexNodesLocked(stale)
+	u.indexNodesLocked(changed)
+}
+
+// attached reports whether node is in the tree, following parent links to
+// the root
+func (tx *Tx) attached(node *Node) bool {
+	for ; node != nil; node = node.parent {
+		if node == tx.u.Root {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error unless the transaction is open and node is in the
+// tree
+func (tx *Tx) check(node *Node, name string) error {
+	if tx.done {
+		return fmt.Errorf("transaction is closed")
+	}
+	if node == nil {
+		return fmt.Errorf("%s cannot be nil", name)
+	}
+	if !tx.attached(node) {
+		return fmt.Errorf("%s is not part of this UAST", name)
+	}
+	return nil
+}
+
+// setChildren replaces the children of a node, recording how to restore them
+func (tx *Tx) setChildren(node *Node, children []*Node) {
+	previous := node.Children
+	node.Children = children
+	tx.undo = append(tx.undo, func() { node.Children = previous })
+}
+
+// setParent links a node to its parent, recording how to restore the link
+func (tx *Tx) setParent(node, parent *Node) {
+	previous := node.parent
+	node.parent = parent
+	tx.undo = append(tx.undo, func() { node.parent = previous })
+}
+
+// link links a subtree added under parent to it, and its nodes to their
+// parents
+func (tx *Tx) link(root, parent *Node) {
+	tx.setParent(root, parent)
+	walk(root, func(node *Node, _ int) {
+		for _, child := range node.Children {
+			if child != nil && child.parent != node {
+				tx.setParent(child, node)
+			}
+		}
+	})
+}
+
+// unlink takes a node out of the children of its old parent, if that is a
+// node of this tree removed earlier in the transaction
+func (tx *Tx) unlink(node *Node) {
+	parent := node.parent
+	if parent == nil {
+		return
+	}
+	if _, ok := tx.u.indexedAs[parent]; !ok {
+		return
+	}
+	if i := slices.Index(parent.Children, node); i >= 0 {
+		tx.setChildren(parent, slices.Delete(slices.Clone(parent.Children), i, i+1))
+	}
+}
+
+// AppendChild appends child as the last child of parent
+func (tx *Tx) AppendChild(parent, child *Node) error {
+	return tx.InsertChild(parent, -1, child)
+}
+
+// InsertChild inserts child into parent's children at index. A negative
+// index appends.
+func (tx *Tx) InsertChild(parent *Node, index int, child *Node) error {
+	if err := tx.check(parent, "parent"); err != nil {
+		return err
+	}
+	if child == nil {
+		return fmt.Errorf("child cannot be nil")
+	}
+	if tx.attached(child) {
+		return fmt.Errorf("child is already part of this UAST")
+	}
+	if slices.ContainsFunc(subtreeNodes(child), tx.attached) {
+		return fmt.Errorf("child holds a node already part of this UAST")
+	}
+
+	if index < 0 || index > len(parent.Children) {
+		index = len(parent.Children)
+	}
+	tx.unlink(child)
+	tx.setChildren(parent, slices.Insert(slices.Clone(parent.Children), index, child))
+	tx.link(child, parent)
+	tx.edited = append(tx.edited, subtreeNodes(child)...)
+	return nil
+}
+
+// RemoveNode detaches node and its subtree from the tree
+func (tx *Tx) RemoveNode(node *Node) error {
+	if err := tx.check(node, "node"); err != nil {
+		return err
+	}
+	if node == tx.u.Root {
+		return fmt.Errorf("cannot remove the root node")
+	}
+
+	parent := node.parent
+	i := slices.Index(parent.Children, node)
+	if i < 0 {
+		return fmt.Errorf("node is not a child of its recorded parent")
+	}
+	tx.setChildren(parent, slices.Delete(slices.Clone(parent.Children), i, i+1))
+	tx.setParent(node, nil)
+	tx.removed = append(tx.removed, node)
+	return nil
+}
+
+// ReplaceNode replaces old and its subtree with replacement
+func (tx *Tx) ReplaceNode(old, replacement *Node) error {
+	if err := tx.check(old, "node"); err != nil {
+		return err
+	}
+	if replacement == nil {
+		return fmt.Errorf("replacement cannot be nil")
+	}
+	if tx.attached(replacement) {
+		return fmt.Errorf("replacement is already part of this UAST")
+	}
+	if slices.ContainsFunc(subtreeNodes(replacement), tx.attached) {
+		return fmt.Errorf("replacement holds a node already part of this UAST")
+	}
+
+	tx.unlink(replacement)
+	u := tx.u
+	parent := old.parent
+	if old == u.Root {
+		previous := u.Root
+		u.Root = replacement
+		tx.undo = append(tx.undo, func() { u.Root = previous })
+	} else {
+		i := slices.Index(parent.Children, old)
+		if i < 0 {
+			return fmt.Errorf("node is not a child of its recorded parent")
+		}
+		children := slices.Clone(parent.Children)
+		children[i] = replacement
+		tx.setChildren(parent, children)
+	}
+	tx.setParent(old, nil)
+	tx.link(replacement, parent)
+	tx.removed = append(tx.removed, old)
+	tx.edited = append(tx.edited, subtreeNodes(replacement)...)
+	return nil
+}
+
+// SetNodeType changes a node's type
+func (tx *Tx) SetNodeType(node *Node, nodeType NodeType) error {
+	if err := tx.check(node, "node"); err != nil {
+		return err
+	}
+
+	previous := node.Type
+	node.Type = nodeType
+	tx.undo = append(tx.undo, func() { node.Type = previous })
+	tx.edited = append(tx.edited, node)
+	return nil
+}
+
+// SetNodeToken changes a node's token
+func (tx *Tx) SetNodeToken(node *Node, token string) error {
+	if err := tx.check(node, "node"); err != nil {
+		return err
+	}
+
+	previous := node.Token
+	node.Token = token
+	tx.undo = append(tx.undo, func() { node.Token = previous })
+	tx.edited = append(tx.edited, node)
+	return nil
+}
@@ -0,0 +1,171 @@
+package uast
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// typedDeclarations are CST node types, beyond those mapped to Parameter or
+// Variable, whose type annotation is captured into the "type" property
+var typedDeclarations = map[string]bool{
+	"parameter_declaration":          true, // Go
+	"variadic_parameter_declaration": true,
+	"field_declaration":              true, // Go, Java, Rust
+	"var_spec":                       true,
+	"const_spec":                     true,
+	"formal_parameter":               true, // Java
+	"spread_parameter":               true,
+	"local_variable_declaration":     true,
+	"required_parameter":             true, // TypeScript
+	"optional_parameter":             true,
+	"public_field_definition":        true,
+	"property_signature":             true,
+	"variable_declarator":            true,
+	"parameter":                      true, // Rust
+	"let_declaration":                true,
+	"const_item":                     true,
+	"static_item":                    true,
+}
+
+// SetTypeCapture configures whether declared types are recorded as
+// properties: "type" on parameters, fields and variables, and "return_type"
+// on functions and methods. Types are rendered from the source tokens, so
+// no inference is performed.
+func (c *Converter) SetTypeCapture(enabled bool) {
+	c.captureTypes = enabled
+}
+
+// captureTypeAnnotations records the declared type of a CST node on its UAST
+// node
+func (c *Converter) captureTypeAnnotations(tsNode *TreeSitterNode, node *Node) {
+	switch {
+	case node.Type == Function || node.Type == Method:
+		if text := returnTypeText(tsNode); text != "" {
+			node.SetProperty("return_type", c.intern(text))
+		}
+	case node.Type == Parameter || node.Type == Variable || typedDeclarations[tsNode.Type]:
+		if typeNode := firstTypeChild(tsNode); typeNode != nil {
+			node.SetProperty("type", c.intern(typeText(typeNode)))
+		}
+	}
+}
+
+// isTypeNode reports whether a CST node type denotes a type expression
+func isTypeNode(tsType string) bool {
+	switch tsType {
+	case "type", "type_identifier", "type_annotation":
+		return true
+	}
+	return strings.HasSuffix(tsType, "_type")
+}
+
+// firstTypeChild returns the first direct child that is a type expression
+func firstTypeChild(tsNode *TreeSitterNode) *TreeSitterNode {
+	for _, child := range tsNode.Children {
+		if child != nil && isTypeNode(child.Type) {
+			return child
+		}
+	}
+	return nil
+}
+
+// returnTypeText renders a function's declared result type. Go declares
+// multiple results as a second parameter list after the parameters.
+func returnTypeText(tsNode *TreeSitterNode) string {
+	if typeNode := firstTypeChild(tsNode); typeNode != nil {
+		return typeText(typeNode)
+	}
+
+	// A receiver list precedes the name, so only count lists after it
+	start := 0
+	for i, child := range tsNode.Children {
+		if child != nil && (child.Type == "identifier" || child.Type == "field_identifier") {
+			start = i + 1
+			break
+		}
+	}
+	lists := 0
+	for _, child := range tsNode.Children[start:] {
+		if child == nil || child.Type != "parameter_list" {
+			continue
+		}
+		lists++
+		if lists == 2 {
+			return typeText(child)
+		}
+	}
+	return ""
+}
+
+// typeText renders a type expression from its leaf tokens, dropping the
+// leading colon or arrow of an annotation
+func typeText(tsNode *TreeSitterNode) string {
+	var tokens []string
+	collectLeafText(tsNode, &tokens)
+	for len(tokens) > 0 && (tokens[0] == ":" || tokens[0] == "->") {
+		tokens = tokens[1:]
+	}
+
+	var b strings.Builder
+	for i, token := range tokens {
+		if i > 0 && needsSpace(tokens[i-1], token) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+// collectLeafText appends the text of each leaf under tsNode in order
+func collectLeafText(tsNode *TreeSitterNode, tokens *[]string) {
+	stack := []*TreeSitterNode{tsNode}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if len(node.Children) == 0 || node.Text != "" {
+			if text := strings.TrimSpace(node.Text); text != "" {
+				*tokens = append(*tokens, text)
+			}
+			continue
+		}
+		for i := len(node.Children) - 1; i >= 0; i-- {
+			if child := node.Children[i]; child != nil {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
+
+// needsSpace reports whether two adjacent type tokens must be separated, as
+// in "chan int" or "(int, error)"
+func needsSpace(prev, next string) bool {
+	last, _ := utf8.DecodeLastRuneInString(prev)
+	first, _ := utf8.DecodeRuneInString(next)
+	if !isWordRune(first) {
+		return false
+	}
+	return isWordRune(last) || last == ',' || last == ')'
+}
+
+// isWordRune reports whether r can be part of an identifier or keyword
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// FindByDeclaredType returns the nodes whose captured "type" or
+// "return_type" property equals typeName, in pre-order. Types are only
+// captured when the Converter has type capture enabled.
+func (u *UAST) FindByDeclaredType(typeName string) []*Node {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var nodes []*Node
+	walk(u.Root, func(node *Node, _ int) {
+		if node.Properties["type"] == typeName || node.Properties["return_type"] == typeName {
+			nodes = append(nodes, node)
+		}
+	})
+	return nodes
+}
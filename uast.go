@@ -65,37 +65,113 @@ const (
 	RoleReceiver    Role = "Receiver"
 	RoleCondition   Role = "Condition"
 	RoleBody        Role = "Body"
+
+	RoleAssignment    Role = "Assignment"
+	RoleWrite         Role = "Write" // The target of an assignment or update
+	RoleLeft          Role = "Left"
+	RoleRight         Role = "Right"
+	RoleOperator      Role = "Operator"
+	RoleBinary        Role = "Binary"
+	RoleUnary         Role = "Unary"
+	RoleName          Role = "Name"
+	RoleValue         Role = "Value"
+	RoleType          Role = "Type"
+	RoleCallee        Role = "Callee"
+	RoleReturn        Role = "Return"
+	RoleBlock         Role = "Block"
+	RoleIf            Role = "If"
+	RoleThen          Role = "Then"
+	RoleElse          Role = "Else"
+	RoleLoop          Role = "Loop"
+	RoleInitializer   Role = "Initializer"
+	RoleUpdate        Role = "Update"
+	RoleLiteral       Role = "Literal"
+	RoleString        Role = "String"
+	RoleNumber        Role = "Number"
+	RoleBoolean       Role = "Boolean"
+	RoleNull          Role = "Null"
+	RoleComment       Role = "Comment"
+	RoleDocumentation Role = "Documentation"
+	RoleVisibility    Role = "Visibility"
+	RolePackage       Role = "Package"
+	RolePath          Role = "Path"
 )
 
 // Node represents a node in the UAST
 type Node struct {
-	ID         string            `json:"id"`
-	Type       NodeType          `json:"type"`
-	Token      string            `json:"token,omitempty"`
-	Roles      []Role            `json:"roles,omitempty"`
-	Children   []*Node           `json:"children,omitempty"`
-	Properties map[string]string `json:"properties,omitempty"`
-	Location   *Location         `json:"location,omitempty"`
+	ID           string            `json:"id"`
+	Type         NodeType          `json:"type"`
+	Token        string            `json:"token,omitempty"`
+	Roles        []Role            `json:"roles,omitempty"`
+	Children     []*Node           `json:"children,omitempty"`
+	Properties   map[string]string `json:"properties,omitempty"`
+	Location     *Location         `json:"location,omitempty"`
+	NameLocation *Location         `json:"nameLocation,omitempty"` // Span of a declaration's name
+	Annotations  map[string]any    `json:"annotations,omitempty"`  // Data attached by analyses; see SetAnnotation
+	parent       *Node
+}
+
+// Parent returns the node's parent, or nil for the root. Parent links are
+// maintained by the UAST that indexes the node.
+func (n *Node) Parent() *Node {
+	return n.parent
+}
+
+// HasRole reports whether the node has the given role
+func (n *Node) HasRole(role Role) bool {
+	return slices.Contains(n.Roles, role)
+}
+
+// SetProperty sets a property, allocating the Properties map on first use.
+// Converted nodes always have a "ts_type" property, so this only saves the
+// map for nodes built by hand.
+func (n *Node) SetProperty(key, value string) {
+	if n.Properties == nil {
+		n.Properties = make(map[string]string, 1)
+	}
+	n.Properties[key] = value
 }
 
 // UAST represents a Universal Abstract Syntax Tree
 type UAST struct {
-	Root       *Node                `json:"root"`
-	Language   string               `json:"language"`
-	Metadata   map[string]string    `json:"metadata,omitempty"`
-	TypeIndex  map[NodeType][]*Node `json:"-"`
-	TokenIndex map[string][]*Node   `json:"-"`
-	mu         sync.RWMutex         `json:"-"`
+	Root        *Node                `json:"root"`
+	Language    string               `json:"language"`
+	Metadata    map[string]string    `json:"metadata,omitempty"`
+	Diagnostics []Diagnostic         `json:"diagnostics,omitempty"` // CST subtrees left out by partial conversion
+	TypeIndex   map[NodeType][]*Node `json:"-"`
+	TokenIndex  map[string][]*Node   `json:"-"`
+	RoleIndex   map[Role][]*Node     `json:"-"`
+	FoldIndex   map[string][]*Node   `json:"-"` // Case-folded tokens; nil unless token folding is enabled
+	mu          sync.RWMutex         `json:"-"`
+
+	// indexedAs records the keys each node is indexed under. It is built on
+	// the first incremental update and discarded by full rebuilds.
+	indexedAs map[*Node]indexKey
+	dirty     []*Node
+	scopes    *ScopeTree // Built lazily, discarded when the tree changes
+	frozen    bool       // Set by Freeze
+	fold      bool       // Maintain FoldIndex
+
+	// generation is bumped whenever the indices change, so caches built
+	// from the tree can tell they are stale
+	generation uint64
 }
 
 // NewUAST creates a new UAST with the given root node and language
 func NewUAST(root *Node, language string) *UAST {
+	return newUAST(root, language, false)
+}
+
+// newUAST creates a UAST, with a folded token index if fold is set
+func newUAST(root *Node, language string, fold bool) *UAST {
 	uast := &UAST{
 		Root:       root,
 		Language:   language,
 		Metadata:   make(map[string]string),
 		TypeIndex:  make(map[NodeType][]*Node),
 		TokenIndex: make(map[string][]*Node),
+		RoleIndex:  make(map[Role][]*Node),
+		fold:       fold,
 	}
 	uast.buildIndices()
 	return uast
@@ -106,27 +182,21 @@ func (u *UAST) buildIndices() {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
-	u.TypeIndex = make(map[NodeType][]*Node)
-	u.TokenIndex = make(map[string][]*Node)
-
-	var build func(*Node)
-	build = func(node *Node) {
-		if node == nil {
-			return
-		}
-
-		u.TypeIndex[node.Type] = append(u.TypeIndex[node.Type], node)
-
-		if node.Token != "" {
-			u.TokenIndex[node.Token] = append(u.TokenIndex[node.Token], node)
-		}
+	u.buildIndicesLocked()
+}
 
-		for _, child := range node.Children {
-			build(child)
-		}
-	}
+// buildIndicesLocked rebuilds the indices; the caller must hold the write lock
+func (u *UAST) buildIndicesLocked() {
+	set := buildIndexSet(u.Root, indexConfig{linkParents: !u.frozen, foldTokens: u.fold})
 
-	build(u.Root)
+	u.TypeIndex = set.types
+	u.TokenIndex = set.tokens
+	u.RoleIndex = set.roles
+	u.FoldIndex = set.folded
+	u.indexedAs = nil
+	u.dirty = nil
+	u.scopes = nil
+	u.generation++
 }
 
 // ToJSON converts the UAST to a JSON string
@@ -140,6 +210,8 @@ func (u *UAST) ToJSON() (string, error) {
 
 // FindByType returns all nodes of the given type
 func (u *UAST) FindByType(nodeType NodeType) []*Node {
+	u.flushDirty()
+
 	u.mu.RLock()
 	defer u.mu.RUnlock()
 
@@ -151,6 +223,8 @@ func (u *UAST) FindByType(nodeType NodeType) []*Node {
 
 // FindByToken returns all nodes with the given token
 func (u *UAST) FindByToken(token string) []*Node {
+	u.flushDirty()
+
 	u.mu.RLock()
 	defer u.mu.RUnlock()
 
@@ -160,6 +234,61 @@ func (u *UAST) FindByToken(token string) []*Node {
 	return []*Node{}
 }
 
+// FindByRole returns all nodes with the given role, such as every
+// declaration
+func (u *UAST) FindByRole(role Role) []*Node {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if nodes, ok := u.RoleIndex[role]; ok {
+		return slices.Clone(nodes)
+	}
+	return []*Node{}
+}
+
+// CountByType returns the number of nodes of the given type without copying
+// the index
+func (u *UAST) CountByType(nodeType NodeType) int {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return len(u.TypeIndex[nodeType])
+}
+
+// HasType reports whether the UAST contains any node of the given type
+func (u *UAST) HasType(nodeType NodeType) bool {
+	return u.CountByType(nodeType) > 0
+}
+
+// CountByToken returns the number of nodes with the given token without
+// copying the index
+func (u *UAST) CountByToken(token string) int {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return len(u.TokenIndex[token])
+}
+
+// TypeHistogram returns the number of nodes of each type
+func (u *UAST) TypeHistogram() map[NodeType]int {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	histogram := make(map[NodeType]int, len(u.TypeIndex))
+	for nodeType, nodes := range u.TypeIndex {
+		histogram[nodeType] = len(nodes)
+	}
+	return histogram
+}
+
 // AddMetadata adds metadata to the UAST
 func (u *UAST) AddMetadata(key, value string) {
 	u.mu.Lock()
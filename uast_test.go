@@ -0,0 +1,1773 @@
+package uast_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flaticols/uast-go"
+)
+
+func TestSimplifyCollapsesWrapperChains(t *testing.T) {
+	tsNode := &uast.TreeSitterNode{
+		Type: "program",
+		Children: []*uast.TreeSitterNode{
+			{
+				Type: "expression_statement",
+				Children: []*uast.TreeSitterNode{
+					{
+						Type: "expression",
+						Children: []*uast.TreeSitterNode{
+							{Type: "call_expression", Text: "run()"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	converter := uast.NewConverter()
+	converter.AddMappingRule("expression_statement", uast.Statement)
+
+	u, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	if removed, err := u.Simplify(); err != nil || removed != 2 {
+		t.Errorf("Expected 2 nodes to be removed, got %d", removed)
+	}
+
+	if len(u.Root.Children) != 1 {
+		t.Fatalf("Expected root to have 1 child, got %d", len(u.Root.Children))
+	}
+
+	call := u.Root.Children[0]
+	if call.Type != uast.Call {
+		t.Errorf("Expected collapsed node to be a Call, got %s", call.Type)
+	}
+	if got := call.Properties["collapsed_path"]; got != "expression_statement/expression" {
+		t.Errorf("Expected collapsed_path 'expression_statement/expression', got '%s'", got)
+	}
+	if len(u.FindByType(uast.Statement)) != 0 {
+		t.Errorf("Expected the statement wrapper to be removed from the index")
+	}
+}
+
+func TestFormattersRenderDeepTrees(t *testing.T) {
+	const depth = 500
+
+	root := &uast.Node{ID: "0", Type: uast.File}
+	current := root
+	for i := 1; i <= depth; i++ {
+		child := &uast.Node{ID: strconv.Itoa(i), Type: uast.Expression}
+		current.Children = []*uast.Node{child}
+		current = child
+	}
+	current.Token = "leaf"
+
+	u := uast.NewUAST(root, "go")
+
+	formats := map[string]uast.LLMFormat{
+		"simple": &uast.SimpleTextFormat{},
+		"tree":   &uast.TreeTextFormat{},
+	}
+	for name, format := range formats {
+		text, err := uast.ToLLMFormat(u, format)
+		if err != nil {
+			t.Fatalf("%s: Error formatting: %v", name, err)
+		}
+		if strings.Contains(text, "truncated") {
+			t.Errorf("%s: Expected output not to be truncated", name)
+		}
+		if got := strings.Count(text, string(uast.Expression)); got != depth {
+			t.Errorf("%s: Expected %d expression lines, got %d", name, depth, got)
+		}
+		if !strings.Contains(text, "Expression: leaf") {
+			t.Errorf("%s: Expected output to contain the leaf node", name)
+		}
+	}
+}
+
+// deepChain returns a UAST whose nodes form a single chain of Calls below a
+// File, depth levels deep
+func deepChain(depth int) *uast.UAST {
+	root := &uast.Node{ID: "0", Type: uast.File}
+	current := root
+	for i := 1; i <= depth; i++ {
+		child := &uast.Node{ID: strconv.Itoa(i), Type: uast.Call, Token: "f" + strconv.Itoa(i)}
+		current.Children = []*uast.Node{child}
+		current = child
+	}
+	current.Token = "leaf"
+	return uast.NewUAST(root, "go")
+}
+
+// nodeCount formats a UAST as its number of nodes, cheaply at any depth
+type nodeCount struct{}
+
+func (nodeCount) Format(u *uast.UAST) (string, error) {
+	return strconv.Itoa(u.Stats().TotalNodes), nil
+}
+
+func TestDeepTrees(t *testing.T) {
+	const depth = 100_000
+
+	// Recursion this deep would need far more stack than this
+	defer debug.SetMaxStack(debug.SetMaxStack(4 << 20))
+	u := deepChain(depth)
+
+	view := u.View(uast.NodeFilter{ExcludeRoles: []uast.Role{uast.RoleDeclaration}})
+	if text, err := view.Format(nodeCount{}); err != nil || text != strconv.Itoa(depth+1) {
+		t.Errorf("Expected a view copy of %d nodes, got %s (%v)", depth+1, text, err)
+	}
+	view = u.View(uast.NodeFilter{ExcludeTypes: []uast.NodeType{uast.Call}})
+	if text, err := view.Format(nodeCount{}); err != nil || text != "1" {
+		t.Errorf("Expected the filter to omit the whole chain, got %s (%v)", text, err)
+	}
+
+	processor := uast.NewLLMProcessor()
+	processor.SetFormat(nodeCount{})
+	processor.MaxTotalTokens = 0
+	for _, simplify := range []bool{false, true} {
+		processor.SimplifyNestedNodes = simplify
+		if text, err := processor.Process(u); err != nil || text != strconv.Itoa(depth+1) {
+			t.Errorf("Expected a processor view of %d nodes, got %s (%v)", depth+1, text, err)
+		}
+	}
+
+	// Over budget, with no weighted subtrees to elide
+	processor.SetTypeWeights(map[uast.NodeType]int{uast.Function: 1})
+	processor.MaxTotalTokens = 1
+	if text, err := processor.Process(u); err != nil || text != strconv.Itoa(depth+1) {
+		t.Errorf("Expected nothing to elide, got %s (%v)", text, err)
+	}
+
+	// Summaries are applied to a copy of the whole tree
+	root := deepChain(depth).Root
+	root.Children = append(root.Children, uast.B(uast.Function, "f", uast.B(uast.Identifier, "x")))
+	processor.PrioritizeTypes = []uast.NodeType{uast.Function}
+	processor.SetSummarizer(uast.SummarizerFunc(func(context.Context, string) (string, error) { return "f", nil }))
+	if text, err := processor.Process(uast.NewUAST(root, "go")); err != nil || text != strconv.Itoa(depth+2) {
+		t.Errorf("Expected the function to be summarized, got %s (%v)", text, err)
+	}
+
+	if parts := u.SplitByType(uast.Call); len(parts) != 1 || parts[0].Stats().TotalNodes != depth {
+		t.Errorf("Expected one part holding every call, got %d", len(parts))
+	}
+
+	built := uast.B(uast.File, "")
+	for current, i := built, 1; i <= depth; i++ {
+		current.Children = []*uast.Node{uast.B(uast.Call, "f")}
+		current = current.Children[0]
+	}
+	if loc := uast.Build(built, "go").Root.Location; loc.End.Line != depth+1 {
+		t.Errorf("Expected the built root to span %d lines, got %v", depth+1, loc)
+	}
+
+	if removed, _ := u.Simplify(); removed != 0 || len(u.FindByType(uast.Call)) != depth {
+		t.Errorf("Expected nothing to collapse in a chain of distinct calls, removed %d", removed)
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	u, err := uast.NewConverter().Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	u.AddMetadata("filename", "example.go")
+
+	compact := u.Compact()
+	if tsType, ok := compact.Property(0, "ts_type"); !ok || tsType != "source_file" {
+		t.Errorf("Expected root ts_type 'source_file', got '%s'", tsType)
+	}
+	if compact.Parents[0] != -1 {
+		t.Errorf("Expected root parent to be -1, got %d", compact.Parents[0])
+	}
+
+	want, err := u.ToJSON()
+	if err != nil {
+		t.Fatalf("Error serializing UAST: %v", err)
+	}
+	got, err := compact.ToUAST().ToJSON()
+	if err != nil {
+		t.Fatalf("Error serializing round-tripped UAST: %v", err)
+	}
+	if got != want {
+		t.Errorf("Expected round-tripped UAST to match the original")
+	}
+}
+
+func TestMappedUAST(t *testing.T) {
+	u := loadGoExample(t)
+	u.AddMetadata("filename", "example.go")
+
+	path := filepath.Join(t.TempDir(), "example.uast")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+	if err := u.Compact().WriteMapped(f); err != nil {
+		t.Fatalf("Error writing mapped UAST: %v", err)
+	}
+	f.Close()
+
+	m, err := uast.OpenMapped(path)
+	if err != nil {
+		t.Fatalf("Error opening mapped UAST: %v", err)
+	}
+	defer m.Close()
+
+	if m.Language() != "go" || m.Metadata()["filename"] != "example.go" {
+		t.Errorf("Expected language and metadata to be kept, got %q and %v", m.Language(), m.Metadata())
+	}
+	functions := m.FindByType(uast.Function)
+	if len(functions) != 2 {
+		t.Fatalf("Expected 2 functions, got %d", len(functions))
+	}
+	if m.Parent(0) != -1 || m.Parent(functions[0]) < 0 {
+		t.Errorf("Expected parents to be recorded")
+	}
+	if tsType, ok := m.Property(0, "ts_type"); !ok || tsType != "source_file" {
+		t.Errorf("Expected root ts_type 'source_file', got '%s'", tsType)
+	}
+
+	want, _ := u.ToJSON()
+	got, _ := m.ToUAST().ToJSON()
+	if got != want {
+		t.Errorf("Expected the mapped UAST to match the original")
+	}
+
+	if err := os.WriteFile(path, []byte("not a mapped UAST at all, just text"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+	if _, err := uast.OpenMapped(path); !errors.Is(err, uast.ErrDecode) {
+		t.Errorf("Expected ErrDecode for a bad file, got %v", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	root := uast.B(uast.File, "",
+		uast.B(uast.Function, "main",
+			uast.B(uast.Identifier, "main").WithRoles(uast.RoleName),
+			uast.B(uast.Return, "return"),
+		).WithRoles(uast.RoleDeclaration, uast.RoleDefinition),
+		uast.B(uast.Function, "helper").WithProperty("exported", "false"),
+	)
+	root.Children[1].ID = "2"
+
+	u := uast.Build(root, "go")
+	if findings := u.Validate(); len(findings) > 0 {
+		t.Errorf("Expected a valid UAST, got %v", findings)
+	}
+	if got := u.FindByRole(uast.RoleDefinition); len(got) != 1 || got[0].Token != "main" {
+		t.Errorf("Expected main to be indexed as a definition, got %v", got)
+	}
+
+	ids := make(map[string]bool)
+	for node := range u.Root.Descendants() {
+		if node.ID == "" || ids[node.ID] {
+			t.Errorf("Expected a unique ID, got %q", node.ID)
+		}
+		ids[node.ID] = true
+	}
+	if root.Children[1].ID != "2" {
+		t.Errorf("Expected a set ID to be kept, got %q", root.Children[1].ID)
+	}
+
+	main := root.Children[0]
+	if *main.Location != (uast.Location{Start: uast.Position{Line: 2, Column: 1}, End: uast.Position{Line: 4, Column: 7}}) {
+		t.Errorf("Expected main to span lines 2 to 4, got %+v", main.Location)
+	}
+}
+
+func TestNewNode(t *testing.T) {
+	pos := func(line, column uint32) uast.Position { return uast.Position{Line: line, Column: column} }
+
+	child := uast.MustNewNode(uast.Identifier, uast.NodeID("2"), uast.NodeToken("x"), uast.NodeLocation(pos(1, 5), pos(1, 6)))
+	node, err := uast.NewNode(uast.Assignment,
+		uast.NodeID("1"),
+		uast.NodeRoles(uast.RoleAssignment),
+		uast.NodeProperty("operator", "="),
+		uast.NodeLocation(pos(1, 1), pos(1, 10)),
+		uast.NodeChildren(child),
+	)
+	if err != nil {
+		t.Fatalf("Error making node: %v", err)
+	}
+	if node.Token != "" || !node.HasRole(uast.RoleAssignment) || node.Properties["operator"] != "=" || len(node.Children) != 1 {
+		t.Errorf("Expected the options to be applied, got %+v", node)
+	}
+
+	invalid := map[string][]uast.NodeOption{
+		"missing ID":        {uast.NodeToken("x")},
+		"reversed location": {uast.NodeID("1"), uast.NodeLocation(pos(2, 1), pos(1, 1))},
+		"child outside":     {uast.NodeID("1"), uast.NodeLocation(pos(1, 1), pos(1, 3)), uast.NodeChildren(child)},
+		"nil child":         {uast.NodeID("1"), uast.NodeChildren(nil)},
+		"exclusive roles":   {uast.NodeID("1"), uast.NodeRoles(uast.RoleLeft, uast.RoleRight)},
+	}
+	for name, opts := range invalid {
+		if _, err := uast.NewNode(uast.Expression, opts...); !errors.Is(err, uast.ErrInvalidNode) {
+			t.Errorf("Expected ErrInvalidNode for %s, got %v", name, err)
+		}
+	}
+}
+
+func TestIndicesFollowSourceOrder(t *testing.T) {
+	root := &uast.Node{ID: "root", Type: uast.File}
+	var want []string
+	for i := 0; i < 64; i++ {
+		fn := &uast.Node{ID: "fn" + strconv.Itoa(i), Type: uast.Function, Token: "f"}
+		want = append(want, fn.ID)
+		for j := 0; j < 3; j++ {
+			fn.Children = append(fn.Children, &uast.Node{
+				ID:    fn.ID + "." + strconv.Itoa(j),
+				Type:  uast.Function,
+				Token: "f",
+			})
+			want = append(want, fn.Children[j].ID)
+		}
+		root.Children = append(root.Children, fn)
+	}
+
+	u := uast.NewUAST(root, "go")
+
+	for name, nodes := range map[string][]*uast.Node{
+		"type":  u.FindByType(uast.Function),
+		"token": u.FindByToken("f"),
+	} {
+		if len(nodes) != len(want) {
+			t.Fatalf("%s: Expected %d nodes, got %d", name, len(want), len(nodes))
+		}
+		for i, node := range nodes {
+			if node.ID != want[i] {
+				t.Fatalf("%s: Expected node %d to be %s, got %s", name, i, want[i], node.ID)
+			}
+		}
+	}
+}
+
+func TestIncrementalIndexUpdates(t *testing.T) {
+	fn := &uast.Node{ID: "2", Type: uast.Function, Token: "main"}
+	root := &uast.Node{ID: "1", Type: uast.File, Children: []*uast.Node{fn}}
+	u := uast.NewUAST(root, "go")
+
+	ret := &uast.Node{ID: "3", Type: uast.Return, Token: "return"}
+	if err := u.AppendChild(fn, ret); err != nil {
+		t.Fatalf("Error appending child: %v", err)
+	}
+	if got := u.FindByType(uast.Return); len(got) != 1 || got[0] != ret {
+		t.Errorf("Expected appended node to be indexed")
+	}
+	if ret.Parent() != fn {
+		t.Errorf("Expected appended node's parent to be set")
+	}
+
+	// In-place edits are picked up once the subtree is marked dirty
+	fn.Token = "run"
+	if err := u.MarkDirty(fn); err != nil {
+		t.Fatalf("Error marking dirty: %v", err)
+	}
+	if len(u.FindByToken("main")) != 0 || len(u.FindByToken("run")) != 1 {
+		t.Errorf("Expected token index to reflect the edited token")
+	}
+
+	if err := u.RemoveNode(ret); err != nil {
+		t.Fatalf("Error removing node: %v", err)
+	}
+	if len(u.FindByType(uast.Return)) != 0 || len(fn.Children) != 0 {
+		t.Errorf("Expected removed node to be gone from the tree and the index")
+	}
+
+	if err := u.RemoveNode(ret); err == nil {
+		t.Errorf("Expected an error removing a node that is no longer in the tree")
+	}
+
+	// A node can't replace another while still attached elsewhere
+	if err := u.AppendChild(fn, ret); err != nil {
+		t.Fatalf("Error appending child: %v", err)
+	}
+	if err := u.ReplaceNode(fn, ret); err == nil || ret.Parent() != fn {
+		t.Errorf("Expected an error replacing a node with one already in the tree, got %v", err)
+	}
+	err := u.Update(func(tx *uast.Tx) error { return tx.ReplaceNode(fn, ret) })
+	if err == nil || len(fn.Children) != 1 {
+		t.Errorf("Expected a transaction to refuse an attached replacement, got %v", err)
+	}
+
+	// Nor while a node below it is
+	wrapper := &uast.Node{ID: "4", Type: uast.Statement, Children: []*uast.Node{ret}}
+	if err := u.AppendChild(root, wrapper); err == nil || len(root.Children) != 1 {
+		t.Errorf("Expected an error inserting a subtree holding an attached node, got %v", err)
+	}
+	if err := u.ReplaceNode(fn, wrapper); err == nil || root.Children[0] != fn {
+		t.Errorf("Expected an error replacing with a subtree holding an attached node, got %v", err)
+	}
+	err = u.Update(func(tx *uast.Tx) error { return tx.AppendChild(root, wrapper) })
+	if err == nil || len(root.Children) != 1 {
+		t.Errorf("Expected a transaction to refuse a subtree holding an attached node, got %v", err)
+	}
+	err = u.Update(func(tx *uast.Tx) error { return tx.ReplaceNode(fn, wrapper) })
+	if err == nil || root.Children[0] != fn {
+		t.Errorf("Expected a transaction to refuse a replacement holding an attached node, got %v", err)
+	}
+	if ret.Parent() != fn || len(u.FindByType(uast.Return)) != 1 || len(u.FindByType(uast.Statement)) != 0 {
+		t.Errorf("Expected the tree and index to be unchanged")
+	}
+}
+
+func TestCountByType(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST(createTestCST())
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	u, err := uast.NewConverter().Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	if got := u.CountByType(uast.Function); got != 1 {
+		t.Errorf("Expected 1 function, got %d", got)
+	}
+	if u.HasType(uast.Loop) {
+		t.Errorf("Expected no loops")
+	}
+
+	histogram := u.TypeHistogram()
+	if histogram[uast.Unknown] != 4 || histogram[uast.Class] != 1 {
+		t.Errorf("Unexpected histogram: %v", histogram)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		u.CountByType(uast.Function)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected CountByType not to allocate, got %.0f allocations", allocs)
+	}
+}
+
+func TestStats(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST(createTestCST())
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	u, err := uast.NewConverter().Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	stats := u.Stats()
+	if stats.TotalNodes != 8 {
+		t.Errorf("Expected 8 nodes, got %d", stats.TotalNodes)
+	}
+	if stats.MaxDepth != 3 {
+		t.Errorf("Expected max depth 3, got %d", stats.MaxDepth)
+	}
+	if stats.LeafNodes != 3 {
+		t.Errorf("Expected 3 leaves, got %d", stats.LeafNodes)
+	}
+	if stats.RoleCounts[uast.RoleDeclaration] != 2 {
+		t.Errorf("Expected 2 declarations, got %d", stats.RoleCounts[uast.RoleDeclaration])
+	}
+	if stats.TokenNodes != 5 || stats.UniqueTokens != 5 {
+		t.Errorf("Expected 5 distinct tokens, got %d nodes and %d unique", stats.TokenNodes, stats.UniqueTokens)
+	}
+	if stats.EstimatedBytes <= 0 {
+		t.Errorf("Expected a positive size estimate")
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tsNode, err := uast.LoadTreeSitterCST(createTestCST())
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+
+	u, err := uast.NewConverter().Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+
+	countWords := uast.TokenizerFunc(func(text string) int {
+		return len(strings.Fields(text))
+	})
+
+	costs, err := uast.CompareFormats(u, map[string]uast.LLMFormat{
+		"json": &uast.JSONFormat{Pretty: true},
+		"tree": &uast.TreeTextFormat{},
+	}, countWords)
+	if err != nil {
+		t.Fatalf("Error comparing formats: %v", err)
+	}
+	if costs["tree"] >= costs["json"] {
+		t.Errorf("Expected tree format (%d) to be cheaper than JSON (%d)", costs["tree"], costs["json"])
+	}
+
+	functions := u.FindByType(uast.Function)
+	if got := uast.EstimateNodeTokens(functions[0], countWords); got != 11 {
+		t.Errorf("Expected 11 words for the function subtree, got %d", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	u := loadGoExample(t)
+
+	matches, err := u.SearchString(`(Call (Expression "fmt" _ $fn) ...)`)
+	if err != nil {
+		t.Fatalf("Error parsing pattern: %v", err)
+	}
+	var names []string
+	for _, match := range matches {
+		names = append(names, match.Captures["fn"].Token)
+	}
+	if got := strings.Join(names, ","); got != "Println,Printf,Println" {
+		t.Errorf("Expected calls to Println, Printf and Println, got %s", got)
+	}
+
+	// Ellipsis matches any arguments, and captures may constrain their type
+	matches, err = u.SearchString(`(Assignment $name:Identifier ":=" (Call "add" ...))`)
+	if err != nil {
+		t.Fatalf("Error parsing pattern: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Captures["name"].Token != "sum" {
+		t.Errorf("Expected sum := add(...) to match, got %+v", matches)
+	}
+
+	// A repeated capture must bind identical subtrees
+	if matches := u.Search(&uast.Pattern{Type: "Expression", Children: []*uast.Pattern{
+		{Capture: "x"}, {Token: "+"}, {Capture: "x"},
+	}}); len(matches) != 0 {
+		t.Errorf("Expected no x + x expressions, got %d", len(matches))
+	}
+
+	for _, pattern := range []string{`(Call`, `...`, `$`, `Identifier="x`, `Call extra`} {
+		if _, err := uast.ParsePattern(pattern); err == nil {
+			t.Errorf("Expected an error parsing %q", pattern)
+		}
+	}
+}
+
+func TestRegenerate(t *testing.T) {
+	leaf := func(tsType, text string, row, col int) *uast.TreeSitterNode {
+		return &uast.TreeSitterNode{
+			Type:       tsType,
+			Text:       text,
+			StartPoint: [2]int{row, col},
+			EndPoint:   [2]int{row, col + len(text)},
+		}
+	}
+	node := func(tsType string, children ...*uast.TreeSitterNode) *uast.TreeSitterNode {
+		return &uast.TreeSitterNode{
+			Type:       tsType,
+			StartPoint: children[0].StartPoint,
+			EndPoint:   children[len(children)-1].EndPoint,
+			Children:   children,
+		}
+	}
+
+	// package main
+	//
+	// func f() int {
+	// 	return 1
+	// }
+	source := node("source_file",
+		node("package_clause", leaf("package", "package", 0, 0), leaf("package_identifier", "main", 0, 8)),
+		node("function_declaration",
+			leaf("func", "func", 2, 0),
+			leaf("identifier", "f", 2, 5),
+			node("parameter_list", leaf("(", "(", 2, 6), leaf(")", ")", 2, 7)),
+			leaf("type_identifier", "int", 2, 9),
+			node("block",
+				leaf("{", "{", 2, 13),
+				node("return_statement", leaf("return", "return", 3, 1), leaf("int_literal", "1", 3, 8)),
+				leaf("}", "}", 4, 0),
+			),
+		),
+	)
+	source.EndPoint = [2]int{5, 0}
+
+	u, err := uast.NewConverter().Convert(source, "go")
+	if err != nil {
+		t.Fatalf("Error converting to UAST: %v", err)
+	}
+	for _, node := range u.FindByToken("f") {
+		node.Token = "renamed"
+	}
+
+	got, err := u.Regenerate()
+	if err != nil {
+		t.Fatalf("Error regenerating source: %v", err)
+	}
+	want := "package main\n\nfunc renamed() int {\n\treturn 1\n}\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// Nodes without locations are spaced apart where needed
+	ret := u.FindByToken("return")[0]
+	ret.Location = nil
+	u.FindByToken("1")[0].Location = nil
+	if got, _ := u.Regenerate(); !strings.Contains(got, "{return 1\n") {
+		t.Errorf("Expected unlocated tokens to be joined, got %q", got)
+	}
+}
+
+func TestSortNodesByLocation(t *testing.T) {
+	u := loadGoExample(t)
+
+	nodes := append(u.FindByType(uast.Call), u.FindByType(uast.Identifier)...)
+	nodes = append(nodes, &uast.Node{ID: "new", Type: uast.Identifier})
+	uast.SortNodesByLocation(nodes)
+
+	if nodes[len(nodes)-1].ID != "new" {
+		t.Error("Expected the node without a location to sort last")
+	}
+	for i := 1; i < len(nodes)-1; i++ {
+		if nodes[i-1].Location.Compare(*nodes[i].Location) > 0 {
+			t.Fatalf("Expected nodes in source order, got %v before %v", nodes[i-1].Location, nodes[i].Location)
+		}
+	}
+
+	outer := uast.Location{Start: uast.Position{Line: 1, Column: 1}, End: uast.Position{Line: 3, Column: 1}}
+	inner := uast.Location{Start: uast.Position{Line: 1, Column: 1}, End: uast.Position{Line: 1, Column: 5}}
+	after := uast.Location{Start: uast.Position{Line: 3, Column: 1}, End: uast.Position{Line: 3, Column: 4}}
+	if outer.Compare(inner) >= 0 {
+		t.Error("Expected an enclosing location to sort before the location it contains")
+	}
+	if !outer.Overlaps(inner) || outer.Overlaps(after) {
+		t.Error("Expected overlapping but not adjacent locations to overlap")
+	}
+	if !inner.Contains(uast.Position{Line: 1, Column: 5}) || inner.Contains(uast.Position{Line: 2, Column: 1}) {
+		t.Error("Expected Contains to include the end position only")
+	}
+	if !outer.ContainsRange(inner) || !outer.ContainsRange(outer) || outer.ContainsRange(after) || inner.ContainsRange(outer) {
+		t.Error("Expected ContainsRange to include equal ends only")
+	}
+	if !inner.Start.Before(inner.End) || inner.End.Before(inner.End) || !after.Start.After(inner.End) || inner.Start.After(outer.Start) {
+		t.Error("Expected Before and After to be strict")
+	}
+}
+
+func TestLineIndex(t *testing.T) {
+	source := []byte("package main\n\nfunc main() {}\n")
+	li := uast.NewLineIndex(source)
+	if li.LineCount() != 4 {
+		t.Errorf("Expected 4 lines, got %d", li.LineCount())
+	}
+
+	for offset := 0; offset <= len(source); offset++ {
+		pos, ok := li.OffsetToPosition(offset)
+		if !ok {
+			t.Fatalf("Expected offset %d to be in the source", offset)
+		}
+		if back, ok := li.PositionToOffset(pos); !ok || back != offset {
+			t.Errorf("Expected %v to map back to offset %d, got %d", pos, offset, back)
+		}
+	}
+	if pos, _ := li.OffsetToPosition(19); pos != (uast.Position{Line: 3, Column: 6}) {
+		t.Errorf("Expected offset 19 at 3:6, got %v", pos)
+	}
+	if _, ok := li.OffsetToPosition(len(source) + 1); ok {
+		t.Error("Expected an offset past the end to be rejected")
+	}
+	if _, ok := li.PositionToOffset(uast.Position{Line: 1, Column: 14}); ok {
+		t.Error("Expected a column past the end of its line to be rejected")
+	}
+
+	name := uast.Location{Start: uast.Position{Line: 3, Column: 6}, End: uast.Position{Line: 3, Column: 10}}
+	if text, ok := li.Slice(name); !ok || string(text) != "main" {
+		t.Errorf("Expected the slice to be main, got %q", text)
+	}
+	if text, ok := li.Lines(1, 3); !ok || string(text) != "package main\n\nfunc main() {}" {
+		t.Errorf("Expected lines 1 to 3 without the last newline, got %q", text)
+	}
+	if _, ok := li.Lines(2, 5); ok {
+		t.Error("Expected lines past the end to be rejected")
+	}
+}
+
+func TestLowestCommonAncestor(t *testing.T) {
+	u := loadGoExample(t)
+
+	mainFn := findFunction(t, u, "main")
+	calls := u.FindByType(uast.Call)
+	var inMain []*uast.Node
+	for _, call := range calls {
+		if call.EnclosingFunction() == mainFn {
+			inMain = append(inMain, call)
+		}
+	}
+	if len(inMain) < 2 {
+		t.Fatalf("Expected calls in main, got %d", len(inMain))
+	}
+
+	// The first and last call in main only share main's body
+	lca := u.LowestCommonAncestor(inMain[0], inMain[len(inMain)-1])
+	if lca == nil || !lca.HasRole(uast.RoleBody) || lca.Parent() != mainFn {
+		t.Errorf("Expected the body of main, got %v", lca)
+	}
+	if got := u.LowestCommonAncestor(inMain[0], mainFn); got != mainFn {
+		t.Errorf("Expected an ancestor to be its own common ancestor, got %v", got)
+	}
+	if got := u.LowestCommonAncestor(append(u.FindByType(uast.Function), inMain[0])...); got != u.Root {
+		t.Errorf("Expected add and main to meet at the root, got %v", got)
+	}
+
+	// Trees built by hand have no parent links
+	a := &uast.Node{ID: "a", Type: uast.Identifier}
+	b := &uast.Node{ID: "b", Type: uast.Identifier}
+	inner := &uast.Node{ID: "inner", Type: uast.Expression, Children: []*uast.Node{a, b}}
+	root := &uast.Node{ID: "root", Type: uast.File, Children: []*uast.Node{inner}}
+	outside := &uast.Node{ID: "outside", Type: uast.Identifier}
+	if got := uast.GetCommonAncestor([]*uast.Node{a, outside, b}, root); got != inner {
+		t.Errorf("Expected inner, got %v", got)
+	}
+}
+
+func TestStructuredFormat(t *testing.T) {
+	u := loadGoExample(t)
+
+	text, err := uast.ToLLMFormat(u, uast.StructuredFormat{Query: `(Call (Expression "fmt" _ $fn) ...)`})
+	if err != nil {
+		t.Fatalf("Error formatting: %v", err)
+	}
+	var results uast.QueryResults
+	if err := json.Unmarshal([]byte(text), &results); err != nil {
+		t.Fatalf("Error decoding results: %v", err)
+	}
+	if len(results.Matches) != 3 || results.Matches[0].Captures[0].Name != "fn" || results.Matches[0].Captures[0].Node.Token != "Println" {
+		t.Errorf("Expected three fmt calls with their captures, got %+v", results.Matches)
+	}
+
+	// The output must conform to the strict schema
+	schema, err := json.Marshal(uast.QueryResultsSchema())
+	if err != nil {
+		t.Fatalf("Error encoding schema: %v", err)
+	}
+	var decodedSchema, value any
+	json.Unmarshal(schema, &decodedSchema)
+	json.Unmarshal([]byte(text), &value)
+	if err := conforms(decodedSchema.(map[string]any), value); err != nil {
+		t.Errorf("Results do not conform to the schema: %v", err)
+	}
+
+	if _, err := uast.GenerateSchema(map[string]string{}); err == nil {
+		t.Errorf("Expected maps to be rejected")
+	}
+}
+
+// conforms checks a decoded JSON value against the subset of JSON Schema
+// that GenerateSchema emits
+func conforms(schema map[string]any, value any) error {
+	types := []any{schema["type"]}
+	if list, ok := schema["type"].([]any); ok {
+		types = list
+	}
+	if value == nil {
+		if slices.Contains(types, any("null")) {
+			return nil
+		}
+		return fmt.Errorf("unexpected null")
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if len(v) != len(properties) || len(schema["required"].([]any)) != len(properties) || schema["additionalProperties"] != false {
+			return fmt.Errorf("object keys %v do not match the closed schema", slices.Sorted(maps.Keys(v)))
+		}
+		for key, item := range v {
+			property, ok := properties[key].(map[string]any)
+			if !ok {
+				return fmt.Errorf("unexpected property %q", key)
+			}
+			if err := conforms(property, item); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := conforms(schema["items"].(map[string]any), item); err != nil {
+				return err
+			}
+		}
+	case string:
+		if !slices.Contains(types, any("string")) {
+			return fmt.Errorf("unexpected string %q", v)
+		}
+	case float64:
+		if !slices.Contains(types, any("integer")) && !slices.Contains(types, any("number")) {
+			return fmt.Errorf("unexpected number %v", v)
+		}
+	}
+	return nil
+}
+
+func TestSummarizer(t *testing.T) {
+	u := loadGoExample(t)
+
+	processor := uast.NewLLMProcessor()
+	full, err := processor.Process(u)
+	if err != nil {
+		t.Fatalf("Error processing: %v", err)
+	}
+
+	calls := 0
+	processor.MaxTotalTokens = (uast.ApproxTokenizer{}).CountTokens(full) / 2
+	processor.SetSummarizer(uast.SummarizerFunc(func(_ context.Context, text string) (string, error) {
+		calls++
+		return fmt.Sprintf("summary of\n%d lines", strings.Count(text, "\n")), nil
+	}))
+	summarized, err := processor.ProcessContext(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Error processing: %v", err)
+	}
+	if calls == 0 || !strings.Contains(summarized, "summary of ") || len(summarized) >= len(full) {
+		t.Errorf("Expected over-budget functions to be summarized on one line, got:\n%s", summarized)
+	}
+
+	// Summaries are cached, and the tree itself is left alone
+	before := calls
+	if again, _ := processor.Process(u); again != summarized || calls != before {
+		t.Errorf("Expected cached summaries, got %d more calls", calls-before)
+	}
+	if got, _ := uast.NewLLMProcessor().Process(u); got != full {
+		t.Errorf("Expected the UAST not to be modified")
+	}
+
+	processor.SetSummarizer(uast.SummarizerFunc(func(context.Context, string) (string, error) {
+		return "", fmt.Errorf("model unavailable")
+	}))
+	if _, err := processor.Process(u); err == nil || !strings.Contains(err.Error(), "model unavailable") {
+		t.Errorf("Expected the summarizer's error, got %v", err)
+	}
+}
+
+func TestFormatTruncation(t *testing.T) {
+	long := strings.Repeat("x", 150)
+	root := &uast.Node{ID: "root", Type: uast.File, Children: []*uast.Node{
+		{ID: "a", Type: uast.Identifier, Token: long},
+		{ID: "b", Type: uast.Call, Children: []*uast.Node{{ID: "b1", Type: uast.Identifier, Token: "f"}}},
+		{ID: "c", Type: uast.Identifier, Token: "c"},
+		{ID: "d", Type: uast.Identifier, Token: "d"},
+	}}
+	u := uast.NewUAST(root, "go")
+
+	text, _ := uast.SimpleTextFormat{}.Format(u)
+	if !strings.Contains(text, "Identifier: "+long[:97]+"...\n") {
+		t.Errorf("Expected tokens to be cut at 100 characters by default, got:\n%s", text)
+	}
+	text, _ = uast.SimpleTextFormat{Truncation: uast.Truncation{MaxTokenLength: -1}}.Format(u)
+	if !strings.Contains(text, long+"\n") {
+		t.Errorf("Expected a negative limit to keep whole tokens")
+	}
+
+	text, _ = uast.SimpleTextFormat{Truncation: uast.Truncation{MaxTokenLength: 5, MaxDepth: 1, MaxChildrenPerNode: 2}}.Format(u)
+	want := "File\n  Identifier: xx...\n  Call\n    …1 more\n  …2 more\n"
+	if !strings.HasSuffix(text, want) {
+		t.Errorf("Expected %q, got:\n%s", want, text)
+	}
+
+	text, _ = uast.TreeTextFormat{Truncation: uast.Truncation{MaxChildrenPerNode: 3}}.Format(u)
+	want = "└── File\n    ├── Identifier: " + long[:97] + "...\n    ├── Call\n    │   └── Identifier: f\n    ├── Identifier: c\n    └── …1 more\n"
+	if !strings.HasSuffix(text, want) {
+		t.Errorf("Expected %q, got:\n%s", want, text)
+	}
+}
+
+func TestFormatProperties(t *testing.T) {
+	root := &uast.Node{ID: "fn", Type: uast.Function, Properties: map[string]string{"ts_type": "function_declaration", "name": "add"}}
+	u := uast.NewUAST(root, "go")
+
+	if text, _ := (uast.SimpleTextFormat{}).Format(u); strings.Contains(text, "ts_type") {
+		t.Errorf("Expected properties to be hidden by default, got:\n%s", text)
+	}
+	text, _ := uast.SimpleTextFormat{PropertyDisplay: uast.PropertyDisplay{IncludeProperties: true}}.Format(u)
+	if !strings.HasSuffix(text, "Function {name=add, ts_type=function_declaration}\n") {
+		t.Errorf("Expected sorted properties, got:\n%s", text)
+	}
+	text, _ = uast.TreeTextFormat{PropertyDisplay: uast.PropertyDisplay{PropertyAllowlist: []string{"ts_type"}}}.Format(u)
+	if !strings.HasSuffix(text, "└── Function {ts_type=function_declaration}\n") {
+		t.Errorf("Expected only allowed properties, got:\n%s", text)
+	}
+}
+
+func TestFormatSubtree(t *testing.T) {
+	u := loadGoExample(t)
+
+	text, err := uast.JSONFormat{RootSelector: "File/Function[add]", MaxDepth: 1}.Format(u)
+	if err != nil {
+		t.Fatalf("Error formatting subtree: %v", err)
+	}
+	decoded, err := uast.DecodeUAST(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Error decoding subtree: %v", err)
+	}
+	if root := decoded.Root; root.Type != uast.Function || root.Token != "add" || len(root.Children) == 0 {
+		t.Fatalf("Expected the add function as root, got %+v", root)
+	}
+	for _, child := range decoded.Root.Children {
+		if len(child.Children) > 0 {
+			t.Errorf("Expected children one level deep to be leaves, got %+v", child)
+		}
+	}
+
+	text, _ = uast.TreeTextFormat{RootSelector: "main", Truncation: uast.Truncation{MaxDepth: 1}}.Format(u)
+	if !strings.Contains(text, "└── Function: main\n") || strings.Contains(text, "Call") {
+		t.Errorf("Expected main one level deep, got:\n%s", text)
+	}
+
+	text, _ = uast.SourceFormat{RootSelector: "add", MaxDepth: 2}.Format(u)
+	if !strings.HasPrefix(text, "func add ...") || strings.Contains(text, "return") {
+		t.Errorf("Expected the body of add to be elided, got:\n%s", text)
+	}
+
+	text, _ = uast.StructuredFormat{RootSelector: "main"}.Format(u)
+	if strings.Contains(text, `"add"`) || !strings.Contains(text, `"main"`) {
+		t.Errorf("Expected only declarations in main, got:\n%s", text)
+	}
+
+	if _, err := (uast.SimpleTextFormat{RootSelector: "missing"}).Format(u); err == nil {
+		t.Error("Expected an error for a selector matching nothing")
+	}
+}
+
+func TestFormatFilters(t *testing.T) {
+	u := loadGoExample(t)
+
+	filter := uast.NodeFilter{ExcludeTypes: []uast.NodeType{uast.Unknown, uast.Comment}}
+	text, _ := uast.SimpleTextFormat{NodeFilter: filter}.Format(u)
+	if strings.Contains(text, "Unknown") || strings.Contains(text, "Comment") {
+		t.Errorf("Expected Unknown and Comment nodes to be omitted, got:\n%s", text)
+	}
+	if !strings.Contains(text, "\n  Function: main [Declaration, Definition]\n    Identifier: main [Reference]\n") {
+		t.Errorf("Expected children of omitted nodes to take their place, got:\n%s", text)
+	}
+	if len(u.FindByType(uast.Unknown)) == 0 {
+		t.Error("Expected the UAST to be unchanged")
+	}
+
+	text, _ = uast.TreeTextFormat{NodeFilter: uast.NodeFilter{IncludeTypes: []uast.NodeType{uast.Function}}}.Format(u)
+	if want := "└── File\n    ├── Function: add\n    └── Function: main\n"; !strings.HasSuffix(text, want) {
+		t.Errorf("Expected %q, got:\n%s", want, text)
+	}
+
+	text, _ = uast.JSONFormat{NodeFilter: uast.NodeFilter{ExcludeRoles: []uast.Role{uast.RoleReference}}}.Format(u)
+	decoded, err := uast.DecodeUAST(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Error decoding filtered UAST: %v", err)
+	}
+	for node := range decoded.Root.Descendants() {
+		if node.HasRole(uast.RoleReference) {
+			t.Fatalf("Expected references to be omitted, got %+v", node)
+		}
+	}
+}
+
+func TestTreeColor(t *testing.T) {
+	root := &uast.Node{ID: "id", Type: uast.Identifier, Token: "x", Roles: []uast.Role{uast.RoleReference}}
+	u := uast.NewUAST(root, "go")
+
+	text, _ := uast.TreeTextFormat{IncludeRoles: true, Color: true}.Format(u)
+	want := "\x1b[2m└── \x1b[0m\x1b[1;36mIdentifier\x1b[0m: \x1b[32mx\x1b[0m \x1b[33m[Reference]\x1b[0m\n"
+	if !strings.HasSuffix(text, want) {
+		t.Errorf("Expected %q, got %q", want, text)
+	}
+	if text, _ := (uast.TreeTextFormat{}).Format(u); strings.Contains(text, "\x1b") || strings.Contains(text, "Reference") {
+		t.Errorf("Expected plain output by default, got %q", text)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if uast.ColorEnabled(os.Stdout) {
+		t.Error("Expected NO_COLOR to disable color")
+	}
+}
+
+func TestProcessorView(t *testing.T) {
+	u := loadGoExample(t)
+
+	processor := uast.NewLLMProcessor()
+	processor.SetFormat(uast.TreeTextFormat{})
+	processor.SetExcludeTypes([]uast.NodeType{uast.Unknown, uast.Comment})
+	processor.MaxTokensPerNode = 8
+	text, err := processor.Process(u)
+	if err != nil {
+		t.Fatalf("Error processing: %v", err)
+	}
+	if strings.Contains(text, "Unknown") || strings.Contains(text, "Comment") || !strings.Contains(text, "Package") {
+		t.Errorf("Expected excluded types to be left out of the custom format, got:\n%s", text)
+	}
+	if strings.Contains(text, "Hello, World!") || !strings.Contains(text, `"Hell...`) {
+		t.Errorf("Expected tokens to be cut to MaxTokensPerNode, got:\n%s", text)
+	}
+
+	// Over budget, the prioritized types are elided from the same view
+	processor.MaxTotalTokens = (uast.ApproxTokenizer{}).CountTokens(text) - 1
+	processor.SetPrioritizeTypes([]uast.NodeType{uast.Function})
+	prioritized, _ := processor.Process(u)
+	if got := (uast.ApproxTokenizer{}).CountTokens(prioritized); got > processor.MaxTotalTokens {
+		t.Errorf("Expected at most %d tokens, got %d", processor.MaxTotalTokens, got)
+	}
+	if !strings.Contains(prioritized, "Function: main … (") || !strings.Contains(prioritized, "Package: main") || !strings.Contains(prioritized, `"stri...`) || strings.Contains(prioritized, "Unknown") {
+		t.Errorf("Expected the larger function elided from the truncated view, got:\n%s", prioritized)
+	}
+	if len(u.FindByType(uast.Unknown)) == 0 {
+		t.Error("Expected the UAST to be unchanged")
+	}
+
+	// The default format and summaries cut tokens the same way, by runes
+	processor = uast.NewLLMProcessor()
+	processor.MaxTokensPerNode = 5
+	node := uast.B(uast.Literal, "héllo wörld")
+	text, _ = processor.Process(uast.NewUAST(node, "go"))
+	if !strings.Contains(text, "Literal: hé...\n") || !strings.Contains(processor.GenerateNodeSummary(node), "Token: hé...\n") {
+		t.Errorf("Expected rune-safe truncation, got:\n%s", text)
+	}
+}
+
+func TestProcessorSimplify(t *testing.T) {
+	body := &uast.Node{ID: "body", Type: uast.Statement, Roles: []uast.Role{uast.RoleBody}}
+	for i := range 20 {
+		body.Children = append(body.Children, &uast.Node{ID: "s" + strconv.Itoa(i), Type: uast.Statement, Children: []*uast.Node{
+			{ID: "e" + strconv.Itoa(i), Type: uast.Expression, Children: []*uast.Node{{ID: "c" + strconv.Itoa(i), Type: uast.Call, Token: "f"}}},
+		}})
+	}
+	u := uast.NewUAST(&uast.Node{ID: "fn", Type: uast.Function, Token: "main", Children: []*uast.Node{body}}, "go")
+
+	processor := uast.NewLLMProcessor()
+	simplified, _ := processor.Process(u)
+	processor.SimplifyNestedNodes = false
+	full, _ := processor.Process(u)
+
+	if want := "    Call: f\n    Call: f\n    Call: f\n    Call: …17 calls\n"; !strings.HasSuffix(simplified, want) {
+		t.Errorf("Expected wrappers collapsed and the run summarized, got:\n%s", simplified)
+	}
+	if tokens := (uast.ApproxTokenizer{}); tokens.CountTokens(simplified) >= tokens.CountTokens(full)/2 {
+		t.Errorf("Expected simplification to at least halve the output, got %d of %d tokens", tokens.CountTokens(simplified), tokens.CountTokens(full))
+	}
+	if len(u.FindByType(uast.Statement)) != 21 || u.FindByType(uast.Call)[0].Properties["collapsed_path"] != "" {
+		t.Error("Expected the UAST to be unchanged")
+	}
+}
+
+func TestProcessorBudget(t *testing.T) {
+	u := loadGoExample(t)
+	tokens := uast.ApproxTokenizer{}
+
+	processor := uast.NewLLMProcessor()
+	processor.SetFormat(uast.TreeTextFormat{})
+	processor.MaxTotalTokens = 250
+	text, err := processor.Process(u)
+	if err != nil {
+		t.Fatalf("Error processing: %v", err)
+	}
+	if tokens.CountTokens(text) > processor.MaxTotalTokens {
+		t.Errorf("Expected at most %d tokens, got %d", processor.MaxTotalTokens, tokens.CountTokens(text))
+	}
+	if !strings.Contains(text, "├── Function: add\n") || !strings.Contains(text, "└── Function: main … (") {
+		t.Errorf("Expected the larger function to be elided, got:\n%s", text)
+	}
+
+	// Only weighted types are elided
+	processor.SetTypeWeights(map[uast.NodeType]int{uast.Comment: 1})
+	processor.MaxTotalTokens = tokens.CountTokens(text)*2 + 20
+	text, _ = processor.Process(u)
+	if strings.Contains(text, "// Do some string processing") || !strings.Contains(text, "Comment: … (") || !strings.Contains(text, "Literal: 7") {
+		t.Errorf("Expected only comments to be elided, got:\n%s", text)
+	}
+}
+
+func TestTypeFormatter(t *testing.T) {
+	u := loadGoExample(t)
+
+	processor := uast.NewLLMProcessor()
+	processor.RegisterTypeFormatter(uast.Call, func(node *uast.Node) string {
+		var tokens []string
+		for d := range node.Descendants() {
+			if d.Type == uast.Identifier || d.Type == uast.Literal {
+				tokens = append(tokens, d.Token)
+			}
+		}
+		return fmt.Sprintf("%s(%s)", tokens[0], strings.Join(tokens[1:], ", "))
+	})
+	text, err := processor.Process(u)
+	if err != nil {
+		t.Fatalf("Error processing: %v", err)
+	}
+	if !strings.Contains(text, "Call: add(5, 7) [Call]\n") || strings.Contains(text, "Literal: 7") {
+		t.Errorf("Expected calls to render on one line, got:\n%s", text)
+	}
+
+	processor.RegisterTypeFormatter(uast.Call, nil)
+	if text, _ = processor.Process(u); strings.Contains(text, "add(5, 7)") {
+		t.Errorf("Expected the formatter to be removed, got:\n%s", text)
+	}
+
+	processor.SetFormat(nil)
+	processor.RegisterTypeFormatter(uast.Function, func(node *uast.Node) string { return "func " + uast.DeclarationName(node) })
+	text, _ = processor.Process(u)
+	if !strings.Contains(text, "Function:\n  func add\n  func main\n") {
+		t.Errorf("Expected the default output to use the formatter, got:\n%s", text)
+	}
+}
+
+func TestFormatTo(t *testing.T) {
+	u := loadGoExample(t)
+
+	for _, name := range uast.FormatNames() {
+		format, _ := uast.LookupFormat(name)
+		text, err := format.Format(u)
+		if err != nil {
+			t.Fatalf("%s: Error formatting: %v", name, err)
+		}
+		var sb strings.Builder
+		if err := uast.WriteLLMFormat(&sb, u, format); err != nil {
+			t.Fatalf("%s: Error writing: %v", name, err)
+		}
+		if strings.TrimSuffix(sb.String(), "\n") != strings.TrimSuffix(text, "\n") {
+			t.Errorf("%s: Expected streamed output to match Format, got:\n%s", name, sb.String())
+		}
+	}
+
+	processor := uast.NewLLMProcessor()
+	processor.MaxTotalTokens = 0
+	want, _ := processor.Process(u)
+	var sb strings.Builder
+	if err := processor.ProcessTo(context.Background(), &sb, u); err != nil || sb.String() != want {
+		t.Errorf("Expected streamed processor output to match Process, got %v:\n%s", err, sb.String())
+	}
+}
+
+func TestValidateUASTJSON(t *testing.T) {
+	u := loadGoExample(t)
+	u.AddMetadata("filename", "example.go")
+	text, err := u.ToJSON()
+	if err != nil {
+		t.Fatalf("Error serializing UAST: %v", err)
+	}
+	if err := uast.ValidateUASTJSON(strings.NewReader(text)); err != nil {
+		t.Errorf("Expected a serialized UAST to be valid, got %v", err)
+	}
+
+	bad := `{"language": "go", "root": {"id": "1", "type": "", "children": [{"id": "2", "type": "Call", "location": {"start": {"line": -1, "column": 1}}, "extra": true}]}}`
+	err = uast.ValidateUASTJSON(strings.NewReader(bad))
+	var schemaErr *uast.SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("Expected a SchemaError, got %v", err)
+	}
+	var got []string
+	for _, v := range schemaErr.Violations {
+		got = append(got, v.Path)
+	}
+	want := []string{"/root/children/0/extra", "/root/children/0/location", "/root/children/0/location/start/line", "/root/type"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected violations at %v, got %v", want, schemaErr.Violations)
+	}
+
+	// The schema describes every serialized field of a node
+	var schema struct {
+		Defs map[string]struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(uast.UASTSchema(), &schema); err != nil {
+		t.Fatalf("Error decoding schema: %v", err)
+	}
+	nodeType := reflect.TypeOf(uast.Node{})
+	for i := range nodeType.NumField() {
+		name, _, _ := strings.Cut(nodeType.Field(i).Tag.Get("json"), ",")
+		if _, ok := schema.Defs["node"].Properties[name]; name != "" && !ok {
+			t.Errorf("Expected the schema to describe node field %q", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// The hand-written example CST has a few children outside their parents
+	u := loadGoExample(t)
+	for _, finding := range u.Validate() {
+		if finding.Kind != uast.FindingLocationOutsideParent {
+			t.Errorf("Expected only location findings in the example, got %v", finding)
+		}
+	}
+
+	loc := func(startLine, endLine uint32) *uast.Location {
+		return &uast.Location{Start: uast.Position{Line: startLine, Column: 1}, End: uast.Position{Line: endLine, Column: 1}}
+	}
+	call := &uast.Node{ID: "3", Type: uast.Call, Token: "f", Location: loc(2, 9)}
+	body := &uast.Node{ID: "2", Type: uast.Statement, Location: loc(2, 4), Children: []*uast.Node{call}}
+	root := &uast.Node{ID: "1", Type: uast.File, Location: loc(1, 5), Children: []*uast.Node{body}}
+	bad := uast.NewUAST(root, "go")
+	if findings := bad.Validate(); len(findings) != 1 || findings[0].Kind != uast.FindingLocationOutsideParent {
+		t.Errorf("Expected only the call to lie outside its parent, got %v", findings)
+	}
+	body.Children = append(body.Children, nil)
+	bad.Root.Children = append(bad.Root.Children, &uast.Node{ID: "2", Type: uast.Comment, Location: loc(4, 3)}, call)
+
+	var got []string
+	for _, finding := range bad.Validate() {
+		got = append(got, string(finding.Kind)+" "+finding.Node.ID)
+	}
+	want := []string{
+		"NilChild 2",
+		"LocationOutsideParent 3",
+		"DuplicateID 2",
+		"ParentLink 2",
+		"InvalidLocation 2",
+		"SharedNode 3",
+		"IndexMismatch 2",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected findings %v, got %v", want, got)
+	}
+
+	body.Children = []*uast.Node{root}
+	cyclic := bad.Validate()
+	if !slices.ContainsFunc(cyclic, func(f uast.Finding) bool { return f.Kind == uast.FindingCycle && f.Node == root }) {
+		t.Errorf("Expected a cycle through the root, got %v", cyclic)
+	}
+
+	if findings := (&uast.UAST{}).Validate(); len(findings) != 1 || findings[0].Kind != uast.FindingNilRoot {
+		t.Errorf("Expected a nil root finding, got %v", findings)
+	}
+}
+
+func TestInject(t *testing.T) {
+	u := loadGoExample(t)
+	var host *uast.Node
+	for _, node := range u.FindByToken(`"Hello, World!"`) {
+		host = node
+	}
+	if host == nil {
+		t.Fatal("Expected the example to contain the greeting literal")
+	}
+
+	// The literal's content, parsed on its own as a made-up language
+	cst := &uast.TreeSitterNode{
+		Type: "sentence", EndByte: 12, EndPoint: [2]int{0, 12},
+		Children: []*uast.TreeSitterNode{
+			{Type: "word", EndByte: 5, EndPoint: [2]int{0, 5}, Text: "Hello"},
+			{Type: "word", StartByte: 7, EndByte: 12, StartPoint: [2]int{0, 7}, EndPoint: [2]int{0, 12}, Text: "World"},
+		},
+	}
+	converter := uast.NewConverter()
+	converter.SetPassThrough(true)
+	injected, err := converter.Convert(cst, "english")
+	if err != nil {
+		t.Fatalf("Error converting injected CST: %v", err)
+	}
+	origin := uast.Position{Line: host.Location.Start.Line, Column: host.Location.Start.Column + 1}
+	if err := u.Inject(host, injected, origin); err != nil {
+		t.Fatalf("Error injecting: %v", err)
+	}
+
+	words := u.FindByTypeInLanguage("english", "word")
+	if len(words) != 2 || words[1].Token != "World" || words[1].ID != host.ID+":3" {
+		t.Fatalf("Expected the two injected words, got %v", words)
+	}
+	if got := *words[1].Location; got.Start != (uast.Position{Line: 15, Column: 24}) || got.End != (uast.Position{Line: 15, Column: 29}) {
+		t.Errorf("Expected the word to be shifted into the literal, got %+v", got)
+	}
+	if got := u.LanguageOf(words[0]); got != "english" {
+		t.Errorf("Expected an injected node to be in english, got %q", got)
+	}
+	if got := u.LanguageOf(host); got != "go" {
+		t.Errorf("Expected the host to be in go, got %q", got)
+	}
+	if got := u.Languages(); !slices.Equal(got, []string{"go", "english"}) {
+		t.Errorf("Expected go and english, got %v", got)
+	}
+	if got := u.FindByTypeInLanguage("go", uast.Function); len(got) != 2 {
+		t.Errorf("Expected the Go functions, got %v", got)
+	}
+	for _, finding := range u.Validate() {
+		if finding.Kind != uast.FindingLocationOutsideParent || strings.Contains(finding.Node.ID, ":") {
+			t.Errorf("Unexpected finding after injection: %v", finding)
+		}
+	}
+}
+
+func TestTypedMetadata(t *testing.T) {
+	u := loadGoExample(t)
+	committed := time.Date(2024, 3, 1, 12, 30, 0, 500, time.FixedZone("CET", 3600))
+	u.SetMetadataInt(uast.MetadataKey("git", "lines"), -42)
+	u.SetMetadataBool(uast.MetadataKey("git", "dirty"), true)
+	u.SetMetadataTime(uast.MetadataKey("git", "committed"), committed)
+	u.SetMetadataStrings(uast.MetadataKey("git", "authors"), []string{"ana", "b,o"})
+	if err := u.SetMetadataJSON("review", map[string]int{"score": 3}); err != nil {
+		t.Fatalf("Error setting JSON metadata: %v", err)
+	}
+
+	// Values survive a JSON round trip
+	text, err := u.ToJSON()
+	if err != nil {
+		t.Fatalf("Error serializing UAST: %v", err)
+	}
+	u, err = uast.DecodeUAST(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Error decoding UAST: %v", err)
+	}
+
+	if got, ok := u.MetadataInt("git.lines"); !ok || got != -42 {
+		t.Errorf("Expected -42 lines, got %d (%v)", got, ok)
+	}
+	if got, ok := u.MetadataBool("git.dirty"); !ok || !got {
+		t.Errorf("Expected dirty to be true, got %v (%v)", got, ok)
+	}
+	if got, ok := u.MetadataTime("git.committed"); !ok || !got.Equal(committed) {
+		t.Errorf("Expected %v, got %v (%v)", committed, got, ok)
+	}
+	if got, ok := u.MetadataStrings("git.authors"); !ok || !slices.Equal(got, []string{"ana", "b,o"}) {
+		t.Errorf("Expected two authors, got %q (%v)", got, ok)
+	}
+	var review struct{ Score int }
+	if err := u.MetadataJSON("review", &review); err != nil || review.Score != 3 {
+		t.Errorf("Expected a score of 3, got %+v (%v)", review, err)
+	}
+
+	if _, ok := u.MetadataInt("git.authors"); ok {
+		t.Error("Expected a list not to read as an integer")
+	}
+	if _, ok := u.MetadataTime("missing"); ok {
+		t.Error("Expected a missing key not to be found")
+	}
+	if err := u.MetadataJSON("git.committed", &review); !errors.Is(err, uast.ErrDecode) {
+		t.Errorf("Expected ErrDecode for a non-JSON value, got %v", err)
+	}
+	if got := u.MetadataNamespace("git"); len(got) != 4 || got["lines"] != "-42" {
+		t.Errorf("Expected the four git values, got %v", got)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	u := loadGoExample(t)
+	fn := u.FindByType(uast.Function)[0]
+	fn.SetAnnotation("complexity.cyclomatic", 3)
+	fn.SetAnnotation("taint.labels", []string{"user-input"})
+
+	if got, ok := uast.AnnotationOf[int](fn, "complexity.cyclomatic"); !ok || got != 3 {
+		t.Errorf("Expected a complexity of 3, got %v (%v)", got, ok)
+	}
+	if _, ok := uast.AnnotationOf[string](fn, "complexity.cyclomatic"); ok {
+		t.Error("Expected an int annotation not to read as a string")
+	}
+	if len(fn.Properties) == 0 || fn.Properties["complexity.cyclomatic"] != "" {
+		t.Errorf("Expected annotations to leave properties alone, got %v", fn.Properties)
+	}
+
+	// Annotations are serialized when set and decode to JSON types
+	text, err := u.ToJSON()
+	if err != nil {
+		t.Fatalf("Error serializing UAST: %v", err)
+	}
+	if err := uast.ValidateUASTJSON(strings.NewReader(text)); err != nil {
+		t.Errorf("Expected annotations to match the schema, got %v", err)
+	}
+	decoded, err := uast.DecodeUAST(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Error decoding UAST: %v", err)
+	}
+	decodedFn := decoded.FindByType(uast.Function)[0]
+	if got, ok := uast.AnnotationOf[float64](decodedFn, "complexity.cyclomatic"); !ok || got != 3 {
+		t.Errorf("Expected the decoded complexity to be 3, got %v (%v)", got, ok)
+	}
+
+	if err := u.ClearAnnotations("taint.labels"); err != nil {
+		t.Fatalf("Error clearing annotations: %v", err)
+	}
+	if _, ok := fn.Annotation("taint.labels"); ok {
+		t.Error("Expected the taint labels to be cleared")
+	}
+	_ = u.ClearAnnotations()
+	if fn.Annotations != nil {
+		t.Errorf("Expected every annotation to be cleared, got %v", fn.Annotations)
+	}
+	if text, _ := u.ToJSON(); strings.Contains(text, "annotations") {
+		t.Error("Expected a tree without annotations not to serialize them")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	load := func(path, commit string) *uast.UAST {
+		u := loadGoExample(t)
+		u.AddMetadata("path", path)
+		u.AddMetadata("module", "example.com/m")
+		u.AddMetadata("commit", commit)
+		return u
+	}
+
+	a, b := load("a.go", "abc"), load("b.go", "def")
+	if _, err := uast.MergeWithPolicy(uast.MergePolicy{Metadata: uast.FailOnConflict}, a, b); err == nil || !strings.Contains(err.Error(), `"commit"`) {
+		t.Errorf("Expected a conflict on the commit, got %v", err)
+	}
+	if _, err := uast.MergeWithPolicy(uast.MergePolicy{IDs: uast.KeepIDs}, a, b); err == nil || !strings.Contains(err.Error(), "duplicate node ID") {
+		t.Errorf("Expected sequential IDs to clash, got %v", err)
+	}
+	if a.Root.ID != "1" {
+		t.Fatalf("Expected a failed merge to leave the trees alone, got root ID %q", a.Root.ID)
+	}
+
+	merged, err := uast.MergeWithPolicy(uast.MergePolicy{Metadata: uast.KeepLast}, a, b)
+	if err != nil {
+		t.Fatalf("Error merging: %v", err)
+	}
+	if merged.Root.Type != uast.Package || len(merged.Root.Children) != 2 || merged.Language != "go" {
+		t.Fatalf("Expected a go package of two files, got %v", merged.Root)
+	}
+	if got := merged.Root.Children[1]; got.ID != "b.go:1" || got.Properties["path"] != "b.go" {
+		t.Errorf("Expected the second file's root to be b.go:1 with its path, got %q %v", got.ID, got.Properties)
+	}
+	if got := merged.FindByType(uast.Function); len(got) != 4 {
+		t.Errorf("Expected the functions of both files, got %d", len(got))
+	}
+	if got := merged.Metadata; got["commit"] != "def" || got["module"] != "example.com/m" || got["path"] != "" {
+		t.Errorf("Expected the shared metadata with the last commit, got %v", got)
+	}
+	for _, finding := range merged.Validate() {
+		if finding.Kind != uast.FindingLocationOutsideParent {
+			t.Errorf("Unexpected finding in the merged tree: %v", finding)
+		}
+	}
+
+	// Trees in different languages keep their own
+	c, d := load("c.go", "abc"), load("d.go", "abc")
+	d.Language = "gox"
+	mixed, err := uast.Merge(c, d)
+	if err != nil {
+		t.Fatalf("Error merging: %v", err)
+	}
+	if got := mixed.Languages(); !slices.Equal(got, []string{"go", "gox"}) || mixed.LanguageOf(mixed.FindByType(uast.Function)[3]) != "gox" {
+		t.Errorf("Expected the functions of d.go to be in gox, got %q", mixed.Languages())
+	}
+}
+
+func TestSplitByType(t *testing.T) {
+	u := loadGoExample(t)
+	u.AddMetadata("path", "main.go")
+
+	parts := u.SplitByType(uast.Function, uast.Class)
+	if len(parts) != 2 {
+		t.Fatalf("Expected a part per function, got %d", len(parts))
+	}
+	functions := u.FindByType(uast.Function)
+	for i, part := range parts {
+		if part.Root == functions[i] || part.Root.ID != functions[i].ID || part.Root.Parent() != nil {
+			t.Errorf("Expected part %d to be rooted at a copy of function %s", i, functions[i].ID)
+		}
+		if part.Metadata["path"] != "main.go" || part.Metadata["node_path"] != functions[i].Path() {
+			t.Errorf("Expected part %d to inherit the metadata, got %v", i, part.Metadata)
+		}
+	}
+
+	parts[0].Root.SetProperty("edited", "true")
+	if _, ok := functions[0].Properties["edited"]; ok {
+		t.Error("Expected editing a part to leave the original alone")
+	}
+	if got := u.SplitByType(uast.File); len(got) != 1 || len(got[0].FindByType(uast.Function)) != 2 {
+		t.Errorf("Expected nested functions to stay in the outermost part, got %v", got)
+	}
+}
+
+func TestView(t *testing.T) {
+	u := loadGoExample(t)
+	view := u.View(uast.NodeFilter{ExcludeTypes: []uast.NodeType{uast.Unknown}})
+
+	for node := range view.Nodes() {
+		if node.Type == uast.Unknown {
+			t.Fatalf("Expected Unknown nodes to be hidden, got %s", node.ID)
+		}
+	}
+	if got := view.FindByType(uast.Unknown); len(got) != 0 {
+		t.Errorf("Expected no visible Unknown nodes, got %d", len(got))
+	}
+	if got := view.FindByType(uast.Function); len(got) != 2 {
+		t.Errorf("Expected both functions, got %d", len(got))
+	}
+	if len(u.FindByType(uast.Unknown)) == 0 {
+		t.Error("Expected the UAST to be unchanged")
+	}
+
+	text, err := view.Format(uast.TreeTextFormat{NodeFilter: uast.NodeFilter{IncludeTypes: []uast.NodeType{uast.Function, uast.Unknown}}})
+	if err != nil {
+		t.Fatalf("Error formatting view: %v", err)
+	}
+	if want := "└── File\n    ├── Function: add\n    └── Function: main\n"; !strings.HasSuffix(text, want) {
+		t.Errorf("Expected %q, got:\n%s", want, text)
+	}
+
+	functions := u.View(uast.NodeFilter{Keep: func(node *uast.Node) bool { return node.Type == uast.Function }})
+	if got := functions.Children(functions.Root()); len(got) != 2 || got[0].Type != uast.Function {
+		t.Errorf("Expected the functions as the root's children, got %v", got)
+	}
+}
+
+func TestFrozen(t *testing.T) {
+	u := loadGoExample(t)
+	u.Freeze()
+
+	literal := u.FindByToken(`"Hello, World!"`)[0]
+	if err := u.SetNodeToken(literal, `"Bye"`); !errors.Is(err, uast.ErrFrozen) {
+		t.Fatalf("Expected ErrFrozen, got %v", err)
+	}
+	if _, err := u.Simplify(); !errors.Is(err, uast.ErrFrozen) {
+		t.Errorf("Expected ErrFrozen from Simplify, got %v", err)
+	}
+	for name, edit := range map[string]func() error{
+		"ClearAnnotations": func() error { return u.ClearAnnotations() },
+		"MarkDirty":        func() error { return u.MarkDirty(literal) },
+		"ReindexSubtree":   func() error { return u.ReindexSubtree(literal) },
+	} {
+		if err := edit(); !errors.Is(err, uast.ErrFrozen) {
+			t.Errorf("Expected ErrFrozen from %s, got %v", name, err)
+		}
+	}
+
+	edited, err := u.WithEdited(literal, func(node *uast.Node) { node.Token = `"Bye"` })
+	if err != nil {
+		t.Fatalf("Error editing frozen UAST: %v", err)
+	}
+	if literal.Token != `"Hello, World!"` || u.CountByToken(`"Bye"`) != 0 {
+		t.Error("Expected the original version to be unchanged")
+	}
+	if got := edited.FindByToken(`"Bye"`); len(got) != 1 || got[0].ID != literal.ID {
+		t.Errorf("Expected the edited literal in the new version, got %v", got)
+	}
+	if !edited.Frozen() || edited.Root == u.Root {
+		t.Error("Expected a new frozen version with a copied root")
+	}
+	add := u.FindByType(uast.Function)[0]
+	if !slices.Contains(edited.FindByType(uast.Function), add) {
+		t.Error("Expected unchanged subtrees to be shared")
+	}
+
+	removed, err := edited.WithRemoved(add)
+	if err != nil {
+		t.Fatalf("Error removing from frozen UAST: %v", err)
+	}
+	if len(removed.FindByType(uast.Function)) != 1 || len(edited.FindByType(uast.Function)) != 2 {
+		t.Error("Expected only the newest version to lose the function")
+	}
+	for _, finding := range removed.Validate() {
+		if finding.Kind != uast.FindingLocationOutsideParent {
+			t.Errorf("Unexpected finding in the new version: %v", finding)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	u := loadGoExample(t)
+	functions := u.FindByType(uast.Function)
+	literal := u.FindByToken(`"Hello, World!"`)[0]
+
+	err := u.Update(func(tx *uast.Tx) error {
+		if err := tx.SetNodeToken(literal, `"Bye"`); err != nil {
+			return err
+		}
+		if err := tx.RemoveNode(functions[0]); err != nil {
+			return err
+		}
+		ret := &uast.Node{ID: "ret", Type: uast.Return, Children: []*uast.Node{{ID: "answer", Type: uast.Literal, Token: "42"}}}
+		return tx.AppendChild(functions[1], ret)
+	})
+	if err != nil {
+		t.Fatalf("Error updating: %v", err)
+	}
+	if got := u.FindByType(uast.Function); len(got) != 1 || got[0] != functions[1] {
+		t.Errorf("Expected only main to remain, got %v", got)
+	}
+	if len(u.FindByToken(`"Bye"`)) != 1 || len(u.FindByToken("42")) != 1 || len(u.FindByToken(`"Hello, World!"`)) != 0 {
+		t.Error("Expected the indices to reflect every edit")
+	}
+	for _, finding := range u.Validate() {
+		if finding.Kind != uast.FindingLocationOutsideParent {
+			t.Errorf("Unexpected finding after update: %v", finding)
+		}
+	}
+
+	failed := errors.New("failed")
+	err = u.Update(func(tx *uast.Tx) error {
+		if err := tx.SetNodeType(functions[1], uast.Method); err != nil {
+			return err
+		}
+		if err := tx.RemoveNode(literal); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Expected the closure's error, got %v", err)
+	}
+	if functions[1].Type != uast.Function || literal.Parent() == nil || len(u.FindByToken(`"Bye"`)) != 1 {
+		t.Error("Expected a failed update to be rolled back")
+	}
+
+	// A node taken from a removed subtree stays indexed where it is attached
+	ret := u.FindByType(uast.Return)[0]
+	answer := ret.Children[0]
+	err = u.Update(func(tx *uast.Tx) error {
+		if err := tx.RemoveNode(ret); err != nil {
+			return err
+		}
+		return tx.AppendChild(functions[1], answer)
+	})
+	if err != nil {
+		t.Fatalf("Error updating: %v", err)
+	}
+	if got := u.FindByToken("42"); len(got) != 1 || got[0] != answer || answer.Parent() != functions[1] {
+		t.Errorf("Expected the moved literal to stay indexed, got %v", got)
+	}
+	if !slices.Contains(u.FindByType(uast.Literal), answer) || len(u.FindByType(uast.Return)) != 0 || len(ret.Children) != 0 {
+		t.Errorf("Expected the literal to move out of the removed return")
+	}
+}
+
+func TestFindByRole(t *testing.T) {
+	u := loadGoExample(t)
+
+	var want []*uast.Node
+	for node := range u.Root.Descendants() {
+		if node.HasRole(uast.RoleDeclaration) {
+			want = append(want, node)
+		}
+	}
+	if got := u.FindByRole(uast.RoleDeclaration); len(want) == 0 || !slices.Equal(got, want) {
+		t.Fatalf("Expected the %d declarations in tree order, got %d", len(want), len(got))
+	}
+
+	fn := want[0]
+	fn.Roles = slices.DeleteFunc(slices.Clone(fn.Roles), func(role uast.Role) bool { return role == uast.RoleDeclaration })
+	if err := u.ReindexSubtree(fn); err != nil {
+		t.Fatalf("Error reindexing: %v", err)
+	}
+	if got := u.FindByRole(uast.RoleDeclaration); slices.Contains(got, fn) || len(got) != len(want)-1 {
+		t.Errorf("Expected the role index to follow edited roles, got %d", len(got))
+	}
+	if err := u.RemoveNode(want[1]); err != nil {
+		t.Fatalf("Error removing node: %v", err)
+	}
+	if got := u.FindByRole(uast.RoleDeclaration); slices.Contains(got, want[1]) {
+		t.Error("Expected removed nodes to leave the role index")
+	}
+	for _, finding := range u.Validate() {
+		if finding.Kind != uast.FindingLocationOutsideParent {
+			t.Errorf("Unexpected finding: %v", finding)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	u := loadGoExample(t)
+	functions := u.FindByType(uast.Function)
+
+	if got := u.Query().Type(uast.Function).WithRole(uast.RoleDefinition).TokenMatches(`^ma`).All(); len(got) != 1 || got[0].Token != "main" {
+		t.Errorf("Expected only main, got %v", got)
+	}
+	if got := u.Query().Type(uast.Function, uast.Method).Count(); got != len(functions) {
+		t.Errorf("Expected %d functions, got %d", len(functions), got)
+	}
+	if got := u.Query().Token(`"Hello, World!"`).Within(functions[0]).First(); got != nil {
+		t.Errorf("Expected no literal within add, got %v", got)
+	}
+	if got := u.Query().Within(functions[1]).Where(func(node *uast.Node) bool { return node.Type == uast.Literal }).All(); len(got) == 0 || !slices.Contains(slices.Collect(got[0].Ancestors()), functions[1]) {
+		t.Errorf("Expected the literals within main, got %v", got)
+	}
+
+	invalid := u.Query().TokenMatches(`(`)
+	if invalid.Exists() || invalid.Err() == nil {
+		t.Error("Expected an invalid pattern to match nothing and report an error")
+	}
+}
+
+func TestTokenFolding(t *testing.T) {
+	root := &uast.Node{ID: "0", Type: uast.File, Children: []*uast.Node{
+		{ID: "1", Type: uast.Identifier, Token: "BEGIN"},
+		{ID: "2", Type: uast.Identifier, Token: "Straße"},
+		{ID: "3", Type: uast.Identifier, Token: "Σίσυφος"},
+	}}
+	u := uast.NewUAST(root, "pascal")
+	if got := u.FindByTokenFold("begin"); got != nil {
+		t.Errorf("Expected no folded lookups before folding is enabled, got %v", got)
+	}
+
+	u.EnableTokenFolding()
+	for query, want := range map[string]string{"begin": "1", "STRAẞE": "2", "ΣΊΣΥΦΟΣ": "3"} {
+		if got := u.FindByTokenFold(query); len(got) != 1 || got[0].ID != want {
+			t.Errorf("Expected %q to find node %s, got %v", query, want, got)
+		}
+	}
+	if err := u.SetNodeToken(root.Children[0], "End"); err != nil {
+		t.Fatalf("Error setting token: %v", err)
+	}
+	if len(u.FindByTokenFold("BEGIN")) != 0 || len(u.FindByTokenFold("end")) != 1 {
+		t.Error("Expected the folded index to follow edits")
+	}
+
+	// A custom folder can also ignore underscores, as Nim does
+	uast.SetTokenFolder(func(token string) string { return strings.ToLower(strings.ReplaceAll(token, "_", "")) })
+	defer uast.SetTokenFolder(nil)
+	snake := uast.NewUAST(&uast.Node{ID: "0", Type: uast.Identifier, Token: "read_File"}, "nim")
+	snake.EnableTokenFolding()
+	if got := snake.FindByTokenFold("readfile"); len(got) != 1 {
+		t.Errorf("Expected the custom folder to be used, got %v", got)
+	}
+
+	tsNode, err := uast.LoadTreeSitterCST("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error loading CST: %v", err)
+	}
+	converter := uast.NewConverter()
+	converter.SetTokenFolding(true)
+	converted, err := converter.Convert(tsNode, "go")
+	if err != nil {
+		t.Fatalf("Error converting: %v", err)
+	}
+	if got := converted.FindByTokenFold("PRINTLN"); len(got) != len(converted.FindByToken("Println")) || len(got) == 0 {
+		t.Errorf("Expected converted UASTs to be folded, got %d", len(got))
+	}
+}
+
+func TestCompile(t *testing.T) {
+	query, err := uast.Compile(`(Call $fn ...)`)
+	if err != nil {
+		t.Fatalf("Error compiling query: %v", err)
+	}
+	if again, _ := uast.Compile(`(Call $fn ...)`); again != query {
+		t.Error("Expected the compiled query to be cached")
+	}
+	if _, err := uast.Compile(`(Call`); err == nil {
+		t.Error("Expected an error for an unclosed pattern")
+	}
+
+	trees := []*uast.UAST{loadGoExample(t), loadGoExample(t)}
+	want, _ := trees[0].SearchString(query.String())
+	var wg sync.WaitGroup
+	for _, u := range trees {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := query.Search(u); len(got) != len(want) || len(want) == 0 {
+				t.Errorf("Expected %d calls, got %d", len(want), len(got))
+			}
+		}()
+	}
+	wg.Wait()
+}
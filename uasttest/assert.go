@@ -0,0 +1,252 @@
+package uasttest
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+)
+
+// maxReported is the number of differences an assertion reports
+const maxReported = 10
+
+// UpdateEnv names the environment variable that makes AssertGolden write the
+// golden files instead of comparing against them
+const UpdateEnv = "UASTTEST_UPDATE"
+
+// N builds an expected node with children, for use with AssertTreesEqual and
+// AssertMatches, as uast.B does
+func N(nodeType uast.NodeType, token string, children ...*uast.Node) *uast.Node {
+	return uast.B(nodeType, token, children...)
+}
+
+// Diff returns the differences between two trees, each prefixed with the
+// JSON Pointer of the node it concerns, such as "/children/2". Roles are
+// compared as sets and annotations are ignored.
+func Diff(want, got *uast.Node, ignoreIDs bool) []string {
+	var diffs []string
+	diffNode(&diffs, "", want, got, func(want, got *uast.Node) []string {
+		return compareNodes(want, got, ignoreIDs)
+	}, true)
+	return diffs
+}
+
+// Match returns the ways got differs from pattern, considering only the
+// fields pattern sets: its type, non-empty token and ID, its roles and
+// properties, which got may add to, and its locations. A pattern node
+// without children matches any children.
+func Match(pattern, got *uast.Node) []string {
+	var diffs []string
+	diffNode(&diffs, "", pattern, got, matchNode, false)
+	return diffs
+}
+
+// AssertTreesEqual reports the differences between two trees as test errors
+func AssertTreesEqual(t testing.TB, want, got *uast.Node, ignoreIDs bool) {
+	t.Helper()
+	report(t, "trees differ", Diff(want, got, ignoreIDs))
+}
+
+// AssertMatches reports the ways got differs from pattern as test errors
+func AssertMatches(t testing.TB, pattern, got *uast.Node) {
+	t.Helper()
+	report(t, "tree does not match", Match(pattern, got))
+}
+
+// AssertGolden compares got with the golden file at path, reporting the
+// differing lines. If the UpdateEnv environment variable is set, it writes
+// got to the file instead.
+func AssertGolden(t testing.TB, path, got string) {
+	t.Helper()
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (set %s=1 to create it): %v", UpdateEnv, err)
+	}
+	report(t, "output differs from "+path, diffLines(string(want), got))
+}
+
+// AssertGoldenFormat formats u and compares the result with the golden
+// file at path, as AssertGolden does
+func AssertGoldenFormat(t testing.TB, path string, u *uast.UAST, format uast.LLMFormat) {
+	t.Helper()
+
+	got, err := uast.ToLLMFormat(u, format)
+	if err != nil {
+		t.Fatalf("failed to format UAST: %v", err)
+	}
+	AssertGolden(t, path, got)
+}
+
+// report fails the test with the first differences, if there are any
+func report(t testing.TB, summary string, diffs []string) {
+	t.Helper()
+
+	if len(diffs) == 0 {
+		return
+	}
+	shown := diffs[:min(len(diffs), maxReported)]
+	message := summary + ":\n  " + strings.Join(shown, "\n  ")
+	if len(diffs) > len(shown) {
+		message += fmt.Sprintf("\n  ... and %d more", len(diffs)-len(shown))
+	}
+	t.Error(message)
+}
+
+// diffNode appends the differences of two subtrees to diffs. With
+// allChildren unset, a want node without children matches any.
+func diffNode(diffs *[]string, path string, want, got *uast.Node, compare func(want, got *uast.Node) []string, allChildren bool) {
+	at := func(format string, args ...any) {
+		*diffs = append(*diffs, pointer(path)+": "+fmt.Sprintf(format, args...))
+	}
+	switch {
+	case want == nil && got == nil:
+		return
+	case want == nil:
+		at("unexpected %s node", got.Type)
+		return
+	case got == nil:
+		at("missing %s node", want.Type)
+		return
+	}
+
+	for _, diff := range compare(want, got) {
+		at("%s", diff)
+	}
+	if !allChildren && len(want.Children) == 0 {
+		return
+	}
+	if len(want.Children) != len(got.Children) {
+		at("%d children, want %d", len(got.Children), len(want.Children))
+	}
+	for i := range max(len(want.Children), len(got.Children)) {
+		var wantChild, gotChild *uast.Node
+		if i < len(want.Children) {
+			wantChild = want.Children[i]
+		}
+		if i < len(got.Children) {
+			gotChild = got.Children[i]
+		}
+		diffNode(diffs, path+"/children/"+strconv.Itoa(i), wantChild, gotChild, compare, allChildren)
+	}
+}
+
+// pointer returns path, or "/" for the root
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// compareNodes returns the differences between the fields of two nodes
+func compareNodes(want, got *uast.Node, ignoreIDs bool) []string {
+	var diffs []string
+	if !ignoreIDs && want.ID != got.ID {
+		diffs = append(diffs, fmt.Sprintf("ID %q, want %q", got.ID, want.ID))
+	}
+	if want.Type != got.Type {
+		diffs = append(diffs, fmt.Sprintf("type %s, want %s", got.Type, want.Type))
+	}
+	if want.Token != got.Token {
+		diffs = append(diffs, fmt.Sprintf("token %q, want %q", got.Token, want.Token))
+	}
+	if !slices.Equal(sortedRoles(want.Roles), sortedRoles(got.Roles)) {
+		diffs = append(diffs, fmt.Sprintf("roles %v, want %v", got.Roles, want.Roles))
+	}
+	if !maps.Equal(want.Properties, got.Properties) {
+		diffs = append(diffs, fmt.Sprintf("properties %v, want %v", got.Properties, want.Properties))
+	}
+	if !equalLocations(want.Location, got.Location) {
+		diffs = append(diffs, fmt.Sprintf("location %s, want %s", locationString(got.Location), locationString(want.Location)))
+	}
+	if !equalLocations(want.NameLocation, got.NameLocation) {
+		diffs = append(diffs, fmt.Sprintf("name location %s, want %s", locationString(got.NameLocation), locationString(want.NameLocation)))
+	}
+	return diffs
+}
+
+// matchNode returns the fields of got that differ from those pattern sets
+func matchNode(pattern, got *uast.Node) []string {
+	var diffs []string
+	if pattern.ID != "" && pattern.ID != got.ID {
+		diffs = append(diffs, fmt.Sprintf("ID %q, want %q", got.ID, pattern.ID))
+	}
+	if pattern.Type != got.Type {
+		diffs = append(diffs, fmt.Sprintf("type %s, want %s", got.Type, pattern.Type))
+	}
+	if pattern.Token != "" && pattern.Token != got.Token {
+		diffs = append(diffs, fmt.Sprintf("token %q, want %q", got.Token, pattern.Token))
+	}
+	for _, role := range pattern.Roles {
+		if !got.HasRole(role) {
+			diffs = append(diffs, fmt.Sprintf("roles %v, want %s among them", got.Roles, role))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(pattern.Properties)) {
+		if value, ok := got.Properties[key]; !ok || value != pattern.Properties[key] {
+			diffs = append(diffs, fmt.Sprintf("property %s is %q, want %q", key, value, pattern.Properties[key]))
+		}
+	}
+	if pattern.Location != nil && !equalLocations(pattern.Location, got.Location) {
+		diffs = append(diffs, fmt.Sprintf("location %s, want %s", locationString(got.Location), locationString(pattern.Location)))
+	}
+	if pattern.NameLocation != nil && !equalLocations(pattern.NameLocation, got.NameLocation) {
+		diffs = append(diffs, fmt.Sprintf("name location %s, want %s", locationString(got.NameLocation), locationString(pattern.NameLocation)))
+	}
+	return diffs
+}
+
+// sortedRoles returns a sorted copy of roles
+func sortedRoles(roles []uast.Role) []uast.Role {
+	return slices.Sorted(slices.Values(roles))
+}
+
+// equalLocations reports whether two optional locations are equal
+func equalLocations(a, b *uast.Location) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// locationString formats an optional location as "line:column-line:column"
+func locationString(loc *uast.Location) string {
+	if loc == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d:%d-%d:%d", loc.Start.Line, loc.Start.Column, loc.End.Line, loc.End.Column)
+}
+
+// diffLines returns the lines that differ between two texts, by line number
+func diffLines(want, got string) []string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var diffs []string
+	for i := range max(len(wantLines), len(gotLines)) {
+		switch {
+		case i >= len(gotLines):
+			diffs = append(diffs, fmt.Sprintf("line %d: missing %q", i+1, wantLines[i]))
+		case i >= len(wantLines):
+			diffs = append(diffs, fmt.Sprintf("line %d: unexpected %q", i+1, gotLines[i]))
+		case wantLines[i] != gotLines[i]:
+			diffs = append(diffs, fmt.Sprintf("line %d: got %q, want %q", i+1, gotLines[i], wantLines[i]))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,86 @@
+package uasttest_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/uasttest"
+)
+
+// recorder captures the failures an assertion reports
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Error(args ...any) {
+	r.failures = append(r.failures, fmt.Sprint(args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertTreesEqual(t *testing.T) {
+	want := uasttest.N(uast.Function, "main", uasttest.N(uast.Return, "return"))
+	got := uasttest.N(uast.Function, "main", uasttest.N(uast.Return, "return"))
+	got.ID, got.Children[0].ID = "1", "2"
+
+	uasttest.AssertTreesEqual(t, want, got, true)
+
+	r := &recorder{}
+	uasttest.AssertTreesEqual(r, want, got, false)
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], `/children/0: ID "2", want ""`) {
+		t.Errorf("Expected the ID differences to be reported, got %v", r.failures)
+	}
+
+	got.Children[0].Type = uast.Call
+	got.Children = append(got.Children, uasttest.N(uast.Identifier, "x"))
+	diffs := uasttest.Diff(want, got, true)
+	if len(diffs) != 3 {
+		t.Errorf("Expected child count, type and extra child differences, got %v", diffs)
+	}
+}
+
+func TestAssertMatches(t *testing.T) {
+	got := &uast.Node{Type: uast.Function, Token: "main", Roles: []uast.Role{uast.RoleDeclaration, uast.RoleDefinition}, Children: []*uast.Node{
+		{Type: uast.Identifier, Token: "main"},
+		{Type: uast.Statement, Children: []*uast.Node{{Type: uast.Return}}},
+	}}
+
+	pattern := uasttest.N(uast.Function, "", uasttest.N(uast.Identifier, "main"), uasttest.N(uast.Statement, ""))
+	pattern.Roles = []uast.Role{uast.RoleDefinition}
+	uasttest.AssertMatches(t, pattern, got)
+
+	pattern.Children[0].Token = "init"
+	if diffs := uasttest.Match(pattern, got); len(diffs) != 1 || !strings.HasPrefix(diffs[0], "/children/0: token") {
+		t.Errorf("Expected one token mismatch, got %v", diffs)
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden", "tree.txt")
+	u := uast.NewUAST(uasttest.N(uast.Function, "main", uasttest.N(uast.Return, "return")), "go")
+
+	t.Setenv(uasttest.UpdateEnv, "1")
+	uasttest.AssertGoldenFormat(t, path, u, uast.SimpleTextFormat{})
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected the golden file to be written: %v", err)
+	}
+
+	t.Setenv(uasttest.UpdateEnv, "")
+	uasttest.AssertGoldenFormat(t, path, u, uast.SimpleTextFormat{})
+
+	r := &recorder{}
+	u.Root.Token = "init"
+	uasttest.AssertGoldenFormat(r, path, u, uast.SimpleTextFormat{})
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], "line") {
+		t.Errorf("Expected the differing line to be reported, got %v", r.failures)
+	}
+}
@@ -0,0 +1,207 @@
+// Package uasttest provides helpers for testing code built on UASTs
+package uasttest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/flaticols/uast-go"
+)
+
+// Weighted is a Tree-sitter node type with its relative frequency
+type Weighted struct {
+	Type   string
+	Weight int
+}
+
+// Config controls the shape of generated trees. Zero fields take their
+// defaults.
+type Config struct {
+	MaxDepth  int        // Depth of the deepest node below the root, defaults to 5
+	MaxFanOut int        // Most children of a node, defaults to 4
+	RootType  string     // Type of the root, defaults to "program"
+	Types     []Weighted // Types of inner nodes, defaults to statements and expressions
+	LeafTypes []Weighted // Types of named leaves, defaults to identifiers, literals and comments
+
+	// Anonymous is the probability that a leaf is an anonymous punctuation
+	// node, such as ";"
+	Anonymous float64
+}
+
+// defaultTypes are inner node types the default converter maps
+var defaultTypes = []Weighted{
+	{"function_definition", 2},
+	{"class_definition", 1},
+	{"if_statement", 2},
+	{"for_statement", 1},
+	{"return_statement", 1},
+	{"call_expression", 3},
+	{"binary_expression", 3},
+	{"statement", 2},
+}
+
+// defaultLeafTypes are leaf types the default converter maps
+var defaultLeafTypes = []Weighted{
+	{"identifier", 6},
+	{"number_literal", 2},
+	{"string_literal", 2},
+	{"comment", 1},
+}
+
+// punctuation is the text of generated anonymous leaves
+var punctuation = []string{";", ",", "(", ")", "{", "}", "="}
+
+// Tree is a generated CST with the source it spans
+type Tree struct {
+	CST    *uast.TreeSitterNode
+	Source string
+}
+
+// Generator produces random but valid CSTs: ranges nest, siblings are in
+// order and don't overlap, and leaf text fills its range, so every tree
+// passes ValidateCST at CSTStrict. The same seed and configuration always
+// produce the same trees.
+type Generator struct {
+	rand   *rand.Rand
+	config Config
+
+	source  strings.Builder
+	row     int
+	column  int
+	counter int
+}
+
+// NewGenerator returns a Generator seeded with seed
+func NewGenerator(seed uint64, config Config) *Generator {
+	if config.MaxDepth <= 0 {
+		config.MaxDepth = 5
+	}
+	if config.MaxFanOut <= 0 {
+		config.MaxFanOut = 4
+	}
+	if config.RootType == "" {
+		config.RootType = "program"
+	}
+	if len(config.Types) == 0 {
+		config.Types = defaultTypes
+	}
+	if len(config.LeafTypes) == 0 {
+		config.LeafTypes = defaultLeafTypes
+	}
+	return &Generator{rand: rand.New(rand.NewPCG(seed, seed)), config: config}
+}
+
+// Tree generates a tree
+func (g *Generator) Tree() Tree {
+	g.source.Reset()
+	g.row, g.column = 0, 0
+
+	root := &uast.TreeSitterNode{Type: g.config.RootType}
+	g.children(root, 0, 1+g.rand.IntN(g.config.MaxFanOut))
+	return Tree{CST: root, Source: g.source.String()}
+}
+
+// CST generates a tree and returns its CST
+func (g *Generator) CST() *uast.TreeSitterNode {
+	return g.Tree().CST
+}
+
+// UAST generates a tree and converts it with a default Converter
+func (g *Generator) UAST() *uast.UAST {
+	u, err := uast.NewConverter().Convert(g.CST(), "generated")
+	if err != nil {
+		panic(fmt.Sprintf("uasttest: failed to convert a generated CST: %v", err))
+	}
+	return u
+}
+
+// node generates a node at depth, below the root
+func (g *Generator) node(depth int) *uast.TreeSitterNode {
+	if depth < g.config.MaxDepth {
+		if count := g.rand.IntN(g.config.MaxFanOut + 1); count > 0 {
+			node := &uast.TreeSitterNode{Type: g.pick(g.config.Types)}
+			g.children(node, depth, count)
+			return node
+		}
+	}
+	return g.leaf()
+}
+
+// children generates count children of node and sets its range to theirs
+func (g *Generator) children(node *uast.TreeSitterNode, depth, count int) {
+	for i := range count {
+		if i > 0 {
+			g.separate()
+		}
+		node.Children = append(node.Children, g.node(depth+1))
+	}
+	first, last := node.Children[0], node.Children[len(node.Children)-1]
+	node.StartByte, node.StartPoint = first.StartByte, first.StartPoint
+	node.EndByte, node.EndPoint = last.EndByte, last.EndPoint
+}
+
+// leaf generates a leaf and writes its text
+func (g *Generator) leaf() *uast.TreeSitterNode {
+	g.counter++
+	named := g.rand.Float64() >= g.config.Anonymous
+
+	var node *uast.TreeSitterNode
+	if named {
+		nodeType := g.pick(g.config.LeafTypes)
+		node = &uast.TreeSitterNode{Type: nodeType, Text: g.text(nodeType)}
+	} else {
+		text := punctuation[g.rand.IntN(len(punctuation))]
+		node = &uast.TreeSitterNode{Type: text, Text: text}
+	}
+	node.IsNamed = &named
+
+	node.StartByte, node.StartPoint = g.source.Len(), [2]int{g.row, g.column}
+	g.source.WriteString(node.Text)
+	g.column += len(node.Text)
+	node.EndByte, node.EndPoint = g.source.Len(), [2]int{g.row, g.column}
+	return node
+}
+
+// text returns the text of a named leaf of a type
+func (g *Generator) text(nodeType string) string {
+	switch nodeType {
+	case "number_literal", "integer_literal", "float_literal":
+		return fmt.Sprint(g.rand.IntN(1000))
+	case "string_literal":
+		return fmt.Sprintf("%q", fmt.Sprint("s", g.counter))
+	case "comment":
+		return fmt.Sprint("/* c", g.counter, " */")
+	}
+	return fmt.Sprint("v", g.counter)
+}
+
+// separate writes the whitespace between two siblings
+func (g *Generator) separate() {
+	if g.rand.IntN(4) == 0 {
+		g.source.WriteByte('\n')
+		g.row, g.column = g.row+1, 0
+		return
+	}
+	g.source.WriteByte(' ')
+	g.column++
+}
+
+// pick returns a type drawn by weight
+func (g *Generator) pick(types []Weighted) string {
+	total := 0
+	for _, t := range types {
+		total += max(t.Weight, 0)
+	}
+	if total == 0 {
+		return types[0].Type
+	}
+	n := g.rand.IntN(total)
+	for _, t := range types {
+		if n < max(t.Weight, 0) {
+			return t.Type
+		}
+		n -= max(t.Weight, 0)
+	}
+	return types[len(types)-1].Type
+}
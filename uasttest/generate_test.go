@@ -0,0 +1,73 @@
+package uasttest_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+	"github.com/flaticols/uast-go/uasttest"
+)
+
+func depth(node *uast.TreeSitterNode) int {
+	deepest := 0
+	for _, child := range node.Children {
+		deepest = max(deepest, 1+depth(child))
+	}
+	return deepest
+}
+
+func TestGenerator(t *testing.T) {
+	config := uasttest.Config{MaxDepth: 3, MaxFanOut: 5, Anonymous: 0.2}
+	g := uasttest.NewGenerator(1, config)
+	for range 100 {
+		tree := g.Tree()
+		if err := uast.ValidateCST(tree.CST, uast.CSTStrict); err != nil {
+			t.Fatalf("Expected a valid CST, got %v", err)
+		}
+		if depth(tree.CST) > 3 {
+			t.Errorf("Expected depth at most 3, got %d", depth(tree.CST))
+		}
+		if tree.CST.EndByte != len(tree.Source) {
+			t.Errorf("Expected the root to span the source, got %d of %d bytes", tree.CST.EndByte, len(tree.Source))
+		}
+		for node := range descendants(tree.CST) {
+			if len(node.Children) > 5 {
+				t.Errorf("Expected at most 5 children, got %d", len(node.Children))
+			}
+			if len(node.Children) == 0 && tree.Source[node.StartByte:node.EndByte] != node.Text {
+				t.Errorf("Expected leaf text %q at its range, got %q", node.Text, tree.Source[node.StartByte:node.EndByte])
+			}
+		}
+	}
+
+	a := uasttest.NewGenerator(7, config).Tree()
+	b := uasttest.NewGenerator(7, config).Tree()
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("Expected the same seed to generate the same tree")
+	}
+
+	only := uasttest.NewGenerator(1, uasttest.Config{Types: []uasttest.Weighted{{Type: "call_expression", Weight: 1}}})
+	for node := range descendants(only.CST()) {
+		if len(node.Children) > 0 && node.Type != "program" && node.Type != "call_expression" {
+			t.Errorf("Expected only configured inner types, got %s", node.Type)
+		}
+	}
+
+	if u := uasttest.NewGenerator(1, config).UAST(); u.Root == nil || u.Root.Type != uast.File {
+		t.Errorf("Expected a converted UAST with a File root")
+	}
+}
+
+func descendants(root *uast.TreeSitterNode) func(func(*uast.TreeSitterNode) bool) {
+	return func(yield func(*uast.TreeSitterNode) bool) {
+		stack := []*uast.TreeSitterNode{root}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !yield(node) {
+				return
+			}
+			stack = append(stack, node.Children...)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package uast
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 // LLMFormat is an interface for formatting UAST nodes for LLM consumption
@@ -13,179 +17,381 @@ type LLMFormat interface {
 	Format(*UAST) (string, error)
 }
 
+// StreamingFormat is an LLMFormat that can write its output as it goes,
+// rather than building it in memory
+type StreamingFormat interface {
+	LLMFormat
+	FormatTo(w io.Writer, u *UAST) error
+}
+
+// textWriter is the writer the text formats render to
+type textWriter interface {
+	io.Writer
+	io.StringWriter
+}
+
+// formatString renders a streaming format to a string
+func formatString(f StreamingFormat, u *UAST) (string, error) {
+	var sb strings.Builder
+	if err := f.FormatTo(&sb, u); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
 // JSONFormat implements LLMFormat for JSON output
 type JSONFormat struct {
-	Pretty bool
+	Pretty       bool
+	RootSelector string // Path or declaration name of the subtree to output; empty means the whole tree
+	MaxDepth     int    // Deeper nodes are left out; zero means no limit
+	NodeFilter
 }
 
 // Format formats the UAST as JSON
 func (f JSONFormat) Format(u *UAST) (string, error) {
+	text, err := formatString(f, u)
+	return strings.TrimSuffix(text, "\n"), err
+}
+
+// FormatTo writes the UAST as JSON to w, followed by a newline
+func (f JSONFormat) FormatTo(w io.Writer, u *UAST) error {
 	if u == nil {
-		return "", fmt.Errorf("cannot format nil UAST")
+		return fmt.Errorf("cannot format nil UAST")
+	}
+	u, err := selectSubtree(u, f.RootSelector, f.MaxDepth, "", f.NodeFilter)
+	if err != nil {
+		return err
 	}
 
-	var data []byte
-	var err error
-
+	encoder := json.NewEncoder(w)
 	if f.Pretty {
-		data, err = json.MarshalIndent(u, "", "  ")
-	} else {
-		data, err = json.Marshal(u)
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(u); err != nil {
+		return fmt.Errorf("failed to marshal UAST to JSON: %w", err)
 	}
+	return nil
+}
 
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal UAST to JSON: %w", err)
+// Truncation limits how much of a tree the text formats render. The zero
+// value cuts tokens at 100 characters and renders every node.
+type Truncation struct {
+	MaxTokenLength     int // Longer tokens end in "..."; zero means 100, negative means no limit
+	MaxDepth           int // Deeper nodes are elided; zero means no limit
+	MaxChildrenPerNode int // Further children are elided; zero means no limit
+}
+
+// token returns a node's token cut to MaxTokenLength characters
+func (t Truncation) token(token string) string {
+	limit := t.MaxTokenLength
+	if limit == 0 {
+		limit = 100
+	}
+	if limit < 0 || utf8.RuneCountInString(token) <= limit {
+		return token
 	}
+	runes := []rune(token)
+	return string(runes[:max(limit-3, 0)]) + "..."
+}
+
+// truncate returns the children of a node at depth to render, and how many
+// are elided by MaxDepth or MaxChildrenPerNode
+func (t Truncation) truncate(children []*Node, depth int) ([]*Node, int) {
+	if t.MaxDepth > 0 && depth >= t.MaxDepth {
+		return nil, len(children)
+	}
+	if t.MaxChildrenPerNode > 0 && len(children) > t.MaxChildrenPerNode {
+		return children[:t.MaxChildrenPerNode], len(children) - t.MaxChildrenPerNode
+	}
+	return children, 0
+}
 
-	return string(data), nil
+// elided describes nodes left out of the output
+func elided(n int) string {
+	return fmt.Sprintf("…%d more", n)
+}
+
+// PropertyDisplay selects the node properties the text formats show
+type PropertyDisplay struct {
+	IncludeProperties bool     // Show every property, such as ts_type and name
+	PropertyAllowlist []string // Show only these properties; implies IncludeProperties
+}
+
+// properties renders the selected properties of a node as " {k=v, ...}"
+func (d PropertyDisplay) properties(node *Node) string {
+	if len(node.Properties) == 0 || (!d.IncludeProperties && len(d.PropertyAllowlist) == 0) {
+		return ""
+	}
+
+	keys := make([]string, 0, len(node.Properties))
+	for key := range node.Properties {
+		if len(d.PropertyAllowlist) == 0 || slices.Contains(d.PropertyAllowlist, key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	slices.Sort(keys)
+
+	var sb strings.Builder
+	sb.WriteString(" {")
+	for i, key := range keys {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s=%s", key, node.Properties[key])
+	}
+	sb.WriteString("}")
+	return sb.String()
 }
 
 // SimpleTextFormat implements LLMFormat for simplified text output
 type SimpleTextFormat struct {
 	IncludeLocations bool
+	RootSelector     string // Path or declaration name of the subtree to render; empty means the whole tree
+	Truncation
+	PropertyDisplay
+	NodeFilter
 }
 
 // Format formats the UAST as simplified text
 func (f SimpleTextFormat) Format(u *UAST) (string, error) {
+	return formatString(f, u)
+}
+
+// FormatTo writes the UAST as simplified text to w
+func (f SimpleTextFormat) FormatTo(w io.Writer, u *UAST) error {
 	if u == nil {
-		return "", fmt.Errorf("cannot format nil UAST")
+		return fmt.Errorf("cannot format nil UAST")
+	}
+	root, err := selectRoot(u, f.RootSelector)
+	if err != nil {
+		return err
 	}
 
-	var sb strings.Builder
+	bw := bufio.NewWriter(w)
 
-	sb.WriteString(fmt.Sprintf("Language: %s\n", u.Language))
+	fmt.Fprintf(bw, "Language: %s\n", u.Language)
 	if len(u.Metadata) > 0 {
-		sb.WriteString("Metadata:\n")
-		for k, v := range u.Metadata {
-			sb.WriteString(fmt.Sprintf("  %s: %s\n", k, v))
+		bw.WriteString("Metadata:\n")
+		keys := make([]string, 0, len(u.Metadata))
+		for k := range u.Metadata {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			fmt.Fprintf(bw, "  %s: %s\n", k, u.Metadata[k])
 		}
 	}
 
-	sb.WriteString("\nStructure:\n")
-	formatNode(&sb, u.Root, 0, f.IncludeLocations)
+	bw.WriteString("\nStructure:\n")
+	formatNode(bw, root, 0, f)
 
-	return sb.String(), nil
+	return flushText(bw)
 }
 
-// formatNode formats a single node for the SimpleTextFormat
-func formatNode(sb *strings.Builder, node *Node, indent int, includeLocations bool) {
-	if node == nil || sb == nil {
+// formatNode formats a subtree for the SimpleTextFormat. It uses an explicit
+// stack so deep trees are rendered completely.
+func formatNode(sb textWriter, root *Node, indent int, f SimpleTextFormat) {
+	if sb == nil || root == nil {
 		return
 	}
 
-	// Prevent excessive indentation
-	if indent > 100 {
-		sb.WriteString(strings.Repeat("  ", indent))
-		sb.WriteString("[Excessive nesting - tree truncated]\n")
-		return
+	type entry struct {
+		node   *Node
+		depth  int
+		elided int // If set, the entry is a line for this many elided nodes
 	}
 
-	indentStr := strings.Repeat("  ", indent)
+	stack := []entry{{node: root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
 
-	// Write node type and token
-	sb.WriteString(indentStr)
-	sb.WriteString(string(node.Type))
+		sb.WriteString(strings.Repeat("  ", indent+top.depth))
+		if top.elided > 0 {
+			sb.WriteString(elided(top.elided))
+			sb.WriteString("\n")
+			continue
+		}
+		node := top.node
+
+		// Write node type and token
+		sb.WriteString(string(node.Type))
 
-	if node.Token != "" {
-		// Escape special characters and truncate very long tokens
-		token := node.Token
-		if len(token) > 100 {
-			token = token[:97] + "..."
+		if node.Token != "" {
+			sb.WriteString(fmt.Sprintf(": %s", f.token(node.Token)))
 		}
-		sb.WriteString(fmt.Sprintf(": %s", token))
-	}
 
-	// Write roles if available
-	if len(node.Roles) > 0 {
-		sb.WriteString(" [")
-		for i, role := range node.Roles {
-			if i > 0 {
-				sb.WriteString(", ")
+		// Write roles if available
+		if len(node.Roles) > 0 {
+			sb.WriteString(" [")
+			for i, role := range node.Roles {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				sb.WriteString(string(role))
 			}
-			sb.WriteString(string(role))
+			sb.WriteString("]")
 		}
-		sb.WriteString("]")
-	}
 
-	// Write location if requested
-	if includeLocations && node.Location != nil {
-		sb.WriteString(fmt.Sprintf(" (%d:%d-%d:%d)",
-			node.Location.Start.Line, node.Location.Start.Column,
-			node.Location.End.Line, node.Location.End.Column))
-	}
+		// Write location if requested
+		if f.IncludeLocations && node.Location != nil {
+			sb.WriteString(fmt.Sprintf(" (%d:%d-%d:%d)",
+				node.Location.Start.Line, node.Location.Start.Column,
+				node.Location.End.Line, node.Location.End.Column))
+		}
 
-	sb.WriteString("\n")
+		sb.WriteString(f.properties(node))
+		sb.WriteString("\n")
 
-	// Write children
-	for _, child := range node.Children {
-		formatNode(sb, child, indent+1, includeLocations)
+		// Push children in reverse so they are rendered in order
+		children, hidden := f.truncate(f.NodeFilter.children(node), top.depth)
+		if hidden > 0 {
+			stack = append(stack, entry{depth: top.depth + 1, elided: hidden})
+		}
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, entry{node: children[i], depth: top.depth + 1})
+		}
 	}
 }
 
 // TreeTextFormat implements LLMFormat for tree-like text output
-type TreeTextFormat struct{}
+type TreeTextFormat struct {
+	RootSelector string // Path or declaration name of the subtree to render; empty means the whole tree
+	IncludeRoles bool
+	Color        bool // Colorize with ANSI escapes for terminals; see ColorEnabled
+	Truncation
+	PropertyDisplay
+	NodeFilter
+}
 
 // Format formats the UAST as a tree-like text structure
 func (f TreeTextFormat) Format(u *UAST) (string, error) {
+	return formatString(f, u)
+}
+
+// FormatTo writes the UAST as a tree-like text structure to w
+func (f TreeTextFormat) FormatTo(w io.Writer, u *UAST) error {
 	if u == nil {
-		return "", fmt.Errorf("cannot format nil UAST")
+		return fmt.Errorf("cannot format nil UAST")
+	}
+	root, err := selectRoot(u, f.RootSelector)
+	if err != nil {
+		return err
 	}
 
-	var sb strings.Builder
+	bw := bufio.NewWriter(w)
 
-	sb.WriteString(fmt.Sprintf("Language: %s\n\n", u.Language))
-	formatNodeTree(&sb, u.Root, "", true)
+	fmt.Fprintf(bw, "Language: %s\n\n", u.Language)
+	formatNodeTree(bw, root, "", true, f)
 
-	return sb.String(), nil
+	return flushText(bw)
+}
+
+// flushText flushes a text format's output
+func flushText(bw *bufio.Writer) error {
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write formatted UAST: %w", err)
+	}
+	return nil
 }
 
-// formatNodeTree formats a single node for the TreeTextFormat
-func formatNodeTree(sb *strings.Builder, node *Node, prefix string, isLast bool) {
-	if node == nil || sb == nil {
+// formatNodeTree formats a subtree for the TreeTextFormat. It uses an
+// explicit stack so deep trees are rendered completely.
+func formatNodeTree(sb textWriter, root *Node, prefix string, isLast bool, f TreeTextFormat) {
+	if root == nil || sb == nil {
 		return
 	}
 
-	// Prevent excessive recursion depth
-	if len(prefix) > 200 {
-		sb.WriteString(prefix)
-		if isLast {
-			sb.WriteString("└── ")
+	type entry struct {
+		node   *Node
+		depth  int
+		prefix string
+		isLast bool
+		elided int // If set, the entry is a line for this many elided nodes
+	}
+
+	stack := []entry{{node: root, prefix: prefix, isLast: isLast}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Generate the current line's prefix
+		childPrefix := top.prefix
+		branch := "├── "
+		if top.isLast {
+			branch = "└── "
+			childPrefix += "    "
 		} else {
-			sb.WriteString("├── ")
+			childPrefix += "│   "
+		}
+		sb.WriteString(f.paint(ansiDim, top.prefix+branch))
+		if top.elided > 0 {
+			sb.WriteString(f.paint(ansiDim, elided(top.elided)))
+			sb.WriteString("\n")
+			continue
 		}
-		sb.WriteString("[Excessive depth - tree truncated]\n")
-		return
-	}
 
-	// Generate the current line's prefix
-	sb.WriteString(prefix)
+		// Write node information
+		node := top.node
+		sb.WriteString(f.paint(ansiType, string(node.Type)))
+		if node.Token != "" {
+			sb.WriteString(": " + f.paint(ansiToken, f.token(node.Token)))
+		}
+		if f.IncludeRoles && len(node.Roles) > 0 {
+			roles := make([]string, len(node.Roles))
+			for i, role := range node.Roles {
+				roles[i] = string(role)
+			}
+			sb.WriteString(" " + f.paint(ansiRole, "["+strings.Join(roles, ", ")+"]"))
+		}
+		if properties := f.properties(node); properties != "" {
+			sb.WriteString(" " + f.paint(ansiDim, strings.TrimPrefix(properties, " ")))
+		}
+		sb.WriteString("\n")
 
-	if isLast {
-		sb.WriteString("└── ")
-		prefix += "    "
-	} else {
-		sb.WriteString("├── ")
-		prefix += "│   "
+		// Push children in reverse so they are rendered in order
+		children, hidden := f.truncate(f.NodeFilter.children(node), top.depth)
+		if hidden > 0 {
+			stack = append(stack, entry{depth: top.depth + 1, prefix: childPrefix, isLast: true, elided: hidden})
+		}
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, entry{node: children[i], depth: top.depth + 1, prefix: childPrefix, isLast: i == len(children)-1 && hidden == 0})
+		}
 	}
+}
 
-	// Write node information
-	nodeInfo := string(node.Type)
-	if node.Token != "" {
-		// Truncate very long tokens
-		token := node.Token
-		if len(token) > 100 {
-			token = token[:97] + "..."
-		}
-		nodeInfo += fmt.Sprintf(": %s", token)
+// ANSI escapes used by TreeTextFormat.Color
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "\x1b[2m"
+	ansiType  = "\x1b[1;36m"
+	ansiToken = "\x1b[32m"
+	ansiRole  = "\x1b[33m"
+)
+
+// paint wraps text in an ANSI escape if the format is colored
+func (f TreeTextFormat) paint(escape, text string) string {
+	if !f.Color || text == "" {
+		return text
 	}
-	sb.WriteString(nodeInfo)
-	sb.WriteString("\n")
+	return escape + text + ansiReset
+}
 
-	// Process children
-	for i, child := range node.Children {
-		isLastChild := i == len(node.Children)-1
-		formatNodeTree(sb, child, prefix, isLastChild)
+// ColorEnabled reports whether output to w should be colored: w must be a
+// terminal, NO_COLOR must be unset or empty and TERM must not be "dumb"
+func ColorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
 	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 // LoadTreeSitterCST loads a Tree-sitter CST from a JSON file
@@ -209,7 +415,7 @@ func DecodeTreeSitterCST(r io.Reader) (*TreeSitterNode, error) {
 
 	decoder := json.NewDecoder(r)
 	if err := decoder.Decode(&root); err != nil {
-		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+		return nil, fmt.Errorf("%w JSON: %w", ErrDecode, err)
 	}
 
 	return &root, nil
@@ -237,6 +443,41 @@ func SaveUAST(uast *UAST, filename string) error {
 	return nil
 }
 
+// LoadUAST loads a UAST from a JSON file written by SaveUAST
+func LoadUAST(filename string) (*UAST, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return DecodeUAST(file)
+}
+
+// DecodeUAST decodes a UAST from JSON and rebuilds its indices
+func DecodeUAST(r io.Reader) (*UAST, error) {
+	if r == nil {
+		return nil, fmt.Errorf("reader cannot be nil")
+	}
+
+	var u UAST
+	if err := json.NewDecoder(r).Decode(&u); err != nil {
+		return nil, fmt.Errorf("%w JSON: %w", ErrDecode, err)
+	}
+
+	return rebuildDecodedUAST(&u), nil
+}
+
+// rebuildDecodedUAST returns a fully initialized copy of a decoded UAST
+func rebuildDecodedUAST(decoded *UAST) *UAST {
+	u := NewUAST(decoded.Root, decoded.Language)
+	for k, v := range decoded.Metadata {
+		u.Metadata[k] = v
+	}
+	u.Diagnostics = decoded.Diagnostics
+	return u
+}
+
 // ToLLMFormat converts the UAST to a string format suitable for LLMs
 func ToLLMFormat(uast *UAST, format LLMFormat) (string, error) {
 	if uast == nil {
@@ -248,108 +489,165 @@ func ToLLMFormat(uast *UAST, format LLMFormat) (string, error) {
 	return format.Format(uast)
 }
 
-// GetCommonAncestor finds the common ancestor of the given nodes
-func GetCommonAncestor(nodes []*Node, root *Node) *Node {
-	if len(nodes) == 0 {
-		return nil
+// WriteLLMFormat writes the UAST in a format to w, streaming the output of
+// a StreamingFormat
+func WriteLLMFormat(w io.Writer, uast *UAST, format LLMFormat) error {
+	if uast == nil {
+		return fmt.Errorf("cannot format nil UAST")
 	}
-	if len(nodes) == 1 {
-		return nodes[0]
+	if format == nil {
+		return fmt.Errorf("formatter cannot be nil")
 	}
-	if root == nil {
-		return nil
+	if f, ok := format.(StreamingFormat); ok {
+		return f.FormatTo(w, uast)
 	}
 
-	// Build a path from root to each node
-	nodePaths := make(map[string][]*Node)
-
-	for _, node := range nodes {
-		if node == nil {
-			continue
-		}
-		path := buildPathTo(node, root)
-		if len(path) > 0 {
-			// Use node ID as map key instead of node pointer
-			nodePaths[node.ID] = path
-		}
+	text, err := format.Format(uast)
+	if err != nil {
+		return err
 	}
-
-	if len(nodePaths) == 0 {
-		return nil // No valid paths found
+	if _, err := io.WriteString(w, text); err != nil {
+		return fmt.Errorf("failed to write formatted UAST: %w", err)
 	}
+	return nil
+}
 
-	// Find the shortest path to compare with others
-	shortestLen := -1
-	var shortestPath []*Node
-
-	for _, path := range nodePaths {
-		if shortestLen == -1 || len(path) < shortestLen {
-			shortestLen = len(path)
-			shortestPath = path
-		}
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]LLMFormat{
+		"json":       JSONFormat{Pretty: true},
+		"simple":     SimpleTextFormat{IncludeLocations: true},
+		"tree":       TreeTextFormat{},
+		"source":     SourceFormat{},
+		"structured": StructuredFormat{Pretty: true},
 	}
+)
 
-	// Compare paths to find common ancestor
-	var commonAncestor *Node
+// RegisterFormat registers a format under a name, such as one chosen on a
+// command line, replacing any existing one
+func RegisterFormat(name string, format LLMFormat) {
+	if name == "" || format == nil {
+		return
+	}
 
-	for i := 0; i < shortestLen; i++ {
-		current := shortestPath[i]
-		isCommon := true
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
 
-		for _, path := range nodePaths {
-			if i >= len(path) || path[i] != current {
-				isCommon = false
-				break
-			}
-		}
+	formats[name] = format
+}
 
-		if isCommon {
-			commonAncestor = current
-		} else {
-			break
-		}
-	}
+// LookupFormat returns the format registered under a name
+func LookupFormat(name string) (LLMFormat, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
 
-	return commonAncestor
+	format, ok := formats[name]
+	return format, ok
 }
 
-// buildPathTo builds a path from root to the given node
-func buildPathTo(target *Node, current *Node) []*Node {
-	if current == nil || target == nil {
-		return nil
-	}
+// FormatNames returns the names of the registered formats in sorted order
+func FormatNames() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
 
-	if current == target {
-		return []*Node{current}
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
 	}
-
-	// Use a map to detect cycles
-	visited := make(map[string]bool)
-	return buildPathToHelper(target, current, visited)
+	slices.Sort(names)
+	return names
 }
 
-// buildPathToHelper is a helper function that uses a visited map to detect cycles
-func buildPathToHelper(target *Node, current *Node, visited map[string]bool) []*Node {
-	if current == nil {
+// GetCommonAncestor finds the lowest common ancestor of the given nodes
+// within the tree rooted at root. Nodes outside the tree are ignored. It
+// follows parent links, so it runs in time proportional to the depth of the
+// nodes; trees without parent links, such as ones built by hand rather than
+// indexed by a UAST, are indexed with a single walk first.
+func GetCommonAncestor(nodes []*Node, root *Node) *Node {
+	if len(nodes) == 0 {
 		return nil
 	}
-
-	// Use node ID to detect cycles
-	if visited[current.ID] {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	if root == nil {
 		return nil
 	}
-	visited[current.ID] = true
 
-	if current == target {
-		return []*Node{current}
+	var parents map[*Node]*Node
+	parentOf := func(node *Node) *Node {
+		if parents != nil {
+			return parents[node]
+		}
+		return node.parent
+	}
+	// depthOf returns the node's depth below root, or -1 if it isn't under it
+	depthOf := func(node *Node) int {
+		depth := 0
+		for ; node != nil; node = parentOf(node) {
+			if node == root {
+				return depth
+			}
+			depth++
+		}
+		return -1
 	}
 
-	for _, child := range current.Children {
-		path := buildPathToHelper(target, child, visited)
-		if path != nil {
-			return append([]*Node{current}, path...)
+	var common *Node
+	commonDepth := 0
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		depth := depthOf(node)
+		if depth < 0 && parents == nil {
+			parents = parentLinks(root)
+			depth = depthOf(node)
+			if common != nil {
+				commonDepth = depthOf(common)
+			}
+		}
+		if depth < 0 {
+			continue
+		}
+		if common == nil {
+			common, commonDepth = node, depth
+			continue
+		}
+
+		// Align the depths, then climb together until the paths meet
+		for ; depth > commonDepth; depth-- {
+			node = parentOf(node)
+		}
+		for ; commonDepth > depth; commonDepth-- {
+			common = parentOf(common)
+		}
+		for node != common {
+			node, common = parentOf(node), parentOf(common)
+			commonDepth--
 		}
 	}
+	return common
+}
 
-	return nil
+// parentLinks maps each node under root to its parent
+func parentLinks(root *Node) map[*Node]*Node {
+	parents := make(map[*Node]*Node)
+	walk(root, func(node *Node, _ int) {
+		for _, child := range node.Children {
+			if child != nil {
+				parents[child] = node
+			}
+		}
+	})
+	return parents
+}
+
+// LowestCommonAncestor returns the deepest node that is an ancestor of, or
+// the same as, every given node in the UAST
+func (u *UAST) LowestCommonAncestor(nodes ...*Node) *Node {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return GetCommonAncestor(nodes, u.Root)
 }
@@ -0,0 +1,170 @@
+package uast
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// FindingKind names an invariant checked by Validate
+type FindingKind string
+
+// Invariants checked by Validate
+const (
+	FindingNilRoot               FindingKind = "NilRoot"
+	FindingNilChild              FindingKind = "NilChild"
+	FindingDuplicateID           FindingKind = "DuplicateID"
+	FindingCycle                 FindingKind = "Cycle"      // A node is its own ancestor
+	FindingSharedNode            FindingKind = "SharedNode" // A node has several parents
+	FindingParentLink            FindingKind = "ParentLink"
+	FindingInvalidLocation       FindingKind = "InvalidLocation" // Ends before it starts
+	FindingLocationOutsideParent FindingKind = "LocationOutsideParent"
+	FindingIndexMismatch         FindingKind = "IndexMismatch"
+)
+
+// Finding is a broken invariant reported by Validate
+type Finding struct {
+	Kind    FindingKind
+	Node    *Node // The offending node, or nil for the tree as a whole
+	Message string
+}
+
+// String formats the finding with the offending node's ID
+func (f Finding) String() string {
+	if f.Node == nil {
+		return fmt.Sprintf("%s: %s", f.Kind, f.Message)
+	}
+	return fmt.Sprintf("%s: node %q: %s", f.Kind, f.Node.ID, f.Message)
+}
+
+// Validate checks the invariants of the tree and its indices: a root is
+// set, IDs are unique, the nodes form a tree with correct parent links,
+// children lie within their parent's location, and the type, token and role
+// indices hold exactly the nodes of the tree. Parent links are not checked
+// in frozen trees, whose nodes may be shared. It returns nil if every
+// invariant holds.
+func (u *UAST) Validate() []Finding {
+	u.flushDirty()
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if u.Root == nil {
+		return []Finding{{Kind: FindingNilRoot, Message: "the root is nil"}}
+	}
+
+	var findings []Finding
+	report := func(kind FindingKind, node *Node, format string, args ...any) {
+		findings = append(findings, Finding{Kind: kind, Node: node, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Walk depth-first with exit entries, tracking the current path to tell
+	// cycles from nodes shared between parents
+	type entry struct {
+		node, parent *Node
+		exit         bool
+	}
+	seen := make(map[*Node]bool)
+	onPath := make(map[*Node]bool)
+	ids := make(map[string]*Node)
+	stack := []entry{{node: u.Root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node, parent := top.node, top.parent
+		if top.exit {
+			delete(onPath, node)
+			continue
+		}
+
+		if onPath[node] {
+			report(FindingCycle, node, "is a child of its descendant %q", parent.ID)
+			continue
+		}
+		if seen[node] {
+			report(FindingSharedNode, node, "is also a child of %q", parent.ID)
+			continue
+		}
+		seen[node] = true
+		onPath[node] = true
+		stack = append(stack, entry{node: node, exit: true})
+
+		if other, ok := ids[node.ID]; ok && node.ID != "" {
+			report(FindingDuplicateID, node, "has the same ID as another %s node", other.Type)
+		}
+		ids[node.ID] = node
+		if node.parent != parent && !u.frozen {
+			report(FindingParentLink, node, "is linked to the wrong parent")
+		}
+		if loc := node.Location; loc != nil {
+			if loc.End.Before(loc.Start) {
+				report(FindingInvalidLocation, node, "ends at %d:%d before it starts at %d:%d", loc.End.Line, loc.End.Column, loc.Start.Line, loc.Start.Column)
+			}
+			if parent != nil && parent.Location != nil && !parent.Location.ContainsRange(*loc) {
+				report(FindingLocationOutsideParent, node, "lies outside its parent %q", parent.ID)
+			}
+		}
+
+		for i := len(node.Children) - 1; i >= 0; i-- {
+			if child := node.Children[i]; child != nil {
+				stack = append(stack, entry{node: child, parent: node})
+			} else {
+				report(FindingNilChild, node, "has a nil child at index %d", i)
+			}
+		}
+	}
+
+	// Every node is indexed once under its type, under its token if it has
+	// one, and under each of its roles
+	typeCounts := make(map[*Node]int)
+	for _, nodeType := range slices.Sorted(maps.Keys(u.TypeIndex)) {
+		for _, node := range u.TypeIndex[nodeType] {
+			typeCounts[node]++
+			if !seen[node] {
+				report(FindingIndexMismatch, node, "is indexed by type but is not in the tree")
+			} else if node.Type != nodeType {
+				report(FindingIndexMismatch, node, "is indexed under type %s", nodeType)
+			}
+		}
+	}
+	tokenCounts := make(map[*Node]int)
+	for _, token := range slices.Sorted(maps.Keys(u.TokenIndex)) {
+		for _, node := range u.TokenIndex[token] {
+			tokenCounts[node]++
+			if !seen[node] {
+				report(FindingIndexMismatch, node, "is indexed by token but is not in the tree")
+			} else if node.Token != token {
+				report(FindingIndexMismatch, node, "is indexed under token %q", token)
+			}
+		}
+	}
+	roleCounts := make(map[*Node]int)
+	for _, role := range slices.Sorted(maps.Keys(u.RoleIndex)) {
+		for _, node := range u.RoleIndex[role] {
+			roleCounts[node]++
+			if !seen[node] {
+				report(FindingIndexMismatch, node, "is indexed by role but is not in the tree")
+			} else if !node.HasRole(role) {
+				report(FindingIndexMismatch, node, "is indexed under role %s", role)
+			}
+		}
+	}
+	var nodes []*Node
+	for node := range seen {
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(a, b *Node) int { return cmp.Compare(a.ID, b.ID) })
+	for _, node := range nodes {
+		if typeCounts[node] != 1 {
+			report(FindingIndexMismatch, node, "is indexed %d times by type", typeCounts[node])
+		}
+		if want := min(len(node.Token), 1); tokenCounts[node] != want {
+			report(FindingIndexMismatch, node, "is indexed %d times by token", tokenCounts[node])
+		}
+		if want := len(sortedRoles(node.Roles)); roleCounts[node] != want {
+			report(FindingIndexMismatch, node, "is indexed %d times by role", roleCounts[node])
+		}
+	}
+	return findings
+}
@@ -0,0 +1,117 @@
+package uast
+
+import (
+	"iter"
+	"maps"
+	"slices"
+)
+
+// View is a read-only view of a UAST that hides the nodes a filter omits,
+// with their children taking their place as in the formats. It shares the
+// UAST's nodes and indices rather than copying them, so it reflects later
+// edits, and its root is always visible. Nodes must be navigated through the
+// view, since their own Children include hidden nodes.
+type View struct {
+	u      *UAST
+	filter NodeFilter
+}
+
+// View returns a view of the UAST without the nodes the filter omits
+func (u *UAST) View(filter NodeFilter) *View {
+	return &View{u: u, filter: filter}
+}
+
+// Root returns the root of the viewed UAST
+func (v *View) Root() *Node {
+	return v.u.Root
+}
+
+// Visible reports whether a node of the UAST is visible in the view
+func (v *View) Visible(node *Node) bool {
+	return node != nil && (node == v.u.Root || v.filter.keep(node))
+}
+
+// Children returns the visible children of a node, including the visible
+// descendants of its hidden children
+func (v *View) Children(node *Node) []*Node {
+	if node == nil {
+		return nil
+	}
+	return v.filter.children(node)
+}
+
+// Nodes iterates over the visible nodes in pre-order, starting at the root
+func (v *View) Nodes() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		if v.u.Root == nil {
+			return
+		}
+		stack := []*Node{v.u.Root}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if !yield(node) {
+				return
+			}
+			children := v.filter.children(node)
+			for i := len(children) - 1; i >= 0; i-- {
+				stack = append(stack, children[i])
+			}
+		}
+	}
+}
+
+// FindByType returns the visible nodes of the given type
+func (v *View) FindByType(nodeType NodeType) []*Node {
+	return slices.DeleteFunc(v.u.FindByType(nodeType), v.hidden)
+}
+
+// FindByToken returns the visible nodes with the given token
+func (v *View) FindByToken(token string) []*Node {
+	return slices.DeleteFunc(v.u.FindByToken(token), v.hidden)
+}
+
+// hidden reports whether a node is hidden by the view
+func (v *View) hidden(node *Node) bool {
+	return !v.Visible(node)
+}
+
+// Format formats the view. The text and JSON formats apply the view's filter
+// along with their own, and other formats are given a copy of the visible
+// nodes.
+func (v *View) Format(format LLMFormat) (string, error) {
+	keep := func(own NodeFilter) NodeFilter {
+		if !v.filter.active() {
+			return own
+		}
+		return NodeFilter{Keep: func(node *Node) bool { return v.filter.keep(node) && own.keep(node) }}
+	}
+
+	switch f := format.(type) {
+	case SimpleTextFormat:
+		f.NodeFilter = keep(f.NodeFilter)
+		return f.Format(v.u)
+	case TreeTextFormat:
+		f.NodeFilter = keep(f.NodeFilter)
+		return f.Format(v.u)
+	case JSONFormat:
+		f.NodeFilter = keep(f.NodeFilter)
+		return f.Format(v.u)
+	}
+	return format.Format(v.copy())
+}
+
+// copy returns a UAST of the visible nodes
+func (v *View) copy() *UAST {
+	if !v.filter.active() || v.u.Root == nil {
+		return v.u
+	}
+
+	v.u.mu.RLock()
+	defer v.u.mu.RUnlock()
+
+	copied := NewUAST(subtreeCopy{filter: v.filter}.copy(v.u.Root, 0), v.u.Language)
+	maps.Copy(copied.Metadata, v.u.Metadata)
+	return copied
+}
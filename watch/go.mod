@@ -0,0 +1,12 @@
+module github.com/flaticols/uast-go/watch
+
+go 1.24.1
+
+require (
+	github.com/flaticols/uast-go v0.0.0
+	github.com/fsnotify/fsnotify v1.10.1
+)
+
+require golang.org/x/sys v0.30.0 // indirect
+
+replace github.com/flaticols/uast-go => ../
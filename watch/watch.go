@@ -0,0 +1,292 @@
+// Package watch keeps UASTs up to date as files change, re-converting each
+// changed file and passing the result to a callback
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/flaticols/uast-go"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Options configures Watch
+type Options struct {
+	uast.LoadOptions
+
+	// Debounce delays conversion until a file has been quiet this long, so
+	// editors saving in several writes trigger one conversion. Defaults to
+	// 100ms.
+	Debounce time.Duration
+
+	// OutputDir, if set, receives a UAST JSON file for every converted file,
+	// at its path relative to the watched root plus ".uast.json". Artifacts
+	// of removed files are deleted. It should be outside root.
+	OutputDir string
+}
+
+// Event reports a converted or removed file
+type Event struct {
+	Path    string
+	UAST    *uast.UAST // Nil if the file was removed or failed to convert
+	Err     error
+	Removed bool
+}
+
+// Watch converts every file under root, then watches the tree and converts
+// files again as they change, calling fn with each result. Calls to fn are
+// serialized. Watch runs until ctx is done, returning nil, or until fn
+// returns an error, returning that error.
+func Watch(ctx context.Context, root string, opts Options, fn func(Event) error) error {
+	if fn == nil {
+		return fmt.Errorf("callback cannot be nil")
+	}
+	if opts.Converter == nil {
+		opts.Converter = uast.NewConverter()
+	}
+	if opts.SkipDirs == nil {
+		opts.SkipDirs = []string{".git", "node_modules"}
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 100 * time.Millisecond
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	w := &watch{root: root, opts: opts, fn: fn, watcher: watcher, timers: make(map[string]*time.Timer), known: make(map[string]bool)}
+	if err := w.addDirs(root); err != nil {
+		return err
+	}
+
+	// Watching starts before the initial load so no change is missed
+	err = uast.LoadDir(ctx, root, opts.LoadOptions, func(result uast.FileResult) error {
+		return w.deliver(Event{Path: result.Path, UAST: result.UAST, Err: result.Err})
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	return w.run(ctx)
+}
+
+// watch is the state of a running Watch
+type watch struct {
+	root    string
+	opts    Options
+	fn      func(Event) error
+	watcher *fsnotify.Watcher
+
+	mu      sync.Mutex
+	timers  map[string]*time.Timer // Pending conversions by path
+	known   map[string]bool        // Files delivered and not since removed
+	stopped bool
+	err     error // First error returned by fn
+}
+
+// run handles file system events until ctx is done or fn fails
+func (w *watch) run(ctx context.Context) error {
+	defer func() {
+		w.mu.Lock()
+		w.stopped = true
+		for _, timer := range w.timers {
+			timer.Stop()
+		}
+		w.mu.Unlock()
+	}()
+
+	failed := make(chan struct{}, 1)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-failed:
+			return w.err
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("failed to watch %s: %w", w.root, err)
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(ctx, event, failed)
+		}
+	}
+}
+
+// handle schedules the work for a file system event
+func (w *watch) handle(ctx context.Context, event fsnotify.Event, failed chan<- struct{}) {
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			// New directories are watched, and files created in them before
+			// the watch was added are picked up by walking them
+			if w.skipDir(event.Name) {
+				return
+			}
+			if err := w.addDirs(event.Name); err == nil {
+				filepath.WalkDir(event.Name, func(path string, d fs.DirEntry, err error) error {
+					if err == nil && !d.IsDir() {
+						w.schedule(ctx, path, failed)
+					}
+					return nil
+				})
+			}
+			return
+		}
+	}
+	if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		w.schedule(ctx, event.Name, failed)
+	}
+}
+
+// schedule converts path once it has been quiet for the debounce interval
+func (w *watch) schedule(ctx context.Context, path string, failed chan<- struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		return
+	}
+	if timer, ok := w.timers[path]; ok {
+		timer.Reset(w.opts.Debounce)
+		return
+	}
+	w.timers[path] = time.AfterFunc(w.opts.Debounce, func() {
+		w.mu.Lock()
+		delete(w.timers, path)
+		stopped := w.stopped
+		w.mu.Unlock()
+		if stopped {
+			return
+		}
+
+		if err := w.convert(ctx, path); err != nil {
+			select {
+			case failed <- struct{}{}:
+			default:
+			}
+		}
+	})
+}
+
+// convert converts a changed file, or reports its removal
+func (w *watch) convert(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		w.mu.Lock()
+		known := w.known[path]
+		w.mu.Unlock()
+		if !known {
+			return nil // Such as an editor's temporary file
+		}
+		if w.opts.OutputDir != "" {
+			if artifact, err := w.artifactPath(path); err == nil {
+				os.Remove(artifact)
+			}
+		}
+		return w.deliver(Event{Path: path, Removed: true})
+	}
+
+	result, ok := uast.LoadFile(ctx, path, w.opts.LoadOptions)
+	if !ok {
+		return nil
+	}
+	return w.deliver(Event{Path: result.Path, UAST: result.UAST, Err: result.Err})
+}
+
+// deliver writes the artifact for an event and passes it to fn, recording
+// the first error fn returns
+func (w *watch) deliver(event Event) error {
+	if w.opts.OutputDir != "" && event.UAST != nil {
+		if err := w.writeArtifact(event); err != nil && event.Err == nil {
+			event.Err = err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	if w.stopped {
+		return nil
+	}
+	if event.Removed {
+		delete(w.known, event.Path)
+	} else {
+		w.known[event.Path] = true
+	}
+	if err := w.fn(event); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// writeArtifact saves the UAST of an event under OutputDir
+func (w *watch) writeArtifact(event Event) error {
+	artifact, err := w.artifactPath(event.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(artifact), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(artifact), err)
+	}
+	return uast.SaveUAST(event.UAST, artifact)
+}
+
+// artifactPath returns where the UAST of path is written
+func (w *watch) artifactPath(path string) (string, error) {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to locate %s under %s: %w", path, w.root, err)
+	}
+	return filepath.Join(w.opts.OutputDir, rel+".uast.json"), nil
+}
+
+// addDirs watches dir and the directories below it
+func (w *watch) addDirs(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && w.skipDir(path) {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// skipDir reports whether a directory is excluded by SkipDirs or is the
+// output directory
+func (w *watch) skipDir(path string) bool {
+	if slices.Contains(w.opts.SkipDirs, filepath.Base(path)) {
+		return true
+	}
+	if w.opts.OutputDir == "" {
+		return false
+	}
+	out, err1 := filepath.Abs(w.opts.OutputDir)
+	dir, err2 := filepath.Abs(path)
+	return err1 == nil && err2 == nil && out == dir
+}
@@ -0,0 +1,82 @@
+package watch_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flaticols/uast-go/watch"
+)
+
+func TestWatch(t *testing.T) {
+	cst, err := os.ReadFile("../testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error reading CST: %v", err)
+	}
+	root, out := t.TempDir(), t.TempDir()
+	path := filepath.Join(root, "main.go.cst.json")
+	if err := os.WriteFile(path, cst, 0o644); err != nil {
+		t.Fatalf("Error writing CST: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan watch.Event, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- watch.Watch(ctx, root, watch.Options{Debounce: 10 * time.Millisecond, OutputDir: out}, func(event watch.Event) error {
+			events <- event
+			return nil
+		})
+	}()
+
+	next := func() watch.Event {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an event")
+			return watch.Event{}
+		}
+	}
+
+	// The existing file is converted on start
+	if event := next(); event.Path != path || event.UAST == nil || event.Err != nil {
+		t.Fatalf("Expected the initial conversion of %s, got %+v", path, event)
+	}
+	artifact := filepath.Join(out, "main.go.cst.json.uast.json")
+	if _, err := os.Stat(artifact); err != nil {
+		t.Errorf("Expected an artifact at %s: %v", artifact, err)
+	}
+
+	// New files in new directories are converted
+	added := filepath.Join(root, "pkg", "util.go.cst.json")
+	if err := os.MkdirAll(filepath.Dir(added), 0o755); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	if err := os.WriteFile(added, cst, 0o644); err != nil {
+		t.Fatalf("Error writing CST: %v", err)
+	}
+	if event := next(); event.Path != added || event.UAST == nil {
+		t.Errorf("Expected %s to be converted, got %+v", added, event)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Error removing CST: %v", err)
+	}
+	if event := next(); event.Path != path || !event.Removed {
+		t.Errorf("Expected %s to be removed, got %+v", path, event)
+	}
+	if _, err := os.Stat(artifact); !os.IsNotExist(err) {
+		t.Errorf("Expected the artifact of a removed file to be deleted")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected Watch to stop cleanly, got %v", err)
+	}
+}
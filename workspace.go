@@ -0,0 +1,367 @@
+package uast
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Workspace holds the UASTs of many files keyed by path, so queries can span
+// a whole repository
+type Workspace struct {
+	mu       sync.RWMutex
+	files    map[string]*UAST
+	metadata map[string]string
+	symbols  *symbolCache // Reset whenever files are added, removed or edited
+}
+
+// WorkspaceMatch is a node found by a workspace-wide query
+type WorkspaceMatch struct {
+	Path string
+	Node *Node
+}
+
+// NewWorkspace creates an empty Workspace
+func NewWorkspace() *Workspace {
+	return &Workspace{
+		files:    make(map[string]*UAST),
+		metadata: make(map[string]string),
+		symbols:  &symbolCache{},
+	}
+}
+
+// Add adds or replaces the UAST for path
+func (w *Workspace) Add(path string, u *UAST) {
+	if u == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.files[path] = u
+	w.symbols = &symbolCache{}
+}
+
+// Remove removes the UAST for path, reporting whether it was present
+func (w *Workspace) Remove(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.files[path]
+	delete(w.files, path)
+	if ok {
+		w.symbols = &symbolCache{}
+	}
+	return ok
+}
+
+// SymbolIndex returns the cross-file symbol index, building it on first use
+// after files were added, removed or edited
+func (w *Workspace) SymbolIndex() *SymbolIndex {
+	w.mu.RLock()
+	cache := w.symbols
+	w.mu.RUnlock()
+
+	index := cache.build(w)
+	if cache.current(w) {
+		return index
+	}
+
+	// A file was edited since, so the index is rebuilt once for everyone
+	w.mu.Lock()
+	if w.symbols == cache {
+		w.symbols = &symbolCache{}
+	}
+	cache = w.symbols
+	w.mu.Unlock()
+	return cache.build(w)
+}
+
+// ResolveSymbol returns the declarations of a qualified symbol across the
+// workspace
+func (w *Workspace) ResolveSymbol(symbol string) []Declaration {
+	return w.SymbolIndex().ResolveSymbol(symbol)
+}
+
+// DeclarationsOf returns every declaration with the given unqualified name
+// across the workspace
+func (w *Workspace) DeclarationsOf(name string) []Declaration {
+	return w.SymbolIndex().DeclarationsOf(name)
+}
+
+// Get returns the UAST for path
+func (w *Workspace) Get(path string) (*UAST, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	u, ok := w.files[path]
+	return u, ok
+}
+
+// Len returns the number of files in the workspace
+func (w *Workspace) Len() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return len(w.files)
+}
+
+// Paths returns the paths of all files in sorted order
+func (w *Workspace) Paths() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	paths := make([]string, 0, len(w.files))
+	for path := range w.files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// find collects matches from every file in path order
+func (w *Workspace) find(query func(*UAST) []*Node) []WorkspaceMatch {
+	var matches []WorkspaceMatch
+	for _, path := range w.Paths() {
+		u, ok := w.Get(path)
+		if !ok {
+			continue
+		}
+		for _, node := range query(u) {
+			matches = append(matches, WorkspaceMatch{Path: path, Node: node})
+		}
+	}
+	return matches
+}
+
+// FindByType returns all nodes of the given type across the workspace,
+// ordered by path
+func (w *Workspace) FindByType(nodeType NodeType) []WorkspaceMatch {
+	return w.find(func(u *UAST) []*Node { return u.FindByType(nodeType) })
+}
+
+// FindByToken returns all nodes with the given token across the workspace,
+// ordered by path
+func (w *Workspace) FindByToken(token string) []WorkspaceMatch {
+	return w.find(func(u *UAST) []*Node { return u.FindByToken(token) })
+}
+
+// Matches iterates over the nodes query selects in each file, in path
+// order. Files are searched as the iteration goes, so stopping early skips
+// the rest of the workspace.
+func (w *Workspace) Matches(query func(*UAST) *Query) iter.Seq[WorkspaceMatch] {
+	return func(yield func(WorkspaceMatch) bool) {
+		for match := range w.matchesFrom(query, "", 0) {
+			if !yield(match.WorkspaceMatch) {
+				return
+			}
+		}
+	}
+}
+
+// FindPage returns up to limit of the nodes query selects across the
+// workspace, starting at cursor, which is empty for the first page. It also
+// returns the cursor of the next page, which is empty after the last page.
+// Pages follow path order, and may skip or repeat nodes if files change
+// between calls.
+func (w *Workspace) FindPage(query func(*UAST) *Query, cursor string, limit int) ([]WorkspaceMatch, string, error) {
+	path, skip, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var page []WorkspaceMatch
+	for match := range w.matchesFrom(query, path, skip) {
+		if limit > 0 && len(page) == limit {
+			return page, encodeCursor(match.Path, match.index), nil
+		}
+		page = append(page, match.WorkspaceMatch)
+	}
+	return page, "", nil
+}
+
+// indexedMatch is a workspace match with its position among its file's
+// matches
+type indexedMatch struct {
+	WorkspaceMatch
+	index int
+}
+
+// matchesFrom iterates over the matches of query from the match at index
+// skip in the file at path, or from the first file after it
+func (w *Workspace) matchesFrom(query func(*UAST) *Query, path string, skip int) iter.Seq[indexedMatch] {
+	return func(yield func(indexedMatch) bool) {
+		paths := w.Paths()
+		start, _ := slices.BinarySearch(paths, path)
+		for _, p := range paths[start:] {
+			u, ok := w.Get(p)
+			if !ok {
+				continue
+			}
+			index := 0
+			for node := range query(u).Nodes() {
+				if p != path || index >= skip {
+					if !yield(indexedMatch{WorkspaceMatch{Path: p, Node: node}, index}) {
+						return
+					}
+				}
+				index++
+			}
+		}
+	}
+}
+
+// encodeCursor returns an opaque cursor for the match at index in a file
+func encodeCursor(path string, index int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(index) + ":" + path))
+}
+
+// decodeCursor returns the file and match index a cursor points to
+func decodeCursor(cursor string) (string, int, error) {
+	if cursor == "" {
+		return "", 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w cursor: %w", ErrDecode, err)
+	}
+	index, path, ok := strings.Cut(string(data), ":")
+	n, err := strconv.Atoi(index)
+	if !ok || err != nil || n < 0 {
+		return "", 0, fmt.Errorf("%w cursor: malformed position", ErrDecode)
+	}
+	return path, n, nil
+}
+
+// AddMetadata adds workspace-level metadata
+func (w *Workspace) AddMetadata(key, value string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.metadata[key] = value
+}
+
+// Metadata returns a copy of the workspace-level metadata
+func (w *Workspace) Metadata() map[string]string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	metadata := make(map[string]string, len(w.metadata))
+	for k, v := range w.metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// MetadataValues returns the distinct values of a per-file metadata key
+// across the workspace, with the number of files having each value
+func (w *Workspace) MetadataValues(key string) map[string]int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	values := make(map[string]int)
+	for _, u := range w.files {
+		u.mu.RLock()
+		if value, ok := u.Metadata[key]; ok {
+			values[value]++
+		}
+		u.mu.RUnlock()
+	}
+	return values
+}
+
+// Languages returns the number of files in each language
+func (w *Workspace) Languages() map[string]int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	languages := make(map[string]int)
+	for _, u := range w.files {
+		languages[u.Language]++
+	}
+	return languages
+}
+
+// MemoryUsage returns the estimated heap used by all trees in the workspace
+func (w *Workspace) MemoryUsage() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	total := 0
+	for _, u := range w.files {
+		total += u.Stats().EstimatedBytes
+	}
+	return total
+}
+
+// workspaceJSON is the serialized form of a Workspace
+type workspaceJSON struct {
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Files    map[string]*UAST  `json:"files"`
+}
+
+// Encode writes the workspace to w as JSON
+func (w *Workspace) Encode(out io.Writer) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	encoder := json.NewEncoder(out)
+	if err := encoder.Encode(workspaceJSON{Metadata: w.metadata, Files: w.files}); err != nil {
+		return fmt.Errorf("failed to encode workspace: %w", err)
+	}
+	return nil
+}
+
+// Save saves the workspace to a JSON file
+func (w *Workspace) Save(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	return w.Encode(file)
+}
+
+// DecodeWorkspace reads a workspace written by Workspace.Encode
+func DecodeWorkspace(r io.Reader) (*Workspace, error) {
+	if r == nil {
+		return nil, fmt.Errorf("reader cannot be nil")
+	}
+
+	var data workspaceJSON
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("%w workspace: %w", ErrDecode, err)
+	}
+
+	w := NewWorkspace()
+	for k, v := range data.Metadata {
+		w.metadata[k] = v
+	}
+	for path, u := range data.Files {
+		if u == nil {
+			continue
+		}
+		w.files[path] = rebuildDecodedUAST(u)
+	}
+	return w, nil
+}
+
+// LoadWorkspace loads a workspace from a JSON file written by Save
+func LoadWorkspace(filename string) (*Workspace, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return DecodeWorkspace(file)
+}
@@ -0,0 +1,346 @@
+package uast_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flaticols/uast-go"
+)
+
+func newTestWorkspace(t *testing.T) *uast.Workspace {
+	t.Helper()
+
+	converter := uast.NewConverter()
+	w := uast.NewWorkspace()
+
+	for path, file := range map[string]string{
+		"example.go": "testdata/example.json",
+		"test.go":    "testdata/test_cst.json",
+	} {
+		tsNode, err := uast.LoadTreeSitterCST(file)
+		if err != nil {
+			t.Fatalf("Error loading CST: %v", err)
+		}
+		u, err := converter.Convert(tsNode, "go")
+		if err != nil {
+			t.Fatalf("Error converting to UAST: %v", err)
+		}
+		u.AddMetadata("filename", path)
+		w.Add(path, u)
+	}
+	return w
+}
+
+func TestWorkspace(t *testing.T) {
+	w := newTestWorkspace(t)
+	w.AddMetadata("repo", "uast-go")
+
+	functions := w.FindByType(uast.Function)
+	if len(functions) != 1 || functions[0].Path != "test.go" {
+		t.Errorf("Expected the single mapped function to be in test.go, got %v", functions)
+	}
+	if got := w.Languages()["go"]; got != 2 {
+		t.Errorf("Expected 2 go files, got %d", got)
+	}
+	if w.MemoryUsage() <= 0 {
+		t.Errorf("Expected a positive memory estimate")
+	}
+
+	var buf bytes.Buffer
+	if err := w.Encode(&buf); err != nil {
+		t.Fatalf("Error encoding workspace: %v", err)
+	}
+	loaded, err := uast.DecodeWorkspace(&buf)
+	if err != nil {
+		t.Fatalf("Error decoding workspace: %v", err)
+	}
+
+	if loaded.Len() != 2 || loaded.Metadata()["repo"] != "uast-go" {
+		t.Errorf("Expected decoded workspace to keep its files and metadata")
+	}
+	if got := len(loaded.FindByToken("main")); got != len(w.FindByToken("main")) {
+		t.Errorf("Expected decoded workspace to be indexed, got %d matches", got)
+	}
+	if got := loaded.MetadataValues("filename"); got["example.go"] != 1 {
+		t.Errorf("Expected per-file metadata to survive, got %v", got)
+	}
+}
+
+func TestWorkspaceSymbolIndex(t *testing.T) {
+	w := newTestWorkspace(t)
+
+	decls := w.ResolveSymbol("Example.test")
+	if len(decls) != 0 {
+		t.Errorf("Expected unmapped methods not to be declarations, got %v", decls)
+	}
+
+	decls = w.ResolveSymbol("Example")
+	if len(decls) != 1 || decls[0].Path != "test.go" {
+		t.Fatalf("Expected Example to be declared in test.go, got %v", decls)
+	}
+	if decls[0].Node.Type != uast.Class {
+		t.Errorf("Expected Example to resolve to a Class, got %s", decls[0].Node.Type)
+	}
+
+	if got := w.DeclarationsOf("hello"); len(got) != 1 || got[0].Symbol != "hello" {
+		t.Errorf("Expected one declaration of hello, got %v", got)
+	}
+
+	// Edits to a file in the workspace rebuild the index too
+	u, _ := w.Get("test.go")
+	example := w.ResolveSymbol("Example")[0].Node
+	example.Token = "Renamed"
+	_ = u.MarkDirty(example)
+	if got := w.ResolveSymbol("Renamed"); len(got) != 1 || len(w.ResolveSymbol("Example")) != 0 {
+		t.Errorf("Expected the index to see a renamed class, got %v", got)
+	}
+	if err := u.RemoveNode(example); err != nil {
+		t.Fatalf("Error removing node: %v", err)
+	}
+	if got := w.ResolveSymbol("Renamed"); len(got) != 0 {
+		t.Errorf("Expected the index to drop a removed class, got %v", got)
+	}
+
+	w.Remove("test.go")
+	if got := w.DeclarationsOf("hello"); len(got) != 0 {
+		t.Errorf("Expected the index to be rebuilt after removing a file, got %v", got)
+	}
+}
+
+func TestAffectedByDiff(t *testing.T) {
+	w := uast.NewWorkspace()
+	w.Add("example.go", loadGoExample(t))
+
+	// Changes the body of add and deletes a line at the end of main
+	diff := `diff --git a/example.go b/example.go
+--- a/example.go
++++ b/example.go
+@@ -9,3 +9,3 @@
+ func add(a, b int) int {
+-	return a + b
++	return b + a
+ }
+@@ -26,4 +26,3 @@
+ 		fmt.Println(strings.Repeat("*", i+1))
+-		// Trailing comment
+ 	}
+ }
+`
+	changes, err := uast.ParseUnifiedDiff(strings.NewReader(diff))
+	if err != nil {
+		t.Fatalf("Error parsing diff: %v", err)
+	}
+	if got := changes["example.go"]; len(got) != 2 || got[0] != (uast.LineRange{Start: 10, End: 10}) {
+		t.Errorf("Expected changes at lines 10 and 27, got %v", got)
+	}
+
+	decls, err := w.AffectedByDiff(strings.NewReader(diff))
+	if err != nil {
+		t.Fatalf("Error mapping diff: %v", err)
+	}
+	var names []string
+	for _, decl := range decls {
+		names = append(names, decl.Name)
+	}
+	if got := strings.Join(names, ","); got != "add,main" {
+		t.Errorf("Expected add and main to be affected, got %s", got)
+	}
+
+	if _, err := uast.ParseUnifiedDiff(strings.NewReader("+++ b/x.go\n@@ -a +1 @@\n")); err == nil {
+		t.Error("Expected an error for an invalid hunk header")
+	}
+}
+
+// cstParser parses "source" that is already a JSON CST dump
+type cstParser struct{}
+
+func (cstParser) Parse(_ context.Context, source []byte, _ string) (*uast.TreeSitterNode, error) {
+	return uast.DecodeTreeSitterCST(bytes.NewReader(source))
+}
+
+func TestDiffRevisions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	oldSource, err := os.ReadFile("testdata/example.json")
+	if err != nil {
+		t.Fatalf("Error reading CST: %v", err)
+	}
+	// Change the literal in if sum > 10
+	newSource := bytes.Replace(oldSource, []byte(`"text": "10"`), []byte(`"text": "20"`), 1)
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	for _, source := range [][]byte{oldSource, newSource} {
+		if err := os.WriteFile(filepath.Join(repo, "main.go"), source, 0o644); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+		git("add", "main.go")
+		git("commit", "-q", "-m", "update")
+	}
+
+	converter := goConverter(t)
+	opts := uast.DiffOptions{Parser: cstParser{}, Converter: converter, Repo: repo}
+
+	report, err := uast.DiffRevisions(context.Background(), "main.go", "HEAD~1", "HEAD", opts)
+	if err != nil {
+		t.Fatalf("Error diffing revisions: %v", err)
+	}
+	if len(report.Changes) != 1 || report.Changes[0].Kind != uast.SymbolModified || report.Changes[0].Symbol != "main" {
+		t.Errorf("Expected only main to be modified, got %+v", report.Changes)
+	}
+	if got := report.Summary(); got != "main.go: Function main: literal changed in expression" {
+		t.Errorf("Unexpected summary %q", got)
+	}
+
+	// Files missing from both revisions have no declarations
+	report, err = uast.DiffRevisions(context.Background(), "missing.go", "HEAD~1", "HEAD", opts)
+	if err != nil || report.Old != nil || report.New != nil || len(report.Changes) != 0 {
+		t.Errorf("Expected an empty report for a missing file, got %+v (%v)", report, err)
+	}
+	report, err = uast.DiffBlobs(context.Background(), "main.go", oldSource, nil, opts)
+	if err != nil {
+		t.Fatalf("Error diffing blobs: %v", err)
+	}
+	if len(report.Changes) != 2 || report.Changes[0].Kind != uast.SymbolRemoved || report.New != nil {
+		t.Errorf("Expected add and main to be removed, got %+v", report.Changes)
+	}
+}
+
+func TestSummarizeChanges(t *testing.T) {
+	decl := func(nodeType uast.NodeType, name string, children ...*uast.Node) *uast.Node {
+		return &uast.Node{Type: nodeType, Roles: []uast.Role{uast.RoleDeclaration}, Properties: map[string]string{"name": name}, Children: children}
+	}
+	body := func(children ...*uast.Node) *uast.Node {
+		return &uast.Node{Type: uast.Statement, Roles: []uast.Role{uast.RoleBody}, Children: children}
+	}
+	call := func(name string) *uast.Node { return &uast.Node{Type: uast.Call, Token: name} }
+
+	old := uast.NewUAST(&uast.Node{Type: uast.File, Children: []*uast.Node{
+		decl(uast.Class, "Bar", decl(uast.Method, "Baz"), decl(uast.Method, "Keep")),
+		decl(uast.Function, "Foo", body(&uast.Node{Type: uast.Loop, Children: []*uast.Node{body(call("a"))}})),
+		decl(uast.Function, "Old"),
+	}}, "go")
+	updated := uast.NewUAST(&uast.Node{Type: uast.File, Children: []*uast.Node{
+		decl(uast.Class, "Bar", decl(uast.Method, "Keep")),
+		decl(uast.Function, "Foo", body(&uast.Node{Type: uast.Loop, Children: []*uast.Node{body(call("a"), call("b"), call("c"))}})),
+		decl(uast.Function, "New", body(call("x"))),
+	}}, "go")
+
+	report := &uast.DiffReport{Path: "main.go", Old: old, New: updated, Changes: uast.DiffUAST(old, updated)}
+	want := "main.go: Class Bar: method Baz removed; Function Foo: 2 calls added in loop body; Function New added; Function Old removed"
+	if got := report.Summary(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := uast.SummarizeDiffs([]*uast.DiffReport{report, {Path: "same.go"}}); got != want+"\n" {
+		t.Errorf("Expected unchanged files to be left out, got %q", got)
+	}
+}
+
+func TestRepoMap(t *testing.T) {
+	converter := goConverter(t)
+	converter.SetSignatureExtraction(true)
+	w := uast.NewWorkspace()
+	for path, file := range map[string]string{"main.go": "testdata/example.json", "test.go": "testdata/test_cst.json"} {
+		tsNode, err := uast.LoadTreeSitterCST(file)
+		if err != nil {
+			t.Fatalf("Error loading CST: %v", err)
+		}
+		u, err := converter.Convert(tsNode, "go")
+		if err != nil {
+			t.Fatalf("Error converting to UAST: %v", err)
+		}
+		w.Add(path, u)
+	}
+
+	full := w.RepoMap(uast.RepoMapOptions{})
+	if !strings.Contains(full, "  function add(a int, b int) int\n") || !strings.Contains(full, "test.go:\n") {
+		t.Errorf("Expected every file and signature in the map, got:\n%s", full)
+	}
+
+	// A small budget keeps the most referenced declaration
+	short := w.RepoMap(uast.RepoMapOptions{Budget: 12})
+	if !strings.Contains(short, "function add(") || strings.Count(short, "\n") > 2 {
+		t.Errorf("Expected only add to fit, got:\n%s", short)
+	}
+}
+
+func TestFuzzyTokens(t *testing.T) {
+	w := newTestWorkspace(t)
+
+	got := w.FuzzyTokens("Prinln", 0)
+	if len(got) != 2 || got[0].Token != "Println" || got[0].Distance != 1 || got[1].Token != "Printf" {
+		t.Errorf("Expected Println then Printf, got %+v", got)
+	}
+	if got := w.FuzzyTokens("return", 1); len(got) != 1 || got[0].Distance != 0 || got[0].Count != 2 {
+		t.Errorf("Expected an exact match in both files, got %+v", got)
+	}
+
+	u, _ := w.Get("example.go")
+	if got := u.FuzzyTokens("MES", 0); len(got) != 1 || got[0].Token != "message" || !got[0].Substring {
+		t.Errorf("Expected a case-insensitive substring match, got %+v", got)
+	}
+	if got := u.FuzzyTokens("", 0); len(got) != 0 {
+		t.Errorf("Expected no matches for an empty query, got %+v", got)
+	}
+}
+
+func TestFindPage(t *testing.T) {
+	w := newTestWorkspace(t)
+	identifiers := func(u *uast.UAST) *uast.Query { return u.Query().Type(uast.Identifier) }
+	want := w.FindByType(uast.Identifier)
+
+	var all []uast.WorkspaceMatch
+	for match := range w.Matches(identifiers) {
+		all = append(all, match)
+	}
+	if len(all) != len(want) || len(want) < 10 {
+		t.Fatalf("Expected %d identifiers, got %d", len(want), len(all))
+	}
+
+	var paged []uast.WorkspaceMatch
+	cursor, pages := "", 0
+	for {
+		page, next, err := w.FindPage(identifiers, cursor, 7)
+		if err != nil {
+			t.Fatalf("Error finding page: %v", err)
+		}
+		paged = append(paged, page...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if pages != (len(want)+6)/7 || len(paged) != len(want) {
+		t.Fatalf("Expected %d identifiers in pages of 7, got %d in %d pages", len(want), len(paged), pages)
+	}
+	for i := range want {
+		if paged[i] != want[i] {
+			t.Fatalf("Expected match %d to be %v, got %v", i, want[i], paged[i])
+		}
+	}
+
+	if _, _, err := w.FindPage(identifiers, "not a cursor", 7); !errors.Is(err, uast.ErrDecode) {
+		t.Errorf("Expected ErrDecode for a bad cursor, got %v", err)
+	}
+
+	u, _ := w.Get("example.go")
+	if got := u.Query().Type(uast.Identifier).Offset(2).Limit(3).All(); len(got) != 3 || got[0] != u.FindByType(uast.Identifier)[2] {
+		t.Errorf("Expected the third to fifth identifiers, got %v", got)
+	}
+}